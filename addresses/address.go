@@ -1,12 +1,14 @@
 package addresses
 
 import (
+	"artisons/conf"
 	"artisons/db"
 	"artisons/validators"
 	"context"
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"strings"
 
 	"github.com/go-playground/validator/v10"
@@ -18,8 +20,22 @@ type Address struct {
 	City          string `validate:"required"`
 	Street        string `validate:"required"`
 	Complementary string
-	Zipcode       string `validate:"required"`
-	Phone         string `validate:"required"`
+
+	// The ISO 3166-1 alpha-2 country code, like FR,
+	// the zipcode and the phone formats depend on it
+	Country string `validate:"required,country"`
+	Zipcode string `validate:"required,zipcode=Country"`
+	Phone   string `validate:"required,phone=Country"`
+}
+
+// CountryCode returns the address country, or the default
+// country for the addresses saved before it existed.
+func (a Address) CountryCode() string {
+	if a.Country == "" {
+		return conf.DefaultCountry
+	}
+
+	return a.Country
 }
 
 func (a Address) Validate(ctx context.Context) error {
@@ -33,23 +49,78 @@ func (a Address) Validate(ctx context.Context) error {
 	return nil
 }
 
+// IsZero returns true when no field is filled
+func (a Address) IsZero() bool {
+	return a == Address{}
+}
+
+// Fields returns the field / value pairs to store the address
+// in a hash. The prefix allows to store several addresses
+// in the same hash, like billing_firstname.
+func (a Address) Fields(prefix string) []interface{} {
+	return []interface{}{
+		prefix + "firstname", a.Firstname,
+		prefix + "lastname", a.Lastname,
+		prefix + "complementary", a.Complementary,
+		prefix + "city", a.City,
+		prefix + "phone", a.Phone,
+		prefix + "zipcode", a.Zipcode,
+		prefix + "street", a.Street,
+		prefix + "country", a.Country,
+	}
+}
+
+// Parse reads the address from the hash fields
+// starting by the prefix.
+func Parse(m map[string]string, prefix string) Address {
+	return Address{
+		Lastname:      m[prefix+"lastname"],
+		Firstname:     m[prefix+"firstname"],
+		Street:        m[prefix+"street"],
+		Complementary: m[prefix+"complementary"],
+		Zipcode:       m[prefix+"zipcode"],
+		City:          m[prefix+"city"],
+		Phone:         m[prefix+"phone"],
+		Country:       m[prefix+"country"],
+	}
+}
+
+// FromForm reads the address from the form fields
+// starting by the prefix.
+// The country is the default one when it is not sent.
+func FromForm(r *http.Request, prefix string) Address {
+	country := strings.ToUpper(strings.TrimSpace(r.FormValue(prefix + "country")))
+	if country == "" {
+		country = conf.DefaultCountry
+	}
+
+	return Address{
+		Firstname:     r.FormValue(prefix + "firstname"),
+		Lastname:      r.FormValue(prefix + "lastname"),
+		Street:        r.FormValue(prefix + "street"),
+		Complementary: r.FormValue(prefix + "complementary"),
+		City:          r.FormValue(prefix + "city"),
+		Zipcode:       r.FormValue(prefix + "zipcode"),
+		Phone:         r.FormValue(prefix + "phone"),
+		Country:       country,
+	}
+}
+
 func (a Address) Save(ctx context.Context, key string) error {
-	slog.LogAttrs(ctx, slog.LevelInfo, "saving the address")
+	return a.SaveAs(ctx, key, "")
+}
+
+// SaveAs stores the address in the hash key
+// with the fields starting by the prefix.
+func (a Address) SaveAs(ctx context.Context, key, prefix string) error {
+	slog.LogAttrs(ctx, slog.LevelInfo, "saving the address", slog.String("prefix", prefix))
 
 	if key == "" {
 		slog.LogAttrs(ctx, slog.LevelError, "cannot validate the key while it is empty")
 		return errors.New("something went wrong")
 	}
 
-	if _, err := db.Redis.HSet(ctx, key,
-		"firstname", a.Firstname,
-		"lastname", a.Lastname,
-		"complementary", a.Complementary,
-		"city", a.City,
-		"phone", a.Phone,
-		"zipcode", a.Zipcode,
-		"street", a.Street,
-	).Result(); err != nil {
+	if _, err := db.Redis.HSet(ctx, key, a.Fields(prefix)...).Result(); err != nil {
 		slog.LogAttrs(ctx, slog.LevelError, "cannot store the user", slog.String("error", err.Error()))
 		return errors.New("something went wrong")
 	}
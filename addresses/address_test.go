@@ -18,8 +18,9 @@ var address Address = Address{
 	Street:        ra.Address,
 	City:          ra.City,
 	Complementary: ra.Address,
-	Zipcode:       ra.PostalCode,
-	Phone:         faker.Phonenumber(),
+	Country:       "FR",
+	Zipcode:       "59000",
+	Phone:         "0612432122",
 }
 
 func TestSaveAddress(t *testing.T) {
@@ -55,6 +56,10 @@ func TestValidateAddress(t *testing.T) {
 		{"city=", 1, "City", "", errors.New("input:city")},
 		{"zipcode=", 1, "Zipcode", "", errors.New("input:zipcode")},
 		{"phone=", 1, "Phone", "", errors.New("input:phone")},
+		{"country=", 1, "Country", "", errors.New("input:country")},
+		{"country=US", 1, "Country", "US", errors.New("input:country")},
+		{"zipcode=1000", 1, "Zipcode", "1000", errors.New("input:zipcode")},
+		{"phone=6012432122", 1, "Phone", "6012432122", errors.New("input:phone")},
 	}
 
 	for _, tt := range cases {
@@ -72,3 +77,28 @@ func TestValidateAddress(t *testing.T) {
 		})
 	}
 }
+
+func TestSaveAs(t *testing.T) {
+	ctx := tests.Context()
+
+	if err := address.SaveAs(ctx, "user:1", "billing_"); err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	m := map[string]string{}
+	fields := address.Fields("billing_")
+
+	for i := 0; i < len(fields); i += 2 {
+		m[fields[i].(string)] = fields[i+1].(string)
+	}
+
+	if a := Parse(m, "billing_"); a != address {
+		t.Fatalf("a = %v, want %v", a, address)
+	}
+
+	if a := Parse(m, ""); !a.IsZero() {
+		t.Fatalf("a = %v, want zero address", a)
+	}
+}
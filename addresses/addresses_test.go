@@ -1,6 +1,7 @@
 package addresses
 
 import (
+	"artisons/conf"
 	"artisons/tests"
 	"path"
 	"runtime"
@@ -17,13 +18,32 @@ func init() {
 func TestGet(t *testing.T) {
 	ctx := tests.Context()
 
-	res, err := Get(ctx, "8 bd du port", 2)
+	RegisterProvider("FR", Stub{Addresses: []string{
+		"8 Boulevard du Port 80000 Amiens",
+		"8 Boulevard du Port 95000 Cergy",
+		"8 Boulevard du Port 56170 Quiberon",
+		"12 Rue de la Paix 75002 Paris",
+	}})
+	defer RegisterProvider("FR", French{URL: conf.AddressesFrApi})
 
-	if err != nil {
-		t.Fatalf(`err = %v, want not nil`, err.Error())
+	var tests = []struct {
+		name    string
+		country string
+		pattern string
+		count   int
+	}{
+		{"country=FR,pattern=boulevard du port", "FR", "boulevard du port", 2},
+		{"country=FR,pattern=rue de la paix", "FR", "rue de la paix", 1},
+		{"country=FR,pattern=idontexist", "FR", "idontexist", 0},
+		{"country=BE,pattern=boulevard du port", "BE", "boulevard du port", 0},
 	}
 
-	if len(res) != 2 {
-		t.Fatalf(`len(res) =  %d, want 2`, len(res))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Get(ctx, tt.country, tt.pattern, 2)
+			if err != nil || len(res) != tt.count {
+				t.Fatalf(`len(res) = %d, err = %v, want %d, nil`, len(res), err, tt.count)
+			}
+		})
 	}
 }
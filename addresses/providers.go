@@ -0,0 +1,152 @@
+package addresses
+
+import (
+	"artisons/conf"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Provider suggests the addresses matching
+// the pattern typed by the customer.
+type Provider interface {
+	Search(ctx context.Context, pattern string, limit int) ([]string, error)
+}
+
+var providers = map[string]Provider{}
+
+var providersMu sync.RWMutex
+
+func init() {
+	RegisterProvider("FR", French{URL: conf.AddressesFrApi})
+}
+
+// RegisterProvider makes an autocomplete provider available
+// for the country code. If a provider is already registered
+// for the country, it is replaced.
+func RegisterProvider(country string, p Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	providers[country] = p
+}
+
+// Get returns the addresses suggested by the provider
+// registered for the country.
+// A country without provider has no suggestion.
+func Get(ctx context.Context, country, pattern string, limit int) ([]string, error) {
+	l := slog.With(slog.String("country", country), slog.String("pattern", pattern), slog.Int("limit", limit))
+
+	providersMu.RLock()
+	p, ok := providers[country]
+	providersMu.RUnlock()
+
+	if !ok {
+		l.LogAttrs(ctx, slog.LevelInfo, "no address provider for the country")
+		return []string{}, nil
+	}
+
+	return p.Search(ctx, pattern, limit)
+}
+
+// French is the provider using the french
+// government address API.
+type French struct {
+	URL string
+}
+
+type geometry struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+type properties struct {
+	Label       string  `json:"label"`
+	Score       float64 `json:"score"`
+	HouseNumber string  `json:"housenumber"`
+	ID          string  `json:"id"`
+	Type        string  `json:"type"`
+	Name        string  `json:"name"`
+	PostCode    string  `json:"postcode"`
+	CityCode    string  `json:"citycode"`
+	C           float64 `json:"x"`
+	Y           float64 `json:"y"`
+	City        string  `json:"city"`
+	Context     string  `json:"context"`
+	Importance  string  `json:"importance"`
+	Street      string  `json:"street"`
+}
+
+type feature struct {
+	Type        string     `json:"type"`
+	Geometry    geometry   `json:"geometry"`
+	Properties  properties `json:"properties"`
+	Attribution string     `json:"attribution"`
+	Licence     string     `json:"licence"`
+	Query       string     `json:"query"`
+	Limit       int        `json:"limit"`
+}
+
+type response struct {
+	Type     string    `json:"type"`
+	Version  string    `json:"version"`
+	Features []feature `json:"features"`
+}
+
+func (f French) Search(ctx context.Context, pattern string, limit int) ([]string, error) {
+	l := slog.With(slog.String("pattern", pattern), slog.Int("limit", limit))
+	res, err := http.Get(fmt.Sprintf("%s/search/?q=%s&limit=%d", f.URL, url.QueryEscape(pattern), limit))
+
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot search for addresses")
+		return []string{}, errors.New("something went wrong")
+	}
+
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot read the addresses response")
+		return []string{}, errors.New("something went wrong")
+	}
+
+	var r response
+	json.Unmarshal(data, &r)
+
+	addresses := []string{}
+	for _, val := range r.Features {
+		addresses = append(addresses, val.Properties.Label)
+	}
+
+	return addresses, nil
+}
+
+// Stub is an offline provider returning the addresses
+// containing the pattern, used in the tests.
+type Stub struct {
+	Addresses []string
+}
+
+func (s Stub) Search(ctx context.Context, pattern string, limit int) ([]string, error) {
+	addresses := []string{}
+	p := strings.ToLower(pattern)
+
+	for _, a := range s.Addresses {
+		if len(addresses) >= limit {
+			break
+		}
+
+		if strings.Contains(strings.ToLower(a), p) {
+			addresses = append(addresses, a)
+		}
+	}
+
+	return addresses, nil
+}
@@ -7,6 +7,7 @@ import (
 	"artisons/http/cookies"
 	"artisons/http/httperrors"
 	"artisons/http/httphelpers"
+	"artisons/orders"
 	"artisons/templates"
 	"artisons/users"
 	"context"
@@ -163,6 +164,12 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 
 	ctx = context.WithValue(ctx, contexts.User, u)
 
+	// The email is verified by the otp so the guest
+	// orders made with it belong to the user
+	if _, err := orders.Claim(ctx, email, u.ID); err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot claim the guest orders", slog.String("error", err.Error()))
+	}
+
 	cookie := httphelpers.NewCookie(cookies.SessionID, u.SID, int(conf.Cookie.MaxAge))
 	http.SetCookie(w, &cookie)
 
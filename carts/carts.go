@@ -6,8 +6,13 @@ import (
 	"artisons/conf"
 	"artisons/db"
 	"artisons/http/contexts"
+	"artisons/money"
+	"artisons/pickups"
 	"artisons/products"
+	"artisons/promotions"
+	"artisons/shipping"
 	"artisons/shops"
+	"artisons/taxes"
 	"artisons/users"
 	"artisons/validators"
 	"context"
@@ -30,15 +35,48 @@ type Cart struct {
 	// "collect" or "home"
 	Delivery string
 
-	DeliveryFees float64
+	DeliveryFees money.Money
 
-	Total float64
+	// The pickup location id and slot id chosen
+	// for the collect delivery
+	Pickup     string
+	PickupSlot string
+
+	// The total, taxes included
+	Total money.Money
+
+	// The VAT breakdown per rate
+	Taxes taxes.Breakdown
+
+	// The promotion code applied to the cart
+	Promotion string
+
+	// The promotion discount, taxes included
+	// like the product prices
+	Discount money.Money
+
+	// The cart currency, set when the first product is added.
+	// All the product prices are in this currency.
+	Currency string
 
 	Payment string
 
 	Products []products.Product
 
+	// The shipping address, used to quote the deliveries
 	Address addresses.Address
+
+	// The billing address, the shipping address
+	// can be the same
+	Billing addresses.Address
+
+	// The contact email, the user email or
+	// the one typed by a guest with the address
+	Email string
+
+	// True when the cart is restored from the
+	// abandoned cart email
+	Recovered bool
 }
 
 // Exists is not linked as a cart method because
@@ -78,28 +116,119 @@ func NewCartID(ctx context.Context) (int, error) {
 	return cid, nil
 }
 
+// addScript adds the quantity of a product to the cart
+// without exceeding the limit.
+// The product is checked again in the script, so a product
+// archived meanwhile is not added, see products.Purge.
+// KEYS[1] is the cart hash, KEYS[2] the product hash.
+// ARGV[1] is the product id, ARGV[2] the quantity and ARGV[3] the limit.
+// It returns the quantity added, 0 if the limit is already reached
+// or -1 if the product is archived or does not exist anymore.
+var addScript = redis.NewScript(`
+local status = redis.call('HGET', KEYS[2], 'status')
+if not status or status == 'archived' then
+	return -1
+end
+
+local current = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0')
+local qty = math.min(tonumber(ARGV[2]), tonumber(ARGV[3]) - current)
+if qty <= 0 then
+	return 0
+end
+
+redis.call('HINCRBY', KEYS[1], ARGV[1], qty)
+
+return qty
+`)
+
 // Add a product into a cart with its quantity
 // Verify that the cart and the product exists.
-func Add(ctx context.Context, cid int, pid string, quantity int) error {
+// The cart quantity cannot exceed the product stock nor
+// its maximum quantity per order, so the quantity added
+// can be lower than the one requested. It is returned.
+func Add(ctx context.Context, cid int, pid string, quantity int) (int, error) {
 	l := slog.With(slog.String("product_id", pid), slog.Int("quantity", quantity))
 	l.LogAttrs(ctx, slog.LevelInfo, "adding a product to the cart")
 
+	if quantity <= 0 {
+		l.LogAttrs(ctx, slog.LevelInfo, "the quantity is not positive")
+		return 0, errors.New("input:quantity")
+	}
+
+	// A product with variants is sold
+	// only through one of its variants
+	if products.HasVariants(ctx, pid) {
+		l.LogAttrs(ctx, slog.LevelInfo, "the variant is required")
+		return 0, errors.New("input:variant")
+	}
+
 	if !products.Available(ctx, pid) {
-		return errors.New("oops the data is not found")
+		return 0, errors.New("oops the data is not found")
+	}
+
+	currency, err := db.Redis.HGet(ctx, fmt.Sprintf("cart:%d:info", cid), "currency").Result()
+	if err != nil && err != redis.Nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot get the cart currency", slog.String("error", err.Error()))
+		return 0, errors.New("something went wrong")
+	}
+
+	if currency == "" {
+		currency = money.ContextCurrency(ctx)
+	}
+
+	p, err := products.Find(ctx, pid)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, ok := p.InCurrency(currency); !ok {
+		l.LogAttrs(ctx, slog.LevelInfo, "the product has no price in the cart currency", slog.String("currency", currency))
+		return 0, errors.New("the product is not available in this currency")
+	}
+
+	// The stock reserved by a previous payment
+	// attempt is still available for the cart
+	limit := p.Stock() + products.Held(ctx, cid, pid)
+	limited := p.MaxQuantity > 0 && p.MaxQuantity <= limit
+	if limited {
+		limit = p.MaxQuantity
+	}
+
+	added, err := addScript.Run(ctx, db.Redis, []string{fmt.Sprintf("cart:%d", cid), "product:" + pid}, pid, quantity, limit).Int()
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot add the product", slog.String("error", err.Error()))
+		return 0, errors.New("something went wrong")
+	}
+
+	if added == -1 {
+		l.LogAttrs(ctx, slog.LevelInfo, "the product is archived")
+		return 0, errors.New("oops the data is not found")
+	}
+
+	if added == 0 {
+		l.LogAttrs(ctx, slog.LevelInfo, "the quantity limit is reached", slog.Int("limit", limit))
+
+		if limited {
+			return 0, errors.New("the product quantity limit is reached")
+		}
+
+		return 0, errors.New("the product is out of stock")
 	}
 
 	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
-		rdb.HIncrBy(ctx, fmt.Sprintf("cart:%d", cid), pid, int64(quantity))
 		rdb.Expire(ctx, fmt.Sprintf("cart:%d", cid), conf.CartDuration)
+		rdb.HSetNX(ctx, fmt.Sprintf("cart:%d:info", cid), "currency", currency)
+		rdb.Expire(ctx, fmt.Sprintf("cart:%d:info", cid), conf.CartDuration)
+		touch(ctx, rdb, cid)
 		return nil
 	}); err != nil {
 		slog.LogAttrs(ctx, slog.LevelError, "cannot store the cart", slog.String("error", err.Error()))
-		return err
+		return 0, err
 	}
 
-	l.LogAttrs(ctx, slog.LevelInfo, "product added in the cart")
+	l.LogAttrs(ctx, slog.LevelInfo, "product added in the cart", slog.Int("added", added))
 
-	return nil
+	return added, nil
 }
 
 func (c Cart) Validate(ctx context.Context) error {
@@ -119,13 +248,25 @@ func (c Cart) Validate(ctx context.Context) error {
 		return errors.New("the cart is empty")
 	}
 
-	if err := validators.V.Struct(c.Address); err != nil {
-		slog.LogAttrs(ctx, slog.LevelError, "cannot validate the user", slog.String("error", err.Error()))
+	if err := validators.V.Struct(c.Billing); err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot validate the billing address", slog.String("error", err.Error()))
 		field := err.(validator.ValidationErrors)[0]
 		low := strings.ToLower(field.Field())
 		return fmt.Errorf("input:%s", low)
 	}
 
+	if err := validators.V.Struct(c.Address); err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot validate the shipping address", slog.String("error", err.Error()))
+		field := err.(validator.ValidationErrors)[0]
+		low := strings.ToLower(field.Field())
+		return fmt.Errorf("input:shipping_%s", low)
+	}
+
+	if err := validators.V.Var(c.Email, "required,email"); err != nil {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot validate the email", slog.String("error", err.Error()))
+		return errors.New("input:email")
+	}
+
 	pids := []string{}
 	for _, p := range c.Products {
 		pids = append(pids, p.ID)
@@ -136,10 +277,10 @@ func (c Cart) Validate(ctx context.Context) error {
 		return errors.New("some products are not available anymore")
 	}
 
-	var amount float64 = 0
+	amount := money.New(0).WithCurrency(c.currency())
 
 	for _, value := range c.Products {
-		amount += float64(value.Quantity) * value.Price
+		amount = amount.Add(value.DiscountedPrice().Mul(value.Quantity))
 	}
 
 	min, err := shops.MinDelivery(ctx)
@@ -147,14 +288,61 @@ func (c Cart) Validate(ctx context.Context) error {
 		return err
 	}
 
-	if amount < min {
-		l.LogAttrs(ctx, slog.LevelInfo, "the minimum amount is not reached", slog.Float64("amount", amount), slog.Float64("min", shops.Data.Min))
+	min = min.Convert(c.currency())
+
+	if amount.Cmp(min) < 0 {
+		l.LogAttrs(ctx, slog.LevelInfo, "the minimum amount is not reached", slog.Any("amount", amount), slog.Any("min", min))
 		return errors.New("the minimum amount is not reached")
 	}
 
-	return nil
+	for _, value := range c.Products {
+		if value.MaxQuantity > 0 && value.Quantity > value.MaxQuantity {
+			l.LogAttrs(ctx, slog.LevelInfo, "the product quantity limit is exceeded", slog.String("pid", value.ID), slog.Int("max", value.MaxQuantity))
+			return errors.New("the product quantity limit is reached")
+		}
+
+		if value.Price.Currency != c.currency() {
+			l.LogAttrs(ctx, slog.LevelInfo, "the product price is not in the cart currency", slog.String("pid", value.ID), slog.String("currency", value.Price.Currency))
+			return errors.New("the order must contain only one currency")
+		}
+	}
+
+	if _, _, err := c.CheckPickup(ctx); err != nil {
+		return err
+	}
+
+	return c.CheckPromotion(ctx)
 }
 
+// CheckPromotion returns an error if the cart promotion
+// cannot be used anymore by the user.
+func (c Cart) CheckPromotion(ctx context.Context) error {
+	if c.Promotion == "" {
+		return nil
+	}
+
+	p, err := promotions.Find(ctx, c.Promotion)
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelInfo, "cannot find the promotion", slog.String("promotion", c.Promotion))
+		return errors.New("the coupon is not valid")
+	}
+
+	u, _ := ctx.Value(contexts.User).(users.User)
+
+	return p.Check(ctx, u.ID, c.Products)
+}
+
+// currency returns the cart currency,
+// the shop currency if it is not set
+func (c Cart) currency() string {
+	if c.Currency == "" {
+		return conf.Currency
+	}
+
+	return c.Currency
+}
+
+// SaveAddress stores the shipping address.
 func (c Cart) SaveAddress(ctx context.Context, a addresses.Address) error {
 	slog.LogAttrs(ctx, slog.LevelInfo, "saving address")
 
@@ -168,6 +356,45 @@ func (c Cart) SaveAddress(ctx context.Context, a addresses.Address) error {
 	return nil
 }
 
+// SaveBilling stores the billing address,
+// the fields are prefixed by billing_.
+func (c Cart) SaveBilling(ctx context.Context, a addresses.Address) error {
+	slog.LogAttrs(ctx, slog.LevelInfo, "saving billing address")
+
+	err := a.SaveAs(ctx, fmt.Sprintf("cart:%d:info", c.ID), "billing_")
+	if err != nil {
+		return err
+	}
+
+	slog.LogAttrs(ctx, slog.LevelInfo, "billing address saved successfullly")
+
+	return nil
+}
+
+// SaveEmail stores the contact email used for the order.
+func (c Cart) SaveEmail(ctx context.Context, email string) error {
+	l := slog.With(slog.String("email", email))
+	l.LogAttrs(ctx, slog.LevelInfo, "saving the email")
+
+	if err := validators.V.Var(email, "required,email"); err != nil {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot validate the email", slog.String("error", err.Error()))
+		return errors.New("input:email")
+	}
+
+	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+		rdb.HSet(ctx, fmt.Sprintf("cart:%d:info", c.ID), "email", email)
+		touch(ctx, rdb, c.ID)
+		return nil
+	}); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot save the email", slog.String("err", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the email is saved")
+
+	return nil
+}
+
 func Delete(ctx context.Context, cid int, pid string, quantity int) error {
 	l := slog.With(slog.String("product_id", pid), slog.Int("quantity", quantity))
 	l.LogAttrs(ctx, slog.LevelInfo, "deleting a product to the cart")
@@ -200,6 +427,8 @@ func Delete(ctx context.Context, cid int, pid string, quantity int) error {
 		return err
 	}
 
+	touch(ctx, db.Redis, cid)
+
 	l.LogAttrs(ctx, slog.LevelInfo, "product removed from the cart")
 
 	return nil
@@ -234,24 +463,38 @@ func Get(ctx context.Context, cid int) (Cart, error) {
 		return Cart{}, errors.New("something went wrong")
 	}
 
-	var fees float64 = 0
+	fees := money.New(0)
 	if values["delivery_fees"] != "" {
-		fees, err = strconv.ParseFloat(values["delivery_fees"], 64)
+		fees, err = money.ParseMinor(values["delivery_fees"])
 		if err != nil {
 			l.LogAttrs(ctx, slog.LevelError, "cannot parse the delivery fees", slog.String("error", err.Error()))
 			return Cart{}, errors.New("something went wrong")
 		}
 	}
 
-	var total float64 = 0
+	discount := money.New(0)
+	if values["discount"] != "" {
+		discount, err = money.ParseMinor(values["discount"])
+		if err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot parse the discount", slog.String("error", err.Error()))
+			return Cart{}, errors.New("something went wrong")
+		}
+	}
+
+	total := money.New(0)
 	if values["total"] != "" {
-		total, err = strconv.ParseFloat(values["total"], 64)
+		total, err = money.ParseMinor(values["total"])
 		if err != nil {
 			l.LogAttrs(ctx, slog.LevelError, "cannot parse the total", slog.String("error", err.Error()))
 			return Cart{}, errors.New("something went wrong")
 		}
 	}
 
+	currency := values["currency"]
+	if currency == "" {
+		currency = conf.Currency
+	}
+
 	pds := []products.Product{}
 
 	for _, p := range data {
@@ -261,32 +504,50 @@ func Get(ctx context.Context, cid int) (Cart, error) {
 			continue
 		}
 
+		// The product is kept without conversion if the price
+		// is removed from the currency, the validation will fail.
+		if pc, ok := p.InCurrency(currency); ok {
+			p = pc
+		} else {
+			l.LogAttrs(ctx, slog.LevelInfo, "the product has no price in the cart currency", slog.String("pid", p.ID), slog.String("currency", currency))
+		}
+
 		p.Quantity = int(q)
 		pds = append(pds, p)
 	}
 
 	l.LogAttrs(ctx, slog.LevelInfo, "got the cart with products", slog.Int("products", len(pds)))
 
+	// The carts saved before the billing address existed
+	// are billed to the shipping address
+	address := addresses.Parse(values, "")
+	billing := addresses.Parse(values, "billing_")
+	if billing.IsZero() {
+		billing = address
+	}
+
 	return Cart{
 		ID:           cid,
 		Delivery:     values["delivery"],
-		DeliveryFees: fees,
+		DeliveryFees: fees.WithCurrency(currency),
+		Pickup:       values["pickup"],
+		PickupSlot:   values["pickup_slot"],
+		Currency:     currency,
 		Payment:      values["payment"],
-		Address: addresses.Address{
-			Lastname:      values["lastname"],
-			Firstname:     values["firstname"],
-			Street:        values["street"],
-			Complementary: values["complementary"],
-			Zipcode:       values["zipcode"],
-			City:          values["city"],
-			Phone:         values["phone"],
-		},
-		Products: pds,
-		Total:    total,
+		Address:      address,
+		Billing:      billing,
+		Email:        values["email"],
+		Recovered:    values["recovered"] == "1",
+		Products:     pds,
+		Total:        total.WithCurrency(currency),
+		Taxes:        taxes.UnSerialize(ctx, values["taxes"]),
+		Promotion:    values["promotion"],
+		Discount:     discount.WithCurrency(currency),
 	}, nil
 }
 
 // UpdateDelivery update the delivery mode in Redis.
+// The delivery has to be available for the cart address.
 func (c Cart) UpdateDelivery(ctx context.Context, del string) error {
 	l := slog.With(slog.String("delivery", del))
 	l.LogAttrs(ctx, slog.LevelInfo, "updating the delivery")
@@ -295,7 +556,33 @@ func (c Cart) UpdateDelivery(ctx context.Context, del string) error {
 		return errors.New("you are not authorized to process this request")
 	}
 
-	if _, err := db.Redis.HSet(ctx, fmt.Sprintf("cart:%d:info", c.ID), "delivery", del).Result(); err != nil {
+	quotes, err := c.Quotes(ctx)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, q := range quotes {
+		if q.Delivery == del {
+			found = true
+		}
+	}
+
+	if !found {
+		l.LogAttrs(ctx, slog.LevelInfo, "the delivery is not available for the cart address")
+		return errors.New("the delivery is not available for this address")
+	}
+
+	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+		rdb.HSet(ctx, fmt.Sprintf("cart:%d:info", c.ID), "delivery", del)
+
+		// The pickup is only for the collect delivery
+		if del != shipping.Collect {
+			rdb.HDel(ctx, fmt.Sprintf("cart:%d:info", c.ID), "pickup", "pickup_slot")
+		}
+
+		return nil
+	}); err != nil {
 		l.LogAttrs(ctx, slog.LevelError, "cannot update the delivery", slog.String("err", err.Error()))
 		return errors.New("something went wrong")
 	}
@@ -305,6 +592,79 @@ func (c Cart) UpdateDelivery(ctx context.Context, del string) error {
 	return nil
 }
 
+// UpdatePickup stores the pickup location and slot
+// chosen for the collect delivery.
+// The slot is required if the location has slots,
+// see pickups.Location.Check.
+func (c Cart) UpdatePickup(ctx context.Context, id, slot string) error {
+	l := slog.With(slog.String("pickup", id), slog.String("slot", slot))
+	l.LogAttrs(ctx, slog.LevelInfo, "updating the pickup")
+
+	if id == "" {
+		l.LogAttrs(ctx, slog.LevelInfo, "the pickup is required")
+		return errors.New("input:pickup")
+	}
+
+	loc, err := pickups.Find(ctx, id)
+	if err != nil {
+		return errors.New("the pickup location is not available")
+	}
+
+	s, err := loc.Check(ctx, slot)
+	if err != nil {
+		return err
+	}
+
+	slot = ""
+	if !s.Start.IsZero() {
+		slot = s.ID()
+	}
+
+	if _, err := db.Redis.HSet(ctx, fmt.Sprintf("cart:%d:info", c.ID), "pickup", loc.ID, "pickup_slot", slot).Result(); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot update the pickup", slog.String("err", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the pickup is updated")
+
+	return nil
+}
+
+// CheckPickup returns the pickup location and slot of the cart.
+// The pickup is required for the collect delivery
+// when active locations exist.
+func (c Cart) CheckPickup(ctx context.Context) (pickups.Location, pickups.Slot, error) {
+	if c.Delivery != shipping.Collect {
+		return pickups.Location{}, pickups.Slot{}, nil
+	}
+
+	if c.Pickup == "" {
+		locs, err := pickups.Actives(ctx)
+		if err != nil {
+			return pickups.Location{}, pickups.Slot{}, err
+		}
+
+		if len(locs) > 0 {
+			slog.LogAttrs(ctx, slog.LevelInfo, "the pickup is required")
+			return pickups.Location{}, pickups.Slot{}, errors.New("input:pickup")
+		}
+
+		return pickups.Location{}, pickups.Slot{}, nil
+	}
+
+	loc, err := pickups.Find(ctx, c.Pickup)
+	if err != nil {
+		return pickups.Location{}, pickups.Slot{}, errors.New("the pickup location is not available")
+	}
+
+	s, err := loc.Check(ctx, c.PickupSlot)
+	if err != nil {
+		return pickups.Location{}, pickups.Slot{}, err
+	}
+
+	return loc, s, nil
+}
+
 // UpdatePayment update the payment mode in Redis.
 func (c Cart) UpdatePayment(ctx context.Context, p string) error {
 	l := slog.With(slog.String("payment", p))
@@ -324,6 +684,77 @@ func (c Cart) UpdatePayment(ctx context.Context, p string) error {
 	return nil
 }
 
+// UpdateCurrency changes the cart currency in Redis.
+// All the cart products must have a price in the currency,
+// so the order contains only one currency.
+func (c Cart) UpdateCurrency(ctx context.Context, currency string) error {
+	l := slog.With(slog.String("currency", currency))
+	l.LogAttrs(ctx, slog.LevelInfo, "updating the currency")
+
+	if !money.Supported(currency) {
+		l.LogAttrs(ctx, slog.LevelInfo, "the currency is not supported")
+		return errors.New("input:currency")
+	}
+
+	for _, p := range c.Products {
+		if _, ok := p.InCurrency(currency); !ok {
+			l.LogAttrs(ctx, slog.LevelInfo, "the product has no price in the currency", slog.String("pid", p.ID))
+			return errors.New("the product is not available in this currency")
+		}
+	}
+
+	if _, err := db.Redis.HSet(ctx, fmt.Sprintf("cart:%d:info", c.ID), "currency", currency).Result(); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot update the currency", slog.String("err", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the currency is updated")
+
+	return nil
+}
+
+// UpdatePromotion applies the coupon code to the cart.
+// An empty code removes the promotion.
+// The discount is computed with the cart total,
+// see CalculateTotal.
+func (c Cart) UpdatePromotion(ctx context.Context, code string) error {
+	l := slog.With(slog.String("code", code))
+	l.LogAttrs(ctx, slog.LevelInfo, "updating the promotion")
+
+	key := fmt.Sprintf("cart:%d:info", c.ID)
+
+	if code == "" {
+		if _, err := db.Redis.HDel(ctx, key, "promotion", "discount").Result(); err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot remove the promotion", slog.String("err", err.Error()))
+			return errors.New("something went wrong")
+		}
+
+		l.LogAttrs(ctx, slog.LevelInfo, "the promotion is removed")
+
+		return nil
+	}
+
+	p, err := promotions.Find(ctx, promotions.Code(code))
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot find the promotion")
+		return errors.New("the coupon is not valid")
+	}
+
+	u, _ := ctx.Value(contexts.User).(users.User)
+	if err := p.Check(ctx, u.ID, c.Products); err != nil {
+		return err
+	}
+
+	if _, err := db.Redis.HSet(ctx, key, "promotion", p.Code).Result(); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot update the promotion", slog.String("err", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the promotion is updated")
+
+	return nil
+}
+
 // RefreshCID refreshes a cart ID (CID).
 // If the CID does not exist, it will be created,
 // with an expiration time.
@@ -367,6 +798,12 @@ func Merge(ctx context.Context, cid int) error {
 		return errors.New("something went wrong")
 	}
 
+	currency, err := db.Redis.HGet(ctx, fmt.Sprintf("cart:%d:info", cid), "currency").Result()
+	if err != nil && err != redis.Nil {
+		slog.LogAttrs(ctx, slog.LevelInfo, "cannot get the anonymous cart currency")
+		return errors.New("something went wrong")
+	}
+
 	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
 		for key, val := range acart {
 			a, err := strconv.ParseInt(val, 10, 64)
@@ -388,7 +825,14 @@ func Merge(ctx context.Context, cid int) error {
 			}
 		}
 
+		// The user cart keeps its currency if it has one
+		if currency != "" {
+			rdb.HSetNX(ctx, fmt.Sprintf("cart:%d:info", u.ID), "currency", currency)
+		}
+
 		rdb.Del(ctx, fmt.Sprintf("cart:%d", cid), fmt.Sprintf("cart:%d:info", cid))
+		rdb.ZRem(ctx, activityKey, cid)
+		touch(ctx, rdb, u.ID)
 		return nil
 	}); err != nil {
 		slog.LogAttrs(ctx, slog.LevelError, "cannot merge the cart into redis", slog.String("error", err.Error()))
@@ -400,35 +844,146 @@ func Merge(ctx context.Context, cid int) error {
 	return nil
 }
 
-func (c Cart) CalculateTotal(ctx context.Context) (float64, error) {
-	var total float64 = 0
+// subtotal returns the products total with the promotion discounts,
+// the discounts by product and true if the promotion offers
+// the shipping.
+func (c Cart) subtotal(ctx context.Context) (money.Money, map[string]money.Money, bool, error) {
+	discounts := map[string]money.Money{}
+	freeShipping := false
 
+	if c.Promotion != "" {
+		p, err := promotions.Find(ctx, c.Promotion)
+		if err != nil {
+			return money.Money{}, discounts, false, err
+		}
+
+		discounts, freeShipping = p.Apply(c.Products, c.currency())
+	}
+
+	total := money.New(0).WithCurrency(c.currency())
 	for _, value := range c.Products {
-		total += float64(value.Quantity) * value.Price
+		total = total.Add(value.DiscountedPrice().Mul(value.Quantity).Sub(discounts[value.ID]))
 	}
 
-	var fees float64 = 0
+	return total, discounts, freeShipping, nil
+}
+
+// Weight returns the total weight of the cart products
+func (c Cart) Weight() float64 {
+	var weight float64
+	for _, value := range c.Products {
+		weight += value.Weight * float64(value.Quantity)
+	}
+
+	return weight
+}
+
+// Quotes returns the deliveries available for the cart address
+// and weight, with their fees in the cart currency.
+func (c Cart) Quotes(ctx context.Context) ([]shipping.Quote, error) {
+	total, _, freeShipping, err := c.subtotal(ctx)
+	if err != nil {
+		return []shipping.Quote{}, err
+	}
+
+	return c.quotes(ctx, total, freeShipping)
+}
+
+// quotes converts the shipping quotes in the cart currency.
+// The fees are free when the total reaches the shop free fees
+// or when the promotion offers the shipping.
+func (c Cart) quotes(ctx context.Context, total money.Money, freeShipping bool) ([]shipping.Quote, error) {
+	quotes, err := shipping.Quotes(ctx, c.Address.CountryCode(), c.Address.Zipcode, c.Weight())
+	if err != nil {
+		return []shipping.Quote{}, err
+	}
 
 	free, err := shops.DeliveryFreeFees(ctx)
 	if err != nil {
-		return 0, err
+		return []shipping.Quote{}, err
+	}
+
+	free = free.Convert(c.currency())
+
+	for i, q := range quotes {
+		if freeShipping || total.Cmp(free) >= 0 {
+			quotes[i].Price = money.New(0).WithCurrency(c.currency())
+		} else {
+			quotes[i].Price = q.Price.Convert(c.currency())
+		}
+	}
+
+	return quotes, nil
+}
+
+// CalculateTotal returns the cart total, taxes included.
+// The product prices are taxes included or not depending
+// on the shop settings, the delivery fees follow the same rule
+// and use the standard tax class. The delivery fees depend on
+// the shipping method, the address zone and the cart weight.
+// The promotion discount is removed from the product lines
+// before the VAT computation, and the free shipping promotion
+// removes the delivery fees. The promotion is expected to be
+// checked before, see Validate.
+// The total, the delivery fees, the discount and the VAT breakdown
+// are stored in the cart info.
+func (c Cart) CalculateTotal(ctx context.Context) (money.Money, error) {
+	total, discounts, freeShipping, err := c.subtotal(ctx)
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	discount := money.New(0).WithCurrency(c.currency())
+
+	classes := []string{taxes.Standard}
+	for _, value := range c.Products {
+		discount = discount.Add(discounts[value.ID])
+		classes = append(classes, value.TaxClass)
 	}
 
-	if c.Delivery != "collect" && total < free {
-		del, err := shops.DeliveryFees(ctx)
+	fees := money.New(0).WithCurrency(c.currency())
+
+	if c.Delivery != shipping.Collect {
+		quotes, err := c.quotes(ctx, total, freeShipping)
 		if err != nil {
-			return 0, err
+			return money.Money{}, err
+		}
+
+		found := false
+		for _, q := range quotes {
+			if q.Delivery == c.Delivery {
+				fees = q.Price
+				found = true
+			}
 		}
 
-		fees = del
+		if !found {
+			slog.LogAttrs(ctx, slog.LevelInfo, "the delivery is not available for the cart", slog.String("delivery", c.Delivery))
+			return money.Money{}, errors.New("the delivery is not available for this address")
+		}
 	}
 
-	total += fees
+	rates, err := taxes.Rates(ctx, classes, c.Address.CountryCode())
+	if err != nil {
+		return money.Money{}, err
+	}
 
-	_, err = db.Redis.HSet(ctx, fmt.Sprintf("cart:%d:info", c.ID), "total", total, "delivery_fees", fees).Result()
+	items := []taxes.Item{}
+	for _, value := range c.Products {
+		items = append(items, taxes.Item{Rate: rates[value.TaxClass], Amount: value.DiscountedPrice().Mul(value.Quantity).Sub(discounts[value.ID])})
+	}
+
+	if fees.Amount > 0 {
+		items = append(items, taxes.Item{Rate: rates[taxes.Standard], Amount: fees})
+	}
+
+	b := taxes.Compute(items, !shops.Data.TaxExclusive)
+	total = b.Gross
+
+	_, err = db.Redis.HSet(ctx, fmt.Sprintf("cart:%d:info", c.ID), "total", total.Minor(), "delivery_fees", fees.Minor(), "discount", discount.Minor(), "taxes", b.Serialize(ctx)).Result()
 	if err != nil {
 		slog.LogAttrs(ctx, slog.LevelInfo, "cannot set the cart total")
-		return 0, errors.New("something went wrong")
+		return money.Money{}, errors.New("something went wrong")
 	}
 
 	return total, nil
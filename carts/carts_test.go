@@ -4,7 +4,9 @@ import (
 	"artisons/addresses"
 	"artisons/db"
 	"artisons/http/contexts"
+	"artisons/money"
 	"artisons/products"
+	"artisons/shops"
 	"artisons/tests"
 	"artisons/users"
 	"context"
@@ -28,8 +30,9 @@ var address addresses.Address = addresses.Address{
 	Street:        ra.Address,
 	City:          ra.City,
 	Complementary: ra.Address,
-	Zipcode:       ra.PostalCode,
-	Phone:         faker.Phonenumber(),
+	Country:       "FR",
+	Zipcode:       "59000",
+	Phone:         "0612432122",
 }
 
 func init() {
@@ -41,22 +44,43 @@ func TestAdd(t *testing.T) {
 	ctx := tests.Context()
 
 	tests.ImportData(ctx, cur+"testdata/cart.redis")
+	tests.ImportData(ctx, cur+"testdata/limits.redis")
 
-	t.Run("Product not found", func(t *testing.T) {
-		qty := 1
-
-		if err := Add(ctx, 0, "idontexist", qty); err == nil || err.Error() != "oops the data is not found" {
-			t.Fatalf(`err = %v, want "", nil, oops the data is not found`, err)
-		}
-	})
+	var tests = []struct {
+		name     string
+		cid      int
+		pid      string
+		quantity int
+		added    int
+		err      error
+	}{
+		{"quantity=0", 789, "PDT7", 0, 0, errors.New("input:quantity")},
+		{"quantity=-1", 789, "PDT7", -1, 0, errors.New("input:quantity")},
+		{"pid=idontexist", 789, "idontexist", 1, 0, errors.New("oops the data is not found")},
+		{"pid=PDT1", 0, "PDT1", 1, 1, nil},
+		{"pid=PDT7&quantity=2", 789, "PDT7", 2, 2, nil},
+		{"pid=PDT7&quantity=2&max", 789, "PDT7", 2, 1, nil},
+		{"pid=PDT7&quantity=1&max", 789, "PDT7", 1, 0, errors.New("the product quantity limit is reached")},
+		{"pid=PDT8&quantity=5", 789, "PDT8", 5, 2, nil},
+		{"pid=PDT8&quantity=1&stock", 789, "PDT8", 1, 0, errors.New("the product is out of stock")},
+		{"pid=PDT9", 789, "PDT9", 1, 0, errors.New("input:variant")},
+		{"pid=PDT9S", 789, "PDT9S", 1, 1, nil},
+		{"pid=PDT10&archived", 789, "PDT10", 1, 0, errors.New("oops the data is not found")},
+	}
 
-	t.Run("Success", func(t *testing.T) {
-		qty := 1
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, err := Add(ctx, tt.cid, tt.pid, tt.quantity)
+			if added != tt.added || fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`Add(ctx, %d, %s, %d) = %d, %v, want %d, %v`, tt.cid, tt.pid, tt.quantity, added, err, tt.added, tt.err)
+			}
+		})
+	}
 
-		if err := Add(ctx, 0, "PDT1", qty); err != nil {
-			t.Fatalf(`err = %v, want not empty, nil`, err)
-		}
-	})
+	qty, _ := db.Redis.HGet(ctx, "cart:789", "PDT7").Result()
+	if qty != "3" {
+		t.Fatalf(`qty = %s, want '3'`, qty)
+	}
 }
 
 func TestGet(t *testing.T) {
@@ -141,6 +165,45 @@ func TestSaveAddress(t *testing.T) {
 	}
 }
 
+func TestSaveBilling(t *testing.T) {
+	ctx := tests.Context()
+	c := Cart{ID: 123}
+
+	tests.ImportData(ctx, cur+"testdata/cart.redis")
+
+	if err := c.SaveBilling(ctx, address); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	cart, err := Get(ctx, 123)
+	if err != nil || cart.Billing != address {
+		t.Fatalf(`billing = %v, err = %v, want %v, nil`, cart.Billing, err, address)
+	}
+}
+
+func TestSaveEmail(t *testing.T) {
+	ctx := tests.Context()
+	c := Cart{ID: 123}
+
+	var tests = []struct {
+		name  string
+		email string
+		err   error
+	}{
+		{"email=", "", errors.New("input:email")},
+		{"email=iamnotanemail", "iamnotanemail", errors.New("input:email")},
+		{"email=guest@artisons.me", "guest@artisons.me", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := c.SaveEmail(ctx, tt.email); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+		})
+	}
+}
+
 func TestUpdateDelivery(t *testing.T) {
 	ctx := tests.Context()
 	c := Cart{ID: 123}
@@ -179,6 +242,96 @@ func TestUpdatePayment(t *testing.T) {
 	})
 }
 
+func TestUpdateCurrency(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/cart.redis")
+
+	c, err := Get(ctx, 123)
+	if err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	var tests = []struct {
+		name     string
+		currency string
+		err      error
+	}{
+		{"currency=CHF", "CHF", nil},
+		{"currency=GBP", "GBP", errors.New("the product is not available in this currency")},
+		{"currency=USD", "USD", errors.New("input:currency")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := c.UpdateCurrency(ctx, tt.currency); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestUpdatePromotion(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/cart.redis")
+
+	c, err := Get(ctx, 123)
+	if err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	var tests = []struct {
+		name string
+		code string
+		err  error
+	}{
+		{"code=", "", nil},
+		{"code=promo10", "promo10", nil},
+		{"code=IDONTEXIST", "IDONTEXIST", errors.New("the coupon is not valid")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := c.UpdatePromotion(ctx, tt.code); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestUpdatePickup(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/cart.redis")
+
+	c, err := Get(ctx, 123)
+	if err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	var tests = []struct {
+		name string
+		id   string
+		slot string
+		err  error
+	}{
+		{"id=", "", "", errors.New("input:pickup")},
+		{"id=IDONTEXIST", "IDONTEXIST", "", errors.New("the pickup location is not available")},
+		{"id=STUDIO,slot=", "STUDIO", "", errors.New("input:slot")},
+		{"id=STUDIO,slot=full", "STUDIO", "209906011000", errors.New("the pickup slot is full")},
+		{"id=STUDIO,slot=209906021000", "STUDIO", "209906021000", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := c.UpdatePickup(ctx, tt.id, tt.slot); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+		})
+	}
+}
+
 func TestExists(t *testing.T) {
 	ctx := tests.Context()
 
@@ -247,16 +400,19 @@ func TestValidate(t *testing.T) {
 		Street:        ra.Address,
 		City:          ra.City,
 		Complementary: ra.Address,
-		Zipcode:       ra.PostalCode,
-		Phone:         faker.Phonenumber(),
+		Country:       "FR",
+		Zipcode:       "59000",
+		Phone:         "0612432122",
 	}
 
 	cart := Cart{
 		Delivery: "colissimo",
-		Total:    100,
+		Total:    money.New(10000),
 		Payment:  "cash",
 		Products: []products.Product{{ID: "PDT1"}},
 		Address:  address,
+		Billing:  address,
+		Email:    "arnaud@artisons.me",
 	}
 
 	var tests = []struct {
@@ -265,12 +421,16 @@ func TestValidate(t *testing.T) {
 		value interface{}
 		err   error
 	}{
+		{"billing=", "Billing", addresses.Address{}, errors.New("input:lastname")},
+		{"address=", "Address", addresses.Address{}, errors.New("input:shipping_lastname")},
+		{"email=", "Email", "", errors.New("input:email")},
+		{"email=iamnotanemail", "Email", "iamnotanemail", errors.New("input:email")},
 		{"delivery=idontexist", "Delivery", "idontexist", errors.New("you are not authorized to process this request")},
 		{"payment=idontexist", "Payment", "idontexist", errors.New("you are not authorized to process this request")},
 		{"products=", "Products", []products.Product{}, errors.New("the cart is empty")},
 		{"products={notavailable}", "Products", []products.Product{{ID: "notavailable"}}, errors.New("some products are not available anymore")},
 		{"products={PDT1}", "Products", []products.Product{{ID: "PDT1"}}, errors.New("the minimum amount is not reached")},
-		{"success", "Products", []products.Product{{ID: "PDT1", Quantity: 10, Price: 100}}, nil},
+		{"success", "Products", []products.Product{{ID: "PDT1", Quantity: 10, Price: money.New(10000)}}, nil},
 	}
 
 	for _, tt := range tests {
@@ -279,6 +439,8 @@ func TestValidate(t *testing.T) {
 
 			if tt.field == "Products" {
 				c.Products = tt.value.([]products.Product)
+			} else if tt.field == "Billing" || tt.field == "Address" {
+				reflect.ValueOf(&c).Elem().FieldByName(tt.field).Set(reflect.ValueOf(tt.value))
 			} else if tt.field != "" {
 				reflect.ValueOf(&c).Elem().FieldByName(tt.field).SetString(tt.value.(string))
 			}
@@ -296,31 +458,72 @@ func TestCalculateTotal(t *testing.T) {
 	tests.ImportData(ctx, cur+"testdata/cart.redis")
 
 	var tests = []struct {
-		name  string
-		cart  Cart
-		total float64
+		name      string
+		cart      Cart
+		exclusive bool
+		total     int64
 	}{
 		{"total=60,delivery=collect", Cart{
 			Delivery: "collect",
-			Products: []products.Product{{Quantity: 1, Price: 11}, {Quantity: 2, Price: 24.5}},
-		}, 60},
+			Products: []products.Product{{Quantity: 1, Price: money.New(1100)}, {Quantity: 2, Price: money.New(2450)}},
+		}, false, 6000},
 		{"total=16.99,delivery=colissimo", Cart{
 			Delivery: "colissimo",
-			Products: []products.Product{{Quantity: 1, Price: 11}},
-		}, 16.99},
+			Products: []products.Product{{Quantity: 1, Price: money.New(1100)}},
+		}, false, 1699},
 		{"total=30,delivery=colissimo", Cart{
 			Delivery: "colissimo",
-			Products: []products.Product{{Quantity: 1, Price: 30}},
-		}, 30},
+			Products: []products.Product{{Quantity: 1, Price: money.New(3000)}},
+		}, false, 3000},
+		{"total=120,delivery=collect,exclusive", Cart{
+			Delivery: "collect",
+			Products: []products.Product{{Quantity: 1, Price: money.New(10000)}},
+		}, true, 12000},
+		{"total=10.55,delivery=collect,class=reduced,exclusive", Cart{
+			Delivery: "collect",
+			Products: []products.Product{{Quantity: 1, Price: money.New(1000), TaxClass: "reduced"}},
+		}, true, 1055},
+		{"total=10,delivery=collect,discount=50", Cart{
+			Delivery: "collect",
+			Products: []products.Product{{Quantity: 1, Price: money.New(2000), Discount: 50}},
+		}, false, 1000},
+		{"total=14.90,delivery=relay,weight=500", Cart{
+			Delivery: "relay",
+			Address:  addresses.Address{Zipcode: "59000"},
+			Products: []products.Product{{Quantity: 1, Price: money.New(1000), Weight: 500}},
+		}, false, 1490},
+		{"total=19.90,delivery=relay,weight=2000", Cart{
+			Delivery: "relay",
+			Address:  addresses.Address{Zipcode: "59000"},
+			Products: []products.Product{{Quantity: 2, Price: money.New(500), Weight: 1000}},
+		}, false, 1990},
+		{"total=54,delivery=collect,promotion=PROMO10", Cart{
+			Delivery:  "collect",
+			Promotion: "PROMO10",
+			Products:  []products.Product{{ID: "PDT1", Quantity: 1, Price: money.New(1100)}, {ID: "PDT2", Quantity: 2, Price: money.New(2450)}},
+		}, false, 5400},
+		{"total=11,delivery=colissimo,promotion=FREESHIP", Cart{
+			Delivery:  "colissimo",
+			Promotion: "FREESHIP",
+			Products:  []products.Product{{ID: "PDT1", Quantity: 1, Price: money.New(1100)}},
+		}, false, 1100},
+		{"total=25,delivery=collect,promotion=FIVE", Cart{
+			Delivery:  "collect",
+			Promotion: "FIVE",
+			Products:  []products.Product{{ID: "PDT1", Quantity: 1, Price: money.New(3000)}},
+		}, false, 2500},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			shops.Data.TaxExclusive = tt.exclusive
+			defer func() { shops.Data.TaxExclusive = false }()
+
 			c := tt.cart
 			total, err := c.CalculateTotal(ctx)
 
-			if fmt.Sprintf("%2.f", tt.total) != fmt.Sprintf("%2.f", total) || err != nil {
-				t.Fatalf(`err = %v, total = %f, want %f`, err, total, tt.total)
+			if total.Amount != tt.total || err != nil {
+				t.Fatalf(`err = %v, total = %d, want %d`, err, total.Amount, tt.total)
 			}
 		})
 	}
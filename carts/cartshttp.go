@@ -7,7 +7,11 @@ import (
 	"artisons/http/cookies"
 	"artisons/http/httperrors"
 	"artisons/http/httphelpers"
+	"artisons/money"
 	"artisons/orders"
+	"artisons/pickups"
+	"artisons/products"
+	"artisons/shipping"
 	"artisons/shops"
 	"artisons/stats"
 	"artisons/tags/tree"
@@ -15,12 +19,13 @@ import (
 	"artisons/users"
 	"fmt"
 	"html/template"
-	"log"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"golang.org/x/text/language"
+	"golang.org/x/text/message"
 )
 
 func getID(r *http.Request, w http.ResponseWriter) int {
@@ -43,6 +48,12 @@ func getID(r *http.Request, w http.ResponseWriter) int {
 }
 
 func Handler(w http.ResponseWriter, r *http.Request) {
+	render(w, r, "")
+}
+
+// render displays the cart with an optional message,
+// like the quantity actually added.
+func render(w http.ResponseWriter, r *http.Request, msg string) {
 	ctx := r.Context()
 	lang := ctx.Value(contexts.Locale).(language.Tag)
 
@@ -58,18 +69,38 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// The links of a variant are the ones of its product
+	pids := []string{}
+	for _, p := range c.Products {
+		if p.Group != "" {
+			pids = append(pids, p.Group)
+		} else {
+			pids = append(pids, p.ID)
+		}
+	}
+
+	suggestions, err := products.Suggestions(ctx, pids)
+	if err != nil {
+		httperrors.Page(w, r.Context(), err.Error(), 500)
+		return
+	}
+
 	data := struct {
-		Lang  language.Tag
-		Shop  shops.Settings
-		Tags  []tree.Leaf
-		Cart  Cart
-		Empty bool
+		Lang        language.Tag
+		Shop        shops.Settings
+		Tags        []tree.Leaf
+		Cart        Cart
+		Empty       bool
+		Message     string
+		Suggestions []products.Product
 	}{
 		lang,
 		shops.Data,
 		tree.Tree,
 		c,
 		len(c.Products) == 0,
+		msg,
+		suggestions,
 	}
 
 	var t *template.Template
@@ -105,12 +136,24 @@ func AddHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	qty, err := strconv.ParseInt(r.FormValue("quantity"), 10, 64)
-	if err != nil {
-		slog.LogAttrs(ctx, slog.LevelError, "cannot parse the quantity", slog.String("error", err.Error()))
+	if err != nil || qty <= 0 {
+		slog.LogAttrs(ctx, slog.LevelInfo, "cannot use the quantity", slog.String("quantity", r.FormValue("quantity")))
 		httperrors.HXCatch(w, ctx, "input:quantity")
 		return
 	}
 
+	// The variant is added instead of its product
+	if vid := r.FormValue("variant"); vid != "" {
+		v, err := products.Find(ctx, vid)
+		if err != nil || v.Group != pid {
+			slog.LogAttrs(ctx, slog.LevelInfo, "cannot use the variant", slog.String("pid", pid), slog.String("vid", vid))
+			httperrors.HXCatch(w, ctx, "input:variant")
+			return
+		}
+
+		pid = vid
+	}
+
 	cid := getID(r, w)
 	if cid == 0 {
 		cid, err = NewCartID(ctx)
@@ -120,7 +163,7 @@ func AddHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	err = Add(ctx, cid, pid, int(qty))
+	added, err := Add(ctx, cid, pid, int(qty))
 	if err != nil {
 		httperrors.HXCatch(w, ctx, err.Error())
 		return
@@ -130,8 +173,21 @@ func AddHandler(w http.ResponseWriter, r *http.Request) {
 	http.SetCookie(w, &c)
 	r.AddCookie(&c)
 
+	// The customer is told about the quantity
+	// actually added because of the limits
+	msg := ""
+	if added < int(qty) {
+		lang := ctx.Value(contexts.Locale).(language.Tag)
+		msg = message.NewPrinter(lang).Sprintf("only %d items were added to the cart", added)
+	}
+
 	if r.Header.Get("HX-Current-Url") == "/cart" {
-		Handler(w, r)
+		render(w, r, msg)
+		return
+	}
+
+	if msg != "" {
+		httperrors.Alert(w, ctx, msg)
 		return
 	}
 
@@ -200,7 +256,20 @@ func DeliveryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	del, err := shops.Deliveries(ctx)
+	// The fees depend on the address zone
+	if c.Address.Zipcode == "" {
+		slog.LogAttrs(ctx, slog.LevelInfo, "the cart address is empty")
+		http.Redirect(w, r, "/cart/address", http.StatusFound)
+		return
+	}
+
+	quotes, err := c.Quotes(ctx)
+	if err != nil {
+		httperrors.Catch(w, ctx, err.Error(), 500)
+		return
+	}
+
+	locs, err := pickups.Actives(ctx)
 	if err != nil {
 		httperrors.Catch(w, ctx, err.Error(), 500)
 		return
@@ -211,12 +280,20 @@ func DeliveryHandler(w http.ResponseWriter, r *http.Request) {
 		Lang       language.Tag
 		Shop       shops.Settings
 		Tags       []tree.Leaf
-		Deliveries []string
+		Deliveries []shipping.Quote
+		Delivery   string
+		Pickups    []pickups.Location
+		Pickup     string
+		PickupSlot string
 	}{
 		lang,
 		shops.Data,
 		tree.Tree,
-		del,
+		quotes,
+		c.Delivery,
+		locs,
+		c.Pickup,
+		c.PickupSlot,
 	}
 
 	w.Header().Set("Content-Type", "text/html")
@@ -266,18 +343,122 @@ func DeliverySetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The pickup is chosen only when there are locations,
+	// the slot field is per location.
+	if del == shipping.Collect {
+		locs, err := pickups.Actives(ctx)
+		if err != nil {
+			httperrors.HXCatch(w, ctx, err.Error())
+			return
+		}
+
+		if len(locs) > 0 {
+			pickup := r.FormValue("pickup")
+			if err := c.UpdatePickup(ctx, pickup, r.FormValue("slot_"+pickup)); err != nil {
+				httperrors.HXCatch(w, ctx, err.Error())
+				return
+			}
+		}
+	}
+
 	coo := httphelpers.NewCookie(cookies.CartID, fmt.Sprintf("%d", cid), int(conf.Cookie.MaxAge))
 	http.SetCookie(w, &coo)
 	r.AddCookie(&coo)
 
-	w.Header().Set("HX-Redirect", "/cart/address")
+	w.Header().Set("HX-Redirect", "/payment")
 	w.Write([]byte(""))
 }
 
-func AddressFormHandler(w http.ResponseWriter, r *http.Request) {
+// CurrencyHandler stores the currency chosen by the customer.
+// The cart currency is changed too, so the order
+// contains only one currency.
+func CurrencyHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+
+	if err := r.ParseForm(); err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot parse the form", slog.String("error", err.Error()))
+		httperrors.HXCatch(w, ctx, "something went wrong")
+		return
+	}
+
+	currency := r.FormValue("currency")
+	if !money.Supported(currency) {
+		slog.LogAttrs(ctx, slog.LevelInfo, "the currency is not supported", slog.String("currency", currency))
+		httperrors.HXCatch(w, ctx, "input:currency")
+		return
+	}
+
+	cid := getID(r, w)
+	if Exists(ctx, cid) {
+		c, err := Get(ctx, cid)
+		if err != nil {
+			httperrors.HXCatch(w, ctx, err.Error())
+			return
+		}
+
+		if err := c.UpdateCurrency(ctx, currency); err != nil {
+			httperrors.HXCatch(w, ctx, err.Error())
+			return
+		}
+	}
+
+	coo := httphelpers.NewCookie(cookies.Currency, currency, int(conf.Cookie.MaxAge))
+	http.SetCookie(w, &coo)
+
+	w.Header().Set("HX-Refresh", "true")
+	w.Write([]byte(""))
+}
+
+// PromotionHandler applies the coupon code typed by the customer
+// to the cart. An empty code removes the promotion.
+func PromotionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	cid := getID(r, w)
+
+	c, err := Get(ctx, cid)
+	if err != nil {
+		httperrors.HXCatch(w, ctx, err.Error())
+		return
+	}
+
+	if len(c.Products) == 0 {
+		slog.LogAttrs(ctx, slog.LevelInfo, "the cart is empty")
+		httperrors.HXCatch(w, ctx, "you are not authorized to process this request")
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot parse the form", slog.String("error", err.Error()))
+		httperrors.HXCatch(w, ctx, "something went wrong")
+		return
+	}
+
+	err = c.UpdatePromotion(ctx, r.FormValue("code"))
+	if err != nil {
+		httperrors.HXCatch(w, ctx, err.Error())
+		return
+	}
+
+	coo := httphelpers.NewCookie(cookies.CartID, fmt.Sprintf("%d", cid), int(conf.Cookie.MaxAge))
+	http.SetCookie(w, &coo)
+	r.AddCookie(&coo)
+
+	w.Header().Set("HX-Refresh", "true")
+	w.Write([]byte(""))
+}
+
+func AddressFormHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := users.Context(r, w)
 	lang := ctx.Value(contexts.Locale).(language.Tag)
 
+	u, logged := ctx.Value(contexts.User).(users.User)
+	if !logged && !shops.Data.Guest {
+		slog.LogAttrs(ctx, slog.LevelInfo, "the guest orders are not allowed")
+		http.Redirect(w, r, "/otp", http.StatusFound)
+		return
+	}
+
 	cid := getID(r, w)
 
 	c, err := Get(ctx, cid)
@@ -292,18 +473,73 @@ func AddressFormHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The addresses are pre-filled with the default ones
+	// of the book until they are typed for the cart.
+	// The customer can pick other addresses from the book.
+	billing, shipping := c.Billing, c.Address
+	book := []users.BookAddress{}
+	billingID, shippingID := r.URL.Query().Get("billing"), r.URL.Query().Get("shipping")
+
+	if logged {
+		book, err = u.Addresses(ctx)
+		if err != nil {
+			httperrors.Catch(w, ctx, err.Error(), 500)
+			return
+		}
+
+		for _, a := range book {
+			if a.ID == billingID || (billingID == "" && a.Billing && billing.IsZero()) {
+				billing, billingID = a.Address, a.ID
+			}
+
+			if a.ID == shippingID || (shippingID == "" && a.Shipping && shipping.IsZero()) {
+				shipping, shippingID = a.Address, a.ID
+			}
+		}
+
+		if billing.IsZero() {
+			billing = u.Address
+		}
+	}
+
+	if shipping.IsZero() {
+		shipping = billing
+	}
+
 	data := struct {
 		Lang    language.Tag
 		Shop    shops.Settings
 		Tags    []tree.Leaf
 		Address addresses.Address
 		URL     string
+		Guest   bool
+		Email   string
+
+		// The shipping address is only asked for the checkout
+		Checkout bool
+		Shipping addresses.Address
+		Same     bool
+
+		// The address book of the user
+		Book       bool
+		Saved      []users.BookAddress
+		BillingID  string
+		ShippingID string
 	}{
 		lang,
 		shops.Data,
 		tree.Tree,
-		c.Address,
+		billing,
 		"/cart/address",
+		!logged,
+		c.Email,
+		true,
+		shipping,
+		shipping == billing,
+		false,
+		book,
+		billingID,
+		shippingID,
 	}
 
 	coo := httphelpers.NewCookie(cookies.CartID, fmt.Sprintf("%d", cid), int(conf.Cookie.MaxAge))
@@ -316,10 +552,16 @@ func AddressFormHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func AddressHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	ctx := users.Context(r, w)
+
+	u, logged := ctx.Value(contexts.User).(users.User)
+	if !logged && !shops.Data.Guest {
+		slog.LogAttrs(ctx, slog.LevelInfo, "the guest orders are not allowed")
+		w.Header().Set("HX-Redirect", "/otp")
+		return
+	}
 
 	cid := getID(r, w)
-	log.Println("cid", cid)
 	c, err := Get(ctx, cid)
 	if err != nil {
 		httperrors.Catch(w, ctx, err.Error(), 401)
@@ -338,22 +580,40 @@ func AddressHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	a := addresses.Address{
-		Firstname:     r.FormValue("firstname"),
-		Lastname:      r.FormValue("lastname"),
-		Street:        r.FormValue("street"),
-		Complementary: r.FormValue("complementary"),
-		City:          r.FormValue("city"),
-		Zipcode:       r.FormValue("zipcode"),
-		Phone:         r.FormValue("phone"),
+	billing := addresses.FromForm(r, "")
+	if err := billing.Validate(ctx); err != nil {
+		httperrors.HXCatch(w, ctx, err.Error())
+		return
 	}
 
-	if err := a.Validate(ctx); err != nil {
+	// The shipping address is the billing one
+	// unless the customer types another one
+	shipping := billing
+	if r.FormValue("same") != "on" {
+		shipping = addresses.FromForm(r, "shipping_")
+		if err := shipping.Validate(ctx); err != nil {
+			httperrors.HXCatch(w, ctx, strings.Replace(err.Error(), "input:", "input:shipping_", 1))
+			return
+		}
+	}
+
+	// The guest types the email used to send the order
+	email := r.FormValue("email")
+	if logged {
+		email = u.Email
+	}
+
+	if err := c.SaveBilling(ctx, billing); err != nil {
 		httperrors.HXCatch(w, ctx, err.Error())
 		return
 	}
 
-	if err := c.SaveAddress(ctx, a); err != nil {
+	if err := c.SaveAddress(ctx, shipping); err != nil {
+		httperrors.HXCatch(w, ctx, err.Error())
+		return
+	}
+
+	if err := c.SaveEmail(ctx, email); err != nil {
 		httperrors.HXCatch(w, ctx, err.Error())
 		return
 	}
@@ -362,7 +622,7 @@ func AddressHandler(w http.ResponseWriter, r *http.Request) {
 	http.SetCookie(w, &coo)
 	r.AddCookie(&coo)
 
-	w.Header().Add("HX-Redirect", "/payment")
+	w.Header().Add("HX-Redirect", "/delivery")
 }
 
 func PaymentHandler(w http.ResponseWriter, r *http.Request) {
@@ -377,6 +637,20 @@ func PaymentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The promotion is removed if it cannot be used anymore,
+	// so the customer can still pay the order
+	promotionErr := ""
+	if err := c.CheckPromotion(ctx); err != nil {
+		promotionErr = err.Error()
+
+		if err := c.UpdatePromotion(ctx, ""); err != nil {
+			httperrors.Catch(w, ctx, err.Error(), 500)
+			return
+		}
+
+		c.Promotion = ""
+	}
+
 	err = c.Validate(ctx)
 	if err != nil {
 		httperrors.Catch(w, ctx, err.Error(), 400)
@@ -395,13 +669,20 @@ func PaymentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	c, err = Get(ctx, cid)
+	if err != nil {
+		httperrors.Catch(w, ctx, err.Error(), 500)
+		return
+	}
+
 	data := struct {
-		Lang     language.Tag
-		Shop     shops.Settings
-		Tags     []tree.Leaf
-		Cart     Cart
-		Payments []string
-		Total    float64
+		Lang           language.Tag
+		Shop           shops.Settings
+		Tags           []tree.Leaf
+		Cart           Cart
+		Payments       []string
+		Total          money.Money
+		PromotionError string
 	}{
 		lang,
 		shops.Data,
@@ -409,6 +690,7 @@ func PaymentHandler(w http.ResponseWriter, r *http.Request) {
 		c,
 		pay,
 		total,
+		promotionErr,
 	}
 
 	coo := httphelpers.NewCookie(cookies.CartID, fmt.Sprintf("%d", cid), int(conf.Cookie.MaxAge))
@@ -421,7 +703,14 @@ func PaymentHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func PaymentProcessHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	ctx := users.Context(r, w)
+
+	u, logged := ctx.Value(contexts.User).(users.User)
+	if !logged && !shops.Data.Guest {
+		slog.LogAttrs(ctx, slog.LevelInfo, "the guest orders are not allowed")
+		httperrors.HXCatch(w, ctx, "you are not authorized to process this request")
+		return
+	}
 
 	if err := r.ParseForm(); err != nil {
 		slog.LogAttrs(ctx, slog.LevelError, "cannot parse the form", slog.String("error", err.Error()))
@@ -439,7 +728,10 @@ func PaymentProcessHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	c.Payment = payment
-	log.Println("!!!!!!!!!!!!!!!!!!!!!!!!!", payment)
+
+	if logged {
+		c.Email = u.Email
+	}
 
 	err = c.Validate(ctx)
 	if err != nil {
@@ -447,13 +739,27 @@ func PaymentProcessHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	pickup, slot, err := c.CheckPickup(ctx)
+	if err != nil {
+		httperrors.Catch(w, ctx, err.Error(), 400)
+		return
+	}
+
 	o := orders.Order{
 		Delivery:     c.Delivery,
 		DeliveryFees: c.DeliveryFees,
+		Pickup:       pickup,
+		PickupSlot:   slot,
+		Weight:       c.Weight(),
 		Payment:      c.Payment,
 		Address:      c.Address,
+		Billing:      c.Billing,
+		Email:        c.Email,
 		Products:     c.Products,
 		Total:        c.Total,
+		Taxes:        c.Taxes,
+		Promotion:    c.Promotion,
+		Discount:     c.Discount,
 	}
 
 	err = o.AssignID(ctx)
@@ -462,33 +768,61 @@ func PaymentProcessHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	redirect, err := shops.Pay(ctx, o.ID, payment)
+	err = products.Reserve(ctx, c.ID, c.Products)
+	if err != nil {
+		httperrors.HXCatch(w, ctx, err.Error())
+		return
+	}
+
+	if !slot.Start.IsZero() {
+		err = pickups.Book(ctx, pickup.ID, slot.ID())
+		if err != nil {
+			products.ReleaseReservation(ctx, c.ID)
+			httperrors.HXCatch(w, ctx, err.Error())
+			return
+		}
+	}
+
+	res, err := shops.Pay(ctx, o.ID, payment, o.Total)
 	if err != nil {
 		throws := ctx.Value(contexts.ThrowsWhenPaymentFailed).(bool)
 		if throws {
 			slog.LogAttrs(ctx, slog.LevelInfo, "the config does not allow to continue when the payment fail")
+			products.ReleaseReservation(ctx, c.ID)
+			if !slot.Start.IsZero() {
+				pickups.CancelBooking(ctx, pickup.ID, slot.ID())
+			}
 			httperrors.HXCatch(w, ctx, err.Error())
 			return
 		}
 
-		o.Status = "payment_progress"
-		slog.LogAttrs(ctx, slog.LevelError, "the payment did not work so the payment status is payment_validated")
+		o.PaymentStatus = "payment_progress"
+		slog.LogAttrs(ctx, slog.LevelError, "the payment did not work so the payment status is payment_progress")
 	} else {
-		o.Status = "payment_validated"
+		o.PaymentStatus = res.Status
+		o.PaymentRef = res.Reference
 	}
 
 	err = o.Save(ctx, c.ID)
 	if err != nil {
+		products.ReleaseReservation(ctx, c.ID)
+		if !slot.Start.IsZero() {
+			pickups.CancelBooking(ctx, pickup.ID, slot.ID())
+		}
 		httperrors.Catch(w, ctx, err.Error(), 400)
 		return
 	}
 
 	go o.SendConfirmationEmail(ctx)
 
-	go stats.Order(ctx, o.ID, o.Products, o.Total)
+	go stats.Order(ctx, o.ID, o.Products, o.Total, o.Taxes.Tax)
+
+	if c.Recovered {
+		go stats.CartRecovered(ctx, o.ID, o.Total)
+	}
 
-	if redirect != "" {
-		w.Header().Add("HX-Redirect", redirect)
+	if res.Redirect != "" {
+		w.Header().Add("HX-Redirect", res.Redirect)
 		return
 	}
 
@@ -497,12 +831,87 @@ func PaymentProcessHandler(w http.ResponseWriter, r *http.Request) {
 	data := struct {
 		Lang           language.Tag
 		SuccessMessage string
+		Email          string
 	}{
 		lang,
 		"the order is created successfully",
+		o.Email,
+	}
+
+	// The guest is invited to create an account
+	// with the email used for the order
+	t := templates.Pages["hx-success"]
+	if !logged {
+		t = templates.Pages["hx-guest-success"]
+	}
+
+	if err := t.Execute(w, &data); err != nil {
+		slog.Error("cannot render the template", slog.String("error", err.Error()))
+	}
+}
+
+// RecoverHandler restores the cart from the signed link
+// of the abandoned cart email.
+// A user cart is restored by logging in, so the
+// user is sent to the login page if needed.
+func RecoverHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := users.Context(r, w)
+
+	cid, err := strconv.Atoi(r.URL.Query().Get("cid"))
+	if err != nil || !VerifyRecovery(cid, r.URL.Query().Get("sig")) {
+		slog.LogAttrs(ctx, slog.LevelInfo, "the recovery link is not valid", slog.String("cid", r.URL.Query().Get("cid")))
+		httperrors.Page(w, ctx, "you are not authorized to process this request", 401)
+		return
+	}
+
+	if err := Recover(ctx, cid); err != nil {
+		httperrors.Page(w, ctx, err.Error(), 404)
+		return
+	}
+
+	if IsUserCart(ctx, cid) {
+		u, ok := ctx.Value(contexts.User).(users.User)
+		if !ok || u.ID != cid {
+			http.Redirect(w, r, "/otp", http.StatusFound)
+			return
+		}
+	} else {
+		coo := httphelpers.NewCookie(cookies.CartID, fmt.Sprintf("%d", cid), int(conf.Cookie.MaxAge))
+		http.SetCookie(w, &coo)
+	}
+
+	http.Redirect(w, r, "/cart", http.StatusFound)
+}
+
+// OptOutHandler stops the abandoned cart emails
+// from the signed link of the email.
+func OptOutHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	lang := ctx.Value(contexts.Locale).(language.Tag)
+
+	email := r.URL.Query().Get("email")
+	if !VerifyOptOut(email, r.URL.Query().Get("sig")) {
+		slog.LogAttrs(ctx, slog.LevelInfo, "the opt out link is not valid", slog.String("email", email))
+		httperrors.Page(w, ctx, "you are not authorized to process this request", 401)
+		return
+	}
+
+	if err := OptOut(ctx, email); err != nil {
+		httperrors.Page(w, ctx, err.Error(), 400)
+		return
+	}
+
+	data := struct {
+		Lang language.Tag
+		Shop shops.Settings
+		Tags []tree.Leaf
+	}{
+		lang,
+		shops.Data,
+		tree.Tree,
 	}
 
-	if err := templates.Pages["hx-success"].Execute(w, &data); err != nil {
+	if err := templates.Pages["optout"].Execute(w, &data); err != nil {
 		slog.Error("cannot render the template", slog.String("error", err.Error()))
 	}
 }
@@ -0,0 +1,281 @@
+package carts
+
+import (
+	"artisons/conf"
+	"artisons/db"
+	"artisons/http/contexts"
+	"artisons/notifications/mails"
+	"artisons/stats"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// The abandoned carts are found with the sorted set carts:activity,
+// scored by the last cart update.
+// The recovery is sent once per idle period: the cart is removed
+// from the set after the email and added again by the next update.
+// The emails opting out are stored in carts:recovery:optout.
+const (
+	activityKey = "carts:activity"
+	optOutKey   = "carts:recovery:optout"
+)
+
+// touch records the cart activity with the current time.
+func touch(ctx context.Context, rdb redis.Cmdable, cid int) {
+	rdb.ZAdd(ctx, activityKey, redis.Z{
+		Score:  float64(time.Now().Unix()),
+		Member: cid,
+	})
+}
+
+// sign returns the hex encoded HMAC-SHA256 of the value
+// with the recovery secret.
+func sign(value string) string {
+	mac := hmac.New(sha256.New, []byte(conf.CartRecoverySecret))
+	mac.Write([]byte(value))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify returns true if the signature matches the value.
+// Nothing is valid without a recovery secret.
+func verify(value, signature string) bool {
+	if conf.CartRecoverySecret == "" || signature == "" {
+		return false
+	}
+
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	expected, _ := hex.DecodeString(sign(value))
+
+	return hmac.Equal(sig, expected)
+}
+
+// RecoveryURL returns the signed link restoring the cart.
+func RecoveryURL(cid int) string {
+	return fmt.Sprintf("%s/cart/recover?cid=%d&sig=%s", conf.WebsiteURL, cid, sign(fmt.Sprintf("cart:%d", cid)))
+}
+
+// VerifyRecovery returns true if the signature
+// of the recovery link is valid for the cart.
+func VerifyRecovery(cid int, signature string) bool {
+	return verify(fmt.Sprintf("cart:%d", cid), signature)
+}
+
+// OptOutURL returns the signed link stopping
+// the recovery emails for the email.
+func OptOutURL(email string) string {
+	return fmt.Sprintf("%s/cart/recover/optout?email=%s&sig=%s", conf.WebsiteURL, url.QueryEscape(email), sign("optout:"+email))
+}
+
+// VerifyOptOut returns true if the signature
+// of the opt out link is valid for the email.
+func VerifyOptOut(email, signature string) bool {
+	return verify("optout:"+email, signature)
+}
+
+// Abandoned returns the ids of the carts
+// without update since the idle duration.
+func Abandoned(ctx context.Context, idle time.Duration) ([]int, error) {
+	l := slog.With(slog.Duration("idle", idle))
+	l.LogAttrs(ctx, slog.LevelInfo, "looking for the abandoned carts")
+
+	max := time.Now().Add(-idle).Unix()
+
+	values, err := db.Redis.ZRangeByScore(ctx, activityKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(max, 10),
+	}).Result()
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot get the abandoned carts", slog.String("error", err.Error()))
+		return []int{}, errors.New("something went wrong")
+	}
+
+	cids := []int{}
+	for _, value := range values {
+		cid, err := strconv.Atoi(value)
+		if err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot parse the cart id", slog.String("cid", value))
+			continue
+		}
+
+		cids = append(cids, cid)
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "got the abandoned carts", slog.Int("carts", len(cids)))
+
+	return cids, nil
+}
+
+// recipient returns the email captured with the cart address
+// or the one of the user owning the cart.
+// The logged user cart id is the user id.
+func recipient(ctx context.Context, cid int) (string, error) {
+	email, err := db.Redis.HGet(ctx, fmt.Sprintf("cart:%d:info", cid), "email").Result()
+	if err != nil && err != redis.Nil {
+		return "", err
+	}
+
+	if email != "" {
+		return email, nil
+	}
+
+	email, err = db.Redis.HGet(ctx, fmt.Sprintf("user:%d", cid), "email").Result()
+	if err != nil && err != redis.Nil {
+		return "", err
+	}
+
+	return email, nil
+}
+
+// OptOut stops the recovery emails for the email.
+func OptOut(ctx context.Context, email string) error {
+	l := slog.With(slog.String("email", email))
+	l.LogAttrs(ctx, slog.LevelInfo, "opting out the cart recovery")
+
+	if email == "" {
+		l.LogAttrs(ctx, slog.LevelInfo, "the email is empty")
+		return errors.New("input:email")
+	}
+
+	if _, err := db.Redis.SAdd(ctx, optOutKey, email).Result(); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot opt out the email", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the email is opted out")
+
+	return nil
+}
+
+// SendRecovery sends the recovery email of an abandoned cart
+// and removes it from the activity.
+// Nothing is sent if the cart does not exist anymore, because it
+// expired or the order is saved, if it is empty, if there is no
+// email or if the email opted out.
+// The email is returned, empty if nothing is sent.
+func SendRecovery(ctx context.Context, cid int) (string, error) {
+	l := slog.With(slog.Int("cid", cid))
+	l.LogAttrs(ctx, slog.LevelInfo, "sending the cart recovery")
+
+	c, err := Get(ctx, cid)
+	if err != nil {
+		return "", err
+	}
+
+	email, err := recipient(ctx, cid)
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot get the email", slog.String("error", err.Error()))
+		return "", errors.New("something went wrong")
+	}
+
+	optout, err := db.Redis.SIsMember(ctx, optOutKey, email).Result()
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot get the opt out", slog.String("error", err.Error()))
+		return "", errors.New("something went wrong")
+	}
+
+	if _, err := db.Redis.ZRem(ctx, activityKey, cid).Result(); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot remove the cart activity", slog.String("error", err.Error()))
+		return "", errors.New("something went wrong")
+	}
+
+	if len(c.Products) == 0 || email == "" || optout {
+		l.LogAttrs(ctx, slog.LevelInfo, "the cart recovery is not sent", slog.Int("products", len(c.Products)), slog.Bool("optout", optout))
+		return "", nil
+	}
+
+	lang := ctx.Value(contexts.Locale).(language.Tag)
+	p := message.NewPrinter(lang)
+
+	msg := p.Sprintf("email_cart_recovery")
+	for _, pd := range c.Products {
+		msg += p.Sprintf("email_cart_recoveryproduct", pd.Quantity, pd.Title)
+	}
+
+	msg += p.Sprintf("email_cart_recoverylink", RecoveryURL(cid))
+	msg += p.Sprintf("email_cart_recoveryoptout", OptOutURL(email))
+
+	if err := mails.Send(ctx, email, p.Sprintf("email_cart_recovery_subject"), msg); err != nil {
+		l.LogAttrs(ctx, slog.LevelWarn, "cannot send the email", slog.String("error", err.Error()))
+		return "", err
+	}
+
+	go stats.CartRecovery(ctx, cid)
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the cart recovery is sent")
+
+	return email, nil
+}
+
+// SendRecoveries sends the recovery emails of the carts
+// abandoned since the idle duration and returns the count sent.
+func SendRecoveries(ctx context.Context, idle time.Duration) (int, error) {
+	if conf.CartRecoverySecret == "" {
+		slog.LogAttrs(ctx, slog.LevelInfo, "the cart recovery is disabled without secret")
+		return 0, nil
+	}
+
+	cids, err := Abandoned(ctx, idle)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, cid := range cids {
+		email, err := SendRecovery(ctx, cid)
+		if err == nil && email != "" {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Recover flags the cart restored from the recovery link,
+// the order will count as a conversion.
+func Recover(ctx context.Context, cid int) error {
+	l := slog.With(slog.Int("cid", cid))
+	l.LogAttrs(ctx, slog.LevelInfo, "recovering the cart")
+
+	if !Exists(ctx, cid) {
+		l.LogAttrs(ctx, slog.LevelInfo, "the cart does not exist")
+		return errors.New("oops the data is not found")
+	}
+
+	if _, err := db.Redis.HSet(ctx, fmt.Sprintf("cart:%d:info", cid), "recovered", "1").Result(); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot flag the cart", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the cart is recovered")
+
+	return nil
+}
+
+// IsUserCart returns true if the cart id is a user id,
+// the cart is then restored by logging in.
+func IsUserCart(ctx context.Context, cid int) bool {
+	exists, err := db.Redis.Exists(ctx, fmt.Sprintf("user:%d", cid)).Result()
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot check the user", slog.Int("cid", cid), slog.String("error", err.Error()))
+		return false
+	}
+
+	return exists > 0
+}
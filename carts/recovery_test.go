@@ -0,0 +1,147 @@
+package carts
+
+import (
+	"artisons/conf"
+	"artisons/db"
+	"artisons/tests"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRecoveryURL(t *testing.T) {
+	conf.CartRecoverySecret = "secret"
+
+	u, err := url.Parse(RecoveryURL(456))
+	if err != nil {
+		t.Fatalf(`url.Parse = %v, want nil`, err)
+	}
+
+	sig := u.Query().Get("sig")
+
+	var tests = []struct {
+		name string
+		cid  int
+		sig  string
+		ok   bool
+	}{
+		{"sig=", 456, "", false},
+		{"sig=hello", 456, "hello", false},
+		{"cid=457", 457, sig, false},
+		{"cid=456", 456, sig, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ok := VerifyRecovery(tt.cid, tt.sig); ok != tt.ok {
+				t.Fatalf(`VerifyRecovery(%d, %s) = %v, want %v`, tt.cid, tt.sig, ok, tt.ok)
+			}
+		})
+	}
+
+	if VerifyOptOut("recover@artisons.me", sig) {
+		t.Fatalf(`VerifyOptOut(recover@artisons.me, sig) = true, want false`)
+	}
+}
+
+func TestAbandoned(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/recovery.redis")
+
+	cids, err := Abandoned(ctx, time.Hour)
+	if err != nil {
+		t.Fatalf(`Abandoned(ctx, time.Hour) = %v, want nil`, err)
+	}
+
+	for _, cid := range []int{456, 457, 458} {
+		if !slices.Contains(cids, cid) {
+			t.Fatalf(`cids = %v, want %d`, cids, cid)
+		}
+	}
+
+	if slices.Contains(cids, 459) {
+		t.Fatalf(`cids = %v, do not want 459`, cids)
+	}
+}
+
+func TestSendRecovery(t *testing.T) {
+	ctx := tests.Context()
+	conf.CartRecoverySecret = "secret"
+
+	tests.ImportData(ctx, cur+"testdata/cart.redis")
+	tests.ImportData(ctx, cur+"testdata/recovery.redis")
+
+	var tests = []struct {
+		name  string
+		cid   int
+		email string
+	}{
+		{"cid=456", 456, "recover@artisons.me"},
+		{"optout@artisons.me", 457, ""},
+		{"cid=idontexist", 458, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email, err := SendRecovery(ctx, tt.cid)
+			if email != tt.email || err != nil {
+				t.Fatalf(`SendRecovery(ctx, %d) = %s, %v, want %s, nil`, tt.cid, email, err, tt.email)
+			}
+
+			if _, err := db.Redis.ZScore(ctx, "carts:activity", fmt.Sprintf("%d", tt.cid)).Result(); err == nil {
+				t.Fatalf(`the cart %d is still in carts:activity`, tt.cid)
+			}
+		})
+	}
+}
+
+func TestOptOut(t *testing.T) {
+	ctx := tests.Context()
+
+	if err := OptOut(ctx, ""); fmt.Sprintf("%s", err) != "input:email" {
+		t.Fatalf(`err = %v, want input:email`, err)
+	}
+
+	if err := OptOut(ctx, "recover@artisons.me"); err != nil {
+		t.Fatalf(`OptOut(ctx, recover@artisons.me) = %v, want nil`, err)
+	}
+
+	if ok, _ := db.Redis.SIsMember(ctx, "carts:recovery:optout", "recover@artisons.me").Result(); !ok {
+		t.Fatalf(`the email is not opted out`)
+	}
+
+	tests.Del(ctx, "carts:recovery:optout")
+}
+
+func TestRecover(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/cart.redis")
+	tests.ImportData(ctx, cur+"testdata/recovery.redis")
+
+	var tests = []struct {
+		name string
+		cid  int
+		err  error
+	}{
+		{"cid=idontexist", 458, errors.New("oops the data is not found")},
+		{"cid=456", 456, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Recover(ctx, tt.cid); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+		})
+	}
+
+	c, err := Get(ctx, 456)
+	if !c.Recovered || err != nil {
+		t.Fatalf(`c.Recovered = %v, err = %v, want true, nil`, c.Recovered, err)
+	}
+}
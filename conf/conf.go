@@ -2,7 +2,10 @@
 package conf
 
 import (
+	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/text/language"
@@ -32,8 +35,54 @@ var ImgProxy = struct {
 	"",
 }
 
+// Currency is the shop currency. The product prices,
+// the delivery fees and the statistics are defined in this currency.
 const Currency = "EUR"
 
+// Currencies are the currencies accepted by the shop with their
+// exchange rate from the shop currency.
+// The rates convert the delivery fees and the statistics, the
+// product prices come from the product price lists.
+// The default rates are replaced by the CURRENCY_RATES
+// variable, like CHF:0.94,GBP:0.85.
+var Currencies = rates(map[string]float64{
+	"EUR": 1,
+	"CHF": 0.94,
+	"GBP": 0.85,
+}, os.Getenv("CURRENCY_RATES"))
+
+// rates replaces the default exchange rates by the rates
+// in the form CHF:0.94,GBP:0.85.
+// The unknown currencies and the invalid rates are ignored,
+// because adding a currency requires a migration of the index.
+func rates(defaults map[string]float64, s string) map[string]float64 {
+	if s == "" {
+		return defaults
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		code, val, _ := strings.Cut(strings.TrimSpace(pair), ":")
+
+		rate, err := strconv.ParseFloat(val, 64)
+		if _, ok := defaults[code]; !ok || code == Currency || err != nil || rate <= 0 {
+			log.Printf("the exchange rate %s is ignored", pair)
+			continue
+		}
+
+		defaults[code] = rate
+	}
+
+	return defaults
+}
+
+// CurrencyRegions gives the currency of the customer region
+// when no currency is chosen
+var CurrencyRegions = map[string]string{
+	"CH": "CHF",
+	"LI": "CHF",
+	"GB": "GBP",
+}
+
 // DefaultMerchantId is the default merchant id
 var DefaultMID = "1234"
 
@@ -87,6 +136,23 @@ var Email = struct {
 	Dry:      os.Getenv("EMAIL_DRY") != "0",
 }
 
+// PaymentWebhookSecret is the key used to verify the HMAC signature
+// sent by the payment providers to the webhook.
+var PaymentWebhookSecret = os.Getenv("PAYMENT_WEBHOOK_SECRET")
+
+// FakePayment registers the fake payment provider, which
+// validates the payments on demand. It is meant for the
+// development and the functional tests only.
+var FakePayment = os.Getenv("PAYMENT_FAKE") == "1"
+
+// CartRecoverySecret is the key used to sign the links
+// sent in the abandoned cart emails.
+var CartRecoverySecret = os.Getenv("CART_RECOVERY_SECRET")
+
+// CartRecoveryDelay is the idle time after which
+// a cart is abandoned and the recovery email is sent.
+const CartRecoveryDelay = time.Hour * 4
+
 // HasHomeDelivery enabled the "home" delivery if true
 const HasHomeDelivery = true
 
@@ -123,6 +189,19 @@ const MaxUploadSize = 1024 * 1024 * 10
 // WorkingSpace is the project root folder. Mainly used for testing
 var WorkingSpace = os.Getenv("WORKSPACE_DIR") + "/"
 
+// InvoicesPath is the folder where the invoice PDF are stored
+var InvoicesPath = WorkingSpace + "web/invoices"
+
+// DefaultVATRate is the VAT rate in percent applied when
+// the tax class has no rate for the country
+const DefaultVATRate = 20.0
+
+// DefaultCountry is the country code used to find the tax rates
+const DefaultCountry = "FR"
+
+// Countries are the country codes accepted for the addresses
+var Countries = []string{"FR", "BE", "CH", "DE"}
+
 // ImagesAllowed defines the image extensions supported by file upload
 var ImagesAllowed = []string{"image/jpg", "image/jpeg", "image/png"}
 
@@ -149,6 +228,10 @@ func Pagination(page int) (int, int) {
 // DefaultLocale is the default language applied
 var DefaultLocale = language.English
 
+// Locales are the languages of the translated
+// contents, like the product image alt texts
+var Locales = []language.Tag{DefaultLocale}
+
 const DefaultTheme = "nostyle"
 
 const AddressesFrApi = "https://api-adresse.data.gouv.fr"
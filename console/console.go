@@ -5,11 +5,11 @@ import (
 	"artisons/console/parser"
 	"artisons/db"
 	"artisons/logs"
-	"artisons/notifications/mails"
-	"artisons/notifications/vapid"
+	"artisons/money"
 	"artisons/orders"
 	"artisons/products"
-	"artisons/users"
+	"artisons/shipping"
+	"artisons/taxes"
 	"context"
 	"encoding/csv"
 	"encoding/json"
@@ -17,9 +17,9 @@ import (
 	"log"
 	"log/slog"
 	"os"
+	"strconv"
+	"strings"
 	"time"
-
-	"golang.org/x/text/message"
 )
 
 func main() {
@@ -96,39 +96,198 @@ func main() {
 
 			flag.Parse()
 
-			err := orders.UpdateStatus(ctx, *id, *status)
+			changed, err := orders.UpdateStatus(ctx, *id, *status)
 			if err != nil {
 				slog.LogAttrs(ctx, slog.LevelError, "cannot update the order", slog.String("oid", *id), slog.String("error", err.Error()))
 				log.Fatal()
 			}
 
-			order, err := orders.Find(ctx, *id)
+			if !changed {
+				slog.LogAttrs(ctx, slog.LevelInfo, "the status is already set", slog.String("oid", *id))
+			} else {
+				order, err := orders.Find(ctx, *id)
+				if err != nil {
+					slog.LogAttrs(ctx, slog.LevelError, "cannot find the order", slog.String("oid", *id), slog.String("error", err.Error()))
+					log.Fatal()
+				}
+
+				// The status is saved, so a notification failure
+				// does not fail the command.
+				if _, err := order.SendStatusNotification(ctx); err != nil {
+					slog.LogAttrs(ctx, slog.LevelWarn, "cannot notify the customer", slog.String("oid", *id), slog.String("error", err.Error()))
+				}
+			}
+		}
+
+	case "orderrefund":
+		{
+			id := flag.String("id", "", "The order id")
+			lines := flag.String("lines", "", "The quantities to refund, like PDT1:1,PDT2:2")
+			amount := flag.String("amount", "", "The amount to refund, like 12.50, calculated from the lines if empty")
+			reason := flag.String("reason", "", "The refund reason")
+
+			flag.Parse()
+
+			qty := map[string]int{}
+
+			for _, line := range strings.Split(*lines, ",") {
+				if line == "" {
+					continue
+				}
+
+				parts := strings.Split(line, ":")
+				if len(parts) != 2 {
+					slog.LogAttrs(ctx, slog.LevelError, "cannot parse the line", slog.String("line", line))
+					log.Fatal()
+				}
+
+				q, err := strconv.Atoi(parts[1])
+				if err != nil {
+					slog.LogAttrs(ctx, slog.LevelError, "cannot parse the quantity", slog.String("line", line), slog.String("error", err.Error()))
+					log.Fatal()
+				}
+
+				qty[parts[0]] = q
+			}
+
+			value := money.New(0)
+			if *amount != "" {
+				var err error
+				value, err = money.Parse(*amount)
+				if err != nil {
+					slog.LogAttrs(ctx, slog.LevelError, "cannot parse the amount", slog.String("amount", *amount), slog.String("error", err.Error()))
+					log.Fatal()
+				}
+			}
+
+			cn, err := orders.Refund(ctx, *id, qty, value, *reason)
 			if err != nil {
-				slog.LogAttrs(ctx, slog.LevelError, "cannot find the order", slog.String("oid", *id), slog.String("error", err.Error()))
+				slog.LogAttrs(ctx, slog.LevelError, "cannot refund the order", slog.String("oid", *id), slog.String("error", err.Error()))
 				log.Fatal()
 			}
 
-			user, err := users.FindByUID(ctx, order.UID)
-			if err != nil {
-				slog.LogAttrs(ctx, slog.LevelError, "cannot get the user", slog.String("oid", *id), slog.String("error", err.Error()))
+			slog.LogAttrs(ctx, slog.LevelInfo, "the order is refunded", slog.String("cnid", cn.ID), slog.Any("amount", cn.Amount))
+		}
+
+	case "taxclass":
+		{
+			id := flag.String("id", "", "The tax class id, like standard or reduced")
+			name := flag.String("name", "", "The tax class name")
+			rates := flag.String("rates", "", "The rates in percent per country, like FR:20,BE:21")
+
+			flag.Parse()
+
+			c := taxes.Class{ID: *id, Name: *name, Rates: map[string]float64{}}
+
+			for _, rate := range strings.Split(*rates, ",") {
+				if rate == "" {
+					continue
+				}
+
+				parts := strings.Split(rate, ":")
+				if len(parts) != 2 {
+					slog.LogAttrs(ctx, slog.LevelError, "cannot parse the rate", slog.String("rate", rate))
+					log.Fatal()
+				}
+
+				r, err := strconv.ParseFloat(parts[1], 64)
+				if err != nil {
+					slog.LogAttrs(ctx, slog.LevelError, "cannot parse the rate", slog.String("rate", rate), slog.String("error", err.Error()))
+					log.Fatal()
+				}
+
+				c.Rates[strings.ToUpper(parts[0])] = r
+			}
+
+			if err := c.Save(ctx); err != nil {
+				slog.LogAttrs(ctx, slog.LevelError, "cannot save the tax class", slog.String("id", *id), slog.String("error", err.Error()))
 				log.Fatal()
 			}
 
-			p := message.NewPrinter(user.Lang)
-			msg := p.Sprintf("login_mail_otp", id, status)
-			subject := p.Sprintf("email_order_update", id)
-			mails.Send(ctx, user.Email, subject, msg)
+			slog.LogAttrs(ctx, slog.LevelInfo, "the tax class is saved", slog.String("id", *id))
+		}
+
+	case "shippingzone":
+		{
+			id := flag.String("id", "", "The zone id, like france or europe")
+			name := flag.String("name", "", "The zone name")
+			countries := flag.String("countries", "", "The country codes, like FR,BE")
+			zipcodes := flag.String("zipcodes", "", "The optional zipcode prefixes, like 20,97")
 
-			sessions, err := user.Sessions(ctx)
-			if err != nil {
-				slog.LogAttrs(ctx, slog.LevelError, "cannot get the session", slog.Int("uid", user.ID), slog.String("error", err.Error()))
+			flag.Parse()
+
+			z := shipping.Zone{ID: *id, Name: *name, Countries: []string{}, Zipcodes: []string{}}
+
+			for _, country := range strings.Split(*countries, ",") {
+				if country != "" {
+					z.Countries = append(z.Countries, strings.ToUpper(country))
+				}
+			}
+
+			for _, zipcode := range strings.Split(*zipcodes, ",") {
+				if zipcode != "" {
+					z.Zipcodes = append(z.Zipcodes, zipcode)
+				}
+			}
+
+			if err := z.Save(ctx); err != nil {
+				slog.LogAttrs(ctx, slog.LevelError, "cannot save the shipping zone", slog.String("id", *id), slog.String("error", err.Error()))
 				log.Fatal()
 			}
 
-			for _, session := range sessions {
-				if session.WPToken != "" {
-					vapid.Send(ctx, session.WPToken, msg)
+			slog.LogAttrs(ctx, slog.LevelInfo, "the shipping zone is saved", slog.String("id", *id))
+		}
+
+	case "shippingmethod":
+		{
+			id := flag.String("id", "", "The method id, which is the delivery name, like colissimo")
+			name := flag.String("name", "", "The method name")
+			rates := flag.String("rates", "", "The prices per zone and max weight in grams, 0 for no limit, like france:1000:5.90,france:0:12.50")
+
+			flag.Parse()
+
+			m := shipping.Method{ID: *id, Name: *name, Rates: []shipping.Rate{}}
+
+			for _, rate := range strings.Split(*rates, ",") {
+				if rate == "" {
+					continue
 				}
+
+				parts := strings.Split(rate, ":")
+				if len(parts) != 3 {
+					slog.LogAttrs(ctx, slog.LevelError, "cannot parse the rate", slog.String("rate", rate))
+					log.Fatal()
+				}
+
+				weight, err := strconv.ParseFloat(parts[1], 64)
+				if err != nil {
+					slog.LogAttrs(ctx, slog.LevelError, "cannot parse the weight", slog.String("rate", rate), slog.String("error", err.Error()))
+					log.Fatal()
+				}
+
+				price, err := money.Parse(parts[2])
+				if err != nil {
+					slog.LogAttrs(ctx, slog.LevelError, "cannot parse the price", slog.String("rate", rate), slog.String("error", err.Error()))
+					log.Fatal()
+				}
+
+				m.Rates = append(m.Rates, shipping.Rate{Zone: parts[0], MaxWeight: weight, Price: price})
+			}
+
+			if err := m.Save(ctx); err != nil {
+				slog.LogAttrs(ctx, slog.LevelError, "cannot save the shipping method", slog.String("id", *id), slog.String("error", err.Error()))
+				log.Fatal()
+			}
+
+			slog.LogAttrs(ctx, slog.LevelInfo, "the shipping method is saved", slog.String("id", *id))
+		}
+
+	case "moneymigrate":
+		{
+			flag.Parse()
+
+			if err := money.Migrate(ctx); err != nil {
+				log.Fatal()
 			}
 		}
 
@@ -212,6 +371,41 @@ func main() {
 
 			log.Printf("%s\n", string(pjson))
 		}
+
+	case "productpurge":
+		{
+			pid := flag.String("id", "", "The archived product id")
+
+			flag.Parse()
+
+			vids, err := products.Variants(ctx, *pid)
+			if err != nil {
+				slog.LogAttrs(ctx, slog.LevelError, "cannot get the variants", slog.String("id", *pid), slog.String("error", err.Error()))
+				log.Fatal()
+			}
+
+			archived, err := products.ArchivedVariants(ctx, *pid)
+			if err != nil {
+				slog.LogAttrs(ctx, slog.LevelError, "cannot get the archived variants", slog.String("id", *pid), slog.String("error", err.Error()))
+				log.Fatal()
+			}
+
+			pids := []string{*pid}
+			for _, v := range append(vids, archived...) {
+				pids = append(pids, v.ID)
+			}
+
+			// The past orders keep their products
+			if err := orders.SnapshotMissing(ctx, pids); err != nil {
+				slog.LogAttrs(ctx, slog.LevelError, "cannot snapshot the ordered products", slog.String("id", *pid), slog.String("error", err.Error()))
+				log.Fatal()
+			}
+
+			if err := products.Purge(ctx, *pid); err != nil {
+				slog.LogAttrs(ctx, slog.LevelError, "cannot purge the product", slog.String("id", *pid), slog.String("error", err.Error()))
+				log.Fatal()
+			}
+		}
 	default:
 		{
 			slog.LogAttrs(ctx, slog.LevelError, "the command is not supported", slog.String("command", command))
@@ -9,6 +9,7 @@ import (
 	"artisons/db"
 	"artisons/http/contexts"
 	"artisons/locales"
+	"artisons/money"
 	"artisons/products"
 	"artisons/string/stringutil"
 	"io"
@@ -18,8 +19,10 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
@@ -33,16 +36,18 @@ const ititle = 1
 const iprice = 3
 const islug = 2
 
-// const icurrency = 4
+const icurrency = 4
 const iquantity = 5
 const istatus = 6
 const idescription = 7
 const iimages = 8
 const iweight = 9
 const itags = 10
-
-// const ilinks = 11
+const ilinks = 11
 const ioptions = 12
+const ipublishat = 13
+const iunpublishat = 14
+const dateLayout = "2006-01-02 15:04"
 const cellSeparator = ";"
 const optionSeparator = ":"
 const requiredFields = 9
@@ -198,37 +203,56 @@ func parseCsvLine(line []string) (products.Product, error) {
 		return products.Product{}, errors.New(printer.Sprintf("the csv is invalid"))
 	}
 
-	price, priceErr := strconv.ParseFloat(line[iprice], 32)
+	price, priceErr := money.Parse(line[iprice])
 	if priceErr != nil {
-		slog.Error("cannot parse the price", slog.Float64("price", price), slog.String("error", priceErr.Error()))
+		slog.Error("cannot parse the price", slog.String("price", line[iprice]), slog.String("error", priceErr.Error()))
 		return products.Product{}, errors.New(printer.Sprintf("input:price", "price"))
 	}
 
+	prices := map[string]money.Money{}
+	if line[icurrency] != "" && line[icurrency] != conf.Currency {
+		for _, v := range strings.Split(line[icurrency], cellSeparator) {
+			parts := strings.Split(v, optionSeparator)
+			if len(parts) != 2 || !money.Supported(parts[0]) {
+				slog.Info("cannot parse the currency", slog.String("currency", v))
+				return products.Product{}, errors.New(printer.Sprintf("input:currency", "currency"))
+			}
+
+			p, err := money.Parse(parts[1])
+			if err != nil {
+				slog.Error("cannot parse the price", slog.String("price", v), slog.String("error", err.Error()))
+				return products.Product{}, errors.New(printer.Sprintf("input:currency", "currency"))
+			}
+
+			prices[parts[0]] = p.WithCurrency(parts[0])
+		}
+	}
+
 	quantity, quantityErr := strconv.ParseInt(line[iquantity], 10, 32)
 	if quantityErr != nil {
 		slog.Error("cannot parse the quantity", slog.Int64("quantity", quantity), slog.String("error", quantityErr.Error()))
 		return products.Product{}, errors.New(printer.Sprintf("input:quantity", "quantity"))
 	}
 
-	images := strings.Split(line[iimages], ";")
-	if len(images) == 0 {
+	files := strings.Split(line[iimages], ";")
+	if len(files) == 0 {
 		slog.Info("cannot parse the empty images")
-		return products.Product{}, errors.New("input:image_1")
+		return products.Product{}, errors.New("input:images")
 	}
 
-	var iids []string
-	for index, v := range images {
+	var images []products.Image
+	for index, v := range files {
 		iid, err := getFile(v)
 		if err != nil {
 			slog.Error("cannot get the file", slog.String("error", err.Error()))
-			return products.Product{}, errors.New(printer.Sprintf("input:image_%d", index))
+			return products.Product{}, errors.New(printer.Sprintf("input:images_%d", index))
 		}
 
-		iids = append(iids, iid)
+		images = append(images, products.Image{ID: iid, Alt: map[string]string{}})
 	}
 
-	if len(iids) != len(images) {
-		slog.Info("cannot parse the images", slog.Int("length", len(iids)), slog.Int("images", len(images)))
+	if len(images) != len(files) {
+		slog.Info("cannot parse the images", slog.Int("length", len(images)), slog.Int("files", len(files)))
 		return products.Product{}, errors.New(printer.Sprintf("input:images", "images"))
 	}
 
@@ -251,10 +275,23 @@ func parseCsvLine(line []string) (products.Product, error) {
 		tags = strings.Split(line[itags], cellSeparator)
 	}
 
-	// var links []string
-	// if length > ilinks && line[ilinks] != "" {
-	// 	links = strings.Split(line[ilinks], cellSeparator)
-	// }
+	links := map[string][]string{}
+	if length > ilinks && line[ilinks] != "" {
+		for _, v := range strings.Split(line[ilinks], cellSeparator) {
+			kind, id := products.LinkRelated, v
+
+			if parts := strings.Split(v, optionSeparator); len(parts) == 2 {
+				kind, id = parts[0], parts[1]
+			}
+
+			if !slices.Contains(products.LinkKinds, kind) || id == "" {
+				slog.Info("cannot parse the link", slog.String("link", v))
+				return products.Product{}, errors.New(printer.Sprintf("input:links", "links"))
+			}
+
+			links[kind] = append(links[kind], id)
+		}
+	}
 
 	options := make(map[string][]string)
 	if length > ioptions && line[ioptions] != "" {
@@ -279,19 +316,37 @@ func parseCsvLine(line []string) (products.Product, error) {
 		}
 	}
 
+	dates := map[string]time.Time{}
+	for key, index := range map[string]int{"publish_at": ipublishat, "unpublish_at": iunpublishat} {
+		if length <= index || line[index] == "" {
+			continue
+		}
+
+		d, err := time.ParseInLocation(dateLayout, line[index], time.Local)
+		if err != nil {
+			slog.Error("cannot parse the date", slog.String(key, line[index]), slog.String("error", err.Error()))
+			return products.Product{}, errors.New("input:" + key)
+		}
+
+		dates[key] = d
+	}
+
 	product := products.Product{
 		Sku:         line[isku],
 		Title:       strings.ReplaceAll(line[ititle], "\"", ""),
 		Description: strings.ReplaceAll(line[idescription], "\"", ""),
 		Price:       price,
+		Prices:      prices,
 		Quantity:    int(quantity),
 		Status:      line[istatus],
 		Weight:      weight,
 		Tags:        tags,
 		Slug:        line[islug],
-		// Links:       links,
-		Meta:   options,
-		Image1: iids[0],
+		Links:       links,
+		Meta:        options,
+		Images:      images,
+		PublishAt:   dates["publish_at"],
+		UnpublishAt: dates["unpublish_at"],
 	}
 
 	ctx := context.WithValue(context.Background(), contexts.Locale, language.English)
@@ -304,71 +359,33 @@ func parseCsvLine(line []string) (products.Product, error) {
 	return product, nil
 }
 
-func deletePreviousImages(ctx context.Context, pid string) error {
-	l := slog.With(slog.String("id", pid))
+// deletePreviousImages removes the files of the images
+// replaced by the import.
+func deletePreviousImages(ctx context.Context, previous, product products.Product) {
+	l := slog.With(slog.String("id", product.ID))
 	l.Info("deleting previous images")
 
-	key := "product:" + pid
-
-	v, err := db.Redis.HGet(ctx, key, "images").Result()
+	// The files shared with the variants are kept
+	removed, err := products.UnusedImages(ctx, product.ID, "", products.RemovedImages(previous.Images, product.Images))
 	if err != nil {
-		l.Error("cannot store the product", slog.String("error", err.Error()))
-		return errors.New(printer.Sprintf("something went wrong"))
-	}
-
-	img, err := strconv.Atoi(v)
-	if err != nil {
-		l.Error("cannot convert the index", slog.String("index", v), slog.String("error", err.Error()))
-		return errors.New(printer.Sprintf("something went wrong"))
+		l.Error("cannot get the unused images", slog.String("error", err.Error()))
+		return
 	}
 
-	for i := 0; i < img; i++ {
-		p := products.ImagePath(pid)
-
-		if err := os.Rename(v, p); err != nil {
-			l.Error("cannot remove the image", slog.String("path", p), slog.String("error", err.Error()))
-			return errors.New(printer.Sprintf("something went wrong"))
-		}
-	}
+	products.DeleteImageFiles(ctx, removed)
 
 	l.Info("previous images deleted")
-
-	return nil
 }
 
+// createImages moves the downloaded images
+// from the temporary folder to the imgproxy folder.
 func createImages(product products.Product) error {
 	l := slog.With(slog.String("id", product.ID))
 	l.Info("creating previous images")
 
-	if product.Image1 != "" {
-		p := products.ImagePath(product.Image1)
-		old := path.Join(conf.WorkingSpace, "web", "tmp", product.Image1)
-		if err := os.Rename(old, p); err != nil {
-			l.Error("cannot move the file", slog.String("old", old), slog.String("new", p), slog.String("error", err.Error()))
-			return errors.New(printer.Sprintf("something went wrong"))
-		}
-	}
-
-	if product.Image2 != "" {
-		p := products.ImagePath(product.Image2)
-		old := path.Join(conf.WorkingSpace, "web", "tmp", product.Image2)
-		if err := os.Rename(old, p); err != nil {
-			l.Error("cannot move the file", slog.String("old", old), slog.String("new", p), slog.String("error", err.Error()))
-			return errors.New(printer.Sprintf("something went wrong"))
-		}
-	}
-
-	if product.Image3 != "" {
-		p := products.ImagePath(product.Image3)
-		old := path.Join(conf.WorkingSpace, "web", "tmp", product.Image3)
-		if err := os.Rename(old, p); err != nil {
-			l.Error("cannot move the file", slog.String("old", old), slog.String("new", p), slog.String("error", err.Error()))
-			return errors.New(printer.Sprintf("something went wrong"))
-		}
-	}
-	if product.Image4 != "" {
-		p := products.ImagePath(product.Image4)
-		old := path.Join(conf.WorkingSpace, "web", "tmp", product.Image4)
+	for _, image := range product.Images {
+		p := products.ImagePath(image.ID)
+		old := path.Join(conf.WorkingSpace, "web", "tmp", image.ID)
 		if err := os.Rename(old, p); err != nil {
 			l.Error("cannot move the file", slog.String("old", old), slog.String("new", p), slog.String("error", err.Error()))
 			return errors.New(printer.Sprintf("something went wrong"))
@@ -380,30 +397,15 @@ func createImages(product products.Product) error {
 	return nil
 }
 
+// removeTmpFiles removes the downloaded images
+// from the temporary folder.
 func removeTmpFiles(product products.Product) {
 	slog.Info("remove temporary images")
 
-	if product.Image1 != "" {
-		if err := os.Remove(product.Image1); err != nil {
-			slog.Error("cannot move the file", slog.String("old", product.Image1), slog.String("error", err.Error()))
-		}
-	}
-
-	if product.Image2 != "" {
-		if err := os.Remove(product.Image2); err != nil {
-			slog.Error("cannot move the file", slog.String("old", product.Image2), slog.String("error", err.Error()))
-		}
-	}
-
-	if product.Image3 != "" {
-		if err := os.Remove(product.Image3); err != nil {
-			slog.Error("cannot move the file", slog.String("old", product.Image3), slog.String("error", err.Error()))
-		}
-	}
-
-	if product.Image4 != "" {
-		if err := os.Remove(product.Image4); err != nil {
-			slog.Error("cannot move the file", slog.String("old", product.Image4), slog.String("error", err.Error()))
+	for _, image := range product.Images {
+		p := path.Join(conf.WorkingSpace, "web", "tmp", image.ID)
+		if err := os.Remove(p); err != nil {
+			slog.Error("cannot remove the file", slog.String("old", p), slog.String("error", err.Error()))
 		}
 	}
 
@@ -439,6 +441,7 @@ func processLine(chans chan<- int, i int, mid string, line []string) {
 	}
 
 	var pid string
+	var previous products.Product
 
 	if exists == 0 {
 		pid, err = stringutil.Random()
@@ -452,12 +455,8 @@ func processLine(chans chan<- int, i int, mid string, line []string) {
 			catchError(err)
 			return
 		}
-	}
 
-	if pid != "" {
-		deletePreviousImages(ctx, pid)
-	} else {
-		pid, err = stringutil.Random()
+		previous, err = products.Find(ctx, pid)
 		if err != nil {
 			catchError(err)
 			return
@@ -476,6 +475,13 @@ func processLine(chans chan<- int, i int, mid string, line []string) {
 		return
 	}
 
+	// The sku mapping finds the product on the next imports
+	if _, err = db.Redis.Set(ctx, key, pid, 0).Result(); err != nil {
+		l.Error("cannot store the sku mapping", slog.String("key", key), slog.String("error", err.Error()))
+	}
+
+	deletePreviousImages(ctx, previous, product)
+
 	chans <- 1
 }
 
@@ -484,14 +490,18 @@ func processLine(chans chan<- int, i int, mid string, line []string) {
 //   - sku: the unique reference (per merchant)
 //   - title: the product title
 //   - price: the product price
-//   - currency: the product currency
+//   - currency: the product prices in the other shop currencies, with
+//     couples currency/price separated by ":", like "CHF:12.90;GBP:10.50".
+//     The shop currency or an empty value means no other price.
 //   - quantity: the product quantity
 //   - status: the product status "online" or "offline"
 //   - description: the product description
 //   - images: the product images
 //   - weight: the product weight in grams (optional)
 //   - tags: the product tags or categories (optional)
-//   - links: the product ids linked to the product
+//   - links: the product ids linked to the product. A link is a couple
+//     kind/id separated by ":", like "upsell:PID1", the kind is "related" by default.
+//     The kinds are "variant", "related", "accessory" and "upsell".
 //   - options: the product options. An option is a couple name/value separated by ":"
 //
 // The separator used inside a cell is ";". If a cell contains a comma, if has to be surrounded
@@ -504,7 +514,7 @@ func processLine(chans chan<- int, i int, mid string, line []string) {
 //   - the field number parsing is invalid
 //
 // If a product link references a non existing product id, it will be ignored when the
-// product details will be displayed.
+// product details will be displayed, and removed.
 func Import(data [][]string, mid string) (int, error) {
 	slog.Info("importing the data", slog.String("mid", mid))
 
@@ -10,10 +10,10 @@ import (
 const image = "https://upload.wikimedia.org/wikipedia/commons/c/ca/1x1.png"
 
 var line = []string{
-	"123456", "Product", "product", "12.4", "EUR", "1", "online", "Best product", image, "164", "gifts;garden", "1234", "color:blue",
+	"123456", "Product", "product", "12.4", "EUR", "1", "online", "Best product", image, "164", "gifts;garden", "1234", "color:blue", "", "",
 }
 
-var header = []string{"sku", "title", "price", "currency", "quantity", "status", "description", "images", "weight", "tags", "links", "options"}
+var header = []string{"sku", "title", "price", "currency", "quantity", "status", "description", "images", "weight", "tags", "links", "options", "publish_at", "unpublish_at"}
 
 func TestImport(t *testing.T) {
 	var tests = []struct {
@@ -79,6 +79,13 @@ func TestImport(t *testing.T) {
 			0,
 			nil,
 		},
+		{
+			"currency invalid",
+			func(h []string) []string { return h },
+			func(l []string) []string { l[4] = "USD:12.90"; return l },
+			0,
+			nil,
+		},
 		{
 			"quantiy missing",
 			func(h []string) []string { return h },
@@ -181,6 +188,37 @@ func TestImport(t *testing.T) {
 			0,
 			nil,
 		},
+		{
+			"publish date invalid",
+			func(h []string) []string { return h },
+			func(l []string) []string {
+				l[13] = "toto"
+				return l
+			},
+			0,
+			nil,
+		},
+		{
+			"unpublish date before publish date",
+			func(h []string) []string { return h },
+			func(l []string) []string {
+				l[13] = "2030-02-01 10:00"
+				l[14] = "2030-01-01 10:00"
+				return l
+			},
+			0,
+			nil,
+		},
+		{
+			"link kind invalid",
+			func(h []string) []string { return h },
+			func(l []string) []string {
+				l[11] = "toto:1234"
+				return l
+			},
+			0,
+			nil,
+		},
 		{
 			"count=1",
 			func(h []string) []string { return h },
@@ -220,6 +258,27 @@ func TestImport(t *testing.T) {
 			1,
 			nil,
 		},
+		{
+			"link kind",
+			func(h []string) []string { return h },
+			func(l []string) []string {
+				l[11] = "upsell:1234;accessory:5678"
+				return l
+			},
+			1,
+			nil,
+		},
+		{
+			"publication dates",
+			func(h []string) []string { return h },
+			func(l []string) []string {
+				l[13] = "2030-01-01 10:00"
+				l[14] = "2030-02-01 10:00"
+				return l
+			},
+			1,
+			nil,
+		},
 		{
 			"no weight",
 			func(h []string) []string { return h },
@@ -75,6 +75,24 @@ func Run(ctx context.Context, args []interface{}) error {
 	return err
 }
 
+// Scan returns the keys matching the pattern,
+// like cart:*, without blocking Redis as KEYS does.
+func Scan(ctx context.Context, match string) ([]string, error) {
+	keys := []string{}
+
+	iter := Redis.Scan(ctx, 0, match, 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+
+	if err := iter.Err(); err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot scan the keys", slog.String("match", match), slog.String("error", err.Error()))
+		return []string{}, err
+	}
+
+	return keys, nil
+}
+
 func SplitQuery(ctx context.Context, s string) ([]interface{}, error) {
 	args := []interface{}{}
 	r := csv.NewReader(strings.NewReader(s))
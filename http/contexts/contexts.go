@@ -29,3 +29,6 @@ const Tracking ContextKey = "tracking"
 
 // ThrowsWhenPaymentFailed placed in the context is easier for testing
 const ThrowsWhenPaymentFailed ContextKey = "throws-when-payment-failed"
+
+// Currency is the context key used to store the customer currency
+const Currency ContextKey = "currency"
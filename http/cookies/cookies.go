@@ -4,3 +4,4 @@ const SessionID = "wsid"
 const CartID = "cid"
 const Device = "did"
 const FlashMessage = "flash"
+const Currency = "currency"
@@ -15,6 +15,8 @@ import (
 	"time"
 )
 
+// upload stores the file in the imgproxy folder and returns
+// its path relative to the imgproxy folder, like products/123.jpg.
 func upload(ctx context.Context, file multipart.File, header *multipart.FileHeader, filename, folder string) (string, error) {
 	slog.LogAttrs(ctx, slog.LevelInfo, "uploading image", slog.String("image", header.Filename), slog.Int64("size", header.Size), slog.Any("headers", header.Header))
 
@@ -41,7 +43,7 @@ func upload(ctx context.Context, file multipart.File, header *multipart.FileHead
 		return "", fmt.Errorf("input:%s", filename)
 	}
 
-	return filepath, nil
+	return path.Join(folder, filepath), nil
 }
 
 func Upload(r *http.Request, folder string, images []string) ([]string, error) {
@@ -75,6 +77,41 @@ func Upload(r *http.Request, folder string, images []string) ([]string, error) {
 	return filepaths, nil
 }
 
+// UploadAll stores all the files sent in the field,
+// in the form order, and returns their paths.
+// If a file cannot be stored, the files already
+// stored are removed.
+func UploadAll(r *http.Request, folder string, field string) ([]string, error) {
+	ctx := r.Context()
+	filepaths := []string{}
+
+	if r.MultipartForm == nil {
+		return filepaths, nil
+	}
+
+	for _, header := range r.MultipartForm.File[field] {
+		file, err := header.Open()
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "cannot open the form file", slog.String("field", field), slog.String("error", err.Error()))
+			RollbackUpload(ctx, filepaths)
+			return []string{}, fmt.Errorf("input:%s", field)
+		}
+
+		filepath, err := upload(ctx, file, header, field, folder)
+		file.Close()
+
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "cannot upload the form file", slog.String("field", field))
+			RollbackUpload(ctx, filepaths)
+			return []string{}, err
+		}
+
+		filepaths = append(filepaths, filepath)
+	}
+
+	return filepaths, nil
+}
+
 func RollbackUpload(ctx context.Context, images []string) {
 	for _, value := range images {
 		if value == "" {
@@ -0,0 +1,329 @@
+// Package invoices manages the invoices created when an order
+// is paid. The invoice numbers are sequential per merchant,
+// without gap, as required by the French law.
+package invoices
+
+import (
+	"artisons/addresses"
+	"artisons/conf"
+	"artisons/db"
+	"artisons/money"
+	"artisons/shops"
+	"artisons/taxes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+type Line struct {
+	Title    string
+	Sku      string
+	Quantity int
+
+	// The unit price, as entered in the shop
+	Price money.Money
+}
+
+type Invoice struct {
+	// The invoice number, like 1234-000001
+	Number string
+
+	// The merchant ID
+	MID string
+
+	// The order ID
+	OID string
+
+	Contact shops.Contact
+
+	// The billing address
+	Customer addresses.Address
+
+	// The shipping address, displayed when
+	// it differs from the billing one
+	Shipping addresses.Address
+
+	Lines []Line
+
+	DeliveryFees money.Money
+
+	// The promotion code and its discount, taxes included
+	Promotion string
+	Discount  money.Money
+
+	// The total, taxes included
+	Total money.Money
+
+	// The VAT breakdown per rate
+	Taxes taxes.Breakdown
+
+	CreatedAt time.Time
+}
+
+// numberScript allocates the next invoice number of the merchant
+// and stores the invoice in the same step, so a number
+// cannot be lost.
+// If the order already has an invoice, its number is returned.
+// KEYS[1] is the order hash, KEYS[2] the merchant counter.
+// ARGV are the merchant id, the order id, the total,
+// the VAT breakdown, the creation date and the currency.
+// It returns the number and 1 if it is allocated now, 0 otherwise.
+var numberScript = redis.NewScript(`
+local existing = redis.call('HGET', KEYS[1], 'invoice')
+if existing then
+	return {existing, 0}
+end
+
+local n = redis.call('INCR', KEYS[2])
+local number = string.format('%s-%06d', ARGV[1], n)
+
+redis.call('HSET', 'invoice:' .. number,
+	'number', number,
+	'mid', ARGV[1],
+	'oid', ARGV[2],
+	'total', ARGV[3],
+	'taxes', ARGV[4],
+	'created_at', ARGV[5],
+	'currency', ARGV[6])
+redis.call('HSET', KEYS[1], 'invoice', number)
+
+return {number, 1}
+`)
+
+// Path returns the PDF path of the invoice
+func Path(number string) string {
+	return path.Join(conf.InvoicesPath, number+".pdf")
+}
+
+// Create allocates the invoice number and writes the PDF.
+// Calling it again for the same order returns the existing
+// invoice, an issued invoice is never written again.
+// The PDF is written again only if the file is missing,
+// with the stored invoice data.
+// The keys are:
+// - invoice:mid:next => the last number of the merchant
+// - invoice:number => the invoice data
+// - order:oid => the invoice number
+func Create(ctx context.Context, inv Invoice) (Invoice, error) {
+	l := slog.With(slog.String("oid", inv.OID), slog.String("mid", inv.MID))
+	l.LogAttrs(ctx, slog.LevelInfo, "creating the invoice")
+
+	if inv.OID == "" || inv.MID == "" {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot create an invoice without order or merchant")
+		return Invoice{}, errors.New("oops the data is not found")
+	}
+
+	if inv.CreatedAt.IsZero() {
+		inv.CreatedAt = time.Now()
+	}
+
+	res, err := numberScript.Run(ctx, db.Redis,
+		[]string{"order:" + inv.OID, fmt.Sprintf("invoice:%s:next", inv.MID)},
+		inv.MID, inv.OID, inv.Total.Minor(), inv.Taxes.Serialize(ctx), inv.CreatedAt.Unix(), inv.Total.Currency,
+	).Slice()
+	if err != nil || len(res) != 2 {
+		l.LogAttrs(ctx, slog.LevelError, "cannot allocate the invoice number", slog.Any("error", err))
+		return Invoice{}, errors.New("something went wrong")
+	}
+
+	number, _ := res[0].(string)
+	created, _ := res[1].(int64)
+
+	inv.Number = number
+	l = l.With(slog.String("number", number))
+
+	if created == 0 {
+		stored, err := Find(ctx, number)
+		if err != nil {
+			return Invoice{}, err
+		}
+
+		inv.Total = stored.Total
+		inv.Taxes = stored.Taxes
+		inv.CreatedAt = stored.CreatedAt
+
+		if _, err := os.Stat(Path(number)); err == nil {
+			l.LogAttrs(ctx, slog.LevelInfo, "the invoice is already issued")
+			return inv, nil
+		}
+	}
+
+	if err := os.MkdirAll(conf.InvoicesPath, 0o750); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot create the invoices folder", slog.String("error", err.Error()))
+		return inv, errors.New("something went wrong")
+	}
+
+	if err := os.WriteFile(Path(number), inv.PDF(), 0o640); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot write the invoice", slog.String("error", err.Error()))
+		return inv, errors.New("something went wrong")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the invoice is created")
+
+	return inv, nil
+}
+
+// Find returns the invoice data, without the lines.
+func Find(ctx context.Context, number string) (Invoice, error) {
+	l := slog.With(slog.String("number", number))
+	l.LogAttrs(ctx, slog.LevelInfo, "finding the invoice")
+
+	if number == "" {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot validate empty number")
+		return Invoice{}, errors.New("oops the data is not found")
+	}
+
+	data, err := db.Redis.HGetAll(ctx, "invoice:"+number).Result()
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot get the invoice", slog.String("error", err.Error()))
+		return Invoice{}, errors.New("something went wrong")
+	}
+
+	if len(data) == 0 {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot find the invoice")
+		return Invoice{}, errors.New("oops the data is not found")
+	}
+
+	total, err := money.ParseMinor(data["total"])
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot parse the total", slog.String("total", data["total"]), slog.String("error", err.Error()))
+		return Invoice{}, errors.New("something went wrong")
+	}
+
+	createdAt, err := strconv.ParseInt(data["created_at"], 10, 64)
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot parse the created at", slog.String("created_at", data["created_at"]), slog.String("error", err.Error()))
+		return Invoice{}, errors.New("something went wrong")
+	}
+
+	if data["currency"] != "" {
+		total = total.WithCurrency(data["currency"])
+	}
+
+	return Invoice{
+		Number:    data["number"],
+		MID:       data["mid"],
+		OID:       data["oid"],
+		Total:     total,
+		Taxes:     taxes.UnSerialize(ctx, data["taxes"]),
+		CreatedAt: time.Unix(createdAt, 0),
+	}, nil
+}
+
+// PDF renders the invoice document
+func (inv Invoice) PDF() []byte {
+	p := message.NewPrinter(language.English)
+	doc := newPdf()
+
+	doc.text(margin, 16, true, inv.Contact.Name)
+	doc.text(350, 16, true, p.Sprintf("Invoice %s", inv.Number))
+	doc.line(20)
+	doc.text(margin, 10, false, inv.Contact.Address)
+	doc.text(350, 10, false, p.Sprintf("Date: %s", inv.CreatedAt.Format("02/01/2006")))
+	doc.line(14)
+	doc.text(margin, 10, false, inv.Contact.Zipcode+" "+inv.Contact.City)
+	doc.text(350, 10, false, p.Sprintf("Order: %s", inv.OID))
+	doc.line(14)
+	doc.text(margin, 10, false, inv.Contact.Phone)
+	doc.line(14)
+	doc.text(margin, 10, false, inv.Contact.Email)
+	doc.line(30)
+
+	c := inv.Customer
+	doc.text(350, 10, true, c.Firstname+" "+c.Lastname)
+	doc.line(14)
+	doc.text(350, 10, false, c.Street)
+	doc.line(14)
+
+	if c.Complementary != "" {
+		doc.text(350, 10, false, c.Complementary)
+		doc.line(14)
+	}
+
+	doc.text(350, 10, false, c.Zipcode+" "+c.City)
+	doc.line(40)
+
+	if s := inv.Shipping; !s.IsZero() && s != c {
+		doc.text(350, 10, true, p.Sprintf("Shipping address"))
+		doc.line(14)
+		doc.text(350, 10, false, s.Firstname+" "+s.Lastname)
+		doc.line(14)
+		doc.text(350, 10, false, s.Street)
+		doc.line(14)
+
+		if s.Complementary != "" {
+			doc.text(350, 10, false, s.Complementary)
+			doc.line(14)
+		}
+
+		doc.text(350, 10, false, s.Zipcode+" "+s.City)
+		doc.line(40)
+	}
+
+	doc.text(margin, 10, true, p.Sprintf("Product"))
+	doc.text(330, 10, true, p.Sprintf("Quantity"))
+	doc.text(400, 10, true, p.Sprintf("Unit price"))
+	doc.text(480, 10, true, p.Sprintf("Total"))
+	doc.line(6)
+	doc.rule()
+	doc.line(12)
+
+	for _, line := range inv.Lines {
+		title := line.Title
+		if line.Sku != "" {
+			title += " (" + line.Sku + ")"
+		}
+
+		doc.text(margin, 10, false, title)
+		doc.text(330, 10, false, fmt.Sprintf("%d", line.Quantity))
+		doc.text(400, 10, false, fmt.Sprintf("%s %s", line.Price, inv.Total.Currency))
+		doc.text(480, 10, false, fmt.Sprintf("%s %s", line.Price.Mul(line.Quantity), inv.Total.Currency))
+		doc.line(14)
+	}
+
+	if inv.Discount.Amount > 0 {
+		doc.text(margin, 10, false, p.Sprintf("Coupon %s", inv.Promotion))
+		doc.text(480, 10, false, fmt.Sprintf("-%s %s", inv.Discount, inv.Total.Currency))
+		doc.line(14)
+	}
+
+	if inv.DeliveryFees.Amount > 0 {
+		doc.text(margin, 10, false, p.Sprintf("Delivery fees"))
+		doc.text(480, 10, false, fmt.Sprintf("%s %s", inv.DeliveryFees, inv.Total.Currency))
+		doc.line(14)
+	}
+
+	doc.line(6)
+	doc.rule()
+	doc.line(12)
+
+	doc.text(margin, 10, true, p.Sprintf("VAT rate"))
+	doc.text(330, 10, true, p.Sprintf("Net"))
+	doc.text(400, 10, true, p.Sprintf("VAT"))
+	doc.text(480, 10, true, p.Sprintf("Gross"))
+	doc.line(14)
+
+	for _, v := range inv.Taxes.Lines {
+		doc.text(margin, 10, false, fmt.Sprintf("%.2f %%", v.Rate))
+		doc.text(330, 10, false, fmt.Sprintf("%s %s", v.Net, inv.Total.Currency))
+		doc.text(400, 10, false, fmt.Sprintf("%s %s", v.Tax, inv.Total.Currency))
+		doc.text(480, 10, false, fmt.Sprintf("%s %s", v.Gross, inv.Total.Currency))
+		doc.line(14)
+	}
+
+	doc.line(10)
+	doc.text(400, 12, true, p.Sprintf("Total"))
+	doc.text(480, 12, true, fmt.Sprintf("%s %s", inv.Total, inv.Total.Currency))
+	doc.line(14)
+
+	return doc.bytes()
+}
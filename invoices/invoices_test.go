@@ -0,0 +1,114 @@
+package invoices
+
+import (
+	"artisons/money"
+	"artisons/taxes"
+	"artisons/tests"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"testing"
+)
+
+var cur string
+
+func init() {
+	_, filename, _, _ := runtime.Caller(0)
+	cur = path.Dir(filename) + "/"
+}
+
+var invoice = Invoice{
+	MID:   "TEST",
+	OID:   "INV1",
+	Total: money.New(12000),
+	Taxes: taxes.Compute([]taxes.Item{{Rate: 20, Amount: money.New(12000)}}, true),
+	Lines: []Line{{Title: "T-shirt Tester c’est douter", Sku: "SKU1", Quantity: 2, Price: money.New(6000)}},
+}
+
+func TestCreate(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/invoices.redis")
+
+	second := invoice
+	second.OID = "INV2"
+
+	var tests = []struct {
+		name   string
+		inv    Invoice
+		number string
+		err    error
+	}{
+		{"oid=INV1", invoice, "TEST-000001", nil},
+		{"oid=INV1 again", invoice, "TEST-000001", nil},
+		{"oid=INV2", second, "TEST-000002", nil},
+		{"oid=", Invoice{MID: "TEST"}, "", errors.New("oops the data is not found")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv, err := Create(ctx, tt.inv)
+			if fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+
+			if inv.Number != tt.number {
+				t.Fatalf(`inv.Number = %s, want %s`, inv.Number, tt.number)
+			}
+		})
+	}
+
+	// An issued invoice is not written again
+	before, err := os.ReadFile(Path("TEST-000001"))
+	if err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	changed := invoice
+	changed.Total = money.New(1)
+	if _, err := Create(ctx, changed); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if after, _ := os.ReadFile(Path("TEST-000001")); !bytes.Equal(before, after) {
+		t.Fatalf(`the invoice TEST-000001 is written again`)
+	}
+
+	inv, err := Find(ctx, "TEST-000002")
+	if err != nil || inv.OID != "INV2" {
+		t.Fatalf(`inv.OID = %s, err = %v, want INV2, nil`, inv.OID, err)
+	}
+
+	if len(inv.Taxes.Lines) != 1 || inv.Taxes.Net.Amount != 10000 || inv.Taxes.Tax.Amount != 2000 {
+		t.Fatalf(`inv.Taxes = %v, want net 100 and tax 20`, inv.Taxes)
+	}
+}
+
+func TestPDF(t *testing.T) {
+	doc := invoice.PDF()
+
+	if !bytes.HasPrefix(doc, []byte("%PDF-1.4")) || !bytes.HasSuffix(doc, []byte("%%EOF\n")) {
+		t.Fatalf(`the document is not a PDF`)
+	}
+
+	if !bytes.Contains(doc, []byte("(SKU1)")) && !bytes.Contains(doc, []byte("\\(SKU1\\)")) {
+		t.Fatalf(`the document does not contain the lines`)
+	}
+}
+
+func TestPDFShipping(t *testing.T) {
+	inv := invoice
+	inv.Shipping = inv.Customer
+	inv.Shipping.Street = "3 rue de la gare"
+
+	if doc := inv.PDF(); !bytes.Contains(doc, []byte("(3 rue de la gare)")) {
+		t.Fatalf(`the document does not contain the shipping address`)
+	}
+
+	if doc := invoice.PDF(); bytes.Contains(doc, []byte("(Shipping address)")) {
+		t.Fatalf(`the document contains the shipping address, want only the billing one`)
+	}
+}
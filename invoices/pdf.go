@@ -0,0 +1,121 @@
+package invoices
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// The page size is A4 in PDF points
+const (
+	pageWidth  = 595.0
+	pageHeight = 842.0
+	margin     = 50.0
+)
+
+// pdf is a minimal PDF writer supporting text only,
+// with the standard Helvetica fonts, so no font file
+// has to be embedded.
+type pdf struct {
+	pages []*bytes.Buffer
+
+	// y is the current vertical position on the last page
+	y float64
+}
+
+func newPdf() *pdf {
+	p := &pdf{}
+	p.addPage()
+
+	return p
+}
+
+func (p *pdf) addPage() {
+	p.pages = append(p.pages, new(bytes.Buffer))
+	p.y = pageHeight - margin
+}
+
+var winAnsi = encoding.ReplaceUnsupported(charmap.Windows1252.NewEncoder())
+
+// escape converts the text to WinAnsi and escapes
+// the PDF string delimiters.
+func escape(s string) string {
+	enc, err := winAnsi.String(s)
+	if err != nil {
+		enc = s
+	}
+
+	r := strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`, "\r", "", "\n", " ")
+
+	return r.Replace(enc)
+}
+
+// text writes the text at the x position on the current line.
+func (p *pdf) text(x float64, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+
+	fmt.Fprintf(p.pages[len(p.pages)-1], "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, p.y, escape(s))
+}
+
+// line moves to the next line and adds a new page
+// when the bottom margin is reached.
+func (p *pdf) line(height float64) {
+	p.y -= height
+
+	if p.y < margin {
+		p.addPage()
+	}
+}
+
+// rule draws an horizontal line on the current line.
+func (p *pdf) rule() {
+	fmt.Fprintf(p.pages[len(p.pages)-1], "%.2f %.2f m %.2f %.2f l S\n", margin, p.y+4, pageWidth-margin, p.y+4)
+}
+
+// bytes returns the PDF document.
+// The objects are:
+// 1 the catalog, 2 the page tree, 3 and 4 the fonts,
+// then a page and its content for each page.
+func (p *pdf) bytes() []byte {
+	buf := new(bytes.Buffer)
+	offsets := []int{}
+
+	obj := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+
+	kids := []string{}
+	for i := range p.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 5+i*2))
+	}
+
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range p.pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", pageWidth, pageHeight, 6+i*2))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+
+	for _, offset := range offsets {
+		fmt.Fprintf(buf, "%010d 00000 n \n", offset)
+	}
+
+	fmt.Fprintf(buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return buf.Bytes()
+}
@@ -14,6 +14,13 @@ func LoadEn() {
 	message.SetString(language.English, "the payment method is not allowed", "The payment method is not allowed.")
 	message.SetString(language.English, "some products are not available anymore", "Some products are not available anymore.")
 	message.SetString(language.English, "the cart does not exist", "The cart does not exist.")
+	message.SetString(language.English, "the product is not available in this currency", "The product is not available in this currency.")
+	message.SetString(language.English, "the order must contain only one currency", "The order must contain only one currency.")
+	message.SetString(language.English, "the coupon is not valid", "The coupon is not valid.")
+	message.SetString(language.English, "the coupon usage limit is reached", "The coupon usage limit is reached.")
+	message.SetString(language.English, "the coupon minimum amount is not reached", "The coupon minimum amount is not reached.")
+	message.SetString(language.English, "the coupon does not apply to the cart products", "The coupon does not apply to the cart products.")
+	message.SetString(language.English, "you need to be logged to use this coupon", "You need to be logged to use this coupon.")
 	message.SetString(language.English, "the data is not found", "The data is not found.")
 	message.SetString(language.English, "the data is invalid", "The data is invalid.")
 	message.SetString(language.English, "the session is expired", "Your session is expired, please refresh your page.")
@@ -43,20 +50,34 @@ func LoadEn() {
 	message.SetString(language.English, "card", "Card")
 	message.SetString(language.English, "bitcoin", "Bitcoin")
 	message.SetString(language.English, "wire", "Wire")
+	message.SetString(language.English, "fake", "Fake payment")
+	message.SetString(language.English, "fake_description", "The payment is confirmed later by the fake provider.")
 	message.SetString(language.English, "collect", "Collect")
 	message.SetString(language.English, "home", "Home")
 
 	// Emails
 	message.SetString(language.English, "email_order_confirmation", "Hi %s,\nWoo hoo! Your order is on its way. Your order details can be found below.\n")
 	message.SetString(language.English, "email_order_confirmationdate", "Order date: %s\n")
+	message.SetString(language.English, "email_order_confirmationguest", "You can follow your order at %s with the order ID and this email, or create an account with this email to find all your orders.\n\n")
 	message.SetString(language.English, "email_order_confirmationfooter", "\nSee you around,\nThe Customer Experience Team at artisons shop")
 	message.SetString(language.English, "email_order_confirmationid", "Order ID: %s\n")
 	message.SetString(language.English, "email_order_confirmationsummary", "Here is your order summary:\n\n")
-	message.SetString(language.English, "email_order_confirmationtotal", "Order total: %.2f\n\n")
+	message.SetString(language.English, "email_order_confirmationpickup", "Pickup: %s, %s\n")
+	message.SetString(language.English, "email_order_confirmationslot", "Pickup slot: %s\n")
+	message.SetString(language.English, "email_order_confirmationdiscount", "Coupon %s: -%s\n")
+	message.SetString(language.English, "email_order_confirmationtotal", "Order total: %s\n\n")
+	message.SetString(language.English, "email_order_confirmationtax", "VAT %.2f%%: net %s, tax %s, gross %s\n")
 	message.SetString(language.English, "email_otp_login", "Hi,\r\nYou have requested us to send an otp to sign into our application.\r\nPlease use the verification code below to sign in.\r\n\r\n%s\r\n\r\nThe OTP can only be used on the device you initiated the request.\r\nIf you didn't request this, you can ignore this email.\r\n\r\nThanks,\r\nThe support team")
+	message.SetString(language.English, "email_cart_recovery", "Hi,\nYou left some products in your cart:\n\n")
+	message.SetString(language.English, "email_cart_recoveryproduct", "- %d x %s\n")
+	message.SetString(language.English, "email_cart_recoverylink", "\nYour cart is waiting for you at %s\n\n")
+	message.SetString(language.English, "email_cart_recoveryoptout", "You do not want these reminders anymore? %s\n\nSee you around,\nThe Customer Experience Team at artisons shop")
+	message.SetString(language.English, "email_cart_recovery_subject", "Your cart is waiting for you")
 	message.SetString(language.English, "email_otp_subject", "🔒 Your OTP code")
 	message.SetString(language.English, "email_order_subject", "Order confirmation %s")
 	message.SetString(language.English, "email_order_update", "Order update %s")
+	message.SetString(language.English, "email_order_status", "Hi,\nYour order %s is now %s.\n\nSee you around,\nThe Customer Experience Team at artisons shop")
+	message.SetString(language.English, "the status transition is not allowed", "The status cannot be changed to this value.")
 	message.SetString(language.English, "email_order_track", "Track your order by clicking on the following link: %s.\n")
 
 	// Texts
@@ -97,6 +118,32 @@ func LoadEn() {
 	message.SetString(language.English, "Name", "Name")
 	message.SetString(language.English, "Note", "Note")
 	message.SetString(language.English, "Notes", "Notes")
+	message.SetString(language.English, "History", "History")
+	message.SetString(language.English, "Refunds", "Refunds")
+	message.SetString(language.English, "Refund", "Refund")
+	message.SetString(language.English, "Reason", "Reason")
+	message.SetString(language.English, "Amount", "Amount")
+	message.SetString(language.English, "Invoice", "Invoice")
+	message.SetString(language.English, "Download the invoice", "Download the invoice")
+	message.SetString(language.English, "Invoice %s", "Invoice %s")
+	message.SetString(language.English, "Date: %s", "Date: %s")
+	message.SetString(language.English, "Order: %s", "Order: %s")
+	message.SetString(language.English, "Unit price", "Unit price")
+	message.SetString(language.English, "Delivery fees", "Delivery fees")
+	message.SetString(language.English, "Coupon %s", "Coupon %s")
+	message.SetString(language.English, "VAT rate", "VAT rate")
+	message.SetString(language.English, "VAT", "VAT")
+	message.SetString(language.English, "Net", "Net")
+	message.SetString(language.English, "Gross", "Gross")
+	message.SetString(language.English, "Total VAT", "Total VAT")
+	message.SetString(language.English, "Tax class", "Tax class")
+	message.SetString(language.English, "standard", "Standard")
+	message.SetString(language.English, "The tax class defines the VAT rate applied to the product.", "The tax class defines the VAT rate applied to the product.")
+	message.SetString(language.English, "Prices without taxes", "Prices without taxes")
+	message.SetString(language.English, "If enabled, the product prices are entered without taxes and the VAT is added to the cart total.", "If enabled, the product prices are entered without taxes and the VAT is added to the cart total.")
+	message.SetString(language.English, "Leave empty to refund the selected products.", "Leave empty to refund the selected products.")
+	message.SetString(language.English, "pending", "Pending")
+	message.SetString(language.English, "refunded", "Refunded")
 	message.SetString(language.English, "Page views", "Page views")
 	message.SetString(language.English, "Phone", "Phone")
 	message.SetString(language.English, "Offline", "Offline")
@@ -135,6 +182,9 @@ func LoadEn() {
 	message.SetString(language.English, "Please click the link to confirm your address or enter the otp code below.", "Please click the link to confirm your address or enter the otp code below.")
 	message.SetString(language.English, "Check your inbox", "Check your inbox")
 	message.SetString(language.English, "Discount", "Discount")
+	message.SetString(language.English, "The percent discount applied to the prices in all the currencies.", "The percent discount applied to the prices in all the currencies.")
+	message.SetString(language.English, "Discount start date", "Discount start date")
+	message.SetString(language.English, "Discount end date", "Discount end date")
 	message.SetString(language.English, "Most products shared", "Most products shared")
 	message.SetString(language.English, "Most products sold", "Most products sold")
 	message.SetString(language.English, "Most visited pages", "Most visited pages")
@@ -239,5 +289,111 @@ func LoadEn() {
 	message.SetString(language.English, "The URL has to be unique.", "The URL has to be unique.")
 	message.SetString(language.English, "Fill with auto generated value.", "Fill with auto generated value.")
 	message.SetString(language.English, "the delivery is invalid", "The delivery is invalid.")
+	message.SetString(language.English, "the delivery is not available for this address", "The delivery is not available for this address.")
+	message.SetString(language.English, "No delivery is available for this address.", "No delivery is available for this address.")
+	message.SetString(language.English, "Free", "Free")
+	message.SetString(language.English, "Promotions", "Promotions")
+	message.SetString(language.English, "Add promotion", "Add promotion")
+	message.SetString(language.English, "Promotion", "Promotion")
+	message.SetString(language.English, "the promotion exists already", "The promotion exists already.")
+	message.SetString(language.English, "Code", "Code")
+	message.SetString(language.English, "Type", "Type")
+	message.SetString(language.English, "Uses", "Uses")
+	message.SetString(language.English, "Validity", "Validity")
+	message.SetString(language.English, "Percent discount", "Percent discount")
+	message.SetString(language.English, "Fixed discount", "Fixed discount")
+	message.SetString(language.English, "Free shipping", "Free shipping")
+	message.SetString(language.English, "Percent", "Percent")
+	message.SetString(language.English, "Minimum basket", "Minimum basket")
+	message.SetString(language.English, "Usage limit", "Usage limit")
+	message.SetString(language.English, "Usage limit per user", "Usage limit per user")
+	message.SetString(language.English, "Start date", "Start date")
+	message.SetString(language.English, "End date", "End date")
+	message.SetString(language.English, "The coupon code typed by the customer, alphanumeric characters only.", "The coupon code typed by the customer, alphanumeric characters only.")
+	message.SetString(language.English, "Required for the percent discount.", "Required for the percent discount.")
+	message.SetString(language.English, "Required for the fixed discount, in the shop currency.", "Required for the fixed discount, in the shop currency.")
+	message.SetString(language.English, "The minimum amount of the discounted products, in the shop currency.", "The minimum amount of the discounted products, in the shop currency.")
+	message.SetString(language.English, "If defined, only the products with one of these tags are discounted.", "If defined, only the products with one of these tags are discounted.")
+	message.SetString(language.English, "The maximum number of orders using the coupon.", "The maximum number of orders using the coupon.")
+	message.SetString(language.English, "The maximum number of orders per user, the customer has to be logged.", "The maximum number of orders per user, the customer has to be logged.")
+	message.SetString(language.English, "If enabled, the customers can use the coupon in the cart.", "If enabled, the customers can use the coupon in the cart.")
+	message.SetString(language.English, "Pickups", "Pickups")
+	message.SetString(language.English, "Pickup", "Pickup")
+	message.SetString(language.English, "Add pickup location", "Add pickup location")
+	message.SetString(language.English, "the pickup location exists already", "The pickup location exists already.")
+	message.SetString(language.English, "the pickup location is not available", "The pickup location is not available.")
+	message.SetString(language.English, "the pickup slot is not available", "The pickup slot is not available.")
+	message.SetString(language.English, "the pickup slot is full", "The pickup slot is full.")
+	message.SetString(language.English, "Street", "Street")
+	message.SetString(language.English, "Zipcode", "Zipcode")
+	message.SetString(language.English, "Slots", "Slots")
+	message.SetString(language.English, "Slot", "Slot")
+	message.SetString(language.English, "Capacity", "Capacity")
+	message.SetString(language.English, "Opening hours", "Opening hours")
+	message.SetString(language.English, "Choose your pickup location", "Choose your pickup location")
+	message.SetString(language.English, "Full", "Full")
+	message.SetString(language.English, "Alphanumeric characters only.", "Alphanumeric characters only.")
+	message.SetString(language.English, "Displayed to the customer when choosing the pickup location.", "Displayed to the customer when choosing the pickup location.")
+	message.SetString(language.English, "One slot per line, like 2024-06-01 10:00-12:00. If empty, the customer comes during the opening hours.", "One slot per line, like 2024-06-01 10:00-12:00. If empty, the customer comes during the opening hours.")
+	message.SetString(language.English, "The maximum number of orders per slot.", "The maximum number of orders per slot.")
+	message.SetString(language.English, "If enabled, the customers can choose the location for the collect delivery.", "If enabled, the customers can choose the location for the collect delivery.")
+	message.SetString(language.English, "Used to send the order confirmation and to find your order later.", "Used to send the order confirmation and to find your order later.")
+	message.SetString(language.English, "Create an account", "Create an account")
+	message.SetString(language.English, "Create an account to follow your orders, your past orders will be attached to it.", "Create an account to follow your orders, your past orders will be attached to it.")
+	message.SetString(language.English, "Find your order", "Find your order")
+	message.SetString(language.English, "Enter the order number and the email used for the order.", "Enter the order number and the email used for the order.")
+	message.SetString(language.English, "Order number", "Order number")
+	message.SetString(language.English, "Billing address", "Billing address")
+	message.SetString(language.English, "Shipping address", "Shipping address")
+	message.SetString(language.English, "The shipping address is the same as the billing address", "The shipping address is the same as the billing address")
+	message.SetString(language.English, "Ignored when the shipping address is the same as the billing address.", "Ignored when the shipping address is the same as the billing address.")
+	message.SetString(language.English, "Same as the shipping address", "Same as the shipping address")
+	message.SetString(language.English, "Address book", "Address book")
+	message.SetString(language.English, "Add an address", "Add an address")
+	message.SetString(language.English, "No address saved yet.", "No address saved yet.")
+	message.SetString(language.English, "Default billing address", "Default billing address")
+	message.SetString(language.English, "Default shipping address", "Default shipping address")
+	message.SetString(language.English, "Use these addresses", "Use these addresses")
+	message.SetString(language.English, "Delete", "Delete")
+	message.SetString(language.English, "Search", "Search")
+	message.SetString(language.English, "Country", "Country")
+	message.SetString(language.English, "FR", "France")
+	message.SetString(language.English, "BE", "Belgium")
+	message.SetString(language.English, "CH", "Switzerland")
+	message.SetString(language.English, "DE", "Germany")
+	message.SetString(language.English, "Cart reminders", "Cart reminders")
+	message.SetString(language.English, "You will not receive the cart reminders anymore.", "You will not receive the cart reminders anymore.")
+	message.SetString(language.English, "Back to the shop", "Back to the shop")
+	message.SetString(language.English, "the product quantity limit is reached", "The maximum quantity per order is reached for this product.")
+	message.SetString(language.English, "the product is out of stock", "There is no more stock for this product.")
+	message.SetString(language.English, "only %d items were added to the cart", "Only %d items were added to the cart because of the stock or the maximum quantity per order.")
+	message.SetString(language.English, "Maximum quantity per order", "Maximum quantity per order")
+	message.SetString(language.English, "No limit if empty.", "No limit if empty.")
+	message.SetString(language.English, "Variant", "Variant")
+	message.SetString(language.English, "Variants", "Variants")
+	message.SetString(language.English, "Options", "Options")
+	message.SetString(language.English, "Add a variant", "Add a variant")
+	message.SetString(language.English, "Add to cart", "Add to cart")
+	message.SetString(language.English, "A product with variants is sold only through its variants.", "A product with variants is sold only through its variants.")
+	message.SetString(language.English, "the variant exists already", "A variant with these options exists already.")
+	message.SetString(language.English, "links_variant", "Other versions")
+	message.SetString(language.English, "links_related", "Related products")
+	message.SetString(language.English, "links_accessory", "Accessories")
+	message.SetString(language.English, "links_upsell", "You may also like")
+	message.SetString(language.English, "The product ids separated by ;", "The product ids separated by ;")
+	message.SetString(language.English, "Images", "Images")
+	message.SetString(language.English, "Primary image", "Primary image")
+	message.SetString(language.English, "Alternative text", "Alternative text")
+	message.SetString(language.English, "Drag the images to reorder them.", "Drag the images to reorder them.")
+	message.SetString(language.English, "Trash", "Trash")
+	message.SetString(language.English, "Archived at", "Archived at")
+	message.SetString(language.English, "Restore", "Restore")
+	message.SetString(language.English, "The archived products are hidden from the shop and can be restored.", "The archived products are hidden from the shop and can be restored.")
+	message.SetString(language.English, "the product is not archived", "The product is not archived.")
+	message.SetString(language.English, "the product is archived", "The product is archived, restore it first.")
+	message.SetString(language.English, "Publication date", "Publication date")
+	message.SetString(language.English, "Unpublication date", "Unpublication date")
+	message.SetString(language.English, "The product is put online automatically at this date.", "The product is put online automatically at this date.")
+	message.SetString(language.English, "The product is put offline automatically at this date.", "The product is put offline automatically at this date.")
 
 }
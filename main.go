@@ -8,12 +8,16 @@ import (
 	"artisons/carts"
 	"artisons/conf"
 	"artisons/http/contexts"
+	"artisons/http/cookies"
 	"artisons/http/security"
 	"artisons/locales"
 	"artisons/logs"
+	"artisons/money"
 	"artisons/orders"
+	"artisons/pickups"
 	"artisons/products"
 	"artisons/products/filters"
+	"artisons/promotions"
 	"artisons/seo"
 	"artisons/seo/urls"
 	"artisons/shops"
@@ -36,6 +40,13 @@ func handler(next http.Handler) http.Handler {
 		id := uuid.New()
 		ctx := context.WithValue(r.Context(), contexts.RequestID, id.String())
 		ctx = context.WithValue(ctx, contexts.Locale, conf.DefaultLocale)
+
+		currency := ""
+		if c, err := r.Cookie(cookies.Currency); err == nil {
+			currency = c.Value
+		}
+
+		ctx = context.WithValue(ctx, contexts.Currency, money.Negotiate(currency, r.Header.Get("Accept-Language")))
 		ctx = context.WithValue(ctx, contexts.HX, r.Header.Get("HX-Request") == "true")
 		ctx = context.WithValue(ctx, contexts.Tracking, conf.EnableTrackingLog)
 		ctx = context.WithValue(ctx, contexts.ThrowsWhenPaymentFailed, shops.Data.ThrowsWhenPaymentFailed)
@@ -81,7 +92,10 @@ func adminMux() *http.ServeMux {
 	admin.HandleFunc("GET /admin/index", stats.Handler)
 	admin.HandleFunc("GET /admin/products", products.AdminListHandlerHandler)
 	admin.HandleFunc("GET /admin/products/add", products.AdminFormHandler)
+	admin.HandleFunc("GET /admin/products/archives", products.AdminArchivesHandler)
 	admin.HandleFunc("GET /admin/products/{id}/edit", products.AdminFormHandler)
+	admin.HandleFunc("GET /admin/products/{id}/variants/add", products.AdminVariantFormHandler)
+	admin.HandleFunc("GET /admin/products/{id}/variants/{vid}/edit", products.AdminVariantFormHandler)
 	admin.HandleFunc("GET /admin/slug", slughttp.Handler)
 	admin.HandleFunc("GET /admin/blog", blog.AdminListHandler)
 	admin.HandleFunc("GET /admin/blog/add", blog.AdminFormHandler)
@@ -92,8 +106,15 @@ func adminMux() *http.ServeMux {
 	admin.HandleFunc("GET /admin/filters", filters.AdminListHandler)
 	admin.HandleFunc("GET /admin/filters/add", filters.AdminFormHandler)
 	admin.HandleFunc("GET /admin/filters/{id}/edit", filters.AdminFormHandler)
+	admin.HandleFunc("GET /admin/promotions", promotions.AdminListHandler)
+	admin.HandleFunc("GET /admin/promotions/add", promotions.AdminFormHandler)
+	admin.HandleFunc("GET /admin/promotions/{id}/edit", promotions.AdminFormHandler)
+	admin.HandleFunc("GET /admin/pickups", pickups.AdminListHandler)
+	admin.HandleFunc("GET /admin/pickups/add", pickups.AdminFormHandler)
+	admin.HandleFunc("GET /admin/pickups/{id}/edit", pickups.AdminFormHandler)
 	admin.HandleFunc("GET /admin/orders", orders.OrderListHandler)
 	admin.HandleFunc("GET /admin/orders/{id}/edit", orders.OrderFormHandler)
+	admin.HandleFunc("GET /admin/orders/{id}/invoice", orders.OrderInvoiceHandler)
 	admin.HandleFunc("GET /admin/settings", shops.SettingsFormHandler)
 	admin.HandleFunc("GET /admin/seo", seo.AdminListHandler)
 	admin.HandleFunc("GET /admin/seo/{id}/edit", seo.AdminFormHandler)
@@ -101,17 +122,28 @@ func adminMux() *http.ServeMux {
 	admin.HandleFunc("POST /admin/products/add", products.AdminSaveHandler)
 	admin.HandleFunc("POST /admin/products/{id}/edit", products.AdminSaveHandler)
 	admin.HandleFunc("POST /admin/products/{id}/delete", products.AdminDeleteHandler)
+	admin.HandleFunc("POST /admin/products/{id}/restore", products.AdminRestoreHandler)
+	admin.HandleFunc("POST /admin/products/{id}/variants/add", products.AdminVariantSaveHandler)
+	admin.HandleFunc("POST /admin/products/{id}/variants/{vid}/edit", products.AdminVariantSaveHandler)
+	admin.HandleFunc("POST /admin/products/{id}/variants/{vid}/delete", products.AdminVariantDeleteHandler)
 	admin.HandleFunc("POST /admin/tags/add", tags.AdminSaveHandler)
 	admin.HandleFunc("POST /admin/tags/{id}/edit", tags.AdminSaveHandler)
 	admin.HandleFunc("POST /admin/tags/{id}/delete", tags.AdminDeleteHandler)
 	admin.HandleFunc("POST /admin/filters/add", filters.AdminSaveHandler)
 	admin.HandleFunc("POST /admin/filters/{id}/edit", filters.AdminSaveHandler)
 	admin.HandleFunc("POST /admin/filters/{id}/delete", filters.AdminDeleteHandler)
+	admin.HandleFunc("POST /admin/promotions/add", promotions.AdminSaveHandler)
+	admin.HandleFunc("POST /admin/promotions/{id}/edit", promotions.AdminSaveHandler)
+	admin.HandleFunc("POST /admin/promotions/{id}/delete", promotions.AdminDeleteHandler)
+	admin.HandleFunc("POST /admin/pickups/add", pickups.AdminSaveHandler)
+	admin.HandleFunc("POST /admin/pickups/{id}/edit", pickups.AdminSaveHandler)
+	admin.HandleFunc("POST /admin/pickups/{id}/delete", pickups.AdminDeleteHandler)
 	admin.HandleFunc("POST /admin/blog/add", blog.AdminSaveHandler)
 	admin.HandleFunc("POST /admin/blog/{id}/edit", blog.AdminSaveHandler)
 	admin.HandleFunc("POST /admin/blog/{id}/delete", blog.AdminDeleteHandler)
 	admin.HandleFunc("POST /admin/orders/{id}/status", orders.OrderUpdateStatus)
 	admin.HandleFunc("POST /admin/orders/{id}/note", orders.OrderAddNoteHandler)
+	admin.HandleFunc("POST /admin/orders/{id}/refund", orders.OrderRefundHandler)
 	admin.HandleFunc("POST /admin/contact-settings", shops.SettingsContactSave)
 	admin.HandleFunc("POST /admin/shop-settings", shops.SettingsShopSave)
 	admin.HandleFunc("POST /admin/seo/{id}/edit", seo.AdminSaveHandler)
@@ -128,6 +160,7 @@ func websiteMux() *http.ServeMux {
 	web.HandleFunc("GET /cart", carts.Handler)
 	web.HandleFunc("GET /otp", auth.Formhandler)
 	web.HandleFunc("GET /search", website.SearchHandler)
+	web.HandleFunc("GET /orders/lookup", orders.LookupFormHandler)
 	web.HandleFunc("GET /"+urls.Get("product", "url")+"/{slug}", products.ProductHandler)
 	web.HandleFunc("GET /"+urls.Get("terms", "url"), website.StaticHandler)
 	web.HandleFunc("GET /"+urls.Get("about", "url"), website.StaticHandler)
@@ -139,26 +172,63 @@ func websiteMux() *http.ServeMux {
 func accountMux() *http.ServeMux {
 	stat := http.NewServeMux()
 	stat.HandleFunc("GET /account/index", users.AccountHandler)
-	stat.HandleFunc("GET /account/address", users.AddressFormHandler)
+	stat.HandleFunc("GET /account/address", users.AddressesHandler)
+	stat.HandleFunc("GET /account/address/add", users.AddressFormHandler)
+	stat.HandleFunc("GET /account/address/{id}/edit", users.AddressFormHandler)
 	stat.HandleFunc("GET /account/wish", products.WishesHandler)
 
 	account := http.NewServeMux()
 	account.Handle("GET /", stats.Middleware(stat))
 	account.HandleFunc("GET /account/orders", orders.OrdersHandler)
 	account.HandleFunc("GET /account/orders/{id}/detail", orders.OrderHandler)
-	account.HandleFunc("POST /account/address", users.AddressHandler)
+	account.HandleFunc("GET /account/orders/{id}/invoice", orders.AccountInvoiceHandler)
+	account.HandleFunc("POST /account/address/add", users.AddressHandler)
+	account.HandleFunc("POST /account/address/{id}/edit", users.AddressHandler)
+	account.HandleFunc("POST /account/address/{id}/delete", users.AddressDeleteHandler)
 	account.HandleFunc("POST /account/wish/{id}/add", products.WishHandler)
 	account.HandleFunc("POST /account/wish/{id}/delete", products.UnWishHandler)
 
 	return account
 }
 
+// releaseReservations gives back the stock
+// reserved by the expired carts.
+func releaseReservations() {
+	for range time.Tick(time.Minute) {
+		ctx := context.WithValue(context.Background(), contexts.RequestID, "reservations")
+		products.ReleaseExpiredReservations(ctx)
+	}
+}
+
+// publishProducts applies the scheduled publications
+// and unpublications of the products.
+func publishProducts() {
+	for range time.Tick(time.Minute) {
+		ctx := context.WithValue(context.Background(), contexts.RequestID, "schedules")
+		products.ApplySchedules(ctx)
+	}
+}
+
+// recoverCarts sends the recovery emails
+// of the abandoned carts.
+func recoverCarts() {
+	for range time.Tick(time.Minute * 10) {
+		ctx := context.WithValue(context.Background(), contexts.RequestID, "recovery")
+		ctx = context.WithValue(ctx, contexts.Locale, conf.DefaultLocale)
+		carts.SendRecoveries(ctx, conf.CartRecoveryDelay)
+	}
+}
+
 func main() {
 	locales.LoadEn()
 	logs.Init()
 	// security.LoadCsp()
 	cache.Busting()
 
+	go releaseReservations()
+	go publishProducts()
+	go recoverCarts()
+
 	admin := adminMux()
 	web := websiteMux()
 	account := accountMux()
@@ -173,15 +243,20 @@ func main() {
 	app.HandleFunc("GET /addresses", addresses.Handler)
 	app.HandleFunc("GET /delivery", carts.DeliveryHandler)
 	app.HandleFunc("GET /cart/address", carts.AddressFormHandler)
+	app.HandleFunc("GET /cart/recover", carts.RecoverHandler)
+	app.HandleFunc("GET /cart/recover/optout", carts.OptOutHandler)
 	app.HandleFunc("GET /payment", carts.PaymentHandler)
 	app.HandleFunc("POST /payment", carts.PaymentProcessHandler)
 	app.HandleFunc("POST /cart/address", carts.AddressHandler)
+	app.HandleFunc("POST /orders/lookup", orders.LookupHandler)
 	app.HandleFunc("POST /otp", auth.OtpHandler)
 	app.HandleFunc("POST /login", auth.LoginHandler)
 	app.HandleFunc("POST /logout", auth.LogoutHandler)
 	app.HandleFunc("POST /cart/{id}/add", carts.AddHandler)
 	app.HandleFunc("POST /cart/{id}/delete", carts.DeleteHandler)
 	app.HandleFunc("POST /delivery", carts.DeliverySetHandler)
+	app.HandleFunc("POST /cart/promotion", carts.PromotionHandler)
+	app.HandleFunc("POST /currency", carts.CurrencyHandler)
 
 	fs := http.FileServer(http.Dir("web/public"))
 	mux := http.NewServeMux()
@@ -195,6 +270,10 @@ func main() {
 	mux.Handle("GET /", handler(app))
 	mux.Handle("POST /", handler(security.Csrf(app)))
 
+	// The payment providers cannot send the HX headers
+	// so the webhook is kept outside the CSRF check.
+	mux.Handle("POST /payments/{provider}/webhook", handler(http.HandlerFunc(orders.PaymentWebhookHandler)))
+
 	slog.Info("Starting server on", slog.String("address", conf.ServerAddr))
 	err := http.ListenAndServe(conf.ServerAddr, mux)
 	log.Fatal(err)
@@ -0,0 +1,115 @@
+package money
+
+import (
+	"artisons/conf"
+	"artisons/http/contexts"
+	"context"
+	"math"
+
+	"golang.org/x/text/language"
+)
+
+type symbol struct {
+	value string
+
+	// True if the symbol is written before the amount
+	prefix bool
+}
+
+var symbols = map[string]symbol{
+	"EUR": {"€", false},
+	"GBP": {"£", true},
+	"CHF": {"CHF ", true},
+}
+
+// Supported returns true if the shop accepts the currency
+func Supported(currency string) bool {
+	_, ok := conf.Currencies[currency]
+	return ok
+}
+
+// Negotiate returns the customer currency.
+// The chosen currency is used if the shop accepts it,
+// otherwise the currency of the first region found in the
+// Accept-Language header, otherwise the shop currency.
+func Negotiate(chosen, acceptLanguage string) string {
+	if Supported(chosen) {
+		return chosen
+	}
+
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil {
+		return conf.Currency
+	}
+
+	for _, tag := range tags {
+		region, confidence := tag.Region()
+		if confidence != language.Exact {
+			continue
+		}
+
+		if currency, ok := conf.CurrencyRegions[region.String()]; ok && Supported(currency) {
+			return currency
+		}
+	}
+
+	return conf.Currency
+}
+
+// ContextCurrency returns the customer currency stored
+// in the context, or the shop currency.
+func ContextCurrency(ctx context.Context) string {
+	if currency, ok := ctx.Value(contexts.Currency).(string); ok && currency != "" {
+		return currency
+	}
+
+	return conf.Currency
+}
+
+// WithCurrency returns the same amount in the currency,
+// without conversion.
+func (m Money) WithCurrency(currency string) Money {
+	return Money{Amount: m.Amount, Currency: currency}
+}
+
+// Convert converts the amount to the currency with the shop
+// exchange rates, rounded to the minor unit.
+// The amount is returned unchanged if one of the currencies
+// is not supported.
+func (m Money) Convert(currency string) Money {
+	from := m.Currency
+	if from == "" {
+		from = conf.Currency
+	}
+
+	if from == currency {
+		return m.WithCurrency(currency)
+	}
+
+	rfrom, ok := conf.Currencies[from]
+	if !ok || rfrom == 0 {
+		return m
+	}
+
+	rto, ok := conf.Currencies[currency]
+	if !ok {
+		return m
+	}
+
+	return Money{Amount: int64(math.Round(float64(m.Amount) * rto / rfrom)), Currency: currency}
+}
+
+// Format returns the amount with its currency symbol,
+// like 12.50 €, £12.50 or CHF 12.50
+func (m Money) Format() string {
+	s, ok := symbols[m.Currency]
+	if !ok {
+		return m.String() + " " + m.Currency
+	}
+
+	if s.prefix {
+		return s.value + m.String()
+	}
+
+	return m.String() + " " + s.value
+}
@@ -0,0 +1,73 @@
+package money
+
+import (
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	var tests = []struct {
+		name           string
+		chosen         string
+		acceptLanguage string
+		currency       string
+	}{
+		{"chosen=CHF", "CHF", "en-GB", "CHF"},
+		{"chosen=USD", "USD", "", "EUR"},
+		{"accept=en-GB", "", "en-GB,en;q=0.9", "GBP"},
+		{"accept=fr-CH", "", "fr-CH", "CHF"},
+		{"accept=en", "", "en", "EUR"},
+		{"accept=", "", "", "EUR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if currency := Negotiate(tt.chosen, tt.acceptLanguage); currency != tt.currency {
+				t.Fatalf(`currency = %s, want %s`, currency, tt.currency)
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	var tests = []struct {
+		name     string
+		money    Money
+		currency string
+		result   Money
+	}{
+		{"EUR to EUR", Money{1000, "EUR"}, "EUR", Money{1000, "EUR"}},
+		{"EUR to CHF", Money{1000, "EUR"}, "CHF", Money{940, "CHF"}},
+		{"CHF to EUR", Money{940, "CHF"}, "EUR", Money{1000, "EUR"}},
+		{"none to GBP", Money{1000, ""}, "GBP", Money{850, "GBP"}},
+		{"EUR to USD", Money{1000, "EUR"}, "USD", Money{1000, "EUR"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if m := tt.money.Convert(tt.currency); m != tt.result {
+				t.Fatalf(`m = %v, want %v`, m, tt.result)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	var tests = []struct {
+		name  string
+		money Money
+		value string
+	}{
+		{"EUR", Money{1250, "EUR"}, "12.50 €"},
+		{"GBP", Money{1250, "GBP"}, "£12.50"},
+		{"CHF", Money{1250, "CHF"}, "CHF 12.50"},
+		{"USD", Money{1250, "USD"}, "12.50 USD"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if s := tt.money.Format(); s != tt.value {
+				t.Fatalf(`s = %s, want %s`, s, tt.value)
+			}
+		})
+	}
+}
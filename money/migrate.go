@@ -0,0 +1,239 @@
+package money
+
+import (
+	"artisons/db"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// migration describes the keys to convert.
+// When fields is empty, the key is a string counter.
+type migration struct {
+	match  string
+	fields []string
+}
+
+var migrations = []migration{
+	{"shop", []string{"min", "delivery_fees", "delivery_free_fees"}},
+	{"product:*", []string{"price"}},
+	{"order:*", []string{"total", "delivery_fees", "refunded", "price", "amount", "taxes"}},
+	{"cart:*", []string{"total", "delivery_fees", "taxes"}},
+	{"invoice:*", []string{"total", "taxes"}},
+	{"stats:orders:revenues:*", nil},
+	{"stats:orders:refunds:*", nil},
+	{"stats:orders:taxes:*", nil},
+	{"demo:stats:orders:revenues:*", nil},
+	{"demo:stats:orders:taxes:*", nil},
+}
+
+// legacyBreakdown is the VAT breakdown stored
+// with float amounts in major units
+type legacyBreakdown struct {
+	Lines []struct {
+		Rate  float64 `json:"rate"`
+		Net   float64 `json:"net"`
+		Tax   float64 `json:"tax"`
+		Gross float64 `json:"gross"`
+	} `json:"lines"`
+	Net   float64 `json:"net"`
+	Tax   float64 `json:"tax"`
+	Gross float64 `json:"gross"`
+}
+
+type breakdown struct {
+	Lines []line `json:"lines"`
+	Net   Money  `json:"net"`
+	Tax   Money  `json:"tax"`
+	Gross Money  `json:"gross"`
+}
+
+type line struct {
+	Rate  float64 `json:"rate"`
+	Net   Money   `json:"net"`
+	Tax   Money   `json:"tax"`
+	Gross Money   `json:"gross"`
+}
+
+// Migrate converts the amounts stored as floats in major units
+// into integers in minor units.
+// The converted keys are kept in a set, so the migration
+// can be run again after a failure without converting
+// a key twice.
+// The shop should be stopped during the migration.
+// The keys are:
+// - migrations:money => the migration is done
+// - migrations:money:keys => the converted keys
+func Migrate(ctx context.Context) error {
+	slog.LogAttrs(ctx, slog.LevelInfo, "migrating the amounts")
+
+	done, err := db.Redis.Exists(ctx, "migrations:money").Result()
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot check the migration", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	if done > 0 {
+		slog.LogAttrs(ctx, slog.LevelInfo, "the amounts are already migrated")
+		return nil
+	}
+
+	count := 0
+
+	for _, m := range migrations {
+		kind := "hash"
+		if len(m.fields) == 0 {
+			kind = "string"
+		}
+
+		iter := db.Redis.ScanType(ctx, 0, m.match, 100, kind).Iterator()
+		for iter.Next(ctx) {
+			converted, err := migrateKey(ctx, iter.Val(), m.fields)
+			if err != nil {
+				return err
+			}
+
+			if converted {
+				count++
+			}
+		}
+
+		if err := iter.Err(); err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "cannot scan the keys", slog.String("match", m.match), slog.String("error", err.Error()))
+			return errors.New("something went wrong")
+		}
+	}
+
+	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+		rdb.Set(ctx, "migrations:money", "1", 0)
+		rdb.Del(ctx, "migrations:money:keys")
+
+		return nil
+	}); err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot store the migration", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	slog.LogAttrs(ctx, slog.LevelInfo, "the amounts are migrated", slog.Int("keys", count))
+
+	return nil
+}
+
+// migrateKey converts the fields of a hash, or the value
+// of a string when fields is empty.
+// It returns false when the key was already converted.
+func migrateKey(ctx context.Context, key string, fields []string) (bool, error) {
+	l := slog.With(slog.String("key", key))
+
+	converted, err := db.Redis.SIsMember(ctx, "migrations:money:keys", key).Result()
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot check the key", slog.String("error", err.Error()))
+		return false, errors.New("something went wrong")
+	}
+
+	if converted {
+		return false, nil
+	}
+
+	values := map[string]string{}
+
+	if len(fields) == 0 {
+		val, err := db.Redis.Get(ctx, key).Result()
+		if err != nil && err != redis.Nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot get the value", slog.String("error", err.Error()))
+			return false, errors.New("something went wrong")
+		}
+
+		values[""] = val
+	} else {
+		vals, err := db.Redis.HMGet(ctx, key, fields...).Result()
+		if err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot get the fields", slog.String("error", err.Error()))
+			return false, errors.New("something went wrong")
+		}
+
+		for i, val := range vals {
+			if s, ok := val.(string); ok {
+				values[fields[i]] = s
+			}
+		}
+	}
+
+	for field, val := range values {
+		if val == "" {
+			delete(values, field)
+			continue
+		}
+
+		if field == "taxes" {
+			values[field] = migrateTaxes(ctx, val)
+			continue
+		}
+
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot parse the amount", slog.String("field", field), slog.String("value", val))
+			delete(values, field)
+			continue
+		}
+
+		values[field] = FromFloat(f).Minor()
+	}
+
+	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+		for field, val := range values {
+			if field == "" {
+				rdb.Set(ctx, key, val, redis.KeepTTL)
+			} else {
+				rdb.HSet(ctx, key, field, val)
+			}
+		}
+
+		rdb.SAdd(ctx, "migrations:money:keys", key)
+
+		return nil
+	}); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot store the amounts", slog.String("error", err.Error()))
+		return false, errors.New("something went wrong")
+	}
+
+	return true, nil
+}
+
+// migrateTaxes converts the VAT breakdown amounts.
+// The value is kept if it cannot be parsed.
+func migrateTaxes(ctx context.Context, s string) string {
+	old := legacyBreakdown{}
+	if err := json.Unmarshal([]byte(s), &old); err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot parse the taxes", slog.String("taxes", s), slog.String("error", err.Error()))
+		return s
+	}
+
+	b := breakdown{
+		Lines: []line{},
+		Net:   FromFloat(old.Net),
+		Tax:   FromFloat(old.Tax),
+		Gross: FromFloat(old.Gross),
+	}
+
+	for _, l := range old.Lines {
+		b.Lines = append(b.Lines, line{
+			Rate:  l.Rate,
+			Net:   FromFloat(l.Net),
+			Tax:   FromFloat(l.Tax),
+			Gross: FromFloat(l.Gross),
+		})
+	}
+
+	data, err := json.Marshal(b)
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot serialize the taxes", slog.String("error", err.Error()))
+		return s
+	}
+
+	return string(data)
+}
@@ -0,0 +1,208 @@
+// Package money represents the amounts in integer minor units,
+// like cents, with their currency code.
+// The amounts are stored in Redis in minor units, so the totals
+// and the statistics counters do not drift like with floats.
+package money
+
+import (
+	"artisons/conf"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of minor units in a major unit.
+// All the supported currencies have two decimals.
+const Scale = 100
+
+type Money struct {
+	// The amount in minor units
+	Amount int64 `json:"amount"`
+
+	// The ISO 4217 currency code
+	Currency string `json:"currency"`
+}
+
+var errParse = errors.New("cannot parse the amount")
+
+// ErrCurrency is logged when an operation mixes amounts
+// in currencies that cannot be converted.
+var ErrCurrency = errors.New("the amounts are in different currencies")
+
+// New returns the amount in minor units with the shop currency
+func New(amount int64) Money {
+	return Money{Amount: amount, Currency: conf.Currency}
+}
+
+// Parse parses a decimal value in major units,
+// like "12.5" or "12,50", without going through a float.
+// More than two decimals is an error.
+func Parse(s string) (Money, error) {
+	s = strings.TrimSpace(strings.Replace(s, ",", ".", 1))
+	if s == "" {
+		return Money{}, errParse
+	}
+
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	units, decimals, _ := strings.Cut(s, ".")
+	if units == "" || len(decimals) > 2 || strings.HasPrefix(decimals, "-") {
+		return Money{}, errParse
+	}
+
+	decimals += strings.Repeat("0", 2-len(decimals))
+
+	major, err := strconv.ParseUint(units, 10, 62)
+	if err != nil {
+		return Money{}, errParse
+	}
+
+	minor, err := strconv.ParseUint(decimals, 10, 8)
+	if err != nil {
+		return Money{}, errParse
+	}
+
+	amount := int64(major)*Scale + int64(minor)
+	if negative {
+		amount = -amount
+	}
+
+	return New(amount), nil
+}
+
+// ParseMinor parses the minor units as stored in Redis
+func ParseMinor(s string) (Money, error) {
+	amount, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return Money{}, errParse
+	}
+
+	return New(amount), nil
+}
+
+// FromFloat converts a float in major units, rounded to
+// the closest minor unit.
+// It should be used only to convert legacy values.
+func FromFloat(f float64) Money {
+	return New(int64(math.Round(f * Scale)))
+}
+
+// Add returns the sum of the amounts.
+// The other amount is converted to the currency of m first,
+// see Convert.
+func (m Money) Add(o Money) Money {
+	o = m.align(o)
+	return Money{Amount: m.Amount + o.Amount, Currency: m.currency(o)}
+}
+
+// Sub returns the difference of the amounts.
+// The other amount is converted to the currency of m first.
+func (m Money) Sub(o Money) Money {
+	o = m.align(o)
+	return Money{Amount: m.Amount - o.Amount, Currency: m.currency(o)}
+}
+
+// Mul multiplies the amount by a quantity
+func (m Money) Mul(qty int) Money {
+	return Money{Amount: m.Amount * int64(qty), Currency: m.Currency}
+}
+
+// Percent returns the percentage of the amount,
+// rounded half away from zero.
+func (m Money) Percent(rate float64) Money {
+	return Money{Amount: int64(math.Round(float64(m.Amount) * rate / 100)), Currency: m.Currency}
+}
+
+// Ratio returns the amount multiplied by num / den,
+// rounded half away from zero.
+func (m Money) Ratio(num, den int64) Money {
+	if den == 0 {
+		return Money{Currency: m.Currency}
+	}
+
+	return Money{Amount: int64(math.Round(float64(m.Amount) * float64(num) / float64(den))), Currency: m.Currency}
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// Cmp returns -1, 0 or 1 if m is lower, equal or greater than o
+func (m Money) Cmp(o Money) int {
+	switch {
+	case m.Amount < o.Amount:
+		return -1
+	case m.Amount > o.Amount:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Float64 returns the amount in major units.
+// It should be used only for display, like the charts.
+func (m Money) Float64() float64 {
+	return float64(m.Amount) / Scale
+}
+
+// String returns the amount in major units with two decimals, like 12.50
+func (m Money) String() string {
+	sign := ""
+	amount := m.Amount
+
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, amount/Scale, amount%Scale)
+}
+
+// LogValue logs the amount in major units
+func (m Money) LogValue() slog.Value {
+	return slog.StringValue(m.String())
+}
+
+// Minor returns the amount in minor units, as stored in Redis
+func (m Money) Minor() string {
+	return strconv.FormatInt(m.Amount, 10)
+}
+
+// MarshalBinary stores the amount in minor units
+// when it is passed to a Redis command.
+func (m Money) MarshalBinary() ([]byte, error) {
+	return []byte(m.Minor()), nil
+}
+
+// align converts the other amount to the currency of m
+// before an operation. The amounts are used in the request
+// handlers and in the goroutines, so a currency that cannot
+// be converted is logged instead of stopping the process.
+func (m Money) align(o Money) Money {
+	if m.Currency == "" || o.Currency == "" || o.Currency == m.Currency {
+		return o
+	}
+
+	c := o.Convert(m.Currency)
+	if c.Currency != m.Currency {
+		slog.LogAttrs(context.Background(), slog.LevelError, "cannot convert the amount", slog.String("from", o.Currency), slog.String("to", m.Currency), slog.String("error", ErrCurrency.Error()))
+	}
+
+	return c
+}
+
+// currency returns the currency of the operation result.
+// An amount without currency, like the zero value Money,
+// takes the currency of the other amount.
+func (m Money) currency(o Money) string {
+	if m.Currency == "" {
+		return o.Currency
+	}
+
+	return m.Currency
+}
@@ -0,0 +1,127 @@
+package money
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	var tests = []struct {
+		name   string
+		value  string
+		amount int64
+		err    error
+	}{
+		{"value=12", "12", 1200, nil},
+		{"value=12.5", "12.5", 1250, nil},
+		{"value=12,50", "12,50", 1250, nil},
+		{"value=0.05", "0.05", 5, nil},
+		{"value=-3.10", "-3.10", -310, nil},
+		{"value=", "", 0, errParse},
+		{"value=abc", "abc", 0, errParse},
+		{"value=1.234", "1.234", 0, errParse},
+		{"value=.5", ".5", 0, errParse},
+		{"value=1.-5", "1.-5", 0, errParse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Parse(tt.value)
+			if fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+
+			if m.Amount != tt.amount {
+				t.Fatalf(`m.Amount = %d, want %d`, m.Amount, tt.amount)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	var tests = []struct {
+		name   string
+		amount int64
+		value  string
+	}{
+		{"amount=1250", 1250, "12.50"},
+		{"amount=5", 5, "0.05"},
+		{"amount=0", 0, "0.00"},
+		{"amount=-310", -310, "-3.10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if s := New(tt.amount).String(); s != tt.value {
+				t.Fatalf(`s = %s, want %s`, s, tt.value)
+			}
+		})
+	}
+}
+
+func TestPercent(t *testing.T) {
+	var tests = []struct {
+		name   string
+		amount int64
+		rate   float64
+		result int64
+	}{
+		{"amount=10000,rate=20", 10000, 20, 2000},
+		{"amount=1000,rate=5.5", 1000, 5.5, 55},
+		{"amount=999,rate=5.5", 999, 5.5, 55},
+		{"amount=0,rate=20", 0, 20, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if m := New(tt.amount).Percent(tt.rate); m.Amount != tt.result {
+				t.Fatalf(`m.Amount = %d, want %d`, m.Amount, tt.result)
+			}
+		})
+	}
+}
+
+func TestRatio(t *testing.T) {
+	var tests = []struct {
+		name   string
+		amount int64
+		num    int64
+		den    int64
+		result int64
+	}{
+		{"amount=12000,ratio=1/6", 12000, 1, 6, 2000},
+		{"amount=1000,ratio=2000/12000", 1000, 2000, 12000, 167},
+		{"amount=1000,den=0", 1000, 1, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if m := New(tt.amount).Ratio(tt.num, tt.den); m.Amount != tt.result {
+				t.Fatalf(`m.Amount = %d, want %d`, m.Amount, tt.result)
+			}
+		})
+	}
+}
+
+func TestAdd(t *testing.T) {
+	var tests = []struct {
+		name   string
+		money  Money
+		other  Money
+		result Money
+	}{
+		{"EUR+EUR", Money{1000, "EUR"}, Money{250, "EUR"}, Money{1250, "EUR"}},
+		{"none+CHF", Money{}, Money{250, "CHF"}, Money{250, "CHF"}},
+		{"CHF+none", Money{1000, "CHF"}, Money{}, Money{1000, "CHF"}},
+		{"EUR+CHF", Money{1000, "EUR"}, Money{250, "CHF"}, Money{1266, "EUR"}},
+		{"EUR+XXX", Money{1000, "EUR"}, Money{250, "XXX"}, Money{1250, "EUR"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if m := tt.money.Add(tt.other); m != tt.result {
+				t.Fatalf(`m = %v, want %v`, m, tt.result)
+			}
+		})
+	}
+}
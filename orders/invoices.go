@@ -0,0 +1,67 @@
+package orders
+
+import (
+	"artisons/conf"
+	"artisons/invoices"
+	"artisons/shops"
+	"artisons/taxes"
+	"context"
+	"log/slog"
+	"time"
+)
+
+// CreateInvoice creates the invoice of the paid order.
+// It can be called several times, the invoice number
+// stays the same.
+func (o Order) CreateInvoice(ctx context.Context) (invoices.Invoice, error) {
+	l := slog.With(slog.String("oid", o.ID))
+	l.LogAttrs(ctx, slog.LevelInfo, "creating the order invoice")
+
+	lines := []invoices.Line{}
+	for _, p := range o.Products {
+		lines = append(lines, invoices.Line{
+			Title:    p.Name(),
+			Sku:      p.Sku,
+			Quantity: p.Quantity,
+			Price:    p.DiscountedPrice(),
+		})
+	}
+
+	createdAt := o.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	inv, err := invoices.Create(ctx, invoices.Invoice{
+		MID:          conf.DefaultMID,
+		OID:          o.ID,
+		Contact:      shops.Data.Contact,
+		Customer:     o.Billing,
+		Shipping:     o.Address,
+		Lines:        lines,
+		DeliveryFees: o.DeliveryFees,
+		Promotion:    o.Promotion,
+		Discount:     o.Discount,
+		Total:        o.Total,
+		Taxes:        o.vat(),
+		CreatedAt:    createdAt,
+	})
+	if err != nil {
+		return invoices.Invoice{}, err
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the order invoice is created", slog.String("number", inv.Number))
+
+	return inv, nil
+}
+
+// vat returns the order VAT breakdown.
+// The orders created before the taxes existed are
+// considered taxes included with the default rate.
+func (o Order) vat() taxes.Breakdown {
+	if len(o.Taxes.Lines) > 0 {
+		return o.Taxes
+	}
+
+	return taxes.Compute([]taxes.Item{{Rate: conf.DefaultVATRate, Amount: o.Total}}, true)
+}
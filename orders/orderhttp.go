@@ -6,14 +6,20 @@ import (
 	"artisons/http/contexts"
 	"artisons/http/httperrors"
 	"artisons/http/httphelpers"
+	"artisons/invoices"
+	"artisons/money"
 	"artisons/shops"
 	"artisons/tags/tree"
 	"artisons/templates"
 	"artisons/users"
+	"fmt"
 	"html/template"
 	"log"
 	"log/slog"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 
 	"golang.org/x/text/language"
 )
@@ -23,6 +29,7 @@ var ordersHxTpl *template.Template
 var ordersFormTpl *template.Template
 var ordersUpdateStatusTpl *template.Template
 var ordersNoteAddStatusTpl *template.Template
+var ordersRefundTpl *template.Template
 
 func init() {
 	var err error
@@ -51,6 +58,7 @@ func init() {
 			conf.WorkingSpace+"web/views/admin/icons/anchor.svg",
 			conf.WorkingSpace+"web/views/admin/orders/orders-form.html",
 			conf.WorkingSpace+"web/views/admin/orders/orders-notes.html",
+			conf.WorkingSpace+"web/views/admin/orders/orders-refunds.html",
 		)...)
 
 	if err != nil {
@@ -73,6 +81,17 @@ func init() {
 	if err != nil {
 		log.Panicln(err)
 	}
+
+	ordersRefundTpl, err = templates.Build("orders-refund-success.html").ParseFiles(
+		append(templates.AdminSuccess,
+			conf.WorkingSpace+"web/views/admin/orders/orders-refund-success.html",
+			conf.WorkingSpace+"web/views/admin/orders/orders-refunds.html",
+		)...,
+	)
+
+	if err != nil {
+		log.Panicln(err)
+	}
 }
 
 func OrderListHandler(w http.ResponseWriter, r *http.Request) {
@@ -147,12 +166,24 @@ func OrderUpdateStatus(w http.ResponseWriter, r *http.Request) {
 	oid := r.PathValue("id")
 	status := r.FormValue("status")
 
-	err := UpdateStatus(ctx, oid, status)
+	changed, err := UpdateStatus(ctx, oid, status)
 	if err != nil {
 		httperrors.HXCatch(w, ctx, err.Error())
 		return
 	}
 
+	// The customer is notified only when
+	// the status really changed
+	if changed {
+		o, err := Find(ctx, oid)
+		if err != nil {
+			httperrors.HXCatch(w, ctx, err.Error())
+			return
+		}
+
+		go o.SendStatusNotification(ctx)
+	}
+
 	lang := ctx.Value(contexts.Locale).(language.Tag)
 
 	data := struct {
@@ -237,6 +268,48 @@ func OrderHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func LookupFormHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	lang := ctx.Value(contexts.Locale).(language.Tag)
+
+	data := struct {
+		Lang language.Tag
+		Shop shops.Settings
+		Tags []tree.Leaf
+	}{
+		lang,
+		shops.Data,
+		tree.Tree,
+	}
+
+	if err := templates.Pages["lookup"].Execute(w, &data); err != nil {
+		slog.Error("cannot render the template", slog.String("error", err.Error()))
+	}
+}
+
+func LookupHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	lang := ctx.Value(contexts.Locale).(language.Tag)
+
+	order, err := Lookup(ctx, r.FormValue("id"), r.FormValue("email"))
+	if err != nil {
+		httperrors.HXCatch(w, ctx, err.Error())
+		return
+	}
+
+	data := struct {
+		Lang  language.Tag
+		Order Order
+	}{
+		lang,
+		order,
+	}
+
+	if err := templates.Pages["hx-lookup"].Execute(w, &data); err != nil {
+		slog.Error("cannot render the template", slog.String("error", err.Error()))
+	}
+}
+
 func OrdersHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	lang := ctx.Value(contexts.Locale).(language.Tag)
@@ -283,3 +356,124 @@ func OrdersHandler(w http.ResponseWriter, r *http.Request) {
 		slog.Error("cannot render the template", slog.String("error", err.Error()))
 	}
 }
+
+func OrderRefundHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := r.ParseForm(); err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot parse the form", slog.String("error", err.Error()))
+		httperrors.HXCatch(w, ctx, "something went wrong")
+		return
+	}
+
+	oid := r.PathValue("id")
+	lines := map[string]int{}
+
+	for key := range r.Form {
+		if !strings.HasPrefix(key, "line_") {
+			continue
+		}
+
+		qty, err := strconv.Atoi(r.FormValue(key))
+		if err != nil || qty < 0 {
+			slog.LogAttrs(ctx, slog.LevelInfo, "cannot parse the quantity", slog.String("quantity", r.FormValue(key)))
+			httperrors.HXCatch(w, ctx, "input:lines")
+			return
+		}
+
+		lines[strings.TrimPrefix(key, "line_")] = qty
+	}
+
+	amount := money.New(0)
+	if r.FormValue("amount") != "" {
+		var err error
+		amount, err = money.Parse(r.FormValue("amount"))
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelInfo, "cannot parse the amount", slog.String("amount", r.FormValue("amount")))
+			httperrors.HXCatch(w, ctx, "input:amount")
+			return
+		}
+	}
+
+	_, err := Refund(ctx, oid, lines, amount, r.FormValue("reason"))
+	if err != nil {
+		httperrors.HXCatch(w, ctx, err.Error())
+		return
+	}
+
+	o, err := Find(ctx, oid)
+	if err != nil {
+		httperrors.Page(w, ctx, err.Error(), 400)
+		return
+	}
+
+	lang := ctx.Value(contexts.Locale).(language.Tag)
+
+	data := struct {
+		Flash    string
+		Lang     language.Tag
+		Currency string
+		Data     Order
+	}{
+		"The data has been saved successfully.",
+		lang,
+		o.Total.Currency,
+		o,
+	}
+
+	if err := ordersRefundTpl.Execute(w, &data); err != nil {
+		slog.Error("cannot render the template", slog.String("error", err.Error()))
+	}
+}
+
+func serveInvoice(w http.ResponseWriter, r *http.Request, o Order) {
+	ctx := r.Context()
+
+	if o.Invoice == "" {
+		slog.LogAttrs(ctx, slog.LevelInfo, "the order does not have any invoice", slog.String("oid", o.ID))
+		httperrors.Page(w, ctx, "oops the data is not found", 404)
+		return
+	}
+
+	file := invoices.Path(o.Invoice)
+
+	if _, err := os.Stat(file); err != nil {
+		slog.LogAttrs(ctx, slog.LevelWarn, "the invoice file is missing", slog.String("number", o.Invoice), slog.String("error", err.Error()))
+
+		if _, err := o.CreateInvoice(ctx); err != nil {
+			httperrors.Page(w, ctx, err.Error(), 500)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", o.Invoice+".pdf"))
+
+	http.ServeFile(w, r, file)
+}
+
+func OrderInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	o, err := Find(ctx, r.PathValue("id"))
+	if err != nil {
+		httperrors.Page(w, ctx, err.Error(), 404)
+		return
+	}
+
+	serveInvoice(w, r, o)
+}
+
+func AccountInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := ctx.Value(contexts.User).(users.User)
+
+	o, err := Find(ctx, r.PathValue("id"))
+	if err != nil || o.UID != user.ID {
+		slog.LogAttrs(ctx, slog.LevelInfo, "cannot access the order invoice", slog.String("oid", r.PathValue("id")))
+		httperrors.Catch(w, ctx, "oops the data is not found", 404)
+		return
+	}
+
+	serveInvoice(w, r, o)
+}
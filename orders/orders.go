@@ -3,19 +3,26 @@ package orders
 
 import (
 	"artisons/addresses"
+	"artisons/conf"
 	"artisons/db"
 	"artisons/http/contexts"
+	"artisons/money"
 	"artisons/notifications/mails"
+	"artisons/pickups"
 	"artisons/products"
+	"artisons/promotions"
 	"artisons/string/stringutil"
+	"artisons/taxes"
 	"artisons/users"
 	"artisons/validators"
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jedib0t/go-pretty/v6/table"
@@ -33,13 +40,27 @@ type SearchResults struct {
 type Order struct {
 	ID string
 
-	// The user ID
+	// The user ID, 0 for a guest order
 	UID int
 
+	// The contact email, kept to reach the guests
+	Email string
+
 	// "collect" or "home"
 	Delivery string
 
-	DeliveryFees float64
+	DeliveryFees money.Money
+
+	// The pickup location chosen for the collect delivery,
+	// a copy is kept in case the location changes
+	Pickup pickups.Location
+
+	// The pickup slot, a zero value when the location has no slot
+	PickupSlot pickups.Slot
+
+	// The total weight in grams used to calculate
+	// the delivery fees
+	Weight float64
 
 	// "cash", "card", "bitcoin" or "wire"
 	Payment string
@@ -47,20 +68,52 @@ type Order struct {
 	// "payment_validated", "payment_progress", "payment_refused"
 	PaymentStatus string
 
+	// The payment reference returned by the payment provider
+	PaymentRef string
+
+	// The invoice number, set when the payment is validated
+	Invoice string
+
 	// "created", "processing", "delivering", "delivered", "canceled"
 	Status string
 
 	// The order note added by the seller
 	Notes []Note
 
+	// The status changes
+	History []History
+
+	// The refunded amount
+	Refunded money.Money
+
+	// The refunded quantities indexed by product id
+	Refunds map[string]int
+
+	CreditNotes []CreditNote
+
+	// The shipping address
 	Address addresses.Address
 
+	// The billing address, the shipping address
+	// for the orders created before it existed
+	Billing addresses.Address
+
 	CreatedAt time.Time
 	UpdatedAt time.Time
 
 	Products []products.Product
 
-	Total float64
+	// The total, taxes included
+	Total money.Money
+
+	// The VAT breakdown per rate
+	Taxes taxes.Breakdown
+
+	// The promotion code used for the order
+	Promotion string
+
+	// The promotion discount, taxes included
+	Discount money.Money
 }
 
 type Note struct {
@@ -71,6 +124,7 @@ type Note struct {
 type Query struct {
 	Keywords string
 	UID      int
+	Email    string
 	Sorter   string
 }
 
@@ -93,9 +147,14 @@ func (o *Order) AssignID(ctx context.Context) error {
 // The data are stored like this:
 // - order:ID => the order data
 // - order:ID product:ID => the product quantity
+// - order:ID:product:PID => the product snapshot at purchase time
 // - user:ID:orders => the order id added in the set
+// The invoice is created when the payment is validated.
+// The stock reserved for the cart is kept and the products
+// without stock anymore are switched offline.
 // An error occurs if the delivery or the payment values are invalid,
-// if the product list is empty, or one of the product is not available.
+// if the product list is empty, or one of the product is not available,
+// or if the promotion usage limits are reached, see promotions.Use.
 func (o *Order) Save(ctx context.Context, cid int) error {
 	l := slog.With()
 	l.LogAttrs(ctx, slog.LevelInfo, "saving the order")
@@ -110,13 +169,23 @@ func (o *Order) Save(ctx context.Context, cid int) error {
 		o.UID = u.ID
 	}
 
+	// The promotion is counted before the transaction,
+	// the order fails if its usage limits are reached
+	if o.Promotion != "" {
+		if err := promotions.Use(ctx, o.Promotion, o.UID); err != nil {
+			return err
+		}
+	}
+
 	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
 		rdb.HSet(ctx, "order:"+o.ID,
 			"id", o.ID,
 			"uid", o.UID,
+			"email", o.Email,
 			"delivery", o.Delivery,
 			"payment", o.Payment,
-			"payment_status", o.Status,
+			"payment_status", o.PaymentStatus,
+			"payment_ref", o.PaymentRef,
 			"status", "created",
 			"address_lastname", o.Address.Lastname,
 			"address_firstname", o.Address.Firstname,
@@ -125,8 +194,13 @@ func (o *Order) Save(ctx context.Context, cid int) error {
 			"address_complementary", o.Address.Complementary,
 			"address_zipcode", o.Address.Zipcode,
 			"address_phone", o.Address.Phone,
+			"address_country", o.Address.Country,
 			"type", "order",
-			"total", o.Total,
+			"total", o.Total.Minor(),
+			"delivery_fees", o.DeliveryFees.Minor(),
+			"weight", o.Weight,
+			"currency", o.Total.Currency,
+			"taxes", o.Taxes.Serialize(ctx),
 			"updated_at", now.Unix(),
 			"created_at", now.Unix(),
 		)
@@ -135,20 +209,59 @@ func (o *Order) Save(ctx context.Context, cid int) error {
 			rdb.HSet(ctx, "order:"+o.ID, "uid", o.UID)
 		}
 
+		if !o.Billing.IsZero() {
+			rdb.HSet(ctx, "order:"+o.ID, o.Billing.Fields("billing_")...)
+		}
+
+		if o.Pickup.ID != "" {
+			rdb.HSet(ctx, "order:"+o.ID,
+				"pickup", o.Pickup.ID,
+				"pickup_name", o.Pickup.Name,
+				"pickup_street", o.Pickup.Street,
+				"pickup_zipcode", o.Pickup.Zipcode,
+				"pickup_city", o.Pickup.City,
+			)
+		}
+
+		if !o.PickupSlot.Start.IsZero() {
+			rdb.HSet(ctx, "order:"+o.ID, "pickup_slot_start", o.PickupSlot.Start.Unix(), "pickup_slot_end", o.PickupSlot.End.Unix())
+		}
+
+		if o.Promotion != "" {
+			rdb.HSet(ctx, "order:"+o.ID, "promotion", o.Promotion, "discount", o.Discount.Minor())
+		}
+
 		for _, p := range o.Products {
 			rdb.HSet(ctx, "order:"+o.ID+":products", p.ID, p.Quantity)
+			snapshot(ctx, rdb, o.ID, p)
 		}
 
-		rdb.Del(ctx, fmt.Sprintf("cart:%d", cid), fmt.Sprintf("cart:%d:inf", cid))
+		products.CommitReservation(ctx, rdb, cid)
+
+		rdb.Del(ctx, fmt.Sprintf("cart:%d", cid), fmt.Sprintf("cart:%d:info", cid))
+
+		// No recovery email is sent for the ordered cart
+		rdb.ZRem(ctx, "carts:activity", cid)
 
 		return nil
 	}); err != nil {
 		l.LogAttrs(ctx, slog.LevelError, "cannot save the order in redis", slog.String("error", err.Error()))
+
+		if o.Promotion != "" {
+			promotions.CancelUse(ctx, o.Promotion, o.UID)
+		}
+
 		return errors.New("something went wrong")
 	}
 
 	l.LogAttrs(ctx, slog.LevelInfo, "the new order is created", slog.String("oid", o.ID))
 
+	if o.PaymentStatus == "payment_validated" {
+		if inv, err := o.CreateInvoice(ctx); err == nil {
+			o.Invoice = inv.Number
+		}
+	}
+
 	return nil
 }
 
@@ -156,19 +269,46 @@ func (o Order) SendConfirmationEmail(ctx context.Context) (string, error) {
 	l := slog.With(slog.String("oid", o.ID))
 	l.LogAttrs(ctx, slog.LevelInfo, "sending confirmation email")
 
-	email, err := db.Redis.HGet(ctx, fmt.Sprintf("user:%d", o.UID), "email").Result()
-	if err != nil {
-		l.LogAttrs(ctx, slog.LevelWarn, "cannot get the email", slog.Int("uid", o.UID), slog.String("error", err.Error()))
-		return "", err
+	// The orders created before the guest checkout
+	// have no email, so the user one is used
+	email := o.Email
+	if email == "" {
+		e, err := db.Redis.HGet(ctx, fmt.Sprintf("user:%d", o.UID), "email").Result()
+		if err != nil {
+			l.LogAttrs(ctx, slog.LevelWarn, "cannot get the email", slog.Int("uid", o.UID), slog.String("error", err.Error()))
+			return "", err
+		}
+
+		email = e
 	}
 
 	lang := ctx.Value(contexts.Locale).(language.Tag)
 	p := message.NewPrinter(lang)
 
-	msg := p.Sprintf("email_order_confirmation", o.Address.Firstname)
+	msg := p.Sprintf("email_order_confirmation", o.Billing.Firstname)
 	msg += p.Sprintf("email_order_confirmationid", o.ID)
 	msg += p.Sprintf("email_order_confirmationdate", o.CreatedAt.Format("Monday, January 1"))
-	msg += p.Sprintf("email_order_confirmationtotal", o.Total)
+	if o.Pickup.ID != "" {
+		msg += p.Sprintf("email_order_confirmationpickup", o.Pickup.Name, o.Pickup.Address())
+	}
+
+	if !o.PickupSlot.Start.IsZero() {
+		msg += p.Sprintf("email_order_confirmationslot", o.PickupSlot.String())
+	}
+
+	if o.Promotion != "" {
+		msg += p.Sprintf("email_order_confirmationdiscount", o.Promotion, o.Discount.Format())
+	}
+
+	msg += p.Sprintf("email_order_confirmationtotal", o.Total.Format())
+
+	for _, line := range o.Taxes.Lines {
+		msg += p.Sprintf("email_order_confirmationtax", line.Rate, line.Net.Format(), line.Tax.Format(), line.Gross.Format())
+	}
+
+	if len(o.Taxes.Lines) > 0 {
+		msg += "\n"
+	}
 
 	t := table.NewWriter()
 	buf := new(bytes.Buffer)
@@ -176,16 +316,20 @@ func (o Order) SendConfirmationEmail(ctx context.Context) (string, error) {
 	t.AppendHeader(table.Row{p.Sprintf("title"), p.Sprintf("quality"), p.Sprintf("price"), p.Sprintf("total"), p.Sprintf("link")})
 
 	for _, value := range o.Products {
-		t.AppendRow([]interface{}{value.Title, value.Quantity, value.Price, float64(value.Quantity) * value.Price, value.URL()})
+		t.AppendRow([]interface{}{value.Name(), value.Quantity, value.DiscountedPrice().Format(), value.DiscountedPrice().Mul(value.Quantity).Format(), value.URL()})
 	}
 
 	t.Render()
 
 	msg += buf.String()
 
+	if o.UID == 0 {
+		msg += p.Sprintf("email_order_confirmationguest", conf.WebsiteURL+"/orders/lookup")
+	}
+
 	msg += p.Sprintf("email_order_confirmationfooter")
 
-	err = mails.Send(ctx, email, p.Sprintf("email_order_subject", o.ID), msg)
+	err := mails.Send(ctx, email, p.Sprintf("email_order_subject", o.ID), msg)
 	if err != nil {
 		l.LogAttrs(ctx, slog.LevelWarn, "cannot send the email", slog.String("error", err.Error()))
 		return "", err
@@ -196,34 +340,167 @@ func (o Order) SendConfirmationEmail(ctx context.Context) (string, error) {
 
 // UpdateStatus updates the order status.
 // An error occurs if the status is not a correct value,
+// if the transition from the current status is not allowed
 // or the order is not found.
-// The full order is returned and an notification is expected
-// to be sent to the customer.
+// Setting the current status again does nothing and
+// returns false, so no notification has to be sent.
+// Each change is appended to the order history with the actor,
+// the admin email or "system" when there is no user.
+// A notification is expected to be sent to the customer,
+// see Order.SendStatusNotification.
+// When the order is canceled, the stock and the pickup slot are given back,
+// unless it was already done when the payment was refused.
 // The keys are :
 // - order:oid => the order data
-func UpdateStatus(ctx context.Context, oid, status string) error {
+// - order:oid:history => the status changes
+func UpdateStatus(ctx context.Context, oid, status string) (bool, error) {
 	l := slog.With(slog.String("oid", oid), slog.String("status", status))
 	l.LogAttrs(ctx, slog.LevelInfo, "updating the order status")
 
 	if err := validators.V.Var(status, "required,oneof=created processing delivering delivered canceled"); err != nil {
 		l.LogAttrs(ctx, slog.LevelInfo, "cannot validate the status", slog.String("error", err.Error()))
-		return errors.New("input:status")
+		return false, errors.New("input:status")
 	}
 
 	if exists, err := db.Redis.Exists(ctx, "order:"+oid).Result(); exists == 0 || err != nil {
 		l.LogAttrs(ctx, slog.LevelInfo, "cannot find the order")
-		return errors.New("oops the data is not found")
+		return false, errors.New("oops the data is not found")
+	}
+
+	key := "order:" + oid
+	actor := "system"
+	changed := false
+
+	u, ok := ctx.Value(contexts.User).(users.User)
+	if ok {
+		actor = u.Email
+	}
+
+	err := db.Redis.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.HGet(ctx, key, "status").Result()
+		if err != nil {
+			return err
+		}
+
+		if current == status {
+			l.LogAttrs(ctx, slog.LevelInfo, "the status is already set")
+			return nil
+		}
+
+		if !CanTransition(current, status) {
+			l.LogAttrs(ctx, slog.LevelInfo, "the status transition is not allowed", slog.String("current", current))
+			return errStatusTransition
+		}
+
+		var qty map[string]string
+		var pickup, slot string
+		if status == "canceled" {
+			qty, pickup, slot, err = heldStock(ctx, tx, key)
+			if err != nil {
+				return err
+			}
+		}
+
+		h, err := json.Marshal(History{
+			From:      current,
+			To:        status,
+			Actor:     actor,
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+			rdb.HSet(ctx, key, "status", status, "updated_at", time.Now().Unix())
+			rdb.RPush(ctx, key+":history", h)
+
+			releaseStock(ctx, rdb, key, qty, pickup, slot)
+
+			return nil
+		})
+
+		changed = err == nil
+
+		return err
+	}, key, key+":restocked")
+
+	if errors.Is(err, errStatusTransition) {
+		return false, err
 	}
 
-	_, err := db.Redis.HSet(ctx, "order:"+oid, "status", status).Result()
 	if err != nil {
 		l.LogAttrs(ctx, slog.LevelError, " cannot update the status order", slog.String("error", err.Error()))
-		return errors.New("something went wrong")
+		return false, errors.New("something went wrong")
 	}
 
-	l.LogAttrs(ctx, slog.LevelInfo, "the status is updated")
+	l.LogAttrs(ctx, slog.LevelInfo, "the status is updated", slog.Bool("changed", changed))
 
-	return nil
+	return changed, nil
+}
+
+// heldStock returns the quantities and the pickup booking
+// held by the order, to give them back when the order is canceled
+// or its payment is refused. The quantities already put back
+// by the refunds are excluded, and nothing is returned if they
+// were already given back, so they are never restored twice.
+func heldStock(ctx context.Context, tx *redis.Tx, key string) (map[string]string, string, string, error) {
+	vals, err := tx.HMGet(ctx, key, "pickup", "pickup_slot_start", "stock_released").Result()
+	if err != nil {
+		return map[string]string{}, "", "", err
+	}
+
+	if released, _ := vals[2].(string); released == "1" {
+		return map[string]string{}, "", "", nil
+	}
+
+	ordered, err := tx.HGetAll(ctx, key+":products").Result()
+	if err != nil {
+		return map[string]string{}, "", "", err
+	}
+
+	// The refunded quantities may be in stock already
+	restocked, err := tx.HGetAll(ctx, key+":restocked").Result()
+	if err != nil {
+		return map[string]string{}, "", "", err
+	}
+
+	qty := map[string]string{}
+	for pid, val := range ordered {
+		q, _ := strconv.Atoi(val)
+		done, _ := strconv.Atoi(restocked[pid])
+
+		if q-done > 0 {
+			qty[pid] = strconv.Itoa(q - done)
+		}
+	}
+
+	pickup, _ := vals[0].(string)
+
+	slot := ""
+	if start, _ := vals[1].(string); start != "" {
+		ts, err := strconv.ParseInt(start, 10, 64)
+		if err != nil {
+			return map[string]string{}, "", "", err
+		}
+		slot = pickups.Slot{Start: time.Unix(ts, 0)}.ID()
+	}
+
+	return qty, pickup, slot, nil
+}
+
+// releaseStock adds into the pipeline the restore of the stock
+// and the pickup booking returned by heldStock, and flags
+// the order with stock_released.
+func releaseStock(ctx context.Context, rdb redis.Pipeliner, key string, qty map[string]string, pickup, slot string) {
+	if len(qty) == 0 && slot == "" {
+		return
+	}
+
+	products.RestoreStock(ctx, rdb, qty)
+	pickups.ReleaseBooking(ctx, rdb, pickup, slot)
+
+	rdb.HSet(ctx, key, "stock_released", "1")
 }
 
 func Find(ctx context.Context, oid string) (Order, error) {
@@ -259,10 +536,9 @@ func Find(ctx context.Context, oid string) (Order, error) {
 	}
 
 	pids := maps.Keys(m)
-	pdts, err := products.FindAll(ctx, pids)
+	pdts, err := snapshots(ctx, o.ID, pids)
 	if err != nil {
-		l.LogAttrs(ctx, slog.LevelError, "cannot retrieve the order products", slog.String("error", err.Error()))
-		return Order{}, errors.New("something went wrong")
+		return Order{}, err
 	}
 
 	for _, pdt := range pdts {
@@ -320,11 +596,115 @@ func Find(ctx context.Context, oid string) (Order, error) {
 		})
 	}
 
+	o.History, err = history(ctx, oid)
+	if err != nil {
+		return Order{}, err
+	}
+
+	o.CreditNotes, err = creditNotes(ctx, oid, o.Total.Currency)
+	if err != nil {
+		return Order{}, err
+	}
+
+	refunds, err := db.Redis.HGetAll(ctx, "order:"+oid+":refunds").Result()
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot get the refunded quantities", slog.String("error", err.Error()))
+		return Order{}, errors.New("something went wrong")
+	}
+
+	for pid, qty := range refunds {
+		q, err := strconv.Atoi(qty)
+		if err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot parse the refunded quantity", slog.String("quantity", qty), slog.String("error", err.Error()))
+			continue
+		}
+
+		o.Refunds[pid] = q
+	}
+
 	l.LogAttrs(ctx, slog.LevelInfo, "got the order with notes", slog.Int("notes", len(o.Notes)))
 
 	return o, nil
 }
 
+// Lookup finds a guest order from its id and the email typed
+// during the checkout.
+// The same error is returned when the order does not exist or
+// when the email does not match, to avoid leaking the order ids.
+func Lookup(ctx context.Context, oid, email string) (Order, error) {
+	l := slog.With(slog.String("oid", oid))
+	l.LogAttrs(ctx, slog.LevelInfo, "looking up the order")
+
+	if err := validators.V.Var(email, "required,email"); err != nil {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot validate the email", slog.String("error", err.Error()))
+		return Order{}, errors.New("input:email")
+	}
+
+	if oid == "" {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot validate empty id")
+		return Order{}, errors.New("input:id")
+	}
+
+	o, err := Find(ctx, oid)
+	if err != nil {
+		return Order{}, err
+	}
+
+	if !strings.EqualFold(o.Email, email) {
+		l.LogAttrs(ctx, slog.LevelInfo, "the email does not match")
+		return Order{}, errors.New("oops the data is not found")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the order is found")
+
+	return o, nil
+}
+
+// Claim attaches the guest orders made with the email
+// to the user account and returns the number of orders claimed.
+// It is called after the login, so the email is already verified.
+func Claim(ctx context.Context, email string, uid int) (int, error) {
+	l := slog.With(slog.String("email", email), slog.Int("uid", uid))
+	l.LogAttrs(ctx, slog.LevelInfo, "claiming the guest orders")
+
+	if email == "" || uid == 0 {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot validate the claim")
+		return 0, errors.New("input:email")
+	}
+
+	res, err := Search(ctx, Query{Email: email}, 0, 9999)
+	if err != nil {
+		return 0, errors.New("something went wrong")
+	}
+
+	oids := []string{}
+	for _, o := range res.Orders {
+		if o.UID == 0 && strings.EqualFold(o.Email, email) {
+			oids = append(oids, o.ID)
+		}
+	}
+
+	if len(oids) == 0 {
+		l.LogAttrs(ctx, slog.LevelInfo, "no guest order to claim")
+		return 0, nil
+	}
+
+	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+		for _, oid := range oids {
+			rdb.HSet(ctx, "order:"+oid, "uid", uid)
+		}
+
+		return nil
+	}); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot claim the orders", slog.String("error", err.Error()))
+		return 0, errors.New("something went wrong")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the guest orders are claimed", slog.Int("orders", len(oids)))
+
+	return len(oids), nil
+}
+
 // AddNote create a new note attached to the order
 // The keys are:
 // - order:oid:note:nid => the note data
@@ -384,32 +764,109 @@ func parse(ctx context.Context, m map[string]string) (Order, error) {
 		return Order{}, errors.New("something went wrong")
 	}
 
-	total, err := strconv.ParseFloat(m["total"], 64)
+	// The orders created before the currencies existed
+	// are in the shop currency
+	currency := m["currency"]
+	if currency == "" {
+		currency = conf.Currency
+	}
+
+	total, err := money.ParseMinor(m["total"])
 	if err != nil {
 		l.LogAttrs(ctx, slog.LevelError, "cannot parse the total", slog.String("total", m["total"]), slog.String("error", err.Error()))
 		return Order{}, errors.New("something went wrong")
 	}
 
+	fees := money.New(0)
+	if m["delivery_fees"] != "" {
+		fees, err = money.ParseMinor(m["delivery_fees"])
+		if err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot parse the delivery fees", slog.String("delivery_fees", m["delivery_fees"]), slog.String("error", err.Error()))
+			return Order{}, errors.New("something went wrong")
+		}
+	}
+
+	discount := money.New(0)
+	if m["discount"] != "" {
+		discount, err = money.ParseMinor(m["discount"])
+		if err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot parse the discount", slog.String("discount", m["discount"]), slog.String("error", err.Error()))
+			return Order{}, errors.New("something went wrong")
+		}
+	}
+
+	refunded := money.New(0)
+	if m["refunded"] != "" {
+		refunded, err = money.ParseMinor(m["refunded"])
+		if err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot parse the refunded amount", slog.String("refunded", m["refunded"]), slog.String("error", err.Error()))
+			return Order{}, errors.New("something went wrong")
+		}
+	}
+
+	var weight float64
+	if m["weight"] != "" {
+		weight, err = strconv.ParseFloat(m["weight"], 64)
+		if err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot parse the weight", slog.String("weight", m["weight"]), slog.String("error", err.Error()))
+			return Order{}, errors.New("something went wrong")
+		}
+	}
+
+	var slot pickups.Slot
+	if m["pickup_slot_start"] != "" {
+		start, err := strconv.ParseInt(m["pickup_slot_start"], 10, 64)
+		if err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot parse the pickup slot start", slog.String("pickup_slot_start", m["pickup_slot_start"]), slog.String("error", err.Error()))
+			return Order{}, errors.New("something went wrong")
+		}
+
+		end, err := strconv.ParseInt(m["pickup_slot_end"], 10, 64)
+		if err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot parse the pickup slot end", slog.String("pickup_slot_end", m["pickup_slot_end"]), slog.String("error", err.Error()))
+			return Order{}, errors.New("something went wrong")
+		}
+
+		slot = pickups.Slot{Start: time.Unix(start, 0), End: time.Unix(end, 0)}
+	}
+
+	address := addresses.Parse(m, "address_")
+	billing := addresses.Parse(m, "billing_")
+	if billing.IsZero() {
+		billing = address
+	}
+
 	return Order{
-		ID:            m["id"],
-		UID:           int(uid),
-		Delivery:      m["delivery"],
+		ID:           m["id"],
+		UID:          int(uid),
+		Email:        m["email"],
+		Delivery:     m["delivery"],
+		DeliveryFees: fees.WithCurrency(currency),
+		Pickup: pickups.Location{
+			ID:      m["pickup"],
+			Name:    m["pickup_name"],
+			Street:  m["pickup_street"],
+			Zipcode: m["pickup_zipcode"],
+			City:    m["pickup_city"],
+		},
+		PickupSlot:    slot,
+		Weight:        weight,
 		PaymentStatus: m["payment_status"],
+		PaymentRef:    m["payment_ref"],
+		Invoice:       m["invoice"],
 		Payment:       m["payment"],
 		Status:        m["status"],
-		Address: addresses.Address{
-			Lastname:      m["address_lastname"],
-			Firstname:     m["address_firstname"],
-			City:          m["address_city"],
-			Street:        m["address_street"],
-			Complementary: m["address_complementary"],
-			Zipcode:       m["address_zipcode"],
-			Phone:         m["address_phone"],
-		},
-		Notes:     []Note{},
-		CreatedAt: time.Unix(createdAt, 0),
-		UpdatedAt: time.Unix(updatedAt, 0),
-		Total:     total,
+		Address:       address,
+		Billing:       billing,
+		Notes:         []Note{},
+		CreatedAt:     time.Unix(createdAt, 0),
+		UpdatedAt:     time.Unix(updatedAt, 0),
+		Total:         total.WithCurrency(currency),
+		Taxes:         taxes.UnSerialize(ctx, m["taxes"]),
+		Refunded:      refunded.WithCurrency(currency),
+		Refunds:       map[string]int{},
+		Promotion:     m["promotion"],
+		Discount:      discount.WithCurrency(currency),
 	}, nil
 }
 
@@ -427,6 +884,10 @@ func Search(ctx context.Context, q Query, offset, num int) (SearchResults, error
 		qs += fmt.Sprintf("(@uid:{%d})", q.UID)
 	}
 
+	if q.Email != "" {
+		qs += fmt.Sprintf("(@email:{%s})", db.Escape(q.Email))
+	}
+
 	sorter := "updated_at"
 	if q.Sorter == "created_at" {
 		sorter = "created_at"
@@ -3,6 +3,7 @@ package orders
 import (
 	"artisons/addresses"
 	"artisons/conf"
+	"artisons/money"
 	"artisons/products"
 	"artisons/tests"
 	"errors"
@@ -23,13 +24,13 @@ var order Order = Order{
 	UID:          1,
 	Delivery:     "collect",
 	Payment:      "cash",
-	Total:        105.5,
-	DeliveryFees: 5,
+	Total:        money.New(10550),
+	DeliveryFees: money.New(500),
 	Products: []products.Product{{
 		ID:       "PDT1",
 		Title:    "T-shirt Tester c'est douter",
 		Slug:     "t-shirt-tester-c-est-douter",
-		Price:    100.5,
+		Price:    money.New(10050),
 		Quantity: 1,
 	}},
 	Address: addresses.Address{
@@ -41,6 +42,15 @@ var order Order = Order{
 		Zipcode:       "31244",
 		Phone:         "0559682532",
 	},
+	Billing: addresses.Address{
+		Firstname:     "Arnaud",
+		Lastname:      "Arnaud",
+		City:          "Oran",
+		Street:        "Hay Yasmine",
+		Complementary: "Hay Salam",
+		Zipcode:       "31244",
+		Phone:         "0559682532",
+	},
 	CreatedAt: time.Unix(1699628645, 0),
 }
 
@@ -57,22 +67,30 @@ func TestUpdateStatus(t *testing.T) {
 	tests.ImportData(ctx, cur+"testdata/orders.redis")
 
 	var tests = []struct {
-		name  string
-		id    string
-		value string
-		err   error
+		name    string
+		id      string
+		value   string
+		changed bool
+		err     error
 	}{
-		{"status=processing", order.ID, "processing", nil},
-		{"status=", "", order.ID, errors.New("input:status")},
-		{"status=idontexist", order.ID, "idontexist", errors.New("input:status")},
-		{"id=idontexist", "idontexist", "processing", errors.New("oops the data is not found")},
+		{"status=processing", order.ID, "processing", true, nil},
+		{"status=processing twice", order.ID, "processing", false, nil},
+		{"status=created from processing", order.ID, "created", false, errors.New("the status transition is not allowed")},
+		{"status=", "", order.ID, false, errors.New("input:status")},
+		{"status=idontexist", order.ID, "idontexist", false, errors.New("input:status")},
+		{"id=idontexist", "idontexist", "processing", false, errors.New("oops the data is not found")},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := UpdateStatus(ctx, tt.id, tt.value); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+			changed, err := UpdateStatus(ctx, tt.id, tt.value)
+			if fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
 				t.Fatalf(`err = %v, want %v`, err, tt.err)
 			}
+
+			if changed != tt.changed {
+				t.Fatalf(`changed = %v, want %v`, changed, tt.changed)
+			}
 		})
 	}
 }
@@ -192,3 +210,55 @@ func TestSearch(t *testing.T) {
 		})
 	}
 }
+
+func TestLookup(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/guest.redis")
+
+	var tests = []struct {
+		name  string
+		id    string
+		email string
+		err   error
+	}{
+		{"email=", "ORDGUEST", "", errors.New("input:email")},
+		{"id=", "", "guest@artisons.me", errors.New("input:id")},
+		{"id=idontexist", "idontexist", "guest@artisons.me", errors.New("oops the data is not found")},
+		{"email=arnaud@artisons.me", "ORDGUEST", "arnaud@artisons.me", errors.New("oops the data is not found")},
+		{"email=GUEST@artisons.me", "ORDGUEST", "GUEST@artisons.me", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Lookup(ctx, tt.id, tt.email); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestClaim(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/guest.redis")
+
+	if _, err := Claim(ctx, "", 2); fmt.Sprintf("%s", err) != "input:email" {
+		t.Fatalf(`err = %v, want input:email`, err)
+	}
+
+	count, err := Claim(ctx, "guest@artisons.me", 2)
+	if count != 1 || err != nil {
+		t.Fatalf(`count = %d, err = %v, want 1, nil`, count, err)
+	}
+
+	o, err := Find(ctx, "ORDGUEST")
+	if o.UID != 2 || err != nil {
+		t.Fatalf(`uid = %d, err = %v, want 2, nil`, o.UID, err)
+	}
+
+	count, err = Claim(ctx, "guest@artisons.me", 3)
+	if count != 0 || err != nil {
+		t.Fatalf(`count = %d, err = %v, want 0, nil`, count, err)
+	}
+}
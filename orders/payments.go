@@ -1,5 +1,185 @@
 package orders
 
-func Payments() {
+import (
+	"artisons/conf"
+	"artisons/db"
+	"artisons/string/stringutil"
+	"artisons/validators"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"time"
 
+	"github.com/redis/go-redis/v9"
+)
+
+// PaymentEvent is a notification sent by a payment
+// provider to the webhook.
+type PaymentEvent struct {
+	// The order ID
+	OID string `json:"oid"`
+
+	// "payment_validated" or "payment_refused"
+	Status string `json:"status"`
+
+	// The provider payment reference
+	Reference string `json:"reference"`
+}
+
+var errPaymentSettled = errors.New("you are not authorized to process this request")
+
+// VerifyPaymentSignature returns true if the signature is the
+// hex encoded HMAC-SHA256 of the body with the webhook secret.
+func VerifyPaymentSignature(body []byte, signature string) bool {
+	if conf.PaymentWebhookSecret == "" || signature == "" {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(conf.PaymentWebhookSecret))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal(sig, expected)
+}
+
+// SavePaymentEvent records a webhook call, even when it is rejected.
+// The data are stored like this:
+// - payment:event:ID => the event data
+// - payments:events => the event ids sorted by reception date
+func SavePaymentEvent(ctx context.Context, provider string, body []byte, result string) (string, error) {
+	l := slog.With(slog.String("provider", provider), slog.String("result", result))
+	l.LogAttrs(ctx, slog.LevelInfo, "saving the payment event")
+
+	id, err := stringutil.Random()
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot generate the event id", slog.String("error", err.Error()))
+		return "", errors.New("something went wrong")
+	}
+
+	now := time.Now()
+
+	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+		rdb.HSet(ctx, "payment:event:"+id,
+			"id", id,
+			"provider", provider,
+			"body", string(body),
+			"result", result,
+			"created_at", now.Unix(),
+		)
+		rdb.ZAdd(ctx, "payments:events", redis.Z{
+			Score:  float64(now.Unix()),
+			Member: id,
+		})
+
+		return nil
+	}); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot save the payment event", slog.String("error", err.Error()))
+		return "", errors.New("something went wrong")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the payment event is saved", slog.String("id", id))
+
+	return id, nil
+}
+
+// UpdatePaymentStatus moves the order payment status from
+// "payment_progress" to "payment_validated" or "payment_refused".
+// Receiving the same status twice is not an error, so the provider
+// can retry its notification safely.
+// The invoice is created when the payment is validated,
+// only once even if the notification is repeated.
+// When the payment is refused, the stock and the pickup slot
+// are given back in the same transaction.
+// An error occurs if the status is invalid or if the payment
+// status was already settled with another value.
+func UpdatePaymentStatus(ctx context.Context, oid, status string) error {
+	l := slog.With(slog.String("oid", oid), slog.String("status", status))
+	l.LogAttrs(ctx, slog.LevelInfo, "updating the payment status")
+
+	if err := validators.V.Var(status, "oneof=payment_validated payment_refused"); err != nil {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot validate the payment status", slog.String("error", err.Error()))
+		return errors.New("input:status")
+	}
+
+	key := "order:" + oid
+	changed := false
+
+	err := db.Redis.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.HGet(ctx, key, "payment_status").Result()
+		if err != nil {
+			return err
+		}
+
+		if current == status {
+			l.LogAttrs(ctx, slog.LevelInfo, "the payment status is already set")
+			return nil
+		}
+
+		if current != "payment_progress" {
+			l.LogAttrs(ctx, slog.LevelInfo, "the payment status is already settled", slog.String("current", current))
+			return errPaymentSettled
+		}
+
+		var qty map[string]string
+		var pickup, slot string
+		if status == "payment_refused" {
+			qty, pickup, slot, err = heldStock(ctx, tx, key)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+			rdb.HSet(ctx, key,
+				"payment_status", status,
+				"updated_at", time.Now().Unix(),
+			)
+
+			releaseStock(ctx, rdb, key, qty, pickup, slot)
+
+			return nil
+		})
+
+		changed = err == nil
+
+		return err
+	}, key, key+":restocked")
+
+	if err != nil {
+		if errors.Is(err, errPaymentSettled) {
+			return err
+		}
+
+		if err == redis.Nil {
+			l.LogAttrs(ctx, slog.LevelInfo, "cannot find the order")
+			return errors.New("oops the data is not found")
+		}
+
+		l.LogAttrs(ctx, slog.LevelError, "cannot update the payment status", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the payment status is updated", slog.Bool("changed", changed))
+
+	// A repeated notification does not touch the invoice
+	if changed && status == "payment_validated" {
+		o, err := Find(ctx, oid)
+		if err != nil {
+			return err
+		}
+
+		if _, err := o.CreateInvoice(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
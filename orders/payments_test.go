@@ -0,0 +1,104 @@
+package orders
+
+import (
+	"artisons/conf"
+	"artisons/db"
+	"artisons/tests"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestVerifyPaymentSignature(t *testing.T) {
+	secret := conf.PaymentWebhookSecret
+	t.Cleanup(func() { conf.PaymentWebhookSecret = secret })
+
+	conf.PaymentWebhookSecret = "secret"
+	body := []byte(`{"oid":"ORD3","status":"payment_validated"}`)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	sig := hex.EncodeToString(mac.Sum(nil))
+
+	var tests = []struct {
+		name      string
+		signature string
+		valid     bool
+	}{
+		{"signature=valid", sig, true},
+		{"signature=", "", false},
+		{"signature=invalid", "1234", false},
+		{"signature=nothex", "hello", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if valid := VerifyPaymentSignature(body, tt.signature); valid != tt.valid {
+				t.Fatalf(`valid = %v, want %v`, valid, tt.valid)
+			}
+		})
+	}
+}
+
+func TestUpdatePaymentStatus(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/payments.redis")
+
+	var tests = []struct {
+		name   string
+		id     string
+		status string
+		err    error
+	}{
+		{"status=payment_validated", "ORD3", "payment_validated", nil},
+		{"status=payment_validated twice", "ORD3", "payment_validated", nil},
+		{"status=payment_refused after validated", "ORD3", "payment_refused", errors.New("you are not authorized to process this request")},
+		{"status=payment_refused already refused", "ORD4", "payment_refused", nil},
+		{"status=idontexist", "ORD3", "idontexist", errors.New("input:status")},
+		{"id=idontexist", "idontexist", "payment_validated", errors.New("oops the data is not found")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := UpdatePaymentStatus(ctx, tt.id, tt.status); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSavePaymentEvent(t *testing.T) {
+	ctx := tests.Context()
+
+	id, err := SavePaymentEvent(ctx, "fake", []byte(`{"oid":"ORD3"}`), "ok")
+	if err != nil || id == "" {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+}
+
+func TestUpdatePaymentStatusRefused(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/payments.redis")
+
+	if err := UpdatePaymentStatus(ctx, "ORD8", "payment_refused"); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if qty, _ := db.Redis.HGet(ctx, "product:PAY1", "quantity").Result(); qty != "3" {
+		t.Fatalf(`qty = %s, want 3`, qty)
+	}
+
+	// The stock is not given back twice
+	if _, err := UpdateStatus(ctx, "ORD8", "canceled"); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if qty, _ := db.Redis.HGet(ctx, "product:PAY1", "quantity").Result(); qty != "3" {
+		t.Fatalf(`qty = %s, want 3`, qty)
+	}
+}
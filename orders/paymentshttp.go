@@ -0,0 +1,85 @@
+package orders
+
+import (
+	"artisons/shops"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+// PaymentWebhookHandler receives the asynchronous payment
+// notifications sent by the providers.
+// The body is signed with HMAC-SHA256 and the hex signature
+// is sent in the X-Signature header.
+// Every call is recorded, even when it is rejected.
+func PaymentWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	provider := r.PathValue("provider")
+
+	l := slog.With(slog.String("provider", provider))
+	l.LogAttrs(ctx, slog.LevelInfo, "receiving a payment event")
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1024*64))
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot read the body", slog.String("error", err.Error()))
+		http.Error(w, "something went wrong", http.StatusBadRequest)
+		return
+	}
+
+	result, code := processPaymentEvent(r, provider, body)
+
+	SavePaymentEvent(ctx, provider, body, result)
+
+	if code != http.StatusOK {
+		http.Error(w, result, code)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func processPaymentEvent(r *http.Request, provider string, body []byte) (string, int) {
+	ctx := r.Context()
+	l := slog.With(slog.String("provider", provider))
+
+	if !VerifyPaymentSignature(body, r.Header.Get("X-Signature")) {
+		l.LogAttrs(ctx, slog.LevelInfo, "the signature is invalid")
+		return "the signature is invalid", http.StatusUnauthorized
+	}
+
+	if _, err := shops.FindPaymentProvider(ctx, provider); err != nil {
+		return err.Error(), http.StatusNotFound
+	}
+
+	var e PaymentEvent
+	if err := json.Unmarshal(body, &e); err != nil {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot parse the event", slog.String("error", err.Error()))
+		return "the data is invalid", http.StatusBadRequest
+	}
+
+	o, err := Find(ctx, e.OID)
+	if err != nil {
+		return err.Error(), http.StatusNotFound
+	}
+
+	if o.Payment != provider {
+		l.LogAttrs(ctx, slog.LevelInfo, "the order is not paid with the provider", slog.String("payment", o.Payment))
+		return "you are not authorized to process this request", http.StatusForbidden
+	}
+
+	if o.PaymentRef != "" && o.PaymentRef != e.Reference {
+		l.LogAttrs(ctx, slog.LevelInfo, "the payment reference does not match", slog.String("ref", e.Reference))
+		return "you are not authorized to process this request", http.StatusForbidden
+	}
+
+	if err := UpdatePaymentStatus(ctx, o.ID, e.Status); err != nil {
+		if err.Error() == "something went wrong" {
+			return err.Error(), http.StatusInternalServerError
+		}
+
+		return err.Error(), http.StatusConflict
+	}
+
+	return "ok", http.StatusOK
+}
@@ -0,0 +1,403 @@
+package orders
+
+import (
+	"artisons/db"
+	"artisons/money"
+	"artisons/products"
+	"artisons/promotions"
+	"artisons/shops"
+	"artisons/stats"
+	"artisons/string/stringutil"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// CreditNote is the document created for each refund
+type CreditNote struct {
+	ID     string
+	OID    string
+	Amount money.Money
+	Reason string
+
+	// The refunded quantities indexed by product id
+	Lines map[string]int
+
+	// "pending" while the provider processes the refund, then "refunded"
+	Status string
+
+	CreatedAt time.Time
+}
+
+var errRefundLines = errors.New("input:lines")
+
+var errRefundAmount = errors.New("input:amount")
+
+var errRefundPayment = errors.New("input:payment_status")
+
+// refundAttempts is the number of times the credit note
+// validation is tried when the order changes meanwhile.
+const refundAttempts = 3
+
+// Refund refunds a part or the totality of the order through
+// the payment provider.
+// The lines are the quantities to refund indexed by product id.
+// If the amount is zero, it is calculated from the lines,
+// minus their part of the promotion discount, split between
+// the lines covered by the promotion.
+// The refunded quantities are put back in stock, unless the
+// stock was already given back when the order was canceled,
+// and the statistics revenues are decreased.
+// When the order total is refunded, the payment status
+// is "payment_refunded".
+// An error occurs if the payment is not validated, if the reason is empty, if a line quantity
+// is greater than the quantity not refunded yet or if the
+// amount is greater than the amount not refunded yet.
+// The keys are:
+// - order:oid:credit:cnid => the credit note data
+// - order:oid:credit:cnid:products => the credit note quantities
+// - order:oid:credits => the credit note ids
+// - order:oid:refunds => the refunded quantities
+// - order:oid:restocked => the quantities put back in stock
+// - order:oid => the refunded amount
+func Refund(ctx context.Context, oid string, lines map[string]int, amount money.Money, reason string) (CreditNote, error) {
+	l := slog.With(slog.String("oid", oid), slog.Any("amount", amount))
+	l.LogAttrs(ctx, slog.LevelInfo, "refunding the order")
+
+	if reason == "" {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot validate the reason")
+		return CreditNote{}, errors.New("input:reason")
+	}
+
+	if amount.Amount < 0 {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot validate the amount")
+		return CreditNote{}, errRefundAmount
+	}
+
+	o, err := Find(ctx, oid)
+	if err != nil {
+		return CreditNote{}, err
+	}
+
+	// A partly refunded order keeps the validated status
+	if o.PaymentStatus != "payment_validated" {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot refund an order without validated payment", slog.String("payment_status", o.PaymentStatus))
+		return CreditNote{}, errRefundPayment
+	}
+
+	p, err := shops.FindPaymentProvider(ctx, o.Payment)
+	if err != nil {
+		return CreditNote{}, err
+	}
+
+	id, err := stringutil.Random()
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot generate the credit note id", slog.String("error", err.Error()))
+		return CreditNote{}, errors.New("something went wrong")
+	}
+
+	cn := CreditNote{
+		ID:        id,
+		OID:       oid,
+		Amount:    amount.WithCurrency(o.Total.Currency),
+		Reason:    reason,
+		Lines:     map[string]int{},
+		Status:    "pending",
+		CreatedAt: time.Now(),
+	}
+
+	for pid, qty := range lines {
+		if qty > 0 {
+			cn.Lines[pid] = qty
+		}
+	}
+
+	key := "order:" + oid
+	refunded := money.New(0).WithCurrency(o.Total.Currency)
+	covered := o.promoted(ctx)
+
+	// The credit note is stored before calling the provider,
+	// so two refunds in parallel cannot exceed the order.
+	err = db.Redis.Watch(ctx, func(tx *redis.Tx) error {
+		refunds, err := tx.HGetAll(ctx, key+":refunds").Result()
+		if err != nil {
+			return err
+		}
+
+		minor, err := tx.HGet(ctx, key, "refunded").Int64()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+
+		refunded = money.New(minor).WithCurrency(o.Total.Currency)
+		total := money.New(0).WithCurrency(o.Total.Currency)
+		promoted := money.New(0).WithCurrency(o.Total.Currency)
+
+		for pid, qty := range cn.Lines {
+			ordered, price, ok := o.line(pid)
+			if !ok {
+				l.LogAttrs(ctx, slog.LevelInfo, "the product is not in the order", slog.String("pid", pid))
+				return errRefundLines
+			}
+
+			done, _ := strconv.Atoi(refunds[pid])
+			if qty+done > ordered {
+				l.LogAttrs(ctx, slog.LevelInfo, "the quantity exceeds the ordered quantity", slog.String("pid", pid), slog.Int("quantity", qty))
+				return errRefundLines
+			}
+
+			total = total.Add(price.Mul(qty))
+
+			if covered[pid] {
+				promoted = promoted.Add(price.Mul(qty))
+			}
+		}
+
+		// The promotion discount is split between
+		// the covered lines by their amounts
+		if o.Discount.Amount > 0 {
+			total = total.Sub(o.Discount.Ratio(promoted.Amount, o.subtotal(covered).Amount))
+		}
+
+		if cn.Amount.IsZero() {
+			cn.Amount = total
+		}
+
+		if cn.Amount.Amount <= 0 || refunded.Add(cn.Amount).Cmp(o.Total) > 0 {
+			l.LogAttrs(ctx, slog.LevelInfo, "the amount exceeds the order total", slog.Any("refunded", refunded))
+			return errRefundAmount
+		}
+
+		_, err = tx.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+			rdb.HSet(ctx, key+":credit:"+cn.ID,
+				"id", cn.ID,
+				"oid", oid,
+				"amount", cn.Amount.Minor(),
+				"reason", cn.Reason,
+				"status", cn.Status,
+				"created_at", cn.CreatedAt.Unix(),
+			)
+
+			for pid, qty := range cn.Lines {
+				rdb.HSet(ctx, key+":credit:"+cn.ID+":products", pid, qty)
+				rdb.HIncrBy(ctx, key+":refunds", pid, int64(qty))
+			}
+
+			rdb.SAdd(ctx, key+":credits", cn.ID)
+			rdb.HIncrBy(ctx, key, "refunded", cn.Amount.Amount)
+
+			return nil
+		})
+
+		return err
+	}, key, key+":refunds")
+
+	if errors.Is(err, errRefundLines) || errors.Is(err, errRefundAmount) {
+		return CreditNote{}, err
+	}
+
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot store the credit note", slog.String("error", err.Error()))
+		return CreditNote{}, errors.New("something went wrong")
+	}
+
+	if err := p.Refund(ctx, o.PaymentRef, cn.Amount); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot refund through the provider", slog.String("error", err.Error()))
+
+		if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+			for pid, qty := range cn.Lines {
+				rdb.HIncrBy(ctx, key+":refunds", pid, int64(-qty))
+			}
+
+			rdb.HIncrBy(ctx, key, "refunded", -cn.Amount.Amount)
+			rdb.SRem(ctx, key+":credits", cn.ID)
+			rdb.Del(ctx, key+":credit:"+cn.ID, key+":credit:"+cn.ID+":products")
+
+			return nil
+		}); err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot rollback the credit note", slog.String("cnid", cn.ID), slog.String("error", err.Error()))
+		}
+
+		return CreditNote{}, errors.New("something went wrong")
+	}
+
+	cn.Status = "refunded"
+
+	qty := map[string]string{}
+	for pid, q := range cn.Lines {
+		qty[pid] = fmt.Sprintf("%d", q)
+	}
+
+	// The canceled order gave back all its stock already,
+	// so the refunded quantities are not put back twice.
+	// The provider refunded already, so the validation is
+	// tried again when the order changed meanwhile.
+	for attempt := 1; attempt <= refundAttempts; attempt++ {
+		err = validateCreditNote(ctx, cn, o, refunded, qty)
+		if err != redis.TxFailedErr {
+			break
+		}
+
+		l.LogAttrs(ctx, slog.LevelInfo, "the order changed during the credit note validation", slog.Int("attempt", attempt))
+	}
+
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot validate the credit note", slog.String("cnid", cn.ID), slog.String("error", err.Error()))
+		return CreditNote{}, errors.New("something went wrong")
+	}
+
+	// The refunded tax is proportional to the order VAT
+	tax := cn.Amount.Ratio(o.vat().Tax.Amount, o.Total.Amount)
+
+	go stats.Refund(ctx, oid, cn.Lines, cn.Amount, tax)
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the order is refunded", slog.String("cnid", cn.ID))
+
+	return cn, nil
+}
+
+// validateCreditNote switches the credit note to refunded, sets
+// the order as refunded when the total is reached, and puts the
+// refunded quantities back in stock unless the order gave back its
+// stock already. redis.TxFailedErr is returned when the order changed.
+func validateCreditNote(ctx context.Context, cn CreditNote, o Order, refunded money.Money, qty map[string]string) error {
+	key := "order:" + o.ID
+
+	return db.Redis.Watch(ctx, func(tx *redis.Tx) error {
+		released, err := tx.HGet(ctx, key, "stock_released").Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+			rdb.HSet(ctx, key+":credit:"+cn.ID, "status", cn.Status)
+
+			if refunded.Add(cn.Amount).Cmp(o.Total) >= 0 {
+				rdb.HSet(ctx, key, "payment_status", "payment_refunded")
+			}
+
+			if released != "1" {
+				products.RestoreStock(ctx, rdb, qty)
+
+				for pid, q := range cn.Lines {
+					rdb.HIncrBy(ctx, key+":restocked", pid, int64(q))
+				}
+			}
+
+			return nil
+		})
+
+		return err
+	}, key, key+":restocked")
+}
+
+// line returns the ordered quantity and the price of the product
+func (o Order) line(pid string) (int, money.Money, bool) {
+	for _, p := range o.Products {
+		if p.ID == pid {
+			return p.Quantity, p.DiscountedPrice(), true
+		}
+	}
+
+	return 0, money.New(0), false
+}
+
+// subtotal returns the amount of the order products
+// covered by the promotion, before the promotion discount
+func (o Order) subtotal(covered map[string]bool) money.Money {
+	total := money.New(0).WithCurrency(o.Total.Currency)
+	for _, p := range o.Products {
+		if covered[p.ID] {
+			total = total.Add(p.DiscountedPrice().Mul(p.Quantity))
+		}
+	}
+
+	return total
+}
+
+// promoted returns the order products covered by the promotion,
+// indexed by product id, with the same rule than promotions.Check.
+// All the products are covered if the promotion does not exist anymore.
+func (o Order) promoted(ctx context.Context) map[string]bool {
+	covered := map[string]bool{}
+	if o.Promotion == "" {
+		return covered
+	}
+
+	p, err := promotions.Find(ctx, o.Promotion)
+
+	for _, pdt := range o.Products {
+		covered[pdt.ID] = err != nil || p.Eligible(pdt)
+	}
+
+	return covered
+}
+
+// creditNotes returns the order credit notes,
+// in the order currency
+func creditNotes(ctx context.Context, oid, currency string) ([]CreditNote, error) {
+	l := slog.With(slog.String("oid", oid))
+
+	ids, err := db.Redis.SMembers(ctx, "order:"+oid+":credits").Result()
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot get the credit note ids", slog.String("error", err.Error()))
+		return []CreditNote{}, errors.New("something went wrong")
+	}
+
+	cmds, err := db.Redis.Pipelined(ctx, func(rdb redis.Pipeliner) error {
+		for _, id := range ids {
+			key := "order:" + oid + ":credit:" + id
+			rdb.HGetAll(ctx, key)
+			rdb.HGetAll(ctx, key+":products")
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot get the credit notes", slog.String("error", err.Error()))
+		return []CreditNote{}, errors.New("something went wrong")
+	}
+
+	cns := []CreditNote{}
+
+	for i := 0; i+1 < len(cmds); i += 2 {
+		val := cmds[i].(*redis.MapStringStringCmd).Val()
+		pdts := cmds[i+1].(*redis.MapStringStringCmd).Val()
+
+		amount, err := money.ParseMinor(val["amount"])
+		if err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot parse the amount", slog.String("amount", val["amount"]), slog.String("error", err.Error()))
+			continue
+		}
+
+		createdAt, err := strconv.ParseInt(val["created_at"], 10, 64)
+		if err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot parse the created at date", slog.String("created_at", val["created_at"]), slog.String("error", err.Error()))
+			continue
+		}
+
+		lines := map[string]int{}
+		for pid, qty := range pdts {
+			q, _ := strconv.Atoi(qty)
+			lines[pid] = q
+		}
+
+		cns = append(cns, CreditNote{
+			ID:        val["id"],
+			OID:       oid,
+			Amount:    amount.WithCurrency(currency),
+			Reason:    val["reason"],
+			Lines:     lines,
+			Status:    val["status"],
+			CreatedAt: time.Unix(createdAt, 0),
+		})
+	}
+
+	return cns, nil
+}
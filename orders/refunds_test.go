@@ -0,0 +1,93 @@
+package orders
+
+import (
+	"artisons/db"
+	"artisons/money"
+	"artisons/tests"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRefund(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/refunds.redis")
+
+	var tests = []struct {
+		name   string
+		id     string
+		lines  map[string]int
+		amount int64
+		reason string
+		want   int64
+		err    error
+	}{
+		{"reason=", "ORD5", map[string]int{"PDT1": 1}, 0, "", 0, errors.New("input:reason")},
+		{"id=idontexist", "idontexist", map[string]int{"PDT1": 1}, 0, "Broken", 0, errors.New("oops the data is not found")},
+		{"pid=idontexist", "ORD5", map[string]int{"idontexist": 1}, 0, "Broken", 0, errors.New("input:lines")},
+		{"lines=PDT1:1", "ORD5", map[string]int{"PDT1": 1}, 0, "Broken", 10050, nil},
+		{"lines=PDT1:2 exceeds", "ORD5", map[string]int{"PDT1": 2}, 0, "Broken", 0, errors.New("input:lines")},
+		{"amount=500 exceeds", "ORD5", map[string]int{}, 50000, "Gesture", 0, errors.New("input:amount")},
+		{"amount=10", "ORD5", map[string]int{}, 1000, "Gesture", 1000, nil},
+		{"payment_status=payment_progress", "ORD9", map[string]int{"PDT1": 1}, 0, "Broken", 0, errors.New("input:payment_status")},
+		{"lines=RFD1:1 outside the promotion", "ORD11", map[string]int{"RFD1": 1}, 0, "Broken", 10000, nil},
+		{"lines=PDT1:1 inside the promotion", "ORD11", map[string]int{"PDT1": 1}, 0, "Broken", 9050, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cn, err := Refund(ctx, tt.id, tt.lines, money.New(tt.amount), tt.reason)
+			if fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+
+			if cn.Amount.Amount != tt.want {
+				t.Fatalf(`cn.Amount = %d, want %d`, cn.Amount.Amount, tt.want)
+			}
+		})
+	}
+
+	o, err := Find(ctx, "ORD5")
+	if err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if o.Refunded.Amount != 11050 || o.Refunds["PDT1"] != 1 || len(o.CreditNotes) != 2 {
+		t.Fatalf(`o.Refunded = %s, o.Refunds = %v, credit notes = %d, want 110.50, PDT1:1, 2`, o.Refunded, o.Refunds, len(o.CreditNotes))
+	}
+}
+
+func TestRefundCanceled(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/refunds.redis")
+
+	if _, err := Refund(ctx, "ORD10", map[string]int{"RFD1": 1}, money.New(0), "Canceled"); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	// The canceled order gave back its stock already
+	if qty, _ := db.Redis.HGet(ctx, "product:RFD1", "quantity").Result(); qty != "2" {
+		t.Fatalf(`qty = %s, want 2`, qty)
+	}
+}
+
+func TestCancelRefunded(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/refunds.redis")
+
+	if _, err := Refund(ctx, "ORD11", map[string]int{"RFD1": 1}, money.New(0), "Broken"); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if _, err := UpdateStatus(ctx, "ORD11", "canceled"); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	// The refunded plate is put back in stock only once
+	if qty, _ := db.Redis.HGet(ctx, "product:RFD1", "quantity").Result(); qty != "3" {
+		t.Fatalf(`qty = %s, want 3`, qty)
+	}
+}
@@ -0,0 +1,232 @@
+package orders
+
+import (
+	"artisons/db"
+	"artisons/money"
+	"artisons/products"
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func snapshotKey(oid, pid string) string {
+	return "order:" + oid + ":product:" + pid
+}
+
+// snapshot adds into the pipeline the copy of the product
+// as it is at purchase time, so later product changes
+// do not alter the order.
+// The discount is stored only if it is running, without dates,
+// so the snapshot keeps the price paid.
+// The tags are kept to know the lines covered by the promotion.
+func snapshot(ctx context.Context, rdb redis.Pipeliner, oid string, p products.Product) {
+	var discount float64
+	if p.Discounted() {
+		discount = p.Discount
+	}
+
+	rdb.HSet(ctx, snapshotKey(oid, p.ID),
+		"id", p.ID,
+		"title", p.Title,
+		"sku", p.Sku,
+		"slug", p.Slug,
+		"price", p.Price.Minor(),
+		"currency", p.Price.Currency,
+		"discount", discount,
+		"weight", p.Weight,
+		"image", p.Image(),
+		"group", p.Group,
+		"options", db.Escape(products.SerializeOptions(ctx, p.Options)),
+		"tags", strings.Join(p.Tags, ";"),
+		"updated_at", p.UpdatedAt.Unix(),
+	)
+}
+
+// snapshotImages returns the primary image of the snapshot,
+// stored in image_1 before the images list.
+func snapshotImages(data map[string]string) []products.Image {
+	id := data["image"]
+	if id == "" {
+		id = data["image_1"]
+	}
+
+	if id == "" {
+		return []products.Image{}
+	}
+
+	return []products.Image{{ID: id, Alt: map[string]string{}}}
+}
+
+func parseSnapshot(ctx context.Context, data map[string]string) (products.Product, error) {
+	l := slog.With(slog.String("id", data["id"]))
+
+	price, err := money.ParseMinor(data["price"])
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot parse the price", slog.String("price", data["price"]), slog.String("error", err.Error()))
+		return products.Product{}, errors.New("something went wrong")
+	}
+
+	if data["currency"] != "" {
+		price = price.WithCurrency(data["currency"])
+	}
+
+	discount, err := strconv.ParseFloat(data["discount"], 64)
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot parse the discount", slog.String("discount", data["discount"]), slog.String("error", err.Error()))
+		return products.Product{}, errors.New("something went wrong")
+	}
+
+	weight, err := strconv.ParseFloat(data["weight"], 64)
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot parse the weight", slog.String("weight", data["weight"]), slog.String("error", err.Error()))
+		return products.Product{}, errors.New("something went wrong")
+	}
+
+	updatedAt, err := strconv.ParseInt(data["updated_at"], 10, 64)
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot parse the updated at", slog.String("updated_at", data["updated_at"]), slog.String("error", err.Error()))
+		return products.Product{}, errors.New("something went wrong")
+	}
+
+	tags := []string{}
+	if data["tags"] != "" {
+		tags = strings.Split(data["tags"], ";")
+	}
+
+	return products.Product{
+		ID:        data["id"],
+		Title:     data["title"],
+		Sku:       data["sku"],
+		Slug:      data["slug"],
+		Price:     price,
+		Discount:  discount,
+		Weight:    weight,
+		Images:    snapshotImages(data),
+		Group:     data["group"],
+		Options:   products.ParseOptions(ctx, db.Unescape(data["options"])),
+		Tags:      tags,
+		UpdatedAt: time.Unix(updatedAt, 0),
+	}, nil
+}
+
+// snapshots returns the order products from the snapshots.
+// The orders created before the snapshots existed are
+// loaded from the current products.
+func snapshots(ctx context.Context, oid string, pids []string) ([]products.Product, error) {
+	l := slog.With(slog.String("oid", oid))
+
+	cmds, err := db.Redis.Pipelined(ctx, func(rdb redis.Pipeliner) error {
+		for _, pid := range pids {
+			rdb.HGetAll(ctx, snapshotKey(oid, pid))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot get the order snapshots", slog.String("error", err.Error()))
+		return []products.Product{}, errors.New("something went wrong")
+	}
+
+	pdts := []products.Product{}
+	missing := []string{}
+
+	for i, cmd := range cmds {
+		val := cmd.(*redis.MapStringStringCmd).Val()
+		if len(val) == 0 {
+			missing = append(missing, pids[i])
+			continue
+		}
+
+		p, err := parseSnapshot(ctx, val)
+		if err != nil {
+			return []products.Product{}, err
+		}
+
+		pdts = append(pdts, p)
+	}
+
+	if len(missing) == 0 {
+		return pdts, nil
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the order has products without snapshot", slog.Any("ids", missing))
+
+	legacy, err := products.FindAll(ctx, missing)
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot retrieve the order products", slog.String("error", err.Error()))
+		return []products.Product{}, errors.New("something went wrong")
+	}
+
+	return append(pdts, legacy...), nil
+}
+
+// SnapshotMissing creates the snapshots of the products in
+// the orders created before the snapshots existed, so these
+// orders keep the products when they are purged.
+func SnapshotMissing(ctx context.Context, pids []string) error {
+	l := slog.With(slog.Any("pids", pids))
+	l.LogAttrs(ctx, slog.LevelInfo, "creating the missing snapshots")
+
+	keys, err := db.Scan(ctx, "order:*:products")
+	if err != nil {
+		return errors.New("something went wrong")
+	}
+
+	pdts, err := products.FindAll(ctx, pids)
+	if err != nil {
+		return errors.New("something went wrong")
+	}
+
+	cmds, err := db.Redis.Pipelined(ctx, func(rdb redis.Pipeliner) error {
+		for _, key := range keys {
+			oid := strings.TrimSuffix(strings.TrimPrefix(key, "order:"), ":products")
+
+			for _, p := range pdts {
+				rdb.HExists(ctx, key, p.ID)
+				rdb.Exists(ctx, snapshotKey(oid, p.ID))
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot check the order snapshots", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	count := 0
+
+	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+		i := 0
+		for _, key := range keys {
+			oid := strings.TrimSuffix(strings.TrimPrefix(key, "order:"), ":products")
+
+			for _, p := range pdts {
+				ordered := cmds[i].(*redis.BoolCmd).Val()
+				exists := cmds[i+1].(*redis.IntCmd).Val()
+				i += 2
+
+				if ordered && exists == 0 {
+					snapshot(ctx, rdb, oid, p)
+					count++
+				}
+			}
+		}
+
+		return nil
+	}); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot store the snapshots", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the missing snapshots are created", slog.Int("snapshots", count))
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package orders
+
+import (
+	"artisons/db"
+	"artisons/tests"
+	"testing"
+)
+
+func TestSnapshots(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/snapshots.redis")
+
+	pdts, err := snapshots(ctx, "ORD6", []string{"PDT1", "PDT2"})
+	if err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if len(pdts) != 2 {
+		t.Fatalf(`len(pdts) = %d, want 2`, len(pdts))
+	}
+
+	for _, p := range pdts {
+		switch p.ID {
+		case "PDT1":
+			if p.Title != "Old title" || p.Price.Amount != 5000 {
+				t.Fatalf(`p = %v, want the snapshot`, p)
+			}
+		case "PDT2":
+			if p.Title != "Mug" || p.Price.Amount != 10000 {
+				t.Fatalf(`p = %v, want the current product`, p)
+			}
+		}
+	}
+}
+
+func TestSnapshotMissing(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/snapshots.redis")
+
+	if err := SnapshotMissing(ctx, []string{"SNAP1"}); err != nil {
+		t.Fatalf(`SnapshotMissing(ctx, [SNAP1]) = %v, want nil`, err)
+	}
+
+	title, _ := db.Redis.HGet(ctx, snapshotKey("ORD7", "SNAP1"), "title").Result()
+	if title != "Vase" {
+		t.Fatalf(`title = %s, want Vase`, title)
+	}
+
+	if exists, _ := db.Redis.Exists(ctx, snapshotKey("ORD6", "SNAP1")).Result(); exists != 0 {
+		t.Fatalf(`exists = %d, want 0`, exists)
+	}
+}
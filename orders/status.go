@@ -0,0 +1,133 @@
+package orders
+
+import (
+	"artisons/conf"
+	"artisons/db"
+	"artisons/notifications/mails"
+	"artisons/notifications/vapid"
+	"artisons/users"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+
+	"golang.org/x/text/message"
+)
+
+// History is an order status change
+type History struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// transitions lists the statuses reachable from each status.
+// "delivered" and "canceled" are final.
+var transitions = map[string][]string{
+	"created":    {"processing", "delivering", "canceled"},
+	"processing": {"delivering", "delivered", "canceled"},
+	"delivering": {"delivered", "canceled"},
+	"delivered":  {},
+	"canceled":   {},
+}
+
+var errStatusTransition = errors.New("the status transition is not allowed")
+
+// CanTransition returns true if the order can move
+// from the status to the next one.
+func CanTransition(from, to string) bool {
+	return slices.Contains(transitions[from], to)
+}
+
+// NextStatuses returns the statuses reachable from the status.
+func NextStatuses(status string) []string {
+	return transitions[status]
+}
+
+// NextStatuses returns the statuses reachable
+// from the order status, proposed in the admin form.
+func (o Order) NextStatuses() []string {
+	return NextStatuses(o.Status)
+}
+
+func history(ctx context.Context, oid string) ([]History, error) {
+	l := slog.With(slog.String("oid", oid))
+
+	vals, err := db.Redis.LRange(ctx, "order:"+oid+":history", 0, -1).Result()
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot get the order history", slog.String("error", err.Error()))
+		return []History{}, errors.New("something went wrong")
+	}
+
+	h := []History{}
+
+	for _, val := range vals {
+		var entry History
+		if err := json.Unmarshal([]byte(val), &entry); err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot parse the history entry", slog.String("entry", val), slog.String("error", err.Error()))
+			continue
+		}
+
+		h = append(h, entry)
+	}
+
+	return h, nil
+}
+
+// SendStatusNotification notifies the customer about the
+// order status by email and by push notification on each
+// device having a push token.
+// A guest order is notified by email only, in the default
+// language, to the order email.
+func (o Order) SendStatusNotification(ctx context.Context) (string, error) {
+	l := slog.With(slog.String("oid", o.ID), slog.String("status", o.Status))
+	l.LogAttrs(ctx, slog.LevelInfo, "sending the status notification")
+
+	if o.UID == 0 {
+		p := message.NewPrinter(conf.DefaultLocale)
+		msg := p.Sprintf("email_order_status", o.ID, p.Sprintf(o.Status))
+
+		if err := mails.Send(ctx, o.Email, p.Sprintf("email_order_update", o.ID), msg); err != nil {
+			l.LogAttrs(ctx, slog.LevelWarn, "cannot send the email", slog.String("error", err.Error()))
+			return "", err
+		}
+
+		l.LogAttrs(ctx, slog.LevelInfo, "the status notification is sent to the guest")
+
+		return msg, nil
+	}
+
+	u, err := users.FindByUID(ctx, o.UID)
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelWarn, "cannot get the user", slog.Int("uid", o.UID), slog.String("error", err.Error()))
+		return "", err
+	}
+
+	p := message.NewPrinter(u.Lang)
+	msg := p.Sprintf("email_order_status", o.ID, p.Sprintf(o.Status))
+
+	err = mails.Send(ctx, u.Email, p.Sprintf("email_order_update", o.ID), msg)
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelWarn, "cannot send the email", slog.String("error", err.Error()))
+		return "", err
+	}
+
+	sessions, err := u.Sessions(ctx)
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelWarn, "cannot get the sessions", slog.Int("uid", u.ID), slog.String("error", err.Error()))
+		return msg, err
+	}
+
+	for _, session := range sessions {
+		if session.WPToken != "" {
+			vapid.Send(ctx, session.WPToken, msg)
+		}
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the status notification is sent")
+
+	return msg, nil
+}
@@ -0,0 +1,62 @@
+package orders
+
+import (
+	"artisons/tests"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	var tests = []struct {
+		name    string
+		from    string
+		to      string
+		allowed bool
+	}{
+		{"created=>processing", "created", "processing", true},
+		{"processing=>delivered", "processing", "delivered", true},
+		{"delivering=>canceled", "delivering", "canceled", true},
+		{"delivered=>created", "delivered", "created", false},
+		{"canceled=>processing", "canceled", "processing", false},
+		{"delivering=>processing", "delivering", "processing", false},
+		{"idontexist=>created", "idontexist", "created", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if allowed := CanTransition(tt.from, tt.to); allowed != tt.allowed {
+				t.Fatalf(`allowed = %v, want %v`, allowed, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestNextStatuses(t *testing.T) {
+	o := Order{Status: "delivering"}
+
+	if statuses := o.NextStatuses(); len(statuses) != 2 || statuses[0] != "delivered" || statuses[1] != "canceled" {
+		t.Fatalf(`statuses = %v, want [delivered canceled]`, statuses)
+	}
+
+	if statuses := NextStatuses("canceled"); len(statuses) != 0 {
+		t.Fatalf(`statuses = %v, want []`, statuses)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/orders.redis")
+
+	if _, err := UpdateStatus(ctx, "ORD1", "processing"); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	h, err := history(ctx, "ORD1")
+	if err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if len(h) != 1 || h[0].From != "created" || h[0].To != "processing" || h[0].Actor != "system" {
+		t.Fatalf(`history = %v, want created => processing by system`, h)
+	}
+}
@@ -0,0 +1,518 @@
+// Package pickups manages the locations where the customers
+// collect their orders, like the workshops or the markets
+package pickups
+
+import (
+	"artisons/db"
+	"artisons/validators"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/redis/go-redis/v9"
+)
+
+// SlotLayout is the format used to type a slot in the admin
+const SlotLayout = "2006-01-02 15:04"
+
+type Location struct {
+	ID string `validate:"required,alphanum"`
+
+	Name string `validate:"required"`
+
+	Street  string `validate:"required"`
+	City    string `validate:"required"`
+	Zipcode string `validate:"required"`
+
+	// The opening hours, free text displayed to the customer
+	Hours string
+
+	// The maximum number of orders per slot, 0 for unlimited
+	Capacity int `validate:"gte=0"`
+
+	// The time slots, if empty the customer comes
+	// during the opening hours
+	Slots []Slot
+
+	Active bool
+
+	UpdatedAt time.Time
+}
+
+type Slot struct {
+	Start time.Time
+	End   time.Time
+
+	// The number of orders booked on the slot
+	Booked int
+}
+
+type ListResults struct {
+	Total     int
+	Locations []Location
+}
+
+// bookScript books a slot if the capacity is not reached.
+// KEYS[1] is the bookings hash, KEYS[2] the location hash.
+// ARGV[1] is the slot id.
+// It returns 1 when succeed or 0 if the slot is full.
+var bookScript = redis.NewScript(`
+local capacity = tonumber(redis.call('HGET', KEYS[2], 'capacity') or '0')
+local booked = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0')
+if capacity > 0 and booked >= capacity then
+	return 0
+end
+
+redis.call('HINCRBY', KEYS[1], ARGV[1], 1)
+
+return 1
+`)
+
+// ParseSlot parses a slot typed like "2024-06-01 10:00-12:00"
+func ParseSlot(s string) (Slot, error) {
+	date, hours, ok := strings.Cut(strings.TrimSpace(s), " ")
+	if !ok {
+		return Slot{}, fmt.Errorf("the slot %s is not valid", s)
+	}
+
+	from, to, ok := strings.Cut(hours, "-")
+	if !ok {
+		return Slot{}, fmt.Errorf("the slot %s is not valid", s)
+	}
+
+	start, err := time.ParseInLocation(SlotLayout, date+" "+strings.TrimSpace(from), time.Local)
+	if err != nil {
+		return Slot{}, err
+	}
+
+	end, err := time.ParseInLocation(SlotLayout, date+" "+strings.TrimSpace(to), time.Local)
+	if err != nil {
+		return Slot{}, err
+	}
+
+	return Slot{Start: start, End: end}, nil
+}
+
+// ID identifies the slot in the location, by its start
+func (s Slot) ID() string {
+	return s.Start.Format("200601021504")
+}
+
+func (s Slot) String() string {
+	return s.Start.Format(SlotLayout) + "-" + s.End.Format("15:04")
+}
+
+// Full returns true if the slot cannot take more orders
+func (s Slot) Full(capacity int) bool {
+	return capacity > 0 && s.Booked >= capacity
+}
+
+// Address returns the location address on one line
+func (l Location) Address() string {
+	return fmt.Sprintf("%s, %s %s", l.Street, l.Zipcode, l.City)
+}
+
+// Upcoming returns the slots not started yet, sorted by date
+func (l Location) Upcoming() []Slot {
+	now := time.Now()
+	slots := []Slot{}
+
+	for _, s := range l.Slots {
+		if s.Start.After(now) {
+			slots = append(slots, s)
+		}
+	}
+
+	sort.Slice(slots, func(i, j int) bool {
+		return slots[i].Start.Before(slots[j].Start)
+	})
+
+	return slots
+}
+
+// Check returns the slot chosen by the customer.
+// The location has to be active, and the slot has to be
+// upcoming and not full when the location has slots.
+// The slot is ignored for a location without slots.
+func (l Location) Check(ctx context.Context, slot string) (Slot, error) {
+	lg := slog.With(slog.String("id", l.ID), slog.String("slot", slot))
+	lg.LogAttrs(ctx, slog.LevelInfo, "checking the pickup")
+
+	if !l.Active {
+		lg.LogAttrs(ctx, slog.LevelInfo, "the pickup location is not active")
+		return Slot{}, errors.New("the pickup location is not available")
+	}
+
+	if len(l.Slots) == 0 {
+		return Slot{}, nil
+	}
+
+	if slot == "" {
+		lg.LogAttrs(ctx, slog.LevelInfo, "the slot is required")
+		return Slot{}, errors.New("input:slot")
+	}
+
+	for _, s := range l.Upcoming() {
+		if s.ID() != slot {
+			continue
+		}
+
+		if s.Full(l.Capacity) {
+			lg.LogAttrs(ctx, slog.LevelInfo, "the slot is full", slog.Int("booked", s.Booked))
+			return Slot{}, errors.New("the pickup slot is full")
+		}
+
+		return s, nil
+	}
+
+	lg.LogAttrs(ctx, slog.LevelInfo, "the slot is not found")
+
+	return Slot{}, errors.New("the pickup slot is not available")
+}
+
+func (l Location) Validate(ctx context.Context) error {
+	slog.LogAttrs(ctx, slog.LevelInfo, "validating a pickup location")
+
+	if err := validators.V.Struct(l); err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot validate the pickup location", slog.String("error", err.Error()))
+		field := err.(validator.ValidationErrors)[0]
+		low := strings.ToLower(field.Field())
+		return fmt.Errorf("input:%s", low)
+	}
+
+	for _, s := range l.Slots {
+		if !s.End.After(s.Start) {
+			slog.LogAttrs(ctx, slog.LevelInfo, "the slot end is before the start", slog.String("slot", s.String()))
+			return errors.New("input:slots")
+		}
+	}
+
+	slog.LogAttrs(ctx, slog.LevelInfo, "pickup location validated")
+
+	return nil
+}
+
+func Exists(ctx context.Context, id string) (bool, error) {
+	slog.LogAttrs(ctx, slog.LevelInfo, "checking existence", slog.String("id", id))
+
+	exists, err := db.Redis.Exists(ctx, "pickup:"+id).Result()
+
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot check pickup location existence")
+		return false, errors.New("something went wrong")
+	}
+
+	slog.LogAttrs(ctx, slog.LevelInfo, "pickup location existence", slog.String("id", id), slog.Int64("exists", exists))
+
+	return exists > 0, nil
+}
+
+// Save stores the pickup location in Redis.
+// The bookings are not updated, see Book.
+// The keys are:
+// - pickup:id => the location data
+// - pickup:id:bookings => the number of orders per slot id
+// - pickups => the location ids sorted by update date
+func (l Location) Save(ctx context.Context) (string, error) {
+	lg := slog.With(slog.String("id", l.ID))
+	lg.LogAttrs(ctx, slog.LevelInfo, "saving a pickup location")
+
+	now := time.Now()
+	active := 0
+	if l.Active {
+		active = 1
+	}
+
+	slots := []string{}
+	for _, s := range l.Slots {
+		slots = append(slots, s.String())
+	}
+
+	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+		rdb.HSet(ctx, "pickup:"+l.ID,
+			"id", l.ID,
+			"name", l.Name,
+			"street", l.Street,
+			"city", l.City,
+			"zipcode", l.Zipcode,
+			"hours", l.Hours,
+			"capacity", l.Capacity,
+			"slots", strings.Join(slots, ";"),
+			"active", active,
+			"updated_at", now.Unix(),
+		)
+
+		rdb.ZAdd(ctx, "pickups", redis.Z{
+			Score:  float64(now.Unix()),
+			Member: l.ID,
+		})
+
+		return nil
+	}); err != nil {
+		lg.LogAttrs(ctx, slog.LevelError, "cannot store the data", slog.String("error", err.Error()))
+		return "", errors.New("something went wrong")
+	}
+
+	lg.LogAttrs(ctx, slog.LevelInfo, "pickup location saved successfully")
+
+	return l.ID, nil
+}
+
+// parse builds the location from its data and its bookings
+func parse(ctx context.Context, data map[string]string, bookings map[string]string) (Location, error) {
+	lg := slog.With(slog.String("id", data["id"]))
+
+	ints := map[string]int64{}
+	for _, key := range []string{"capacity", "updated_at"} {
+		if data[key] == "" {
+			continue
+		}
+
+		val, err := strconv.ParseInt(data[key], 10, 64)
+		if err != nil {
+			lg.LogAttrs(ctx, slog.LevelError, "cannot parse the value", slog.String("key", key), slog.String("value", data[key]), slog.String("error", err.Error()))
+			return Location{}, fmt.Errorf("input:%s", key)
+		}
+
+		ints[key] = val
+	}
+
+	slots := []Slot{}
+	if data["slots"] != "" {
+		for _, val := range strings.Split(data["slots"], ";") {
+			s, err := ParseSlot(val)
+			if err != nil {
+				lg.LogAttrs(ctx, slog.LevelError, "cannot parse the slot", slog.String("slot", val), slog.String("error", err.Error()))
+				return Location{}, errors.New("input:slots")
+			}
+
+			if bookings[s.ID()] != "" {
+				booked, err := strconv.ParseInt(bookings[s.ID()], 10, 64)
+				if err != nil {
+					lg.LogAttrs(ctx, slog.LevelError, "cannot parse the bookings", slog.String("slot", val), slog.String("error", err.Error()))
+					return Location{}, errors.New("input:slots")
+				}
+				s.Booked = int(booked)
+			}
+
+			slots = append(slots, s)
+		}
+	}
+
+	return Location{
+		ID:        data["id"],
+		Name:      data["name"],
+		Street:    data["street"],
+		City:      data["city"],
+		Zipcode:   data["zipcode"],
+		Hours:     data["hours"],
+		Capacity:  int(ints["capacity"]),
+		Slots:     slots,
+		Active:    data["active"] == "1",
+		UpdatedAt: time.Unix(ints["updated_at"], 0),
+	}, nil
+}
+
+func Find(ctx context.Context, id string) (Location, error) {
+	lg := slog.With(slog.String("id", id))
+	lg.LogAttrs(ctx, slog.LevelInfo, "looking for pickup location")
+
+	if id == "" {
+		lg.LogAttrs(ctx, slog.LevelInfo, "cannot validate empty pickup id")
+		return Location{}, errors.New("input:id")
+	}
+
+	data, err := db.Redis.HGetAll(ctx, "pickup:"+id).Result()
+	if err != nil {
+		lg.LogAttrs(ctx, slog.LevelError, "cannot find the pickup location", slog.String("error", err.Error()))
+		return Location{}, errors.New("something went wrong")
+	}
+
+	if len(data) == 0 {
+		lg.LogAttrs(ctx, slog.LevelInfo, "cannot find the pickup location")
+		return Location{}, errors.New("oops the data is not found")
+	}
+
+	bookings, err := db.Redis.HGetAll(ctx, "pickup:"+id+":bookings").Result()
+	if err != nil {
+		lg.LogAttrs(ctx, slog.LevelError, "cannot get the bookings", slog.String("error", err.Error()))
+		return Location{}, errors.New("something went wrong")
+	}
+
+	l, err := parse(ctx, data, bookings)
+	if err != nil {
+		lg.LogAttrs(ctx, slog.LevelError, "cannot parse the pickup location", slog.String("error", err.Error()))
+		return Location{}, errors.New("something went wrong")
+	}
+
+	lg.LogAttrs(ctx, slog.LevelInfo, "the pickup location is found")
+
+	return l, nil
+}
+
+func List(ctx context.Context, offset, num int) (ListResults, error) {
+	slog.LogAttrs(ctx, slog.LevelInfo, "listing pickup locations")
+
+	ids, err := db.Redis.ZRevRange(ctx, "pickups", int64(offset), int64(offset+num-1)).Result()
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot get the pickup locations", slog.String("error", err.Error()))
+		return ListResults{}, errors.New("something went wrong")
+	}
+
+	locations := []Location{}
+
+	cmds, err := db.Redis.Pipelined(ctx, func(rdb redis.Pipeliner) error {
+		for _, val := range ids {
+			rdb.HGetAll(ctx, "pickup:"+val)
+			rdb.HGetAll(ctx, "pickup:"+val+":bookings")
+		}
+
+		return nil
+	})
+
+	if err != nil && err != redis.Nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot get the pickup location data", slog.String("error", err.Error()))
+		return ListResults{}, errors.New("something went wrong")
+	}
+
+	// The commands go by pair, the location data then its bookings
+	for i := 0; i+1 < len(cmds); i += 2 {
+		key := fmt.Sprintf("%s", cmds[i].Args()[1])
+
+		if cmds[i].Err() != nil && cmds[i].Err() != redis.Nil {
+			slog.LogAttrs(ctx, slog.LevelError, "cannot get the pickup location data", slog.String("key", key), slog.String("error", cmds[i].Err().Error()))
+			continue
+		}
+
+		val := cmds[i].(*redis.MapStringStringCmd).Val()
+		if len(val) == 0 {
+			continue
+		}
+
+		bookings := cmds[i+1].(*redis.MapStringStringCmd).Val()
+
+		l, err := parse(ctx, val, bookings)
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "cannot parse the pickup location", slog.String("key", key), slog.String("error", err.Error()))
+			continue
+		}
+
+		locations = append(locations, l)
+	}
+
+	total, err := db.Redis.ZCount(ctx, "pickups", "-inf", "+inf").Result()
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot get the pickup locations count")
+		return ListResults{}, errors.New("something went wrong")
+	}
+
+	slog.LogAttrs(ctx, slog.LevelInfo, "found pickup locations", slog.Int("length", len(locations)))
+
+	return ListResults{
+		Total:     int(total),
+		Locations: locations,
+	}, nil
+}
+
+// Actives returns the locations the customer can choose
+func Actives(ctx context.Context) ([]Location, error) {
+	res, err := List(ctx, 0, 9999)
+	if err != nil {
+		return []Location{}, err
+	}
+
+	locations := []Location{}
+	for _, l := range res.Locations {
+		if l.Active {
+			locations = append(locations, l)
+		}
+	}
+
+	return locations, nil
+}
+
+func Delete(ctx context.Context, id string) error {
+	lg := slog.With(slog.String("id", id))
+	lg.LogAttrs(ctx, slog.LevelInfo, "deleting pickup location")
+
+	if id == "" {
+		lg.LogAttrs(ctx, slog.LevelInfo, "the id cannot be empty")
+		return errors.New("input:id")
+	}
+
+	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+		rdb.Del(ctx, "pickup:"+id, "pickup:"+id+":bookings")
+		rdb.ZRem(ctx, "pickups", id)
+
+		return nil
+	}); err != nil {
+		lg.LogAttrs(ctx, slog.LevelError, "cannot delete the data", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	lg.LogAttrs(ctx, slog.LevelInfo, "pickup location deleted successfully")
+
+	return nil
+}
+
+// Book takes a place on the slot for an order.
+// An error occurs if the slot capacity is reached.
+// An empty slot does nothing.
+func Book(ctx context.Context, id, slot string) error {
+	lg := slog.With(slog.String("id", id), slog.String("slot", slot))
+	lg.LogAttrs(ctx, slog.LevelInfo, "booking the slot")
+
+	if slot == "" {
+		return nil
+	}
+
+	ok, err := bookScript.Run(ctx, db.Redis, []string{"pickup:" + id + ":bookings", "pickup:" + id}, slot).Int()
+	if err != nil {
+		lg.LogAttrs(ctx, slog.LevelError, "cannot book the slot", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	if ok == 0 {
+		lg.LogAttrs(ctx, slog.LevelInfo, "the slot is full")
+		return errors.New("the pickup slot is full")
+	}
+
+	lg.LogAttrs(ctx, slog.LevelInfo, "the slot is booked")
+
+	return nil
+}
+
+// CancelBooking gives back the place taken on the slot.
+func CancelBooking(ctx context.Context, id, slot string) error {
+	lg := slog.With(slog.String("id", id), slog.String("slot", slot))
+	lg.LogAttrs(ctx, slog.LevelInfo, "canceling the booking")
+
+	if slot == "" {
+		return nil
+	}
+
+	if _, err := db.Redis.HIncrBy(ctx, "pickup:"+id+":bookings", slot, -1).Result(); err != nil {
+		lg.LogAttrs(ctx, slog.LevelError, "cannot cancel the booking", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	lg.LogAttrs(ctx, slog.LevelInfo, "the booking is canceled")
+
+	return nil
+}
+
+// ReleaseBooking adds the booking cancelation into the pipeline,
+// in order to run it in the same transaction than the order cancelation.
+func ReleaseBooking(ctx context.Context, rdb redis.Pipeliner, id, slot string) {
+	if id == "" || slot == "" {
+		return
+	}
+
+	rdb.HIncrBy(ctx, "pickup:"+id+":bookings", slot, -1)
+}
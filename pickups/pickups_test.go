@@ -0,0 +1,257 @@
+package pickups
+
+import (
+	"artisons/tests"
+	"errors"
+	"fmt"
+	"path"
+	"runtime"
+	"testing"
+	"time"
+)
+
+var location Location = Location{
+	ID:       "SHOP",
+	Name:     "Shop",
+	Street:   "1 rue de la Paix",
+	City:     "Lille",
+	Zipcode:  "59000",
+	Capacity: 2,
+	Active:   true,
+}
+
+var cur string
+
+func init() {
+	_, filename, _, _ := runtime.Caller(0)
+	cur = path.Dir(filename) + "/"
+}
+
+func TestParseSlot(t *testing.T) {
+	var tests = []struct {
+		name  string
+		value string
+		slot  string
+		err   bool
+	}{
+		{"value=2099-06-01 10:00-12:00", "2099-06-01 10:00-12:00", "2099-06-01 10:00-12:00", false},
+		{"value= 2099-06-01 10:00 - 12:00 ", " 2099-06-01 10:00 - 12:00 ", "2099-06-01 10:00-12:00", false},
+		{"value=2099-06-01", "2099-06-01", "", true},
+		{"value=2099-06-01 10:00", "2099-06-01 10:00", "", true},
+		{"value=2099-06-01 10h-12h", "2099-06-01 10h-12h", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseSlot(tt.value)
+			if (err != nil) != tt.err {
+				t.Fatalf(`err = %v, want error %v`, err, tt.err)
+			}
+
+			if err == nil && s.String() != tt.slot {
+				t.Fatalf(`slot = %s, want %s`, s, tt.slot)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	ctx := tests.Context()
+
+	start := time.Now().Add(24 * time.Hour)
+
+	var tests = []struct {
+		name   string
+		update func(l Location) Location
+		err    error
+	}{
+		{"id=", func(l Location) Location { l.ID = ""; return l }, errors.New("input:id")},
+		{"id=!!!", func(l Location) Location { l.ID = "!!!"; return l }, errors.New("input:id")},
+		{"name=", func(l Location) Location { l.Name = ""; return l }, errors.New("input:name")},
+		{"street=", func(l Location) Location { l.Street = ""; return l }, errors.New("input:street")},
+		{"capacity=-1", func(l Location) Location { l.Capacity = -1; return l }, errors.New("input:capacity")},
+		{"end<start", func(l Location) Location {
+			l.Slots = []Slot{{Start: start, End: start.Add(-time.Hour)}}
+			return l
+		}, errors.New("input:slots")},
+		{"slots", func(l Location) Location {
+			l.Slots = []Slot{{Start: start, End: start.Add(time.Hour)}}
+			return l
+		}, nil},
+		{"success", func(l Location) Location { return l }, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := tt.update(location)
+
+			if err := l.Validate(ctx); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSave(t *testing.T) {
+	ctx := tests.Context()
+
+	l := location
+	s, _ := ParseSlot("2099-06-01 10:00-12:00")
+	l.Slots = []Slot{s}
+
+	id, err := l.Save(ctx)
+	if id != l.ID || err != nil {
+		t.Fatalf(`id = %s, err = %v, want %s, nil`, id, err, l.ID)
+	}
+
+	p, err := Find(ctx, id)
+	if err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if p.Capacity != l.Capacity || !p.Active || len(p.Slots) != 1 || !p.Slots[0].Start.Equal(s.Start) {
+		t.Fatalf(`p = %v, want %v`, p, l)
+	}
+}
+
+func TestFind(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/pickups.redis")
+
+	var tests = []struct {
+		name string
+		id   string
+		err  error
+	}{
+		{"id=", "", errors.New("input:id")},
+		{"id=WORKSHOP", "WORKSHOP", nil},
+		{"id=idontexist", "idontexist", errors.New("oops the data is not found")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Find(ctx, tt.id); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/pickups.redis")
+
+	res, err := List(ctx, 0, 10)
+	if err != nil || res.Total == 0 || len(res.Locations) == 0 {
+		t.Fatalf(`total = %d, err = %v, want > 0, nil`, res.Total, err)
+	}
+
+	res, err = List(ctx, 0, 2)
+	if err != nil || len(res.Locations) != 2 {
+		t.Fatalf(`len(res.Locations) = %d, err = %v, want 2, nil`, len(res.Locations), err)
+	}
+}
+
+func TestActives(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/pickups.redis")
+
+	locs, err := Actives(ctx)
+	if err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	for _, l := range locs {
+		if l.ID == "CLOSED" {
+			t.Fatalf(`the location %s is not active`, l.ID)
+		}
+	}
+}
+
+func TestUpcoming(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/pickups.redis")
+
+	l, err := Find(ctx, "WORKSHOP")
+	if err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	slots := l.Upcoming()
+	if len(slots) != 2 || slots[0].ID() != "209906011000" || slots[0].Booked != 1 {
+		t.Fatalf(`slots = %v, want 2 slots starting by 209906011000`, slots)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/pickups.redis")
+
+	var tests = []struct {
+		name string
+		id   string
+		slot string
+		err  error
+	}{
+		{"id=CLOSED", "CLOSED", "", errors.New("the pickup location is not available")},
+		{"id=MARKET", "MARKET", "", nil},
+		{"id=WORKSHOP,slot=", "WORKSHOP", "", errors.New("input:slot")},
+		{"id=WORKSHOP,slot=past", "WORKSHOP", "200006011000", errors.New("the pickup slot is not available")},
+		{"id=WORKSHOP,slot=full", "WORKSHOP", "209906011000", errors.New("the pickup slot is full")},
+		{"id=WORKSHOP,slot=209906021000", "WORKSHOP", "209906021000", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := Find(ctx, tt.id)
+			if err != nil {
+				t.Fatalf(`err = %v, want nil`, err)
+			}
+
+			if _, err := l.Check(ctx, tt.slot); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestBook(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/pickups.redis")
+
+	if err := Book(ctx, "WORKSHOP", "209906021000"); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if err := Book(ctx, "WORKSHOP", "209906021000"); fmt.Sprintf("%s", err) != "the pickup slot is full" {
+		t.Fatalf(`err = %v, want the pickup slot is full`, err)
+	}
+
+	if err := CancelBooking(ctx, "WORKSHOP", "209906021000"); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if err := Book(ctx, "WORKSHOP", "209906021000"); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/pickups.redis")
+
+	if err := Delete(ctx, "CLOSED"); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if exists, err := Exists(ctx, "CLOSED"); exists || err != nil {
+		t.Fatalf(`exists = %v, err = %v, want false, nil`, exists, err)
+	}
+}
@@ -0,0 +1,216 @@
+package pickups
+
+import (
+	"artisons/conf"
+	"artisons/http/contexts"
+	"artisons/http/httperrors"
+	"artisons/http/httphelpers"
+	"artisons/templates"
+	"html/template"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+var pickupsTpl *template.Template
+var pickupsHxTpl *template.Template
+var pickupsFormTpl *template.Template
+
+func init() {
+	var err error
+
+	files := append(templates.AdminTable,
+		conf.WorkingSpace+"web/views/admin/pickups/pickups-table.html",
+	)
+
+	pickupsTpl, err = templates.Build("base.html").ParseFiles(
+		append(files, append(templates.AdminListHandler,
+			conf.WorkingSpace+"web/views/admin/pickups/pickups-actions.html",
+			conf.WorkingSpace+"web/views/admin/pickups/pickups.html")...,
+		)...)
+
+	if err != nil {
+		log.Panicln(err)
+	}
+
+	pickupsHxTpl, err = templates.Build("pickups-table.html").ParseFiles(files...)
+
+	if err != nil {
+		log.Panicln(err)
+	}
+
+	pickupsFormTpl, err = templates.Build("base.html").ParseFiles(
+		append(templates.AdminUI,
+			conf.WorkingSpace+"web/views/admin/pickups/pickups-form.html",
+		)...)
+
+	if err != nil {
+		log.Panicln(err)
+	}
+}
+
+func AdminSaveHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := r.ParseForm(); err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot parse the form", slog.String("error", err.Error()))
+		httperrors.HXCatch(w, ctx, "something went wrong")
+		return
+	}
+
+	var capacity int
+	if r.FormValue("capacity") != "" {
+		val, err := strconv.ParseInt(r.FormValue("capacity"), 10, 64)
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "cannot parse the capacity", slog.String("capacity", r.FormValue("capacity")), slog.String("error", err.Error()))
+			httperrors.HXCatch(w, ctx, "input:capacity")
+			return
+		}
+		capacity = int(val)
+	}
+
+	// One slot per line
+	slots := []Slot{}
+	for _, line := range strings.Split(r.FormValue("slots"), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		s, err := ParseSlot(line)
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "cannot parse the slot", slog.String("slot", line), slog.String("error", err.Error()))
+			httperrors.HXCatch(w, ctx, "input:slots")
+			return
+		}
+
+		slots = append(slots, s)
+	}
+
+	id := r.PathValue("id")
+	lid := id
+	if lid == "" {
+		lid = strings.TrimSpace(r.FormValue("id"))
+	}
+
+	l := Location{
+		ID:       lid,
+		Name:     r.FormValue("name"),
+		Street:   r.FormValue("street"),
+		City:     r.FormValue("city"),
+		Zipcode:  r.FormValue("zipcode"),
+		Hours:    r.FormValue("hours"),
+		Capacity: capacity,
+		Slots:    slots,
+		Active:   r.FormValue("active") == "on",
+	}
+
+	err := l.Validate(ctx)
+	if err != nil {
+		httperrors.HXCatch(w, ctx, err.Error())
+		return
+	}
+
+	if id == "" {
+		exists, err := Exists(ctx, lid)
+		if err != nil {
+			httperrors.HXCatch(w, ctx, "input:id")
+			return
+		}
+
+		if exists {
+			httperrors.HXCatch(w, ctx, "the pickup location exists already")
+			return
+		}
+	}
+
+	_, err = l.Save(ctx)
+	if err != nil {
+		httperrors.HXCatch(w, ctx, err.Error())
+		return
+	}
+
+	httphelpers.Success(w, "/admin/pickups")
+}
+
+func AdminListHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	p := httphelpers.BuildPaginator(r)
+
+	res, err := List(ctx, p.Offset, p.Num)
+	if err != nil {
+		httperrors.Catch(w, ctx, err.Error(), 500)
+		return
+	}
+
+	t := pickupsTpl
+	isHX, _ := ctx.Value(contexts.HX).(bool)
+	if isHX {
+		t = pickupsHxTpl
+	}
+
+	lang := ctx.Value(contexts.Locale).(language.Tag)
+	data := httphelpers.List[Location]{
+		Lang:       lang,
+		Items:      res.Locations,
+		Empty:      len(res.Locations) == 0,
+		Currency:   conf.Currency,
+		Pagination: p.Build(ctx, res.Total, len(res.Locations)),
+		Page:       "Pickups",
+		Flash:      httphelpers.Flash(w, r),
+	}
+
+	if err = t.Execute(w, &data); err != nil {
+		slog.Error("cannot render the template", slog.String("error", err.Error()))
+	}
+}
+
+func AdminFormHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+
+	var location Location
+
+	if id != "" {
+		var err error
+		location, err = Find(ctx, id)
+
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "cannot find the pickup location", slog.Any("id", id), slog.String("error", err.Error()))
+			httperrors.Page(w, ctx, "oops the data is not found", 404)
+			return
+		}
+	}
+
+	lang := ctx.Value(contexts.Locale).(language.Tag)
+	data := httphelpers.Form[Location]{
+		Data:     location,
+		Lang:     lang,
+		Currency: conf.Currency,
+		Page:     "Pickups",
+	}
+
+	if err := pickupsFormTpl.Execute(w, &data); err != nil {
+		slog.Error("cannot render the template", slog.String("error", err.Error()))
+	}
+}
+
+func AdminDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+
+	err := Delete(ctx, id)
+	if err != nil {
+		httperrors.HXCatch(w, ctx, err.Error())
+		return
+	}
+
+	p, _ := url.Parse(r.Header.Get("HX-Current-Url"))
+	r.URL.Path = p.Path
+
+	AdminListHandler(w, r)
+}
@@ -0,0 +1,344 @@
+package products
+
+import (
+	"artisons/db"
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// archiveScript moves the products to the trash.
+// The previous status is kept in archived_status
+// to be applied when the product is restored.
+// KEYS are the product hashes, ARGV[1] is the archive timestamp.
+// It returns the number of products archived.
+var archiveScript = redis.NewScript(`
+local archived = 0
+for i = 1, #KEYS do
+	local status = redis.call('HGET', KEYS[i], 'status')
+	if status and status ~= 'archived' then
+		redis.call('HSET', KEYS[i], 'status', 'archived', 'archived_status', status, 'archived_at', ARGV[1], 'updated_at', ARGV[1])
+		archived = archived + 1
+	end
+end
+
+return archived
+`)
+
+// restoreArchiveScript puts the products back with
+// the status they had before being archived, offline
+// if it is unknown.
+// KEYS are the product hashes, ARGV[1] is the restore timestamp.
+// It returns the number of products restored.
+var restoreArchiveScript = redis.NewScript(`
+local restored = 0
+for i = 1, #KEYS do
+	if redis.call('HGET', KEYS[i], 'status') == 'archived' then
+		local status = redis.call('HGET', KEYS[i], 'archived_status') or 'offline'
+		redis.call('HSET', KEYS[i], 'status', status, 'updated_at', ARGV[1])
+		redis.call('HDEL', KEYS[i], 'archived_status', 'archived_at')
+		restored = restored + 1
+	end
+end
+
+return restored
+`)
+
+// productKeys returns the hash keys of the product
+// and its variants.
+func productKeys(ctx context.Context, pid string) ([]string, []string, error) {
+	vids, err := db.Redis.ZRange(ctx, variantsKey(pid), 0, -1).Result()
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot get the variants", slog.String("pid", pid), slog.String("error", err.Error()))
+		return []string{}, []string{}, errors.New("something went wrong")
+	}
+
+	keys := []string{"product:" + pid}
+	for _, vid := range vids {
+		keys = append(keys, "product:"+vid)
+	}
+
+	return keys, vids, nil
+}
+
+// Delete moves the product and its variants to the trash.
+// The product is archived, so it is excluded from the search and
+// cannot be added to the cart anymore, but the data is kept
+// for the orders and the product can be restored.
+// See Purge to remove the product definitively.
+func Delete(ctx context.Context, pid string) error {
+	l := slog.With(slog.String("pid", pid))
+	l.LogAttrs(ctx, slog.LevelInfo, "archiving the product")
+
+	if pid == "" {
+		l.LogAttrs(ctx, slog.LevelInfo, "the pid cannot be empty")
+		return errors.New("input:id")
+	}
+
+	if exists, err := db.Redis.Exists(ctx, "product:"+pid).Result(); exists == 0 || err != nil {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot find the product")
+		return errors.New("oops the data is not found")
+	}
+
+	keys, _, err := productKeys(ctx, pid)
+	if err != nil {
+		return err
+	}
+
+	if _, err := archiveScript.Run(ctx, db.Redis, keys, time.Now().Unix()).Result(); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot archive the product", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the product is archived")
+
+	return nil
+}
+
+// Restore takes the product and its variants out of the trash,
+// with the status they had before being archived.
+func Restore(ctx context.Context, pid string) error {
+	l := slog.With(slog.String("pid", pid))
+	l.LogAttrs(ctx, slog.LevelInfo, "restoring the product")
+
+	p, err := Find(ctx, pid)
+	if err != nil {
+		return err
+	}
+
+	if p.Status != Archived {
+		l.LogAttrs(ctx, slog.LevelInfo, "the product is not archived", slog.String("status", p.Status))
+		return errors.New("the product is not archived")
+	}
+
+	keys, _, err := productKeys(ctx, pid)
+	if err != nil {
+		return err
+	}
+
+	if _, err := restoreArchiveScript.Run(ctx, db.Redis, keys, time.Now().Unix()).Result(); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot restore the product", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the product is restored")
+
+	return nil
+}
+
+var errNotArchived = errors.New("the product is not archived")
+
+var errArchived = errors.New("the product is archived")
+
+// purgeAttempts is the number of times the purge is tried
+// when the product is changed during the transaction.
+const purgeAttempts = 3
+
+// Purge removes definitively an archived product with its variants,
+// the archived variants included, its links, merchant sku mapping, schedules, and its references in the carts,
+// the wish lists and the stock reservations, in a transaction.
+// The image files are removed once the data is deleted,
+// except the ones still shown by the order snapshots.
+// The orders keep their own copy of the products, so the
+// missing snapshots have to be created before, see orders.SnapshotMissing.
+// The product keys are watched, so the purge is tried again if the
+// product is restored or changed meanwhile. The carts, the wish lists and
+// the reservations refuse the archived products atomically, so no new
+// reference can be added while the references are collected.
+func Purge(ctx context.Context, pid string) error {
+	l := slog.With(slog.String("pid", pid))
+	l.LogAttrs(ctx, slog.LevelInfo, "purging the product")
+
+	p, err := Find(ctx, pid)
+	if err != nil {
+		return err
+	}
+
+	if p.Status != Archived {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot purge a product not archived", slog.String("status", p.Status))
+		return errNotArchived
+	}
+
+	if p.Group != "" {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot purge a variant", slog.String("group", p.Group))
+		return errors.New("you are not authorized to process this request")
+	}
+
+	for attempt := 1; attempt <= purgeAttempts; attempt++ {
+		images, vids, err := purge(ctx, pid)
+		if err == redis.TxFailedErr {
+			l.LogAttrs(ctx, slog.LevelInfo, "the product changed during the purge", slog.Int("attempt", attempt))
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		DeleteImageFiles(ctx, images)
+
+		l.LogAttrs(ctx, slog.LevelInfo, "the product is purged", slog.Int("variants", len(vids)), slog.Int("images", len(images)))
+
+		return nil
+	}
+
+	l.LogAttrs(ctx, slog.LevelError, "cannot purge the product, it keeps changing")
+
+	return errors.New("something went wrong")
+}
+
+// purge deletes the product data in a transaction watching
+// the product keys, and returns the image ids and the variant ids.
+// redis.TxFailedErr is returned when a watched key changed.
+func purge(ctx context.Context, pid string) ([]string, []string, error) {
+	l := slog.With(slog.String("pid", pid))
+
+	images := []string{}
+	vids := []string{}
+
+	err := db.Redis.Watch(ctx, func(tx *redis.Tx) error {
+		// The product may be restored since the first check
+		p, err := Find(ctx, pid)
+		if err != nil {
+			return err
+		}
+
+		if p.Status != Archived {
+			l.LogAttrs(ctx, slog.LevelInfo, "the product is not archived anymore", slog.String("status", p.Status))
+			return errNotArchived
+		}
+
+		keys, ids, err := productKeys(ctx, pid)
+		if err != nil {
+			return err
+		}
+
+		archived, err := db.Redis.ZRange(ctx, archivedVariantsKey(pid), 0, -1).Result()
+		if err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot get the archived variants", slog.String("error", err.Error()))
+			return errors.New("something went wrong")
+		}
+
+		for _, vid := range archived {
+			keys = append(keys, "product:"+vid)
+		}
+
+		vids = append(ids, archived...)
+
+		if err := tx.Watch(ctx, keys...).Err(); err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot watch the variants", slog.String("error", err.Error()))
+			return errors.New("something went wrong")
+		}
+
+		variants, err := FindAll(ctx, vids)
+		if err != nil {
+			return err
+		}
+
+		pids := append([]string{pid}, vids...)
+
+		images = p.ImageIDs()
+		for _, v := range variants {
+			for _, id := range v.ImageIDs() {
+				if !slices.Contains(images, id) {
+					images = append(images, id)
+				}
+			}
+		}
+
+		// The files shown by the orders are kept
+		ordered, err := orderedImages(ctx, append([]string{pid}, vids...))
+		if err != nil {
+			return err
+		}
+
+		images = slices.DeleteFunc(images, func(id string) bool {
+			return slices.Contains(ordered, id)
+		})
+
+		// The sku mapping is removed only if it
+		// targets the product
+		mappings := []string{}
+		for _, v := range append([]Product{p}, variants...) {
+			if v.MID == "" || v.Sku == "" {
+				continue
+			}
+
+			key := "merchant:" + v.MID + ":" + v.Sku
+			if id, err := db.Redis.Get(ctx, key).Result(); err == nil && id == v.ID {
+				mappings = append(mappings, key)
+			}
+		}
+
+		carts, err := db.Scan(ctx, "cart:*")
+		if err != nil {
+			return errors.New("something went wrong")
+		}
+
+		wishes, err := db.Scan(ctx, "wish:*")
+		if err != nil {
+			return errors.New("something went wrong")
+		}
+
+		reservations, err := db.Redis.ZRange(ctx, "reservations", 0, -1).Result()
+		if err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot get the reservations", slog.String("error", err.Error()))
+			return errors.New("something went wrong")
+		}
+
+		members := []interface{}{}
+		for _, id := range pids {
+			members = append(members, id)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+			deleted := append([]string{variantsKey(pid), archivedVariantsKey(pid)}, keys...)
+			deleted = append(deleted, mappings...)
+
+			for _, kind := range LinkKinds {
+				deleted = append(deleted, linksKey(pid, kind))
+			}
+
+			rdb.Del(ctx, deleted...)
+
+			// The cart infos are stored in cart:{cid}:info
+			for _, key := range carts {
+				if strings.Count(key, ":") == 1 {
+					rdb.HDel(ctx, key, pids...)
+				}
+			}
+
+			rdb.ZRem(ctx, publishKey, members...)
+			rdb.ZRem(ctx, unpublishKey, members...)
+
+			for _, key := range wishes {
+				rdb.ZRem(ctx, key, members...)
+			}
+
+			// The reservation fields are the product hash keys
+			for _, key := range reservations {
+				rdb.HDel(ctx, key, keys...)
+			}
+
+			return nil
+		})
+
+		return err
+	}, "product:"+pid, variantsKey(pid), archivedVariantsKey(pid))
+
+	if err == redis.TxFailedErr || errors.Is(err, errNotArchived) {
+		return images, vids, err
+	}
+
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot purge the product", slog.String("error", err.Error()))
+		return images, vids, errors.New("something went wrong")
+	}
+
+	return images, vids, nil
+}
@@ -0,0 +1,141 @@
+package products
+
+import (
+	"artisons/db"
+	"artisons/tests"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestDelete(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/archives.redis")
+
+	var tests = []struct {
+		name string
+		pid  string
+		err  error
+	}{
+		{"pid=", "", errors.New("input:id")},
+		{"pid=idontexist", "idontexist", errors.New("oops the data is not found")},
+		{"success", "ARC1", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Delete(ctx, tt.pid); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`Delete(ctx, "%s") = %v, want %v`, tt.pid, err, tt.err)
+			}
+		})
+	}
+
+	for pid, status := range map[string]string{"ARC1": "online", "ARC1S": "offline"} {
+		vals, _ := db.Redis.HMGet(ctx, "product:"+pid, "status", "archived_status").Result()
+		if vals[0] != Archived || vals[1] != status {
+			t.Fatalf(`%s = %v, want [archived %s]`, pid, vals, status)
+		}
+	}
+
+	if Available(ctx, "ARC1S") {
+		t.Fatalf(`Available(ctx, "ARC1S") = true, want false`)
+	}
+}
+
+func TestSaveArchived(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/archives.redis")
+
+	if err := Delete(ctx, "ARC1"); err != nil {
+		t.Fatalf(`Delete(ctx, "ARC1") = %v, want nil`, err)
+	}
+
+	p, err := Find(ctx, "ARC1")
+	if err != nil {
+		t.Fatalf(`Find(ctx, "ARC1") = %v, want nil`, err)
+	}
+
+	p.Status = Online
+	if _, err := p.Save(ctx); fmt.Sprintf("%s", err) != "the product is archived" {
+		t.Fatalf(`p.Save(ctx) = %v, want the product is archived`, err)
+	}
+
+	if _, err := SaveVariant(ctx, "ARC1", Product{ID: "ARC1S"}); fmt.Sprintf("%s", err) != "the product is archived" {
+		t.Fatalf(`SaveVariant(ctx, "ARC1", ARC1S) = %v, want the product is archived`, err)
+	}
+
+	vals, _ := db.Redis.HMGet(ctx, "product:ARC1", "status", "archived_status").Result()
+	if vals[0] != Archived || vals[1] != Online {
+		t.Fatalf(`ARC1 = %v, want [archived online]`, vals)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/archives.redis")
+
+	if err := Restore(ctx, "ARC1"); fmt.Sprintf("%s", err) != "the product is not archived" {
+		t.Fatalf(`Restore(ctx, "ARC1") = %v, want the product is not archived`, err)
+	}
+
+	if err := Delete(ctx, "ARC1"); err != nil {
+		t.Fatalf(`Delete(ctx, "ARC1") = %v, want nil`, err)
+	}
+
+	if err := Restore(ctx, "ARC1"); err != nil {
+		t.Fatalf(`Restore(ctx, "ARC1") = %v, want nil`, err)
+	}
+
+	for pid, status := range map[string]string{"ARC1": "online", "ARC1S": "offline"} {
+		p, err := Find(ctx, pid)
+		if err != nil || p.Status != status || !p.ArchivedAt.IsZero() {
+			t.Fatalf(`%s = %v, want %s`, pid, p, status)
+		}
+	}
+}
+
+func TestPurge(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/archives.redis")
+
+	if err := Purge(ctx, "ARC2"); fmt.Sprintf("%s", err) != "the product is not archived" {
+		t.Fatalf(`Purge(ctx, "ARC2") = %v, want the product is not archived`, err)
+	}
+
+	if err := Delete(ctx, "ARC1"); err != nil {
+		t.Fatalf(`Delete(ctx, "ARC1") = %v, want nil`, err)
+	}
+
+	if err := Purge(ctx, "ARC1S"); fmt.Sprintf("%s", err) != "you are not authorized to process this request" {
+		t.Fatalf(`Purge(ctx, "ARC1S") = %v, want you are not authorized to process this request`, err)
+	}
+
+	if err := Purge(ctx, "ARC1"); err != nil {
+		t.Fatalf(`Purge(ctx, "ARC1") = %v, want nil`, err)
+	}
+
+	keys := []string{"product:ARC1", "product:ARC1S", "product:ARC1:variants", "product:links:ARC1:related", "merchant:1:ARC1"}
+	if exists, _ := db.Redis.Exists(ctx, keys...).Result(); exists != 0 {
+		t.Fatalf(`exists = %d, want 0`, exists)
+	}
+
+	if cart, _ := db.Redis.HGetAll(ctx, "cart:9001").Result(); len(cart) != 1 || cart["PDT1"] != "1" {
+		t.Fatalf(`cart = %v, want [PDT1]`, cart)
+	}
+
+	if wish, _ := db.Redis.ZRange(ctx, "wish:9001", 0, -1).Result(); len(wish) != 1 || wish[0] != "PDT1" {
+		t.Fatalf(`wish = %v, want [PDT1]`, wish)
+	}
+
+	if exists, _ := db.Redis.Exists(ctx, "reservation:9001").Result(); exists != 0 {
+		t.Fatalf(`reservation = %d, want 0`, exists)
+	}
+
+	if currency, _ := db.Redis.HGet(ctx, "cart:9001:info", "currency").Result(); currency != "EUR" {
+		t.Fatalf(`currency = %s, want EUR`, currency)
+	}
+}
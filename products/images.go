@@ -0,0 +1,255 @@
+package products
+
+import (
+	"artisons/conf"
+	"artisons/db"
+	"context"
+	"errors"
+	"log/slog"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/text/language"
+)
+
+// Image is a product image with its alternative
+// texts by locale, like en => "A blue mug".
+type Image struct {
+	ID  string
+	Alt map[string]string
+}
+
+// The images are stored in the product hash:
+//   - images: the image ids ordered and separated by ";",
+//     the first one is the primary image
+//   - images_alt: the alternative texts url encoded,
+//     the keys are {iid}:{lang}
+//
+// The products saved before the images list have
+// the image ids in the fields image_1 to image_4.
+var legacyImageFields = []string{"image_1", "image_2", "image_3", "image_4"}
+
+// AltText returns the alternative text in the language,
+// or in the default locale if it is missing.
+func (i Image) AltText(lang language.Tag) string {
+	if alt := i.Alt[lang.String()]; alt != "" {
+		return alt
+	}
+
+	return i.Alt[conf.DefaultLocale.String()]
+}
+
+// Image returns the primary image id,
+// empty if the product has no image.
+func (p Product) Image() string {
+	if len(p.Images) == 0 {
+		return ""
+	}
+
+	return p.Images[0].ID
+}
+
+// ImageIDs returns the image ids in order.
+func (p Product) ImageIDs() []string {
+	ids := []string{}
+	for _, image := range p.Images {
+		ids = append(ids, image.ID)
+	}
+
+	return ids
+}
+
+// serializeImages returns the image ids and
+// the alternative texts as stored in the hash.
+func serializeImages(images []Image) (string, string) {
+	ids := []string{}
+	alt := url.Values{}
+
+	for _, image := range images {
+		ids = append(ids, image.ID)
+
+		for lang, text := range image.Alt {
+			if text != "" {
+				alt.Set(image.ID+":"+lang, text)
+			}
+		}
+	}
+
+	return strings.Join(ids, ";"), alt.Encode()
+}
+
+// parseImages reads the images from the hash data.
+func parseImages(ctx context.Context, data map[string]string) []Image {
+	ids := []string{}
+
+	if data["images"] != "" {
+		ids = strings.Split(data["images"], ";")
+	} else {
+		for _, field := range legacyImageFields {
+			if data[field] != "" && !slices.Contains(ids, data[field]) {
+				ids = append(ids, data[field])
+			}
+		}
+	}
+
+	alt, err := url.ParseQuery(data["images_alt"])
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot parse the image alt texts", slog.String("images_alt", data["images_alt"]), slog.String("error", err.Error()))
+	}
+
+	images := []Image{}
+	for _, id := range ids {
+		image := Image{ID: id, Alt: map[string]string{}}
+
+		for _, lang := range conf.Locales {
+			if text := alt.Get(id + ":" + lang.String()); text != "" {
+				image.Alt[lang.String()] = text
+			}
+		}
+
+		images = append(images, image)
+	}
+
+	return images
+}
+
+// RemovedImages returns the ids of the previous
+// images which are not in the current ones.
+func RemovedImages(previous, current []Image) []string {
+	ids := []string{}
+
+	for _, image := range previous {
+		if !slices.ContainsFunc(current, func(i Image) bool { return i.ID == image.ID }) {
+			ids = append(ids, image.ID)
+		}
+	}
+
+	return ids
+}
+
+// UnusedImages returns the image ids which are not used by
+// the product pid or its variants, except the variant vid.
+// A variant is created with the product images, so the
+// files can be shared by the product and all its variants.
+// The vid is empty when the product itself is saved.
+// The archived variants and the order snapshots keep
+// their images, see orderedImages.
+func UnusedImages(ctx context.Context, pid, vid string, ids []string) ([]string, error) {
+	l := slog.With(slog.String("pid", pid), slog.String("vid", vid))
+	l.LogAttrs(ctx, slog.LevelInfo, "looking for the unused images")
+
+	if len(ids) == 0 {
+		return []string{}, nil
+	}
+
+	p, err := Find(ctx, pid)
+	if err != nil {
+		return []string{}, err
+	}
+
+	variants, err := Variants(ctx, pid)
+	if err != nil {
+		return []string{}, err
+	}
+
+	archived, err := ArchivedVariants(ctx, pid)
+	if err != nil {
+		return []string{}, err
+	}
+
+	pids := []string{pid}
+	used := p.ImageIDs()
+	for _, v := range append(variants, archived...) {
+		pids = append(pids, v.ID)
+
+		if v.ID != vid {
+			used = append(used, v.ImageIDs()...)
+		}
+	}
+
+	ordered, err := orderedImages(ctx, pids)
+	if err != nil {
+		return []string{}, err
+	}
+
+	used = append(used, ordered...)
+
+	unused := []string{}
+	for _, id := range ids {
+		if !slices.Contains(used, id) {
+			unused = append(unused, id)
+		}
+	}
+
+	return unused, nil
+}
+
+// orderedImages returns the image ids kept by the order
+// snapshots of the products, in the order:{oid}:product:{pid}
+// hashes. The snapshots keep the primary image only, in the
+// image field or in image_1 for the oldest ones, and the
+// files are never removed while an order shows them.
+func orderedImages(ctx context.Context, pids []string) ([]string, error) {
+	l := slog.With(slog.Any("pids", pids))
+
+	keys, err := db.Scan(ctx, "order:*:product:*")
+	if err != nil {
+		return []string{}, errors.New("something went wrong")
+	}
+
+	snapshots := []string{}
+	for _, key := range keys {
+		if slices.Contains(pids, key[strings.LastIndex(key, ":")+1:]) {
+			snapshots = append(snapshots, key)
+		}
+	}
+
+	if len(snapshots) == 0 {
+		return []string{}, nil
+	}
+
+	cmds, err := db.Redis.Pipelined(ctx, func(rdb redis.Pipeliner) error {
+		for _, key := range snapshots {
+			rdb.HMGet(ctx, key, "image", "image_1")
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot get the ordered images", slog.String("error", err.Error()))
+		return []string{}, errors.New("something went wrong")
+	}
+
+	ids := []string{}
+	for _, cmd := range cmds {
+		for _, val := range cmd.(*redis.SliceCmd).Val() {
+			if id, _ := val.(string); id != "" && !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	return ids, nil
+}
+
+// DeleteImageFiles removes the image files from the
+// imgproxy folder. The errors are only logged because
+// the product is already saved.
+func DeleteImageFiles(ctx context.Context, ids []string) {
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+
+		if err := os.Remove(ImagePath(id)); err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "cannot remove the image", slog.String("image", id), slog.String("error", err.Error()))
+			continue
+		}
+
+		slog.LogAttrs(ctx, slog.LevelInfo, "the image is removed", slog.String("image", id))
+	}
+}
@@ -0,0 +1,106 @@
+package products
+
+import (
+	"artisons/tests"
+	"reflect"
+	"testing"
+
+	"golang.org/x/text/language"
+)
+
+func TestSerializeImages(t *testing.T) {
+	images := []Image{
+		{ID: "products/1.jpg", Alt: map[string]string{"en": "A blue mug"}},
+		{ID: "products/2.jpg", Alt: map[string]string{}},
+	}
+
+	ids, alt := serializeImages(images)
+	if ids != "products/1.jpg;products/2.jpg" {
+		t.Fatalf(`ids = %s, want products/1.jpg;products/2.jpg`, ids)
+	}
+
+	if alt != "products%2F1.jpg%3Aen=A+blue+mug" {
+		t.Fatalf(`alt = %s, want products%%2F1.jpg%%3Aen=A+blue+mug`, alt)
+	}
+}
+
+func TestParseImages(t *testing.T) {
+	ctx := tests.Context()
+
+	var tests = []struct {
+		name   string
+		data   map[string]string
+		images []Image
+	}{
+		{"images=", map[string]string{}, []Image{}},
+		{
+			"images=1;2",
+			map[string]string{"images": "1;2", "images_alt": "1%3Aen=A+blue+mug", "image_1": "3"},
+			[]Image{{ID: "1", Alt: map[string]string{"en": "A blue mug"}}, {ID: "2", Alt: map[string]string{}}},
+		},
+		{
+			"image_1=3",
+			map[string]string{"image_1": "3", "image_2": "4", "image_3": "3"},
+			[]Image{{ID: "3", Alt: map[string]string{}}, {ID: "4", Alt: map[string]string{}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if images := parseImages(ctx, tt.data); !reflect.DeepEqual(images, tt.images) {
+				t.Fatalf(`parseImages(ctx, %v) = %v, want %v`, tt.data, images, tt.images)
+			}
+		})
+	}
+}
+
+func TestRemovedImages(t *testing.T) {
+	previous := []Image{{ID: "1"}, {ID: "2"}, {ID: "3"}}
+	current := []Image{{ID: "3"}, {ID: "1"}, {ID: "4"}}
+
+	if ids := RemovedImages(previous, current); !reflect.DeepEqual(ids, []string{"2"}) {
+		t.Fatalf(`RemovedImages(previous, current) = %v, want [2]`, ids)
+	}
+}
+
+func TestUnusedImages(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/variants.redis")
+
+	var tests = []struct {
+		name   string
+		pid    string
+		vid    string
+		ids    []string
+		unused []string
+	}{
+		{"vid=", "IMG1", "", []string{"products/IMG1.jpeg", "products/OLD.jpeg"}, []string{"products/OLD.jpeg"}},
+		{"vid=IMG1B", "IMG1", "IMG1B", []string{"products/IMG1A.jpeg", "products/IMG1B.jpeg"}, []string{"products/IMG1B.jpeg"}},
+		{"vid=IMG1A", "IMG1", "IMG1A", []string{"products/IMG1.jpeg", "products/IMG1A.jpeg"}, []string{}},
+		{"ids=", "IMG1", "", []string{}, []string{}},
+		{"ordered", "IMG1", "", []string{"products/IMG1ORDER.jpeg", "products/OLD.jpeg"}, []string{"products/OLD.jpeg"}},
+		{"ordered=image_1", "IMG1", "IMG1A", []string{"products/IMG1LEGACY.jpeg"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unused, err := UnusedImages(ctx, tt.pid, tt.vid, tt.ids)
+			if err != nil {
+				t.Fatalf(`err = %v, want nil`, err)
+			}
+
+			if !reflect.DeepEqual(unused, tt.unused) {
+				t.Fatalf(`unused = %v, want %v`, unused, tt.unused)
+			}
+		})
+	}
+}
+
+func TestImageAltText(t *testing.T) {
+	image := Image{ID: "1", Alt: map[string]string{"en": "A blue mug"}}
+
+	if alt := image.AltText(language.French); alt != "A blue mug" {
+		t.Fatalf(`image.AltText(fr) = %s, want A blue mug`, alt)
+	}
+}
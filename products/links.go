@@ -0,0 +1,235 @@
+package products
+
+import (
+	"artisons/db"
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// The link kinds between the products:
+//   - variant: the products are variants of each other,
+//     like the same t-shirt in an other fabric
+//   - related: the products are similar
+//   - accessory: the product completes the linked one
+//   - upsell: the product is a better version of the linked one
+const (
+	LinkVariant   = "variant"
+	LinkRelated   = "related"
+	LinkAccessory = "accessory"
+	LinkUpsell    = "upsell"
+)
+
+var LinkKinds = []string{LinkVariant, LinkRelated, LinkAccessory, LinkUpsell}
+
+// The linked product ids are stored in the set
+// product:links:{pid}:{kind}.
+func linksKey(pid, kind string) string {
+	return "product:links:" + pid + ":" + kind
+}
+
+// validateLinks checks the link kinds and that
+// the product is not linked to itself.
+// The linked products are not required to exist, because
+// the import can link products created later, the links
+// to missing products are removed when they are read.
+func validateLinks(ctx context.Context, pid string, links map[string][]string) error {
+	l := slog.With(slog.String("pid", pid))
+
+	for kind, ids := range links {
+		if !slices.Contains(LinkKinds, kind) {
+			l.LogAttrs(ctx, slog.LevelInfo, "cannot use the link kind", slog.String("kind", kind))
+			return errors.New("input:links")
+		}
+
+		for _, id := range ids {
+			if id == "" || id == pid {
+				l.LogAttrs(ctx, slog.LevelInfo, "cannot link the product", slog.String("kind", kind), slog.String("link", id))
+				return errors.New("input:links_" + kind)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkLinks checks that the linked products
+// exist and are not variants.
+func checkLinks(ctx context.Context, links map[string][]string) error {
+	pids := []string{}
+	for _, ids := range links {
+		pids = append(pids, ids...)
+	}
+
+	cmds, err := db.Redis.Pipelined(ctx, func(rdb redis.Pipeliner) error {
+		for _, id := range pids {
+			rdb.HGet(ctx, "product:"+id, "type")
+		}
+
+		return nil
+	})
+
+	if err != nil && err != redis.Nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot get the linked products", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	for i, cmd := range cmds {
+		if cmd.(*redis.StringCmd).Val() == "product" {
+			continue
+		}
+
+		for kind, ids := range links {
+			if slices.Contains(ids, pids[i]) {
+				slog.LogAttrs(ctx, slog.LevelInfo, "cannot find the linked product", slog.String("kind", kind), slog.String("link", pids[i]))
+				return errors.New("input:links_" + kind)
+			}
+		}
+	}
+
+	return nil
+}
+
+// saveLinks adds into the pipeline the replacement
+// of the product links for every kind.
+func saveLinks(ctx context.Context, rdb redis.Pipeliner, pid string, links map[string][]string) {
+	for _, kind := range LinkKinds {
+		key := linksKey(pid, kind)
+		rdb.Del(ctx, key)
+
+		if len(links[kind]) > 0 {
+			rdb.SAdd(ctx, key, links[kind])
+		}
+	}
+}
+
+// LinkIDs returns the linked product ids by kind,
+// sorted, as stored.
+func LinkIDs(ctx context.Context, pid string) (map[string][]string, error) {
+	l := slog.With(slog.String("pid", pid))
+	l.LogAttrs(ctx, slog.LevelInfo, "getting the product links")
+
+	cmds, err := db.Redis.Pipelined(ctx, func(rdb redis.Pipeliner) error {
+		for _, kind := range LinkKinds {
+			rdb.SMembers(ctx, linksKey(pid, kind))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot get the product links", slog.String("error", err.Error()))
+		return map[string][]string{}, errors.New("something went wrong")
+	}
+
+	links := map[string][]string{}
+	for i, cmd := range cmds {
+		ids := cmd.(*redis.StringSliceCmd).Val()
+		sort.Strings(ids)
+		links[LinkKinds[i]] = ids
+	}
+
+	return links, nil
+}
+
+// Links returns the online products linked to the product
+// for the kind.
+// The links to the deleted products are removed, so they are
+// cleaned up while they are read. The links to the products
+// offline, archived or which are variants are kept, because
+// the products can be published again, but not returned.
+func Links(ctx context.Context, pid, kind string) ([]Product, error) {
+	l := slog.With(slog.String("pid", pid), slog.String("kind", kind))
+	l.LogAttrs(ctx, slog.LevelInfo, "getting the linked products")
+
+	key := linksKey(pid, kind)
+
+	ids, err := db.Redis.SMembers(ctx, key).Result()
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot get the product links", slog.String("error", err.Error()))
+		return []Product{}, errors.New("something went wrong")
+	}
+
+	if len(ids) == 0 {
+		return []Product{}, nil
+	}
+
+	sort.Strings(ids)
+
+	pdts, err := FindAll(ctx, ids)
+	if err != nil {
+		return []Product{}, err
+	}
+
+	now := time.Now()
+	online := []Product{}
+	for _, p := range pdts {
+		if p.Group == "" && p.Published(now) {
+			online = append(online, p)
+		}
+	}
+
+	deleted := []interface{}{}
+	for _, id := range ids {
+		if !slices.ContainsFunc(pdts, func(p Product) bool { return p.ID == id }) {
+			deleted = append(deleted, id)
+		}
+	}
+
+	if len(deleted) > 0 {
+		l.LogAttrs(ctx, slog.LevelInfo, "removing the links to the deleted products", slog.Any("links", deleted))
+
+		if _, err := db.Redis.SRem(ctx, key, deleted...).Result(); err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot remove the links to the deleted products", slog.String("error", err.Error()))
+		}
+	}
+
+	return online, nil
+}
+
+// AllLinks returns the online linked products by kind.
+func AllLinks(ctx context.Context, pid string) (map[string][]Product, error) {
+	links := map[string][]Product{}
+
+	for _, kind := range LinkKinds {
+		pdts, err := Links(ctx, pid, kind)
+		if err != nil {
+			return map[string][]Product{}, err
+		}
+
+		links[kind] = pdts
+	}
+
+	return links, nil
+}
+
+// Suggestions returns the accessories and the upsells
+// of the products, without the products themselves
+// and without duplicates.
+func Suggestions(ctx context.Context, pids []string) ([]Product, error) {
+	suggestions := []Product{}
+
+	for _, pid := range pids {
+		for _, kind := range []string{LinkAccessory, LinkUpsell} {
+			pdts, err := Links(ctx, pid, kind)
+			if err != nil {
+				return []Product{}, err
+			}
+
+			for _, p := range pdts {
+				if slices.Contains(pids, p.ID) || slices.ContainsFunc(suggestions, func(s Product) bool { return s.ID == p.ID }) {
+					continue
+				}
+
+				suggestions = append(suggestions, p)
+			}
+		}
+	}
+
+	return suggestions, nil
+}
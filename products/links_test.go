@@ -0,0 +1,83 @@
+package products
+
+import (
+	"artisons/db"
+	"artisons/tests"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestValidateLinks(t *testing.T) {
+	ctx := tests.Context()
+
+	var tests = []struct {
+		name  string
+		links map[string][]string
+		err   error
+	}{
+		{"kind=toto", map[string][]string{"toto": {"LNK2"}}, errors.New("input:links")},
+		{"link=self", map[string][]string{LinkRelated: {"LNK1"}}, errors.New("input:links_related")},
+		{"link=", map[string][]string{LinkUpsell: {""}}, errors.New("input:links_upsell")},
+		{"success", map[string][]string{LinkAccessory: {"LNK2"}, LinkUpsell: {}}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateLinks(ctx, "LNK1", tt.links); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`validateLinks(ctx, "LNK1", %v) = %v, want %v`, tt.links, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheckLinks(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/links.redis")
+
+	if err := checkLinks(ctx, map[string][]string{LinkRelated: {"LNK2", "LNKDELETED"}}); fmt.Sprintf("%s", err) != "input:links_related" {
+		t.Fatalf(`checkLinks(ctx, LNKDELETED) = %v, want input:links_related`, err)
+	}
+
+	if err := checkLinks(ctx, map[string][]string{LinkRelated: {"LNK2"}}); err != nil {
+		t.Fatalf(`checkLinks(ctx, LNK2) = %v, want nil`, err)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/links.redis")
+
+	pdts, err := Links(ctx, "LNK1", LinkAccessory)
+	if err != nil {
+		t.Fatalf(`Links(ctx, "LNK1", "accessory") = %v, want nil`, err)
+	}
+
+	if len(pdts) != 1 || pdts[0].ID != "LNK2" {
+		t.Fatalf(`pdts = %v, want [LNK2]`, pdts)
+	}
+
+	ids, _ := db.Redis.SMembers(ctx, linksKey("LNK1", LinkAccessory)).Result()
+	sort.Strings(ids)
+	if len(ids) != 2 || ids[0] != "LNK2" || ids[1] != "LNK3" {
+		t.Fatalf(`ids = %v, want [LNK2 LNK3]`, ids)
+	}
+}
+
+func TestSuggestions(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/links.redis")
+
+	pdts, err := Suggestions(ctx, []string{"LNK1", "LNK2"})
+	if err != nil {
+		t.Fatalf(`Suggestions(ctx, [LNK1 LNK2]) = %v, want nil`, err)
+	}
+
+	if len(pdts) != 1 || pdts[0].ID != "LNK4" {
+		t.Fatalf(`pdts = %v, want [LNK4]`, pdts)
+	}
+}
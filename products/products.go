@@ -4,6 +4,7 @@ package products
 import (
 	"artisons/conf"
 	"artisons/db"
+	"artisons/money"
 	"artisons/string/stringutil"
 	"artisons/validators"
 	"context"
@@ -22,12 +23,24 @@ import (
 
 // Product is the product representation in the application
 type Product struct {
-	ID          string  `redis:"id"` // ID is an unique identifier
-	Title       string  `redis:"title" validate:"required"`
-	Description string  `redis:"description" validate:"required"`
-	Price       float64 `redis:"price" validate:"required"`
+	ID          string      `redis:"id"` // ID is an unique identifier
+	Title       string      `redis:"title" validate:"required"`
+	Description string      `redis:"description" validate:"required"`
+	Price       money.Money `redis:"price"`
+	// The prices indexed by currency code, including the shop currency.
+	// The product cannot be sold in a currency without price.
+	Prices map[string]money.Money
 	// The percent discount
-	Discount float64 `redis:"discount"`
+	Discount float64 `redis:"discount" validate:"gte=0,lt=100"`
+	// The discount validity window, no limit if zero
+	DiscountStartAt time.Time
+	DiscountEndAt   time.Time
+
+	// The scheduled publication and unpublication,
+	// nothing is scheduled if zero
+	PublishAt   time.Time
+	UnpublishAt time.Time
+
 	Slug     string  `redis:"slug" validate:"required"`
 	MID      string  `redis:"mid"`
 	Sku      string  `redis:"sku" validate:"omitempty,alphanum"`
@@ -35,18 +48,45 @@ type Product struct {
 	Status   string  `redis:"status" validate:"oneof=online offline"`
 	Weight   float64 `redis:"weight"`
 
-	Image1 string
-	Image2 string
-	Image3 string
-	Image4 string
-	Tags   []string
+	// The maximum quantity per order, no limit if zero
+	MaxQuantity int `redis:"max_quantity" validate:"gte=0"`
+
+	// The units held by the carts during the payment,
+	// not saved with the product, see Reserve
+	Held int `redis:"held"`
+
+	// The tax class, "standard" if empty
+	TaxClass string `redis:"tax_class"`
+
+	// The images ordered, the first one is the primary image.
+	// A nil value keeps the stored images.
+	Images []Image
 
-	// Links []string // Links contains the linked product IDs
+	Tags []string
+
+	// The linked product ids by link kind, like related => [PID1].
+	// The links are not loaded with the product, see LinkIDs.
+	// A nil value keeps the stored links.
+	Links map[string][]string
+
+	// The product id of a variant, empty for a product
+	Group string `redis:"group"`
+
+	// The variant options, the keys and values are
+	// the filter ones, like size => M
+	Options map[string]string
 
 	Meta map[string][]string
 
 	CreatedAt time.Time
 	UpdatedAt time.Time
+
+	// The trash date, zero if the product is not archived
+	ArchivedAt time.Time
+
+	// True if the product was switched offline
+	// because its stock ran out, see CommitReservation
+	SoldOut bool
 }
 
 type SearchResults struct {
@@ -58,16 +98,25 @@ type Meta = map[string]string
 
 type Query struct {
 	Keywords string
-	PriceMin float32
-	PriceMax float32
+	PriceMin money.Money
+	PriceMax money.Money
 	Tags     []string
 	Meta     map[string][]string
 	Slug     string
+
+	// The product status, online if empty
+	Status string
+
+	// The currency of the price filters.
+	// If it is not the shop currency, only the products
+	// having a price in this currency are returned.
+	Currency string
 }
 
 const (
-	Online  = "online"  // Make th product available in the application
-	Offline = "offline" // Hide th product  in the application
+	Online   = "online"   // Make th product available in the application
+	Offline  = "offline"  // Hide th product  in the application
+	Archived = "archived" // Move the product to the trash
 )
 
 // ImageExtensions is the allowed extensions in the application
@@ -85,14 +134,15 @@ func ImagePath(id string) string {
 	return path.Join(conf.ImgProxy.Path, id)
 }
 
-// Available return true if all the product ids are availables
+// Availables return true if all the product ids are online
+// and have stock.
 func Availables(ctx context.Context, pids []string) bool {
 	l := slog.With(slog.Any("ids", pids))
 	l.LogAttrs(ctx, slog.LevelInfo, "checking the pids availability")
 
 	pipe := db.Redis.Pipeline()
 	for _, pid := range pids {
-		pipe.HGet(ctx, "product:"+pid, "status")
+		pipe.HMGet(ctx, "product:"+pid, "status", "quantity", "publish_at", "unpublish_at", "soldout", "held", "group")
 	}
 
 	cmds, err := pipe.Exec(ctx)
@@ -105,13 +155,18 @@ func Availables(ctx context.Context, pids []string) bool {
 		key := fmt.Sprintf("%s", cmd.Args()[1])
 
 		if cmd.Err() != nil {
-			slog.LogAttrs(ctx, slog.LevelError, "cannot get the status", slog.String("key", key), slog.String("error", err.Error()))
+			slog.LogAttrs(ctx, slog.LevelError, "cannot get the status", slog.String("key", key), slog.String("error", cmd.Err().Error()))
 			continue
 		}
 
-		status := cmd.(*redis.StringCmd).Val()
-		if status != "online" {
-			l.LogAttrs(ctx, slog.LevelInfo, "cannot get the product while it is not available", slog.String("id", cmd.Args()[1].(string)))
+		vals := cmd.(*redis.SliceCmd).Val()
+		if !inStock(vals) {
+			l.LogAttrs(ctx, slog.LevelInfo, "cannot get the product while it is not available", slog.String("id", key))
+			return false
+		}
+
+		if group, _ := vals[6].(string); group != "" && !groupPublished(ctx, group) {
+			l.LogAttrs(ctx, slog.LevelInfo, "cannot get the variant while its product is not available", slog.String("id", key), slog.String("group", group))
 			return false
 		}
 	}
@@ -121,7 +176,9 @@ func Availables(ctx context.Context, pids []string) bool {
 	return true
 }
 
-// Available return true if the product is available
+// Available return true if the product is online, with its
+// publication dates, and has stock.
+// The product of a variant must be visible too.
 func Available(ctx context.Context, pid string) bool {
 	l := slog.With(slog.String("id", pid))
 	l.LogAttrs(ctx, slog.LevelInfo, "checking the pid availability")
@@ -131,19 +188,65 @@ func Available(ctx context.Context, pid string) bool {
 		return false
 	}
 
-	status, err := db.Redis.HGet(ctx, "product:"+pid, "status").Result()
+	vals, err := db.Redis.HMGet(ctx, "product:"+pid, "status", "quantity", "publish_at", "unpublish_at", "soldout", "held", "group").Result()
 	if err != nil {
 		l.LogAttrs(ctx, slog.LevelError, "cannot find the product", slog.String("error", err.Error()))
 		return false
 	}
 
-	l.LogAttrs(ctx, slog.LevelInfo, "got the product status", slog.String("availability", "status"))
+	available := inStock(vals)
 
-	return status == "online"
+	// A variant is sold only while its product is visible
+	if group, _ := vals[6].(string); available && group != "" {
+		available = groupPublished(ctx, group)
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "got the product availability", slog.Bool("availability", available))
+
+	return available
+}
+
+// inStock checks the status, quantity, publication
+// dates, sold out and held values returned by HMGET.
+func inStock(vals []interface{}) bool {
+	status, _ := vals[0].(string)
+	qty, _ := vals[1].(string)
+	publishAt, _ := vals[2].(string)
+	unpublishAt, _ := vals[3].(string)
+	soldout, _ := vals[4].(string)
+	h, _ := vals[5].(string)
+
+	quantity, err := strconv.Atoi(qty)
+	held, _ := strconv.Atoi(h)
+
+	return published(status, soldout == "1", timestamp(publishAt), timestamp(unpublishAt), time.Now()) && err == nil && quantity-held > 0
+}
+
+// groupPublished returns true if the product of a variant
+// is visible, whatever its own stock, so the variants of an
+// offline or archived product are not available.
+func groupPublished(ctx context.Context, pid string) bool {
+	vals, err := db.Redis.HMGet(ctx, "product:"+pid, "status", "publish_at", "unpublish_at").Result()
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot find the variant product", slog.String("pid", pid), slog.String("error", err.Error()))
+		return false
+	}
+
+	status, _ := vals[0].(string)
+	publishAt, _ := vals[1].(string)
+	unpublishAt, _ := vals[2].(string)
+
+	return published(status, false, timestamp(publishAt), timestamp(unpublishAt), time.Now())
+}
+
+// Stock returns the units which can still be
+// ordered, the quantity minus the held units.
+func (p Product) Stock() int {
+	return p.Quantity - p.Held
 }
 
 func parse(ctx context.Context, data map[string]string) (Product, error) {
-	price, err := strconv.ParseFloat(data["price"], 32)
+	price, err := money.ParseMinor(data["price"])
 	if err != nil {
 		slog.Error("cannot parse the product price", slog.String("price", data["price"]))
 		return Product{}, errors.New("input:price")
@@ -155,6 +258,9 @@ func parse(ctx context.Context, data map[string]string) (Product, error) {
 		return Product{}, errors.New("input:quantity")
 	}
 
+	// The held field is missing when no cart holds the product
+	held, _ := strconv.Atoi(data["held"])
+
 	var weight float64
 
 	if data["weight"] != "" {
@@ -167,14 +273,58 @@ func parse(ctx context.Context, data map[string]string) (Product, error) {
 		weight = v
 	}
 
+	var max int64
+
+	if data["max_quantity"] != "" {
+		max, err = strconv.ParseInt(data["max_quantity"], 10, 32)
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "cannot parse the product max quantity", slog.String("max_quantity", data["max_quantity"]))
+			return Product{}, errors.New("input:max_quantity")
+		}
+	}
+
+	var discount float64
+
 	if data["discount"] != "" {
-		v, err := strconv.ParseFloat(data["discount"], 32)
+		v, err := strconv.ParseFloat(data["discount"], 64)
 		if err != nil {
 			slog.LogAttrs(ctx, slog.LevelError, "cannot parse the product discount", slog.String("discount", data["discount"]))
 			return Product{}, errors.New("input:discount")
 		}
 
-		weight = v
+		discount = v
+	}
+
+	var discountStartAt, discountEndAt, publishAt, unpublishAt time.Time
+
+	for key, t := range map[string]*time.Time{"discount_start_at": &discountStartAt, "discount_end_at": &discountEndAt, "publish_at": &publishAt, "unpublish_at": &unpublishAt} {
+		if data[key] == "" || data[key] == "0" {
+			continue
+		}
+
+		v, err := strconv.ParseInt(data[key], 10, 64)
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "cannot parse the product date", slog.String(key, data[key]))
+			return Product{}, fmt.Errorf("input:%s", key)
+		}
+
+		*t = time.Unix(v, 0)
+	}
+
+	prices := map[string]money.Money{conf.Currency: price}
+	for currency := range conf.Currencies {
+		val := data[PriceField(currency)]
+		if currency == conf.Currency || val == "" {
+			continue
+		}
+
+		m, err := money.ParseMinor(val)
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "cannot parse the product price", slog.String("currency", currency), slog.String("price", val))
+			continue
+		}
+
+		prices[currency] = m.WithCurrency(currency)
 	}
 
 	updatedAt, err := strconv.ParseInt(data["updated_at"], 10, 64)
@@ -183,24 +333,47 @@ func parse(ctx context.Context, data map[string]string) (Product, error) {
 		return Product{}, errors.New("input:updated_at")
 	}
 
+	var archivedAt time.Time
+
+	if data["archived_at"] != "" {
+		v, err := strconv.ParseInt(data["archived_at"], 10, 64)
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "cannot parse the product archived at", slog.String("archived_at", data["archived_at"]))
+			return Product{}, errors.New("input:archived_at")
+		}
+
+		archivedAt = time.Unix(v, 0)
+	}
+
 	return Product{
 		ID:          data["id"],
 		Title:       db.Unescape(data["title"]),
 		Description: db.Unescape(data["description"]),
 		Price:       price,
+		Prices:      prices,
+		Discount:    discount,
 		Slug:        db.Unescape(data["slug"]),
 		MID:         data["mid"],
 		Sku:         db.Unescape(data["sku"]),
 		Quantity:    int(quantity),
 		Weight:      weight,
+		MaxQuantity: int(max),
+		Held:        held,
+		TaxClass:    data["tax_class"],
 		Status:      data["status"],
 		Tags:        strings.Split(db.Unescape(data["tags"]), ";"),
 		Meta:        UnSerializeMeta(ctx, db.Unescape(data["meta"])),
-		Image1:      data["image_1"],
-		Image2:      data["image_2"],
-		Image3:      data["image_3"],
-		Image4:      data["image_4"],
+		Images:      parseImages(ctx, data),
+		Group:       data["group"],
+		Options:     ParseOptions(ctx, db.Unescape(data["options"])),
 		UpdatedAt:   time.Unix(updatedAt, 0),
+		ArchivedAt:  archivedAt,
+		SoldOut:     data["soldout"] == "1",
+
+		DiscountStartAt: discountStartAt,
+		DiscountEndAt:   discountEndAt,
+		PublishAt:       publishAt,
+		UnpublishAt:     unpublishAt,
 	}, nil
 }
 
@@ -214,12 +387,46 @@ func (p Product) Validate(ctx context.Context) error {
 		return fmt.Errorf("input:%s", low)
 	}
 
+	if p.Price.Amount <= 0 {
+		slog.LogAttrs(ctx, slog.LevelInfo, "cannot validate the product price", slog.Any("price", p.Price))
+		return errors.New("input:price")
+	}
+
+	for currency, price := range p.Prices {
+		if !money.Supported(currency) || price.Amount < 0 {
+			slog.LogAttrs(ctx, slog.LevelInfo, "cannot validate the product price", slog.String("currency", currency), slog.Any("price", price))
+			return errors.New("input:" + PriceField(currency))
+		}
+	}
+
+	if !p.DiscountStartAt.IsZero() && !p.DiscountEndAt.IsZero() && p.DiscountEndAt.Before(p.DiscountStartAt) {
+		slog.LogAttrs(ctx, slog.LevelInfo, "cannot validate the discount end date before the start date")
+		return errors.New("input:discount_end_at")
+	}
+
+	if !p.PublishAt.IsZero() && !p.UnpublishAt.IsZero() && !p.UnpublishAt.After(p.PublishAt) {
+		slog.LogAttrs(ctx, slog.LevelInfo, "cannot validate the unpublication date before the publication date")
+		return errors.New("input:unpublish_at")
+	}
+
+	if len(p.Links) > 0 {
+		if err := validateLinks(ctx, p.ID, p.Links); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 // Save a product into redis.
 // The keys are :
 // product:pid => the product data
+// The discounted prices are stored in the sale_price fields,
+// used by the price filter when the discount is running.
+// The publication dates are scheduled in products:publish
+// and products:unpublish, see ApplySchedules.
+// An archived product cannot be saved, it has to be
+// restored first, see Restore.
 func (p Product) Save(ctx context.Context) (string, error) {
 	if p.ID == "" {
 		pid, err := stringutil.Random()
@@ -244,49 +451,102 @@ func (p Product) Save(ctx context.Context) (string, error) {
 		"title", title,
 		"slug", db.Escape(p.Slug),
 		"description", db.Escape(p.Title),
-		"price", p.Price,
+		"price", p.Price.Minor(),
+		"sale_price", p.Price.Sub(p.Price.Percent(p.Discount)).Minor(),
+		"discount", p.Discount,
+		"discount_start_at", unix(p.DiscountStartAt),
+		"discount_end_at", unix(p.DiscountEndAt),
+		"publish_at", unix(p.PublishAt),
+		"unpublish_at", unix(p.UnpublishAt),
 		"quantity", p.Quantity,
 		"status", p.Status,
 		"weight", p.Weight,
+		"max_quantity", p.MaxQuantity,
+		"tax_class", p.TaxClass,
 		"mid", p.MID,
 		"tags", db.Escape(strings.Join(p.Tags, ";")),
-		// "links", db.Escape(strings.Join(p.Links, ";")),
 		"meta", db.Escape(SerializeMeta(ctx, p.Meta)),
 		"updated_at", now,
 	)
 
-	if p.Image1 == "-" {
-		values = append(values, "image_1", "")
-	} else if p.Image1 != "" {
-		values = append(values, "image_1", p.Image1)
+	// The variants are excluded from the search
+	// which looks only for the products
+	kind := "product"
+	if p.Group != "" {
+		kind = "variant"
+		values = append(values, "group", p.Group, "options", db.Escape(SerializeOptions(ctx, p.Options)))
 	}
 
-	if p.Image2 == "-" {
-		values = append(values, "image_2", "")
-	} else if p.Image2 != "" {
-		values = append(values, "image_2", p.Image2)
+	// A missing price removes the product from the currency.
+	// The field is deleted because an empty value cannot
+	// be indexed as a number.
+	deleted := []string{}
+	for currency := range conf.Currencies {
+		if currency == conf.Currency {
+			continue
+		}
+
+		if m, ok := p.Prices[currency]; ok && m.Amount > 0 {
+			values = append(values, PriceField(currency), m.Minor(), SalePriceField(currency), m.Sub(m.Percent(p.Discount)).Minor())
+		} else {
+			deleted = append(deleted, PriceField(currency), SalePriceField(currency))
+		}
 	}
 
-	if p.Image3 == "-" {
-		values = append(values, "image_3", "")
-	} else if p.Image3 != "" {
-		values = append(values, "image_3", p.Image3)
+	// The status chosen with stock replaces
+	// the one applied when it was sold out
+	if p.Quantity > 0 {
+		deleted = append(deleted, "soldout")
 	}
 
-	if p.Image4 == "-" {
-		values = append(values, "image_4", "")
-	} else if p.Image4 != "" {
-		values = append(values, "image_4", p.Image4)
+	// The legacy image fields are replaced by the images list
+	if p.Images != nil {
+		ids, alt := serializeImages(p.Images)
+		values = append(values, "images", ids, "images_alt", alt)
+		deleted = append(deleted, legacyImageFields...)
 	}
 
-	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
-		rdb.HSet(ctx, key, values)
-		rdb.HSetNX(ctx, key, "created_at", now)
-		rdb.HSetNX(ctx, key, "id", p.ID)
-		rdb.HSetNX(ctx, key, "type", "product")
+	// The product is watched, so it cannot be archived
+	// between the status check and the write
+	err := db.Redis.Watch(ctx, func(tx *redis.Tx) error {
+		status, err := tx.HGet(ctx, key, "status").Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
 
-		return nil
-	}); err != nil {
+		if status == Archived {
+			return errArchived
+		}
+
+		_, err = tx.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+			rdb.HSet(ctx, key, values)
+
+			if len(deleted) > 0 {
+				rdb.HDel(ctx, key, deleted...)
+			}
+
+			rdb.HSetNX(ctx, key, "created_at", now)
+			rdb.HSetNX(ctx, key, "id", p.ID)
+			rdb.HSetNX(ctx, key, "type", kind)
+
+			if p.Links != nil {
+				saveLinks(ctx, rdb, p.ID, p.Links)
+			}
+
+			saveSchedules(ctx, rdb, p)
+
+			return nil
+		})
+
+		return err
+	}, key)
+
+	if errors.Is(err, errArchived) {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot save an archived product")
+		return "", err
+	}
+
+	if err != nil {
 		l.LogAttrs(ctx, slog.LevelError, "cannot store the product", slog.String("error", err.Error()))
 		return "", err
 	}
@@ -374,12 +634,12 @@ func Find(ctx context.Context, pid string) (Product, error) {
 func Search(ctx context.Context, q Query, offset, num int) (SearchResults, error) {
 	var attrs []slog.Attr = []slog.Attr{}
 
-	if q.PriceMin > 0 {
-		attrs = append(attrs, slog.Int("price_min", int(q.PriceMin)))
+	if q.PriceMin.Amount > 0 {
+		attrs = append(attrs, slog.Any("price_min", q.PriceMin))
 	}
 
-	if q.PriceMax > 0 {
-		attrs = append(attrs, slog.Int("price_max", int(q.PriceMax)))
+	if q.PriceMax.Amount > 0 {
+		attrs = append(attrs, slog.Any("price_max", q.PriceMax))
 	}
 
 	if q.Keywords != "" {
@@ -396,7 +656,12 @@ func Search(ctx context.Context, q Query, offset, num int) (SearchResults, error
 
 	slog.LogAttrs(ctx, slog.LevelInfo, "searching products", attrs...)
 
-	qs := fmt.Sprintf("FT.SEARCH %s \"@status:{online}@type:{product}", db.ProductIdx)
+	filter := publishedFilter(time.Now())
+	if q.Status != "" && q.Status != Online {
+		filter = fmt.Sprintf("@status:{%s}", q.Status)
+	}
+
+	qs := fmt.Sprintf("FT.SEARCH %s \"%s@type:{product}", db.ProductIdx, filter)
 
 	if q.Keywords != "" {
 		k := db.SearchValue(q.Keywords)
@@ -408,23 +673,38 @@ func Search(ctx context.Context, q Query, offset, num int) (SearchResults, error
 		qs += fmt.Sprintf("(@slug:{%s})", k)
 	}
 
+	field := "price"
+	if q.Currency != "" && q.Currency != conf.Currency {
+		field = PriceField(q.Currency)
+	}
+
 	var priceMin interface{} = "-inf"
 	var priceMax interface{} = "+inf"
 	priceMinRep := "%v"
 	priceMaxRep := "%v"
 
-	if q.PriceMin > 0 {
-		priceMinRep = "%f"
-		priceMin = q.PriceMin
+	// The prices are stored in minor units
+	if q.PriceMin.Amount > 0 {
+		priceMinRep = "%d"
+		priceMin = q.PriceMin.Amount
 	}
 
-	if q.PriceMax > 0 {
-		priceMaxRep = "%f"
-		priceMax = q.PriceMax
+	if q.PriceMax.Amount > 0 {
+		priceMaxRep = "%d"
+		priceMax = q.PriceMax.Amount
 	}
 
 	if priceMin != "-inf" || priceMax != "+inf" {
-		qs += fmt.Sprintf("@price:["+priceMinRep+" "+priceMaxRep+"]", priceMin, priceMax)
+		// The discounted price is used while the discount is running.
+		// A zero end date means the discount never ends.
+		now := time.Now().Unix()
+		running := fmt.Sprintf("@discount_start_at:[-inf %d] -@discount_end_at:[1 %d]", now, now)
+		rng := "[" + priceMinRep + " " + priceMaxRep + "]"
+		sale := SalePriceField(q.Currency)
+
+		qs += fmt.Sprintf("((%s @"+sale+":"+rng+")|(-(%s) @"+field+":"+rng+"))", running, priceMin, priceMax, running, priceMin, priceMax)
+	} else if field != "price" {
+		qs += fmt.Sprintf("@%s:[-inf +inf]", field)
 	}
 
 	if len(q.Tags) > 0 {
@@ -482,6 +762,85 @@ func Search(ctx context.Context, q Query, offset, num int) (SearchResults, error
 	}, nil
 }
 
+// PriceField returns the hash field storing the price
+// in the currency, like price_chf
+func PriceField(currency string) string {
+	if currency == conf.Currency {
+		return "price"
+	}
+
+	return "price_" + strings.ToLower(currency)
+}
+
+// SalePriceField returns the hash field storing the discounted
+// price in the currency, like sale_price_chf
+func SalePriceField(currency string) string {
+	if currency == "" {
+		currency = conf.Currency
+	}
+
+	return "sale_" + PriceField(currency)
+}
+
+// HasDiscount returns true if the product has a discount
+// running at the given time.
+func (p Product) HasDiscount(t time.Time) bool {
+	if p.Discount <= 0 {
+		return false
+	}
+
+	if !p.DiscountStartAt.IsZero() && t.Before(p.DiscountStartAt) {
+		return false
+	}
+
+	if !p.DiscountEndAt.IsZero() && !t.Before(p.DiscountEndAt) {
+		return false
+	}
+
+	return true
+}
+
+// DiscountedPrice returns the price to pay for the product,
+// the price minus the discount if it is running.
+func (p Product) DiscountedPrice() money.Money {
+	if !p.HasDiscount(time.Now()) {
+		return p.Price
+	}
+
+	return p.Price.Sub(p.Price.Percent(p.Discount))
+}
+
+// Discounted returns true if the discount is running now,
+// mainly used in the templates.
+func (p Product) Discounted() bool {
+	return p.HasDiscount(time.Now())
+}
+
+// InCurrency returns the product with its price in the currency.
+// It returns false if the product has no price in this currency.
+func (p Product) InCurrency(currency string) (Product, bool) {
+	if currency == "" || currency == p.Price.Currency {
+		return p, true
+	}
+
+	price, ok := p.Prices[currency]
+	if !ok || price.Amount <= 0 {
+		return p, false
+	}
+
+	p.Price = price
+
+	return p, true
+}
+
+func unix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.Unix()
+}
+
 func (p Product) URL() string {
 	return conf.WebsiteURL + "/" + p.ID + "-" + p.Slug + ".html"
 }
@@ -532,22 +891,6 @@ func UnSerializeMeta(ctx context.Context, s string) map[string][]string {
 	return meta
 }
 
-func Delete(ctx context.Context, pid string) error {
-	slog.LogAttrs(ctx, slog.LevelInfo, "deleting product", slog.Any("pid", pid))
-
-	if pid == "" {
-		slog.LogAttrs(ctx, slog.LevelInfo, "the pid cannot be empty")
-		return errors.New("input:id")
-	}
-
-	if _, err := db.Redis.Del(ctx, "product:"+pid).Result(); err != nil {
-		slog.LogAttrs(ctx, slog.LevelError, "cannot delete product", slog.String("string", err.Error()))
-		return err
-	}
-
-	return nil
-}
-
 func List(ctx context.Context, pids []string) ([]Product, error) {
 	slog.LogAttrs(ctx, slog.LevelInfo, "listing products", slog.Any("pids", pids))
 
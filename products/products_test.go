@@ -2,6 +2,7 @@ package products
 
 import (
 	"artisons/conf"
+	"artisons/money"
 	"artisons/tests"
 	"errors"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 )
 
 var cur string
@@ -23,7 +25,7 @@ var product = Product{
 	ID:          "123",
 	Title:       "Title",
 	Description: "Description",
-	Price:       32.5,
+	Price:       money.New(3250),
 	Slug:        "title",
 	MID:         "12345",
 	Sku:         "123456",
@@ -169,15 +171,22 @@ func TestSearch(t *testing.T) {
 		{"keywords=unisexe", Query{Keywords: "unisexe"}, 1},
 		{"keywords=SKU1", Query{Keywords: "SKU1"}, 1},
 		{"keywords=idontexist", Query{Keywords: "idontexist"}, 0},
-		{"min=10", Query{PriceMin: 200}, 1},
-		{"min=500", Query{PriceMin: 500}, 0},
-		{"min=150", Query{PriceMax: 150}, 1},
-		{"min=50", Query{PriceMax: 50}, 0},
+		{"min=10", Query{PriceMin: money.New(20000)}, 1},
+		{"min=500", Query{PriceMin: money.New(50000)}, 0},
+		{"min=150", Query{PriceMax: money.New(15000)}, 1},
+		{"min=50", Query{PriceMax: money.New(5000)}, 0},
+		{"min=300,discount=50", Query{PriceMin: money.New(30000)}, 0},
+		{"max=250,discount=50", Query{PriceMax: money.New(25000)}, 2},
+		{"currency=CHF", Query{Currency: "CHF"}, 1},
+		{"currency=CHF,min=100", Query{Currency: "CHF", PriceMin: money.New(10000)}, 0},
+		{"currency=GBP", Query{Currency: "GBP"}, 0},
 		{"slug=t-shirt-tester-c-est-douter", Query{Slug: "t-shirt-tester-c-est-douter"}, 1},
 		{"tags=clothes", Query{Tags: []string{"clothes"}}, 1},
 		{"color=blue", Query{Meta: map[string][]string{"color": {"blue"}}}, 1},
 		{"color=blue cyan", Query{Meta: map[string][]string{"color": {"blue cyan"}}}, 1},
 		{"color=idontexist", Query{Meta: map[string][]string{"color": {"idontexist"}}}, 0},
+		{"keywords=SKU3", Query{Keywords: "SKU3"}, 0},
+		{"status=archived", Query{Status: Archived}, 1},
 	}
 
 	for _, tt := range tests {
@@ -205,13 +214,73 @@ func TestURL(t *testing.T) {
 	}
 }
 
-func TestDelete(t *testing.T) {
-	ctx := tests.Context()
+func TestInCurrency(t *testing.T) {
+	p := product
+	p.Price = money.New(3250).WithCurrency(conf.Currency)
+	p.Prices = map[string]money.Money{
+		conf.Currency: p.Price,
+		"CHF":         money.New(3050).WithCurrency("CHF"),
+	}
 
-	tests.ImportData(ctx, cur+"testdata/products.redis")
+	var tests = []struct {
+		name     string
+		currency string
+		price    money.Money
+		ok       bool
+	}{
+		{"currency=CHF", "CHF", money.New(3050).WithCurrency("CHF"), true},
+		{"currency=EUR", "EUR", money.New(3250).WithCurrency("EUR"), true},
+		{"currency=GBP", "GBP", money.New(3250).WithCurrency("EUR"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pdt, ok := p.InCurrency(tt.currency)
+			if ok != tt.ok {
+				t.Fatalf(`ok = %v, want %v`, ok, tt.ok)
+			}
+
+			if pdt.Price != tt.price {
+				t.Fatalf(`pdt.Price = %v, want %v`, pdt.Price, tt.price)
+			}
+		})
+	}
+}
+
+func TestDiscountedPrice(t *testing.T) {
+	now := time.Now()
+
+	var tests = []struct {
+		name    string
+		start   time.Time
+		end     time.Time
+		price   int64
+		running bool
+	}{
+		{"dates=", time.Time{}, time.Time{}, 2250, true},
+		{"start<now", now.Add(-time.Hour), time.Time{}, 2250, true},
+		{"start>now", now.Add(time.Hour), time.Time{}, 3000, false},
+		{"end>now", time.Time{}, now.Add(time.Hour), 2250, true},
+		{"end<now", time.Time{}, now.Add(-time.Hour), 3000, false},
+		{"start<now<end", now.Add(-time.Hour), now.Add(time.Hour), 2250, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := product
+			p.Price = money.New(3000)
+			p.Discount = 25
+			p.DiscountStartAt = tt.start
+			p.DiscountEndAt = tt.end
 
-	if err := Delete(ctx, ""); err == nil || err.Error() != "input:id" {
-		t.Fatalf(`err = %s want "input:id"`, err.Error())
+			if running := p.Discounted(); running != tt.running {
+				t.Fatalf(`running = %v, want %v`, running, tt.running)
+			}
+
+			if price := p.DiscountedPrice(); price.Amount != tt.price {
+				t.Fatalf(`price = %d, want %d`, price.Amount, tt.price)
+			}
+		})
 	}
 }
 
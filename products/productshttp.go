@@ -7,11 +7,13 @@ import (
 	"artisons/http/forms"
 	"artisons/http/httperrors"
 	"artisons/http/httphelpers"
+	"artisons/money"
 	"artisons/products/filters"
 	"artisons/shops"
 	"artisons/string/stringutil"
 	"artisons/tags"
 	"artisons/tags/tree"
+	"artisons/taxes"
 	"artisons/templates"
 	"artisons/users"
 	"html/template"
@@ -19,7 +21,11 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"golang.org/x/text/language"
 )
@@ -27,6 +33,8 @@ import (
 var productsTpl *template.Template
 var productsHxTpl *template.Template
 var productsFormTpl *template.Template
+var productsArchivesTpl *template.Template
+var productsArchivesHxTpl *template.Template
 
 func init() {
 	var err error
@@ -51,12 +59,34 @@ func init() {
 		log.Panicln(err)
 	}
 
+	archives := append(templates.AdminTable,
+		conf.WorkingSpace+"web/views/admin/icons/back.svg",
+		conf.WorkingSpace+"web/views/admin/products/products-archives-table.html",
+	)
+
+	productsArchivesTpl, err = templates.Build("base.html").ParseFiles(
+		append(archives, append(templates.AdminListHandler,
+			conf.WorkingSpace+"web/views/admin/products/products-actions.html",
+			conf.WorkingSpace+"web/views/admin/products/products-archives.html")...,
+		)...)
+
+	if err != nil {
+		log.Panicln(err)
+	}
+
+	productsArchivesHxTpl, err = templates.Build("products-archives-table.html").ParseFiles(archives...)
+
+	if err != nil {
+		log.Panicln(err)
+	}
+
 	productsFormTpl, err = templates.Build("base.html").ParseFiles(
 		append(templates.AdminUI,
 			conf.WorkingSpace+"web/views/admin/icons/close.svg",
 			conf.WorkingSpace+"web/views/admin/products/products-head.html",
 			conf.WorkingSpace+"web/views/admin/products/products-scripts.html",
 			conf.WorkingSpace+"web/views/admin/slug.html",
+			conf.WorkingSpace+"web/views/admin/products/products-images.html",
 			conf.WorkingSpace+"web/views/admin/products/products-form.html",
 		)...)
 
@@ -83,11 +113,13 @@ func ProductHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	p := res.Products[0]
+	p, ok := res.Products[0].InCurrency(money.ContextCurrency(ctx))
+	if !ok {
+		slog.LogAttrs(ctx, slog.LevelInfo, "cannot find the product price in the currency", slog.String("slug", slug))
+	}
 
 	wish := false
-	user, ok := ctx.Value(contexts.User).(users.User)
-	if ok {
+	if user, ok := ctx.Value(contexts.User).(users.User); ok {
 		wish = HasWish(ctx, user.ID, p.ID)
 	}
 
@@ -97,13 +129,38 @@ func ProductHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	all, err := Variants(ctx, p.ID)
+	if err != nil {
+		httperrors.Page(w, r.Context(), err.Error(), 400)
+		return
+	}
+
+	// Only the published variants with a price
+	// in the customer currency are proposed
+	now := time.Now()
+	variants := []Product{}
+	for _, v := range all {
+		v, ok := v.InCurrency(money.ContextCurrency(ctx))
+		if ok && v.Published(now) {
+			variants = append(variants, v)
+		}
+	}
+
+	links, err := AllLinks(ctx, p.ID)
+	if err != nil {
+		httperrors.Page(w, r.Context(), err.Error(), 400)
+		return
+	}
+
 	data := struct {
-		Lang    language.Tag
-		Shop    shops.Settings
-		Product Product
-		Tags    []tree.Leaf
-		Wish    bool
-		Filters []filters.Filter
+		Lang     language.Tag
+		Shop     shops.Settings
+		Product  Product
+		Tags     []tree.Leaf
+		Wish     bool
+		Filters  []filters.Filter
+		Variants []Product
+		Links    map[string][]Product
 	}{
 		lang,
 		shops.Data,
@@ -111,6 +168,8 @@ func ProductHandler(w http.ResponseWriter, r *http.Request) {
 		tree.Tree,
 		wish,
 		f,
+		variants,
+		links,
 	}
 
 	if err := templates.Pages["product"].Execute(w, &data); err != nil {
@@ -139,7 +198,7 @@ func AdminSaveHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	price, err := strconv.ParseFloat(r.FormValue("price"), 64)
+	price, err := money.Parse(r.FormValue("price"))
 	if err != nil {
 		slog.LogAttrs(ctx, slog.LevelError, "cannot parse the price", slog.String("price", r.FormValue("price")), slog.String("error", err.Error()))
 		httperrors.HXCatch(w, ctx, "input:price")
@@ -164,6 +223,35 @@ func AdminSaveHandler(w http.ResponseWriter, r *http.Request) {
 		discount = val
 	}
 
+	// The publication dates are precise to the minute
+	layouts := map[string]string{
+		"discount_start_at": "2006-01-02",
+		"discount_end_at":   "2006-01-02",
+		"publish_at":        "2006-01-02T15:04",
+		"unpublish_at":      "2006-01-02T15:04",
+	}
+
+	dates := map[string]time.Time{}
+	for key, layout := range layouts {
+		if r.FormValue(key) == "" {
+			continue
+		}
+
+		val, err := time.ParseInLocation(layout, r.FormValue(key), time.Local)
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "cannot parse the date", slog.String(key, r.FormValue(key)), slog.String("error", err.Error()))
+			httperrors.HXCatch(w, ctx, "input:"+key)
+			return
+		}
+
+		dates[key] = val
+	}
+
+	// The end date is included
+	if !dates["discount_end_at"].IsZero() {
+		dates["discount_end_at"] = dates["discount_end_at"].Add(24*time.Hour - time.Second)
+	}
+
 	var weight float64 = 0
 	if r.FormValue("weight") != "" {
 		val, err := strconv.ParseFloat(r.FormValue("weight"), 64)
@@ -175,6 +263,33 @@ func AdminSaveHandler(w http.ResponseWriter, r *http.Request) {
 		weight = val
 	}
 
+	var max int64 = 0
+	if r.FormValue("max_quantity") != "" {
+		max, err = strconv.ParseInt(r.FormValue("max_quantity"), 10, 64)
+		if err != nil || max < 0 {
+			slog.LogAttrs(ctx, slog.LevelInfo, "cannot parse the max quantity", slog.String("max_quantity", r.FormValue("max_quantity")))
+			httperrors.HXCatch(w, ctx, "input:max_quantity")
+			return
+		}
+	}
+
+	prices := map[string]money.Money{}
+	for currency := range conf.Currencies {
+		field := PriceField(currency)
+		if currency == conf.Currency || r.FormValue(field) == "" {
+			continue
+		}
+
+		val, err := money.Parse(r.FormValue(field))
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "cannot parse the price", slog.String(field, r.FormValue(field)), slog.String("error", err.Error()))
+			httperrors.HXCatch(w, ctx, "input:"+field)
+			return
+		}
+
+		prices[currency] = val.WithCurrency(currency)
+	}
+
 	status := "online"
 
 	if r.FormValue("status") != "on" {
@@ -193,6 +308,18 @@ func AdminSaveHandler(w http.ResponseWriter, r *http.Request) {
 		meta[val.Key] = r.Form[val.Key]
 	}
 
+	// The linked product ids are separated by ";"
+	links := map[string][]string{}
+	for _, kind := range LinkKinds {
+		links[kind] = []string{}
+
+		for _, id := range strings.Split(r.FormValue("links_"+kind), ";") {
+			if id = strings.TrimSpace(id); id != "" {
+				links[kind] = append(links[kind], id)
+			}
+		}
+	}
+
 	p := Product{
 		Title:       r.FormValue("title"),
 		Description: r.FormValue("description"),
@@ -200,10 +327,19 @@ func AdminSaveHandler(w http.ResponseWriter, r *http.Request) {
 		Sku:         r.FormValue("sku"),
 		Tags:        r.MultipartForm.Value["tags"],
 		Price:       price,
+		Prices:      prices,
 		Discount:    discount,
 		Weight:      weight,
+		TaxClass:    r.FormValue("tax_class"),
 		Quantity:    int(quantity),
+		MaxQuantity: int(max),
 		Meta:        meta,
+		Links:       links,
+
+		DiscountStartAt: dates["discount_start_at"],
+		DiscountEndAt:   dates["discount_end_at"],
+		PublishAt:       dates["publish_at"],
+		UnpublishAt:     dates["unpublish_at"],
 	}
 
 	if r.FormValue("slug") != "" {
@@ -212,18 +348,6 @@ func AdminSaveHandler(w http.ResponseWriter, r *http.Request) {
 		p.Slug = stringutil.Slugify(p.Title)
 	}
 
-	if r.FormValue("image_2_delete") != "" {
-		p.Image2 = "-"
-	}
-
-	if r.FormValue("image_3_delete") != "" {
-		p.Image3 = "-"
-	}
-
-	if r.FormValue("image_4_delete") != "" {
-		p.Image4 = "-"
-	}
-
 	p.ID = r.PathValue("id")
 
 	err = p.Validate(ctx)
@@ -232,6 +356,11 @@ func AdminSaveHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := checkLinks(ctx, p.Links); err != nil {
+		httperrors.HXCatch(w, ctx, err.Error())
+		return
+	}
+
 	query := Query{Slug: p.Slug}
 	res, err := Search(ctx, query, 0, 1)
 	if err != nil || res.Total > 0 && (res.Products[0].ID != p.ID) {
@@ -239,36 +368,50 @@ func AdminSaveHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	images := []string{"image_1", "image_2", "image_3", "image_3"}
-	files, err := forms.Upload(r, "products", images)
+	current := []Image{}
+	if p.ID != "" {
+		previous, err := Find(ctx, p.ID)
+		if err != nil {
+			httperrors.HXCatch(w, ctx, err.Error())
+			return
+		}
+
+		current = previous.Images
+	}
+
+	files, err := forms.UploadAll(r, "products", "images")
 	if err != nil {
 		httperrors.HXCatch(w, ctx, err.Error())
 		return
 	}
 
-	p.Image1 = files[0]
+	p.Images = formImages(r, current, files)
 
-	if files[1] != "" {
-		p.Image2 = files[1]
-	}
-
-	if files[2] != "" {
-		p.Image3 = files[2]
+	if len(p.Images) == 0 {
+		slog.LogAttrs(ctx, slog.LevelInfo, "cannot process the product without image")
+		httperrors.HXCatch(w, ctx, "input:images")
+		return
 	}
 
-	if files[3] != "" {
-		p.Image4 = files[4]
+	pid, err := p.Save(ctx)
+	if err != nil {
+		forms.RollbackUpload(ctx, files)
+		httperrors.HXCatch(w, ctx, err.Error())
+		return
 	}
 
-	if p.ID == "" && p.Image1 == "" {
-		slog.LogAttrs(ctx, slog.LevelError, "cannot process the empty image one")
-		httperrors.HXCatch(w, ctx, "input:image_1")
+	// The files shared with the variants are kept
+	removed, err := UnusedImages(ctx, pid, "", RemovedImages(current, p.Images))
+	if err != nil {
+		httperrors.HXCatch(w, ctx, err.Error())
 		return
 	}
 
-	_, err = p.Save(ctx)
-	if err != nil {
-		forms.RollbackUpload(ctx, files)
+	DeleteImageFiles(ctx, removed)
+
+	// The meta of the variant options
+	// are kept from the variants
+	if err := syncMeta(ctx, pid, []string{}); err != nil {
 		httperrors.HXCatch(w, ctx, err.Error())
 		return
 	}
@@ -313,6 +456,62 @@ func AdminListHandlerHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// formImages returns the images from the form:
+//   - the current images in the order of the images_order values,
+//     or in the stored order if the order is not sent
+//   - without the images_delete values
+//   - with the alt texts of the alt:{iid}:{lang} values
+//   - followed by the uploaded files
+//
+// The primary value is moved to the first position.
+func formImages(r *http.Request, current []Image, uploaded []string) []Image {
+	order := r.Form["images_order"]
+	if len(order) == 0 {
+		for _, image := range current {
+			order = append(order, image.ID)
+		}
+	}
+
+	images := []Image{}
+	for _, id := range order {
+		i := slices.IndexFunc(current, func(image Image) bool { return image.ID == id })
+		if i == -1 || slices.Contains(r.Form["images_delete"], id) || slices.ContainsFunc(images, func(image Image) bool { return image.ID == id }) {
+			continue
+		}
+
+		image := Image{ID: id, Alt: current[i].Alt}
+		if _, ok := r.Form["alt:"+id+":"+conf.DefaultLocale.String()]; ok {
+			image.Alt = map[string]string{}
+
+			for _, lang := range conf.Locales {
+				image.Alt[lang.String()] = strings.TrimSpace(r.FormValue("alt:" + id + ":" + lang.String()))
+			}
+		}
+
+		images = append(images, image)
+	}
+
+	for _, id := range uploaded {
+		images = append(images, Image{ID: id, Alt: map[string]string{}})
+	}
+
+	primary := r.FormValue("primary")
+	if i := slices.IndexFunc(images, func(image Image) bool { return image.ID == primary }); i > 0 {
+		image := images[i]
+		images = append([]Image{image}, slices.Delete(images, i, i+1)...)
+	}
+
+	return images
+}
+
+// priceList is a product price in a currency
+// other than the shop currency.
+type priceList struct {
+	Currency string
+	Field    string
+	Price    string
+}
+
 func AdminFormHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	id := r.PathValue("id")
@@ -348,12 +547,59 @@ func AdminFormHandler(w http.ResponseWriter, r *http.Request) {
 		httperrors.Catch(w, ctx, err.Error(), 500)
 	}
 
+	tc, err := taxes.List(ctx)
+	if err != nil {
+		httperrors.Catch(w, ctx, err.Error(), 500)
+	}
+
+	variants := []Product{}
+	links := map[string][]string{}
+	if id != "" {
+		variants, err = Variants(ctx, id)
+		if err != nil {
+			httperrors.Catch(w, ctx, err.Error(), 500)
+		}
+
+		links, err = LinkIDs(ctx, id)
+		if err != nil {
+			httperrors.Catch(w, ctx, err.Error(), 500)
+		}
+	}
+
+	prices := []priceList{}
+	for currency := range conf.Currencies {
+		if currency == conf.Currency {
+			continue
+		}
+
+		pl := priceList{Currency: currency, Field: PriceField(currency)}
+		if price, ok := product.Prices[currency]; ok {
+			pl.Price = price.String()
+		}
+
+		prices = append(prices, pl)
+	}
+
+	sort.Slice(prices, func(i, j int) bool {
+		return prices[i].Currency < prices[j].Currency
+	})
+
 	data.Extra = struct {
-		Tags    []tags.Tag
-		Filters []filters.Filter
+		Tags       []tags.Tag
+		Filters    []filters.Filter
+		TaxClasses []taxes.Class
+		Prices     []priceList
+		Variants   []Product
+		LinkKinds  []string
+		Links      map[string][]string
 	}{
 		t.Tags,
 		f,
+		tc,
+		prices,
+		variants,
+		LinkKinds,
+		links,
 	}
 
 	if err := productsFormTpl.Execute(w, &data); err != nil {
@@ -376,3 +622,55 @@ func AdminDeleteHandler(w http.ResponseWriter, r *http.Request) {
 
 	AdminListHandlerHandler(w, r)
 }
+
+func AdminArchivesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	p := httphelpers.BuildPaginator(r)
+
+	qry := Query{Status: Archived}
+	if p.Query != "" {
+		qry.Keywords = db.Escape(p.Query)
+	}
+
+	res, err := Search(ctx, qry, p.Offset, p.Num)
+	if err != nil {
+		httperrors.Catch(w, ctx, err.Error(), 500)
+		return
+	}
+
+	t := productsArchivesTpl
+	isHX, _ := ctx.Value(contexts.HX).(bool)
+	if isHX {
+		t = productsArchivesHxTpl
+	}
+
+	lang := ctx.Value(contexts.Locale).(language.Tag)
+	data := httphelpers.List[Product]{
+		Lang:       lang,
+		Items:      res.Products,
+		Empty:      len(res.Products) == 0,
+		Currency:   conf.Currency,
+		Pagination: p.Build(ctx, res.Total, len(res.Products)),
+		Page:       "Products",
+		Flash:      httphelpers.Flash(w, r),
+	}
+
+	if err = t.Execute(w, &data); err != nil {
+		slog.Error("cannot render the template", slog.String("error", err.Error()))
+	}
+}
+
+func AdminRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+
+	if err := Restore(ctx, id); err != nil {
+		httperrors.HXCatch(w, ctx, err.Error())
+		return
+	}
+
+	p, _ := url.Parse(r.Header.Get("HX-Current-Url"))
+	r.URL.Path = p.Path
+
+	AdminArchivesHandler(w, r)
+}
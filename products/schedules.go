@@ -0,0 +1,156 @@
+package products
+
+import (
+	"artisons/db"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// The products scheduled for publication and unpublication
+// are stored in the sorted sets products:publish and
+// products:unpublish, scored by the timestamp.
+// The scheduler switches the status when the date is reached,
+// but the queries check the dates too, so a product is never
+// displayed out of its publication window while waiting for
+// the scheduler.
+const (
+	publishKey   = "products:publish"
+	unpublishKey = "products:unpublish"
+)
+
+// scheduleScript applies a due publication or unpublication.
+// The status is switched only if the product has the expected
+// status, so an archived product or a product already switched
+// by the merchant is not changed, but the date is cleared anyway.
+// A product switched offline because it is sold out is not
+// published, it is put back online when the stock is restored.
+// KEYS[1] is the product hash, KEYS[2] is the schedule sorted set.
+// ARGV[1] is the date field, ARGV[2] the expected status, ARGV[3]
+// the new status, ARGV[4] the current timestamp and ARGV[5] the product id.
+// It returns 1 if the status is switched.
+var scheduleScript = redis.NewScript(`
+local at = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0') or 0
+if at > tonumber(ARGV[4]) then
+	return 0
+end
+
+local switched = 0
+if at > 0 and redis.call('HGET', KEYS[1], 'status') == ARGV[2] and redis.call('HGET', KEYS[1], 'soldout') ~= '1' then
+	redis.call('HSET', KEYS[1], 'status', ARGV[3], 'updated_at', ARGV[4])
+	switched = 1
+end
+
+if at > 0 then
+	redis.call('HSET', KEYS[1], ARGV[1], 0)
+end
+
+redis.call('ZREM', KEYS[2], ARGV[5])
+
+return switched
+`)
+
+// saveSchedules adds the publication dates in the schedule
+// sorted sets, or removes them when they are empty.
+func saveSchedules(ctx context.Context, rdb redis.Pipeliner, p Product) {
+	for key, t := range map[string]time.Time{publishKey: p.PublishAt, unpublishKey: p.UnpublishAt} {
+		if t.IsZero() {
+			rdb.ZRem(ctx, key, p.ID)
+			continue
+		}
+
+		rdb.ZAdd(ctx, key, redis.Z{Score: float64(t.Unix()), Member: p.ID})
+	}
+}
+
+// timestamp parses a timestamp stored in a hash,
+// 0 if it is empty or invalid.
+func timestamp(s string) int64 {
+	ts, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return ts
+}
+
+// published returns true if the product is visible at the time t.
+// The product is visible if it is online, or offline with a due
+// publication not applied yet by the scheduler, except when its
+// publication is scheduled later or its unpublication is due.
+// An offline product sold out is not published by the scheduler,
+// so its due publication is ignored.
+// The timestamps are 0 when the dates are not set.
+func published(status string, soldout bool, publishAt, unpublishAt int64, t time.Time) bool {
+	now := t.Unix()
+
+	if publishAt > now || (unpublishAt > 0 && unpublishAt <= now) {
+		return false
+	}
+
+	return status == Online || (status == Offline && publishAt > 0 && !soldout)
+}
+
+// Published returns true if the product is visible at the time t,
+// with its status and its publication dates.
+func (p Product) Published(t time.Time) bool {
+	return published(p.Status, p.SoldOut, unix(p.PublishAt), unix(p.UnpublishAt), t)
+}
+
+// publishedFilter returns the search query part matching
+// the products visible at the time t, see published.
+func publishedFilter(t time.Time) string {
+	now := t.Unix()
+
+	return fmt.Sprintf("((@status:{online}|(@status:{offline} @publish_at:[1 %d] -@soldout:{1})) -@publish_at:[(%d +inf] -@unpublish_at:[1 %d])", now, now, now)
+}
+
+// ApplySchedules switches the status of the products
+// whose publication or unpublication date is reached.
+// It returns the number of products switched.
+func ApplySchedules(ctx context.Context) (int, error) {
+	slog.LogAttrs(ctx, slog.LevelInfo, "applying the product schedules")
+
+	now := time.Now().Unix()
+
+	schedules := []struct {
+		key   string
+		field string
+		from  string
+		to    string
+	}{
+		{publishKey, "publish_at", Offline, Online},
+		{unpublishKey, "unpublish_at", Online, Offline},
+	}
+
+	count := 0
+	for _, s := range schedules {
+		pids, err := db.Redis.ZRangeByScore(ctx, s.key, &redis.ZRangeBy{
+			Min: "-inf",
+			Max: strconv.FormatInt(now, 10),
+		}).Result()
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "cannot get the scheduled products", slog.String("key", s.key), slog.String("error", err.Error()))
+			return 0, errors.New("something went wrong")
+		}
+
+		for _, pid := range pids {
+			switched, err := scheduleScript.Run(ctx, db.Redis, []string{"product:" + pid, s.key}, s.field, s.from, s.to, now, pid).Int()
+			if err != nil {
+				slog.LogAttrs(ctx, slog.LevelError, "cannot apply the schedule", slog.String("pid", pid), slog.String("field", s.field), slog.String("error", err.Error()))
+				return 0, errors.New("something went wrong")
+			}
+
+			count += switched
+		}
+	}
+
+	slog.LogAttrs(ctx, slog.LevelInfo, "the product schedules are applied", slog.Int("length", count))
+
+	return count, nil
+}
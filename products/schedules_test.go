@@ -0,0 +1,178 @@
+package products
+
+import (
+	"artisons/db"
+	"artisons/tests"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPublished(t *testing.T) {
+	now := time.Unix(2000, 0)
+
+	var tests = []struct {
+		name        string
+		status      string
+		soldout     bool
+		publishAt   int64
+		unpublishAt int64
+		published   bool
+	}{
+		{"status=online", Online, false, 0, 0, true},
+		{"status=offline", Offline, false, 0, 0, false},
+		{"status=archived,publish_at=past", Archived, false, 1000, 0, false},
+		{"status=online,publish_at=future", Online, false, 3000, 0, false},
+		{"status=offline,publish_at=past", Offline, false, 1000, 0, true},
+		{"status=offline,publish_at=past,soldout", Offline, true, 1000, 0, false},
+		{"status=offline,publish_at=future", Offline, false, 3000, 0, false},
+		{"status=online,unpublish_at=past", Online, false, 0, 1000, false},
+		{"status=online,unpublish_at=future", Online, false, 0, 3000, true},
+		{"status=offline,publish_at=past,unpublish_at=past", Offline, false, 500, 1000, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if published := published(tt.status, tt.soldout, tt.publishAt, tt.unpublishAt, now); published != tt.published {
+				t.Fatalf(`published = %v, want %v`, published, tt.published)
+			}
+		})
+	}
+}
+
+func TestScheduledSearch(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.Del(ctx, "product")
+	tests.ImportData(ctx, cur+"testdata/schedules.redis")
+
+	var tests = []struct {
+		name  string
+		q     Query
+		count int
+	}{
+		{"keywords=SCH1", Query{Keywords: "SCH1"}, 0},
+		{"keywords=SCH2", Query{Keywords: "SCH2"}, 1},
+		{"keywords=SCH3", Query{Keywords: "SCH3"}, 0},
+		{"keywords=SCH4", Query{Keywords: "SCH4"}, 0},
+		{"keywords=SCH5", Query{Keywords: "SCH5"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Search(ctx, tt.q, 0, 10)
+			if err != nil {
+				t.Fatalf(`err = %v, want nil`, err.Error())
+			}
+
+			if p.Total != tt.count {
+				t.Fatalf(`total = %d, want %d`, p.Total, tt.count)
+			}
+		})
+	}
+}
+
+func TestScheduledAvailable(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/schedules.redis")
+
+	for pid, available := range map[string]bool{"SCH1": false, "SCH2": true, "SCH3": false, "SCH4": false, "SCH5": false} {
+		if a := Available(ctx, pid); a != available {
+			t.Fatalf(`Available(ctx, "%s") = %v, want %v`, pid, a, available)
+		}
+	}
+}
+
+func TestScheduledReserve(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/schedules.redis")
+
+	if err := Reserve(ctx, 1002, []Product{{ID: "SCH1", Quantity: 1}}); fmt.Sprintf("%s", err) != "some products are not available anymore" {
+		t.Fatalf(`Reserve(ctx, 1002, SCH1) = %v, want some products are not available anymore`, err)
+	}
+
+	if err := Reserve(ctx, 1002, []Product{{ID: "SCH5", Quantity: 1}}); fmt.Sprintf("%s", err) != "some products are not available anymore" {
+		t.Fatalf(`Reserve(ctx, 1002, SCH5) = %v, want some products are not available anymore`, err)
+	}
+
+	if err := Reserve(ctx, 1002, []Product{{ID: "SCH2", Quantity: 1}}); err != nil {
+		t.Fatalf(`Reserve(ctx, 1002, SCH2) = %v, want nil`, err)
+	}
+}
+
+func TestApplySchedules(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/schedules.redis")
+
+	count, err := ApplySchedules(ctx)
+	if err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if count != 2 {
+		t.Fatalf(`count = %d, want 2`, count)
+	}
+
+	for pid, status := range map[string]string{"SCH1": Offline, "SCH2": Online, "SCH3": Offline, "SCH4": Archived, "SCH5": Offline} {
+		p, err := Find(ctx, pid)
+		if err != nil || p.Status != status {
+			t.Fatalf(`%s = %v, want %s`, pid, p, status)
+		}
+	}
+
+	if pids, _ := db.Redis.ZRange(ctx, publishKey, 0, -1).Result(); len(pids) != 1 || pids[0] != "SCH1" {
+		t.Fatalf(`pids = %v, want [SCH1]`, pids)
+	}
+
+	if pids, _ := db.Redis.ZRange(ctx, unpublishKey, 0, -1).Result(); len(pids) != 0 {
+		t.Fatalf(`pids = %v, want []`, pids)
+	}
+}
+
+func TestSaveSchedules(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/schedules.redis")
+
+	p, err := Find(ctx, "SCH1")
+	if err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	p.PublishAt = time.Time{}
+	p.UnpublishAt = time.Unix(4102444800, 0)
+
+	if _, err := p.Save(ctx); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if _, err := db.Redis.ZScore(ctx, publishKey, "SCH1").Result(); err == nil {
+		t.Fatalf(`the publication of SCH1 is still scheduled`)
+	}
+
+	if score, _ := db.Redis.ZScore(ctx, unpublishKey, "SCH1").Result(); score != 4102444800 {
+		t.Fatalf(`score = %v, want 4102444800`, score)
+	}
+}
+
+func TestSaveSoldOut(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/schedules.redis")
+
+	p, err := Find(ctx, "SCH5")
+	if err != nil || !p.SoldOut {
+		t.Fatalf(`p.SoldOut = %v, err = %v, want true, nil`, p.SoldOut, err)
+	}
+
+	if _, err := p.Save(ctx); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if p, err := Find(ctx, "SCH5"); err != nil || p.SoldOut || !p.Published(time.Now()) {
+		t.Fatalf(`p.SoldOut = %v, err = %v, want false, nil`, p.SoldOut, err)
+	}
+}
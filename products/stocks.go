@@ -0,0 +1,265 @@
+package products
+
+import (
+	"artisons/conf"
+	"artisons/db"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// The reserved units are counted in the held field of the
+// product hash, apart from the quantity which is the stock
+// typed by the merchant. So the product form and the import
+// can write the quantity while carts hold units, and the
+// available stock is quantity - held, see Product.Stock.
+// The quantity is decreased only when the order is created.
+
+// reserveScript holds the stock for a cart.
+// The previous reservation of the cart is released first,
+// so calling it several times keeps only the last one.
+// Nothing is changed if one product is not available,
+// with its status, its publication dates and its sold out flag, see published.
+// KEYS[1] is the reservation hash, KEYS[2..n] the product hashes.
+// ARGV[1] is the expiration timestamp, ARGV[2..n] the quantities
+// and ARGV[n+1] the current timestamp.
+// It returns 0 when succeed or the position of the product
+// which is not available.
+var reserveScript = redis.NewScript(`
+local prev = redis.call('HGETALL', KEYS[1])
+local previous = {}
+for i = 1, #prev, 2 do
+	previous[prev[i]] = tonumber(prev[i + 1])
+end
+
+local now = tonumber(ARGV[#KEYS + 1])
+local function published(key)
+	local status = redis.call('HGET', key, 'status')
+	local publishAt = tonumber(redis.call('HGET', key, 'publish_at') or '0') or 0
+	local unpublishAt = tonumber(redis.call('HGET', key, 'unpublish_at') or '0') or 0
+	if publishAt > now or (unpublishAt > 0 and unpublishAt <= now) then
+		return false
+	end
+
+	return status == 'online' or (status == 'offline' and publishAt > 0 and redis.call('HGET', key, 'soldout') ~= '1')
+end
+
+for i = 2, #KEYS do
+	local qty = tonumber(ARGV[i])
+	local quantity = tonumber(redis.call('HGET', KEYS[i], 'quantity') or '0') or 0
+	local held = tonumber(redis.call('HGET', KEYS[i], 'held') or '0') or 0
+	local stock = quantity - held + (previous[KEYS[i]] or 0)
+	if not published(KEYS[i]) or stock < qty then
+		return i - 1
+	end
+end
+
+for key, qty in pairs(previous) do
+	if redis.call('EXISTS', key) == 1 then
+		redis.call('HINCRBY', key, 'held', -qty)
+	end
+end
+
+redis.call('DEL', KEYS[1])
+
+for i = 2, #KEYS do
+	redis.call('HINCRBY', KEYS[i], 'held', ARGV[i])
+	redis.call('HSET', KEYS[1], KEYS[i], ARGV[i])
+end
+
+redis.call('ZADD', 'reservations', ARGV[1], KEYS[1])
+
+return 0
+`)
+
+// commitScript takes the held units from the stock.
+// The products without stock anymore are switched offline
+// and flagged as sold out. The archived products stay
+// in the trash and will be restored offline.
+// The products deleted meanwhile are skipped.
+// KEYS[1] is the reservation hash.
+var commitScript = redis.NewScript(`
+local items = redis.call('HGETALL', KEYS[1])
+for i = 1, #items, 2 do
+	if redis.call('EXISTS', items[i]) == 1 then
+		redis.call('HINCRBY', items[i], 'held', -tonumber(items[i + 1]))
+		local stock = redis.call('HINCRBY', items[i], 'quantity', -tonumber(items[i + 1]))
+		if stock <= 0 then
+			local field = 'status'
+			if redis.call('HGET', items[i], 'status') == 'archived' then
+				field = 'archived_status'
+			end
+
+			redis.call('HSET', items[i], field, 'offline', 'soldout', '1')
+		end
+	end
+end
+
+redis.call('DEL', KEYS[1])
+redis.call('ZREM', 'reservations', KEYS[1])
+
+return #items / 2
+`)
+
+// releaseScript gives back the units held by the reservation.
+// The products deleted meanwhile are skipped, so their
+// hash is not created again with only the held field.
+// KEYS[1] is the reservation hash.
+var releaseScript = redis.NewScript(`
+local items = redis.call('HGETALL', KEYS[1])
+for i = 1, #items, 2 do
+	if redis.call('EXISTS', items[i]) == 1 then
+		redis.call('HINCRBY', items[i], 'held', -tonumber(items[i + 1]))
+	end
+end
+
+redis.call('DEL', KEYS[1])
+redis.call('ZREM', 'reservations', KEYS[1])
+
+return #items / 2
+`)
+
+// restoreScript gives back the stock of a canceled order.
+// The products switched offline because they were sold out
+// are put back online, unless they are archived.
+// The purged products are skipped.
+// KEYS are the product hashes, ARGV the quantities.
+var restoreScript = redis.NewScript(`
+for i = 1, #KEYS do
+	if redis.call('EXISTS', KEYS[i]) == 1 then
+		local stock = redis.call('HINCRBY', KEYS[i], 'quantity', ARGV[i])
+		if stock > 0 and redis.call('HGET', KEYS[i], 'soldout') == '1' and redis.call('HGET', KEYS[i], 'status') ~= 'archived' then
+			redis.call('HSET', KEYS[i], 'status', 'online')
+			redis.call('HDEL', KEYS[i], 'soldout')
+		end
+	end
+end
+
+return #KEYS
+`)
+
+func reservationKey(cid int) string {
+	return fmt.Sprintf("reservation:%d", cid)
+}
+
+// Reserve holds the stock of the products for the cart.
+// The reservation expires with the cart, the stock is given back
+// by ReleaseExpiredReservations if no order is created.
+// An error occurs if one of the product is not online or
+// does not have enough stock.
+func Reserve(ctx context.Context, cid int, pdts []Product) error {
+	l := slog.With(slog.Int("cid", cid))
+	l.LogAttrs(ctx, slog.LevelInfo, "reserving the stock")
+
+	if len(pdts) == 0 {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot reserve empty products")
+		return errors.New("the cart is empty")
+	}
+
+	keys := []string{reservationKey(cid)}
+	args := []interface{}{time.Now().Add(conf.CartDuration).Unix()}
+
+	for _, p := range pdts {
+		keys = append(keys, "product:"+p.ID)
+		args = append(args, p.Quantity)
+	}
+
+	args = append(args, time.Now().Unix())
+
+	pos, err := reserveScript.Run(ctx, db.Redis, keys, args...).Int()
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot reserve the stock", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	if pos > 0 {
+		l.LogAttrs(ctx, slog.LevelInfo, "the product is not available", slog.String("id", pdts[pos-1].ID))
+		return errors.New("some products are not available anymore")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the stock is reserved")
+
+	return nil
+}
+
+// Held returns the stock of the product reserved by the cart,
+// still available for this cart.
+func Held(ctx context.Context, cid int, pid string) int {
+	qty, err := db.Redis.HGet(ctx, reservationKey(cid), "product:"+pid).Int()
+	if err != nil && err != redis.Nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot get the reservation", slog.Int("cid", cid), slog.String("pid", pid), slog.String("error", err.Error()))
+	}
+
+	return qty
+}
+
+// CommitReservation adds the reservation commit into the pipeline,
+// in order to run it in the same transaction than the order creation.
+func CommitReservation(ctx context.Context, rdb redis.Pipeliner, cid int) {
+	commitScript.Eval(ctx, rdb, []string{reservationKey(cid)})
+}
+
+// ReleaseReservation gives back the stock reserved by the cart.
+func ReleaseReservation(ctx context.Context, cid int) error {
+	l := slog.With(slog.Int("cid", cid))
+	l.LogAttrs(ctx, slog.LevelInfo, "releasing the reservation")
+
+	if _, err := releaseScript.Run(ctx, db.Redis, []string{reservationKey(cid)}).Result(); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot release the reservation", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the reservation is released")
+
+	return nil
+}
+
+// ReleaseExpiredReservations gives back the stock of the
+// reservations whose cart expired.
+func ReleaseExpiredReservations(ctx context.Context) (int, error) {
+	slog.LogAttrs(ctx, slog.LevelInfo, "releasing the expired reservations")
+
+	keys, err := db.Redis.ZRangeByScore(ctx, "reservations", &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().Unix(), 10),
+	}).Result()
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot get the expired reservations", slog.String("error", err.Error()))
+		return 0, errors.New("something went wrong")
+	}
+
+	for _, key := range keys {
+		if _, err := releaseScript.Run(ctx, db.Redis, []string{key}).Result(); err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "cannot release the reservation", slog.String("key", key), slog.String("error", err.Error()))
+			return 0, errors.New("something went wrong")
+		}
+	}
+
+	slog.LogAttrs(ctx, slog.LevelInfo, "the expired reservations are released", slog.Int("length", len(keys)))
+
+	return len(keys), nil
+}
+
+// RestoreStock adds the restore into the pipeline, in order to run
+// it in the same transaction than the order cancelation.
+// The quantities are indexed by product id.
+func RestoreStock(ctx context.Context, rdb redis.Pipeliner, quantities map[string]string) {
+	if len(quantities) == 0 {
+		return
+	}
+
+	keys := []string{}
+	args := []interface{}{}
+
+	for pid, qty := range quantities {
+		keys = append(keys, "product:"+pid)
+		args = append(args, qty)
+	}
+
+	restoreScript.Eval(ctx, rdb, keys, args...)
+}
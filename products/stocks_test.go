@@ -0,0 +1,193 @@
+package products
+
+import (
+	"artisons/db"
+	"artisons/tests"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// stock returns the available stock, the quantity
+// minus the held units, and the status.
+func stock(ctx context.Context, pid string) (string, string) {
+	vals, _ := db.Redis.HMGet(ctx, "product:"+pid, "quantity", "held", "status").Result()
+	qty, _ := vals[0].(string)
+	h, _ := vals[1].(string)
+	status, _ := vals[2].(string)
+
+	quantity, _ := strconv.Atoi(qty)
+	held, _ := strconv.Atoi(h)
+
+	return strconv.Itoa(quantity - held), status
+}
+
+func TestAvailableStock(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/stocks.redis")
+
+	if !Available(ctx, "STK1") {
+		t.Fatalf(`available = false, want true`)
+	}
+
+	if Available(ctx, "STK2") {
+		t.Fatalf(`available = true, want false`)
+	}
+
+	if Availables(ctx, []string{"STK1", "STK2"}) {
+		t.Fatalf(`availables = true, want false`)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/stocks.redis")
+
+	var tests = []struct {
+		name string
+		pdts []Product
+		qty  string
+		err  error
+	}{
+		{"quantity=1", []Product{{ID: "STK1", Quantity: 1}}, "1", nil},
+		{"quantity=2 replaces the reservation", []Product{{ID: "STK1", Quantity: 2}}, "0", nil},
+		{"quantity=3", []Product{{ID: "STK1", Quantity: 3}}, "0", errors.New("some products are not available anymore")},
+		{"status=offline", []Product{{ID: "STK3", Quantity: 1}}, "0", errors.New("some products are not available anymore")},
+		{"products=", []Product{}, "0", errors.New("the cart is empty")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Reserve(ctx, 1001, tt.pdts); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+
+			if qty, _ := stock(ctx, "STK1"); qty != tt.qty {
+				t.Fatalf(`qty = %s, want %s`, qty, tt.qty)
+			}
+		})
+	}
+
+	if err := Reserve(ctx, 1002, []Product{{ID: "STK1", Quantity: 1}}); err == nil {
+		t.Fatalf(`err = nil, want some products are not available anymore`)
+	}
+
+	if err := ReleaseReservation(ctx, 1001); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if qty, _ := stock(ctx, "STK1"); qty != "2" {
+		t.Fatalf(`qty = %s, want 2`, qty)
+	}
+}
+
+func TestCommitAndRestore(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/stocks.redis")
+
+	if err := Reserve(ctx, 1001, []Product{{ID: "STK1", Quantity: 2}}); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+		CommitReservation(ctx, rdb, 1001)
+		return nil
+	}); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if qty, status := stock(ctx, "STK1"); qty != "0" || status != "offline" {
+		t.Fatalf(`qty = %s, status = %s, want 0, offline`, qty, status)
+	}
+
+	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+		RestoreStock(ctx, rdb, map[string]string{"STK1": "2"})
+		return nil
+	}); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if qty, status := stock(ctx, "STK1"); qty != "2" || status != "online" {
+		t.Fatalf(`qty = %s, status = %s, want 2, online`, qty, status)
+	}
+}
+
+func TestReleaseExpiredReservations(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/stocks.redis")
+
+	if err := Reserve(ctx, 1001, []Product{{ID: "STK1", Quantity: 1}}); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	db.Redis.ZAdd(ctx, "reservations", redis.Z{Score: 1, Member: "reservation:1001"})
+
+	if _, err := ReleaseExpiredReservations(ctx); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if qty, _ := stock(ctx, "STK1"); qty != "2" {
+		t.Fatalf(`qty = %s, want 2`, qty)
+	}
+}
+
+func TestReleaseDeletedProduct(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/stocks.redis")
+
+	if err := Reserve(ctx, 1001, []Product{{ID: "STK4", Quantity: 1}}); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	db.Redis.Del(ctx, "product:STK4")
+
+	if err := ReleaseReservation(ctx, 1001); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if exists, _ := db.Redis.Exists(ctx, "product:STK4").Result(); exists != 0 {
+		t.Fatalf(`exists = %d, want 0`, exists)
+	}
+}
+
+func TestSaveWhileReserved(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/stocks.redis")
+
+	if err := Reserve(ctx, 1001, []Product{{ID: "STK1", Quantity: 1}}); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	p, err := Find(ctx, "STK1")
+	if err != nil || p.Quantity != 2 || p.Stock() != 1 {
+		t.Fatalf(`p.Quantity = %d, p.Stock() = %d, err = %v, want 2, 1, nil`, p.Quantity, p.Stock(), err)
+	}
+
+	// The merchant sets the stock to 5 while the cart holds 1
+	p.Quantity = 5
+	if _, err := p.Save(ctx); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if qty, _ := stock(ctx, "STK1"); qty != "4" {
+		t.Fatalf(`qty = %s, want 4`, qty)
+	}
+
+	if err := ReleaseReservation(ctx, 1001); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if qty, _ := stock(ctx, "STK1"); qty != "5" {
+		t.Fatalf(`qty = %s, want 5`, qty)
+	}
+}
@@ -0,0 +1,346 @@
+package products
+
+import (
+	"artisons/db"
+	"artisons/products/filters"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// A variant is stored like a product in product:{vid} with
+// the type "variant", so it has its own SKU, price, stock and
+// images, and the cart, the reservations and the orders use
+// the variant id as a product id.
+// The variant is linked to its product by the group field.
+// The variant ids are stored in the sorted set
+// product:{pid}:variants, scored by the update date.
+
+func variantsKey(pid string) string {
+	return "product:" + pid + ":variants"
+}
+
+// The deleted variant ids are moved to the sorted set
+// product:{pid}:variants:archived, scored by the archive date,
+// so the purge of the product removes them.
+func archivedVariantsKey(pid string) string {
+	return variantsKey(pid) + ":archived"
+}
+
+// SerializeOptions transforms the options to the meta
+// string representation.
+// Example: map["size"]"M" => size_M
+func SerializeOptions(ctx context.Context, options map[string]string) string {
+	meta := map[string][]string{}
+	for key, value := range options {
+		meta[key] = []string{value}
+	}
+
+	return SerializeMeta(ctx, meta)
+}
+
+// ParseOptions transforms the serialized options to a map.
+// Example: size_M => map["size"]"M"
+func ParseOptions(ctx context.Context, s string) map[string]string {
+	options := map[string]string{}
+
+	for key, values := range UnSerializeMeta(ctx, s) {
+		if len(values) > 0 {
+			options[key] = values[0]
+		}
+	}
+
+	return options
+}
+
+// OptionsLabel returns the option values sorted by key,
+// like "blue / M".
+func (p Product) OptionsLabel() string {
+	keys := []string{}
+	for key := range p.Options {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	values := []string{}
+	for _, key := range keys {
+		values = append(values, p.Options[key])
+	}
+
+	return strings.Join(values, " / ")
+}
+
+// Name returns the product title with the
+// variant options if any.
+func (p Product) Name() string {
+	if len(p.Options) == 0 {
+		return p.Title
+	}
+
+	return p.Title + " - " + p.OptionsLabel()
+}
+
+// validateOptions checks that the options are active
+// filters and that their values exist in these filters.
+func validateOptions(ctx context.Context, options map[string]string) error {
+	if len(options) == 0 {
+		slog.LogAttrs(ctx, slog.LevelInfo, "cannot use empty options")
+		return errors.New("input:options")
+	}
+
+	actives, err := filters.Actives(ctx)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range options {
+		i := slices.IndexFunc(actives, func(f filters.Filter) bool {
+			return f.Key == key
+		})
+
+		if i == -1 || !slices.Contains(actives[i].Values, value) {
+			slog.LogAttrs(ctx, slog.LevelInfo, "the option does not match a filter", slog.String("key", key), slog.String("value", value))
+			return fmt.Errorf("input:%s", key)
+		}
+	}
+
+	return nil
+}
+
+// HasVariants returns true if the product has variants.
+// Such a product is sold only through its variants.
+func HasVariants(ctx context.Context, pid string) bool {
+	count, err := db.Redis.ZCard(ctx, variantsKey(pid)).Result()
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot count the variants", slog.String("pid", pid), slog.String("error", err.Error()))
+		return false
+	}
+
+	return count > 0
+}
+
+// Variants returns the variants of the product.
+func Variants(ctx context.Context, pid string) ([]Product, error) {
+	l := slog.With(slog.String("pid", pid))
+	l.LogAttrs(ctx, slog.LevelInfo, "listing the variants")
+
+	vids, err := db.Redis.ZRange(ctx, variantsKey(pid), 0, -1).Result()
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot get the variants", slog.String("error", err.Error()))
+		return []Product{}, errors.New("something went wrong")
+	}
+
+	if len(vids) == 0 {
+		return []Product{}, nil
+	}
+
+	return FindAll(ctx, vids)
+}
+
+// ArchivedVariants returns the deleted variants of the product,
+// kept until the product is purged.
+func ArchivedVariants(ctx context.Context, pid string) ([]Product, error) {
+	l := slog.With(slog.String("pid", pid))
+	l.LogAttrs(ctx, slog.LevelInfo, "listing the archived variants")
+
+	vids, err := db.Redis.ZRange(ctx, archivedVariantsKey(pid), 0, -1).Result()
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot get the archived variants", slog.String("error", err.Error()))
+		return []Product{}, errors.New("something went wrong")
+	}
+
+	if len(vids) == 0 {
+		return []Product{}, nil
+	}
+
+	return FindAll(ctx, vids)
+}
+
+// SaveVariant validates and stores a variant of the product.
+// The title, description, slug, tags and tax class are
+// the product ones, and the images too when
+// the variant is created without image.
+// The options combination must be unique for the product.
+// The product meta are updated with the variant options,
+// so the filters find the product.
+func SaveVariant(ctx context.Context, pid string, v Product) (string, error) {
+	l := slog.With(slog.String("pid", pid), slog.String("vid", v.ID))
+	l.LogAttrs(ctx, slog.LevelInfo, "saving the variant")
+
+	p, err := Find(ctx, pid)
+	if err != nil {
+		return "", err
+	}
+
+	if p.Group != "" {
+		l.LogAttrs(ctx, slog.LevelInfo, "a variant cannot have variants")
+		return "", errors.New("you are not authorized to process this request")
+	}
+
+	if p.Status == Archived {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot save the variant of an archived product")
+		return "", errArchived
+	}
+
+	variants, err := Variants(ctx, pid)
+	if err != nil {
+		return "", err
+	}
+
+	if v.ID != "" && !slices.ContainsFunc(variants, func(s Product) bool { return s.ID == v.ID }) {
+		l.LogAttrs(ctx, slog.LevelInfo, "the variant does not belong to the product")
+		return "", errors.New("oops the data is not found")
+	}
+
+	if err := validateOptions(ctx, v.Options); err != nil {
+		return "", err
+	}
+
+	for _, s := range variants {
+		if s.ID != v.ID && maps.Equal(s.Options, v.Options) {
+			l.LogAttrs(ctx, slog.LevelInfo, "the variant exists already", slog.String("existing", s.ID))
+			return "", errors.New("the variant exists already")
+		}
+	}
+
+	v.Group = pid
+	v.Title = p.Title
+	v.Description = p.Description
+	v.Slug = p.Slug
+	v.Tags = p.Tags
+	v.TaxClass = p.TaxClass
+
+	if v.ID == "" && len(v.Images) == 0 {
+		v.Images = p.Images
+	}
+
+	if err := v.Validate(ctx); err != nil {
+		return "", err
+	}
+
+	vid, err := v.Save(ctx)
+	if errors.Is(err, errArchived) {
+		return "", err
+	}
+
+	if err != nil {
+		return "", errors.New("something went wrong")
+	}
+
+	if _, err := db.Redis.ZAdd(ctx, variantsKey(pid), redis.Z{
+		Score:  float64(time.Now().Unix()),
+		Member: vid,
+	}).Result(); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot store the variant id", slog.String("error", err.Error()))
+		return "", errors.New("something went wrong")
+	}
+
+	if err := syncMeta(ctx, pid, []string{}); err != nil {
+		return "", err
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the variant is saved", slog.String("vid", vid))
+
+	return vid, nil
+}
+
+// DeleteVariant archives the variant of the product
+// and removes its options from the product meta.
+// The variant data is kept for the orders, and is
+// removed when the product is purged.
+func DeleteVariant(ctx context.Context, pid, vid string) error {
+	l := slog.With(slog.String("pid", pid), slog.String("vid", vid))
+	l.LogAttrs(ctx, slog.LevelInfo, "archiving the variant")
+
+	v, err := Find(ctx, vid)
+	if err != nil {
+		return err
+	}
+
+	if v.Group != pid || v.Status == Archived {
+		l.LogAttrs(ctx, slog.LevelInfo, "the variant does not belong to the product", slog.String("status", v.Status))
+		return errors.New("oops the data is not found")
+	}
+
+	now := time.Now().Unix()
+
+	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+		archiveScript.Eval(ctx, rdb, []string{"product:" + vid}, now)
+		rdb.ZRem(ctx, variantsKey(pid), vid)
+		rdb.ZAdd(ctx, archivedVariantsKey(pid), redis.Z{Score: float64(now), Member: vid})
+		return nil
+	}); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot archive the variant", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	keys := []string{}
+	for key := range v.Options {
+		keys = append(keys, key)
+	}
+
+	if err := syncMeta(ctx, pid, keys); err != nil {
+		return err
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the variant is archived")
+
+	return nil
+}
+
+// syncMeta sets the product meta of the option keys to the
+// values of its variants. The keys given are synced too,
+// so the values of a deleted variant are removed.
+func syncMeta(ctx context.Context, pid string, keys []string) error {
+	l := slog.With(slog.String("pid", pid))
+
+	p, err := Find(ctx, pid)
+	if err != nil {
+		return err
+	}
+
+	variants, err := Variants(ctx, pid)
+	if err != nil {
+		return err
+	}
+
+	values := map[string][]string{}
+	for _, key := range keys {
+		values[key] = []string{}
+	}
+
+	for _, v := range variants {
+		for key, value := range v.Options {
+			if !slices.Contains(values[key], value) {
+				values[key] = append(values[key], value)
+			}
+		}
+	}
+
+	meta := p.Meta
+	for key, vals := range values {
+		if len(vals) == 0 {
+			delete(meta, key)
+			continue
+		}
+
+		sort.Strings(vals)
+		meta[key] = vals
+	}
+
+	if _, err := db.Redis.HSet(ctx, "product:"+pid, "meta", db.Escape(SerializeMeta(ctx, meta))).Result(); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot update the product meta", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package products
+
+import (
+	"artisons/money"
+	"artisons/tests"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestVariants(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/variants.redis")
+
+	variants, err := Variants(ctx, "VAR1")
+	if err != nil {
+		t.Fatalf(`Variants(ctx, "VAR1") = %v, want nil`, err)
+	}
+
+	if len(variants) != 1 || variants[0].ID != "VAR1S" {
+		t.Fatalf(`variants = %v, want [VAR1S]`, variants)
+	}
+
+	if variants[0].Group != "VAR1" || variants[0].Options["sizes"] != "S" {
+		t.Fatalf(`variant = %s %v, want VAR1 map[sizes:S]`, variants[0].Group, variants[0].Options)
+	}
+
+	if variants[0].Name() != "Sweat - S" {
+		t.Fatalf(`name = %s, want Sweat - S`, variants[0].Name())
+	}
+
+	if !HasVariants(ctx, "VAR1") {
+		t.Fatalf(`HasVariants(ctx, "VAR1") = false, want true`)
+	}
+}
+
+func TestVariantAvailable(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/variants.redis")
+
+	if !Available(ctx, "VAR1S") {
+		t.Fatalf(`Available(ctx, "VAR1S") = false, want true`)
+	}
+
+	if Available(ctx, "VAR4S") {
+		t.Fatalf(`Available(ctx, "VAR4S") = true, want false`)
+	}
+
+	if Availables(ctx, []string{"VAR1S", "VAR4S"}) {
+		t.Fatalf(`Availables(ctx, [VAR1S VAR4S]) = true, want false`)
+	}
+}
+
+func TestSaveVariant(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/variants.redis")
+
+	price, _ := money.Parse("60")
+	variant := func(id string, options map[string]string) Product {
+		return Product{ID: id, Price: price, Quantity: 2, Status: "online", Sku: "VAR1M", Options: options}
+	}
+
+	var tests = []struct {
+		name    string
+		pid     string
+		variant Product
+		err     error
+	}{
+		{"options=", "VAR1", variant("", map[string]string{}), errors.New("input:options")},
+		{"options=unknown", "VAR1", variant("", map[string]string{"unknown": "S"}), errors.New("input:unknown")},
+		{"options=sizes_XL", "VAR1", variant("", map[string]string{"sizes": "XL"}), errors.New("input:sizes")},
+		{"options=sizes_S", "VAR1", variant("", map[string]string{"sizes": "S"}), errors.New("the variant exists already")},
+		{"pid=VAR2", "VAR2", variant("", map[string]string{"sizes": "M"}), errors.New("you are not authorized to process this request")},
+		{"vid=VAR2", "VAR1", variant("VAR2", map[string]string{"sizes": "M"}), errors.New("oops the data is not found")},
+		{"options=sizes_M", "VAR1", variant("", map[string]string{"sizes": "M"}), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := SaveVariant(ctx, tt.pid, tt.variant); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`SaveVariant(ctx, %s, %v) = %v, want %v`, tt.pid, tt.variant, err, tt.err)
+			}
+		})
+	}
+
+	p, err := Find(ctx, "VAR1")
+	if err != nil {
+		t.Fatalf(`Find(ctx, "VAR1") = %v, want nil`, err)
+	}
+
+	if fmt.Sprintf("%v", p.Meta["sizes"]) != "[M S]" {
+		t.Fatalf(`meta = %v, want [M S]`, p.Meta["sizes"])
+	}
+}
+
+func TestDeleteVariant(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/variants.redis")
+
+	if err := DeleteVariant(ctx, "VAR1", "VAR2"); fmt.Sprintf("%s", err) != "oops the data is not found" {
+		t.Fatalf(`DeleteVariant(ctx, "VAR1", "VAR2") = %v, want oops the data is not found`, err)
+	}
+
+	if err := DeleteVariant(ctx, "VAR1", "VAR1S"); err != nil {
+		t.Fatalf(`DeleteVariant(ctx, "VAR1", "VAR1S") = %v, want nil`, err)
+	}
+
+	if HasVariants(ctx, "VAR1") {
+		t.Fatalf(`HasVariants(ctx, "VAR1") = true, want false`)
+	}
+
+	v, err := Find(ctx, "VAR1S")
+	if err != nil {
+		t.Fatalf(`Find(ctx, "VAR1S") = %v, want nil`, err)
+	}
+
+	if v.Status != Archived {
+		t.Fatalf(`v.Status = %s, want archived`, v.Status)
+	}
+
+	archived, err := ArchivedVariants(ctx, "VAR1")
+	if err != nil || len(archived) != 1 || archived[0].ID != "VAR1S" {
+		t.Fatalf(`ArchivedVariants(ctx, "VAR1") = %v, %v, want [VAR1S], nil`, archived, err)
+	}
+
+	if err := DeleteVariant(ctx, "VAR1", "VAR1S"); fmt.Sprintf("%s", err) != "oops the data is not found" {
+		t.Fatalf(`DeleteVariant(ctx, "VAR1", "VAR1S") = %v, want oops the data is not found`, err)
+	}
+
+	p, err := Find(ctx, "VAR1")
+	if err != nil {
+		t.Fatalf(`Find(ctx, "VAR1") = %v, want nil`, err)
+	}
+
+	if _, ok := p.Meta["sizes"]; ok {
+		t.Fatalf(`meta = %v, want no sizes`, p.Meta)
+	}
+}
@@ -0,0 +1,216 @@
+package products
+
+import (
+	"artisons/conf"
+	"artisons/http/contexts"
+	"artisons/http/forms"
+	"artisons/http/httperrors"
+	"artisons/http/httphelpers"
+	"artisons/money"
+	"artisons/products/filters"
+	"artisons/templates"
+	"html/template"
+	"log"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/text/language"
+)
+
+var variantsFormTpl *template.Template
+
+func init() {
+	var err error
+
+	variantsFormTpl, err = templates.Build("base.html").ParseFiles(
+		append(templates.AdminUI,
+			conf.WorkingSpace+"web/views/admin/products/products-head.html",
+			conf.WorkingSpace+"web/views/admin/products/products-scripts.html",
+			conf.WorkingSpace+"web/views/admin/products/products-images.html",
+			conf.WorkingSpace+"web/views/admin/products/variants-form.html",
+		)...)
+
+	if err != nil {
+		log.Panicln(err)
+	}
+}
+
+func AdminVariantFormHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	pid := r.PathValue("id")
+	vid := r.PathValue("vid")
+
+	p, err := Find(ctx, pid)
+	if err != nil {
+		httperrors.Page(w, ctx, "oops the data is not found", 404)
+		return
+	}
+
+	var variant Product
+
+	if vid != "" {
+		variant, err = Find(ctx, vid)
+		if err != nil || variant.Group != pid {
+			slog.LogAttrs(ctx, slog.LevelInfo, "cannot find the variant", slog.String("pid", pid), slog.String("vid", vid))
+			httperrors.Page(w, ctx, "oops the data is not found", 404)
+			return
+		}
+	}
+
+	f, err := filters.Actives(ctx)
+	if err != nil {
+		httperrors.Catch(w, ctx, err.Error(), 500)
+		return
+	}
+
+	lang := ctx.Value(contexts.Locale).(language.Tag)
+	data := httphelpers.Form[Product]{
+		Data:     variant,
+		Lang:     lang,
+		Currency: conf.Currency,
+		Page:     "Products",
+		Extra: struct {
+			Product Product
+			Filters []filters.Filter
+		}{
+			p,
+			f,
+		},
+	}
+
+	if err := variantsFormTpl.Execute(w, &data); err != nil {
+		slog.Error("cannot render the template", slog.String("error", err.Error()))
+	}
+}
+
+func AdminVariantSaveHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	pid := r.PathValue("id")
+
+	if err := r.ParseMultipartForm(conf.MaxUploadSize); err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot parse the form", slog.String("error", err.Error()))
+		httperrors.HXCatch(w, ctx, "something went wrong")
+		return
+	}
+
+	price, err := money.Parse(r.FormValue("price"))
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelInfo, "cannot parse the price", slog.String("price", r.FormValue("price")))
+		httperrors.HXCatch(w, ctx, "input:price")
+		return
+	}
+
+	quantity, err := strconv.ParseInt(r.FormValue("quantity"), 10, 64)
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelInfo, "cannot parse the quantity", slog.String("quantity", r.FormValue("quantity")))
+		httperrors.HXCatch(w, ctx, "input:quantity")
+		return
+	}
+
+	var max int64 = 0
+	if r.FormValue("max_quantity") != "" {
+		max, err = strconv.ParseInt(r.FormValue("max_quantity"), 10, 64)
+		if err != nil || max < 0 {
+			slog.LogAttrs(ctx, slog.LevelInfo, "cannot parse the max quantity", slog.String("max_quantity", r.FormValue("max_quantity")))
+			httperrors.HXCatch(w, ctx, "input:max_quantity")
+			return
+		}
+	}
+
+	var weight float64 = 0
+	if r.FormValue("weight") != "" {
+		weight, err = strconv.ParseFloat(r.FormValue("weight"), 64)
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelInfo, "cannot parse the weight", slog.String("weight", r.FormValue("weight")))
+			httperrors.HXCatch(w, ctx, "input:weight")
+			return
+		}
+	}
+
+	status := "online"
+	if r.FormValue("status") != "on" {
+		status = "offline"
+	}
+
+	f, err := filters.Actives(ctx)
+	if err != nil {
+		httperrors.HXCatch(w, ctx, "something went wrong")
+		return
+	}
+
+	options := map[string]string{}
+	for _, val := range f {
+		if r.FormValue(val.Key) != "" {
+			options[val.Key] = r.FormValue(val.Key)
+		}
+	}
+
+	current := []Image{}
+	if vid := r.PathValue("vid"); vid != "" {
+		previous, err := Find(ctx, vid)
+		if err != nil {
+			httperrors.HXCatch(w, ctx, err.Error())
+			return
+		}
+
+		current = previous.Images
+	}
+
+	files, err := forms.UploadAll(r, "products", "images")
+	if err != nil {
+		httperrors.HXCatch(w, ctx, err.Error())
+		return
+	}
+
+	v := Product{
+		ID:          r.PathValue("vid"),
+		Sku:         r.FormValue("sku"),
+		Status:      status,
+		Price:       price,
+		Quantity:    int(quantity),
+		MaxQuantity: int(max),
+		Weight:      weight,
+		Options:     options,
+		Images:      formImages(r, current, files),
+	}
+
+	// The variant is created with the product images
+	// if it has no image
+	if v.ID != "" && len(v.Images) == 0 {
+		forms.RollbackUpload(ctx, files)
+		httperrors.HXCatch(w, ctx, "input:images")
+		return
+	}
+
+	vid, err := SaveVariant(ctx, pid, v)
+	if err != nil {
+		forms.RollbackUpload(ctx, files)
+		httperrors.HXCatch(w, ctx, err.Error())
+		return
+	}
+
+	// The files shared with the product
+	// and the other variants are kept
+	removed, err := UnusedImages(ctx, pid, vid, RemovedImages(current, v.Images))
+	if err != nil {
+		httperrors.HXCatch(w, ctx, err.Error())
+		return
+	}
+
+	DeleteImageFiles(ctx, removed)
+
+	httphelpers.Success(w, "/admin/products/"+pid+"/edit")
+}
+
+func AdminVariantDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	pid := r.PathValue("id")
+
+	if err := DeleteVariant(ctx, pid, r.PathValue("vid")); err != nil {
+		httperrors.HXCatch(w, ctx, err.Error())
+		return
+	}
+
+	httphelpers.Success(w, "/admin/products/"+pid+"/edit")
+}
@@ -11,18 +11,39 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// wishScript adds the product to the wish list
+// if it exists and is not archived, see Purge.
+// KEYS[1] is the product hash, KEYS[2] the wish list.
+// ARGV[1] is the timestamp and ARGV[2] the product id.
+// It returns 1 when succeed or 0 if the product is not found.
+var wishScript = redis.NewScript(`
+local status = redis.call('HGET', KEYS[1], 'status')
+if not status or status == 'archived' then
+	return 0
+end
+
+redis.call('ZADD', KEYS[2], ARGV[1], ARGV[2])
+
+return 1
+`)
+
+// Wish adds the product to the user wish list.
+// An error occurs if the product does not exist or is archived.
 func Wish(ctx context.Context, uid int, pid string) error {
 	l := slog.With(slog.String("pid", pid))
 	l.LogAttrs(ctx, slog.LevelInfo, "adding to wish list")
 
-	if _, err := db.Redis.ZAdd(ctx, fmt.Sprintf("wish:%d", uid), redis.Z{
-		Member: pid,
-		Score:  float64(time.Now().Unix()),
-	}).Result(); err != nil {
+	ok, err := wishScript.Run(ctx, db.Redis, []string{"product:" + pid, fmt.Sprintf("wish:%d", uid)}, time.Now().Unix(), pid).Int()
+	if err != nil {
 		slog.LogAttrs(ctx, slog.LevelError, "cannot add to the wish list", slog.String("error", err.Error()))
 		return errors.New("something went wrong")
 	}
 
+	if ok == 0 {
+		l.LogAttrs(ctx, slog.LevelInfo, "the product is not found")
+		return errors.New("oops the data is not found")
+	}
+
 	return nil
 }
 
@@ -2,6 +2,8 @@ package products
 
 import (
 	"artisons/tests"
+	"errors"
+	"fmt"
 	"slices"
 	"testing"
 )
@@ -10,8 +12,26 @@ func TestWish(t *testing.T) {
 	ctx := tests.Context()
 	tests.ImportData(ctx, cur+"testdata/wish.redis")
 
-	if err := Wish(ctx, 1, "PDT1"); err != nil {
-		t.Fatalf(`err = %v, want nil`, err)
+	var tests = []struct {
+		name string
+		pid  string
+		err  error
+	}{
+		{"pid=PDT1", "PDT1", nil},
+		{"pid=WSH1&archived", "WSH1", errors.New("oops the data is not found")},
+		{"pid=idontexist", "idontexist", errors.New("oops the data is not found")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Wish(ctx, 1, tt.pid); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+		})
+	}
+
+	if HasWish(ctx, 1, "WSH1") {
+		t.Fatalf(`HasWish(ctx, 1, "WSH1") = true, want false`)
 	}
 }
 
@@ -9,6 +9,7 @@ import (
 	"artisons/users"
 	"log/slog"
 	"net/http"
+	"slices"
 
 	"golang.org/x/text/language"
 )
@@ -34,6 +35,10 @@ func WishesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The archived products are hidden but kept in
+	// the wish list until they are restored or purged
+	pds = slices.DeleteFunc(pds, func(p Product) bool { return p.Status == Archived })
+
 	data := struct {
 		Lang     language.Tag
 		Shop     shops.Settings
@@ -0,0 +1,593 @@
+// Package promotions manages the coupon codes applied in the cart
+package promotions
+
+import (
+	"artisons/db"
+	"artisons/money"
+	"artisons/products"
+	"artisons/validators"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/redis/go-redis/v9"
+)
+
+type Promotion struct {
+	// The coupon code typed by the customer, in uppercase
+	Code string `validate:"required,alphanum"`
+
+	Label string `validate:"required"`
+
+	// "percent", "fixed" or "shipping"
+	Type string `validate:"required,oneof=percent fixed shipping"`
+
+	// The percent discount, for the percent type
+	Percent float64 `validate:"gte=0,lte=100"`
+
+	// The discount amount in the shop currency, for the fixed type
+	Amount money.Money
+
+	// The minimum basket in the shop currency
+	Min money.Money
+
+	// The maximum number of orders, 0 for unlimited
+	Limit int `validate:"gte=0"`
+
+	// The maximum number of orders per user, 0 for unlimited
+	UserLimit int `validate:"gte=0"`
+
+	// The number of orders using the promotion
+	Uses int
+
+	// The tag keys restricting the discounted products,
+	// empty for the whole cart
+	Tags []string
+
+	Active bool
+
+	// The validity window, a zero value means no limit
+	StartAt time.Time
+	EndAt   time.Time
+
+	UpdatedAt time.Time
+}
+
+type ListResults struct {
+	Total      int
+	Promotions []Promotion
+}
+
+// Code normalizes the coupon code typed by the customer
+func Code(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func (p Promotion) Validate(ctx context.Context) error {
+	slog.LogAttrs(ctx, slog.LevelInfo, "validating a promotion")
+
+	if err := validators.V.Struct(p); err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot validate the promotion", slog.String("error", err.Error()))
+		field := err.(validator.ValidationErrors)[0]
+		low := strings.ToLower(field.Field())
+		return fmt.Errorf("input:%s", low)
+	}
+
+	if p.Type == "percent" && p.Percent <= 0 {
+		slog.LogAttrs(ctx, slog.LevelInfo, "the percent is required", slog.Float64("percent", p.Percent))
+		return errors.New("input:percent")
+	}
+
+	if p.Type == "fixed" && p.Amount.Amount <= 0 {
+		slog.LogAttrs(ctx, slog.LevelInfo, "the amount is required", slog.Any("amount", p.Amount))
+		return errors.New("input:amount")
+	}
+
+	if p.Min.Amount < 0 {
+		slog.LogAttrs(ctx, slog.LevelInfo, "the minimum cannot be negative", slog.Any("min", p.Min))
+		return errors.New("input:min")
+	}
+
+	if !p.StartAt.IsZero() && !p.EndAt.IsZero() && p.EndAt.Before(p.StartAt) {
+		slog.LogAttrs(ctx, slog.LevelInfo, "the end date is before the start date")
+		return errors.New("input:end_at")
+	}
+
+	slog.LogAttrs(ctx, slog.LevelInfo, "promotion validated")
+
+	return nil
+}
+
+func Exists(ctx context.Context, code string) (bool, error) {
+	slog.LogAttrs(ctx, slog.LevelInfo, "checking existence", slog.String("code", code))
+
+	exists, err := db.Redis.Exists(ctx, "promotion:"+code).Result()
+
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot check promotion existence")
+		return false, errors.New("something went wrong")
+	}
+
+	slog.LogAttrs(ctx, slog.LevelInfo, "promotion existence", slog.String("code", code), slog.Int64("exists", exists))
+
+	return exists > 0, nil
+}
+
+// Save stores the promotion in Redis.
+// The uses are not updated, see Use.
+// The keys are:
+// - promotion:code => the promotion data
+// - promotion:code:users => the number of orders per user id
+// - promotions => the promotion codes sorted by update date
+func (p Promotion) Save(ctx context.Context) (string, error) {
+	l := slog.With(slog.String("code", p.Code))
+	l.LogAttrs(ctx, slog.LevelInfo, "saving a promotion")
+
+	now := time.Now()
+	active := 0
+	if p.Active {
+		active = 1
+	}
+
+	var startAt, endAt int64
+	if !p.StartAt.IsZero() {
+		startAt = p.StartAt.Unix()
+	}
+
+	if !p.EndAt.IsZero() {
+		endAt = p.EndAt.Unix()
+	}
+
+	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+		rdb.HSet(ctx, "promotion:"+p.Code,
+			"label", p.Label,
+			"type", p.Type,
+			"percent", p.Percent,
+			"amount", p.Amount.Minor(),
+			"min", p.Min.Minor(),
+			"limit", p.Limit,
+			"user_limit", p.UserLimit,
+			"tags", strings.Join(p.Tags, ";"),
+			"active", active,
+			"start_at", startAt,
+			"end_at", endAt,
+			"updated_at", now.Unix(),
+		)
+
+		rdb.HSetNX(ctx, "promotion:"+p.Code, "code", p.Code)
+		rdb.HSetNX(ctx, "promotion:"+p.Code, "uses", 0)
+
+		rdb.ZAdd(ctx, "promotions", redis.Z{
+			Score:  float64(now.Unix()),
+			Member: p.Code,
+		})
+
+		return nil
+	}); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot store the data", slog.String("error", err.Error()))
+		return "", errors.New("something went wrong")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "promotion saved successfully")
+
+	return p.Code, nil
+}
+
+func parse(ctx context.Context, data map[string]string) (Promotion, error) {
+	l := slog.With(slog.String("code", data["code"]))
+
+	var percent float64
+	var err error
+
+	if data["percent"] != "" {
+		percent, err = strconv.ParseFloat(data["percent"], 64)
+		if err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot parse the percent", slog.String("percent", data["percent"]), slog.String("error", err.Error()))
+			return Promotion{}, errors.New("input:percent")
+		}
+	}
+
+	amount := money.New(0)
+	if data["amount"] != "" {
+		amount, err = money.ParseMinor(data["amount"])
+		if err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot parse the amount", slog.String("amount", data["amount"]), slog.String("error", err.Error()))
+			return Promotion{}, errors.New("input:amount")
+		}
+	}
+
+	min := money.New(0)
+	if data["min"] != "" {
+		min, err = money.ParseMinor(data["min"])
+		if err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot parse the min", slog.String("min", data["min"]), slog.String("error", err.Error()))
+			return Promotion{}, errors.New("input:min")
+		}
+	}
+
+	ints := map[string]int64{}
+	for _, key := range []string{"limit", "user_limit", "uses", "start_at", "end_at", "updated_at"} {
+		if data[key] == "" {
+			continue
+		}
+
+		val, err := strconv.ParseInt(data[key], 10, 64)
+		if err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot parse the value", slog.String("key", key), slog.String("value", data[key]), slog.String("error", err.Error()))
+			return Promotion{}, fmt.Errorf("input:%s", key)
+		}
+
+		ints[key] = val
+	}
+
+	tags := []string{}
+	if data["tags"] != "" {
+		tags = strings.Split(data["tags"], ";")
+	}
+
+	p := Promotion{
+		Code:      data["code"],
+		Label:     data["label"],
+		Type:      data["type"],
+		Percent:   percent,
+		Amount:    amount,
+		Min:       min,
+		Limit:     int(ints["limit"]),
+		UserLimit: int(ints["user_limit"]),
+		Uses:      int(ints["uses"]),
+		Tags:      tags,
+		Active:    data["active"] == "1",
+		UpdatedAt: time.Unix(ints["updated_at"], 0),
+	}
+
+	if ints["start_at"] > 0 {
+		p.StartAt = time.Unix(ints["start_at"], 0)
+	}
+
+	if ints["end_at"] > 0 {
+		p.EndAt = time.Unix(ints["end_at"], 0)
+	}
+
+	return p, nil
+}
+
+func Find(ctx context.Context, code string) (Promotion, error) {
+	l := slog.With(slog.String("code", code))
+	l.LogAttrs(ctx, slog.LevelInfo, "looking for promotion")
+
+	if code == "" {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot validate empty promotion code")
+		return Promotion{}, errors.New("input:code")
+	}
+
+	data, err := db.Redis.HGetAll(ctx, "promotion:"+code).Result()
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot find the promotion", slog.String("error", err.Error()))
+		return Promotion{}, errors.New("something went wrong")
+	}
+
+	if len(data) == 0 {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot find the promotion")
+		return Promotion{}, errors.New("oops the data is not found")
+	}
+
+	p, err := parse(ctx, data)
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot parse the promotion", slog.String("error", err.Error()))
+		return Promotion{}, errors.New("something went wrong")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the promotion is found")
+
+	return p, nil
+}
+
+func List(ctx context.Context, offset, num int) (ListResults, error) {
+	slog.LogAttrs(ctx, slog.LevelInfo, "listing promotions")
+
+	codes, err := db.Redis.ZRevRange(ctx, "promotions", int64(offset), int64(offset+num-1)).Result()
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot get the promotions", slog.String("error", err.Error()))
+		return ListResults{}, errors.New("something went wrong")
+	}
+
+	promotions := []Promotion{}
+
+	cmds, err := db.Redis.Pipelined(ctx, func(rdb redis.Pipeliner) error {
+		for _, val := range codes {
+			rdb.HGetAll(ctx, "promotion:"+val)
+		}
+
+		return nil
+	})
+
+	if err != nil && err != redis.Nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot get the promotion data", slog.String("error", err.Error()))
+		return ListResults{}, errors.New("something went wrong")
+	}
+
+	for _, cmd := range cmds {
+		key := fmt.Sprintf("%s", cmd.Args()[1])
+
+		if cmd.Err() != nil && cmd.Err() != redis.Nil {
+			slog.LogAttrs(ctx, slog.LevelError, "cannot get the promotion data", slog.String("key", key), slog.String("error", cmd.Err().Error()))
+			continue
+		}
+
+		val := cmd.(*redis.MapStringStringCmd).Val()
+		if len(val) == 0 {
+			continue
+		}
+
+		p, err := parse(ctx, val)
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "cannot parse the promotion", slog.String("key", key), slog.String("error", err.Error()))
+			continue
+		}
+
+		promotions = append(promotions, p)
+	}
+
+	total, err := db.Redis.ZCount(ctx, "promotions", "-inf", "+inf").Result()
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot get the promotions count")
+		return ListResults{}, errors.New("something went wrong")
+	}
+
+	slog.LogAttrs(ctx, slog.LevelInfo, "found promotions", slog.Int("length", len(promotions)))
+
+	return ListResults{
+		Total:      int(total),
+		Promotions: promotions,
+	}, nil
+}
+
+func Delete(ctx context.Context, code string) error {
+	l := slog.With(slog.String("code", code))
+	l.LogAttrs(ctx, slog.LevelInfo, "deleting promotion")
+
+	if code == "" {
+		l.LogAttrs(ctx, slog.LevelInfo, "the code cannot be empty")
+		return errors.New("input:code")
+	}
+
+	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+		rdb.Del(ctx, "promotion:"+code, "promotion:"+code+":users")
+		rdb.ZRem(ctx, "promotions", code)
+
+		return nil
+	}); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot delete the data", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "promotion deleted successfully")
+
+	return nil
+}
+
+// Eligible returns true if the product is discounted
+// by the promotion
+func (p Promotion) Eligible(pdt products.Product) bool {
+	if len(p.Tags) == 0 {
+		return true
+	}
+
+	for _, tag := range pdt.Tags {
+		if slices.Contains(p.Tags, tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Check returns an error if the user cannot use the promotion
+// for the products.
+// The promotion has to be active, inside its validity window,
+// under its usage limits, and the eligible products have to reach
+// the minimum basket. A user limit requires a logged user.
+func (p Promotion) Check(ctx context.Context, uid int, pdts []products.Product) error {
+	l := slog.With(slog.String("code", p.Code), slog.Int("uid", uid))
+	l.LogAttrs(ctx, slog.LevelInfo, "checking the promotion")
+
+	now := time.Now()
+
+	if !p.Active || (!p.StartAt.IsZero() && now.Before(p.StartAt)) || (!p.EndAt.IsZero() && now.After(p.EndAt)) {
+		l.LogAttrs(ctx, slog.LevelInfo, "the promotion is not active", slog.Bool("active", p.Active))
+		return errors.New("the coupon is not valid")
+	}
+
+	if p.Limit > 0 && p.Uses >= p.Limit {
+		l.LogAttrs(ctx, slog.LevelInfo, "the promotion limit is reached", slog.Int("uses", p.Uses))
+		return errors.New("the coupon usage limit is reached")
+	}
+
+	if p.UserLimit > 0 {
+		if uid == 0 {
+			l.LogAttrs(ctx, slog.LevelInfo, "the promotion requires a user")
+			return errors.New("you need to be logged to use this coupon")
+		}
+
+		uses, err := db.Redis.HGet(ctx, "promotion:"+p.Code+":users", strconv.Itoa(uid)).Int()
+		if err != nil && err != redis.Nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot get the user uses", slog.String("error", err.Error()))
+			return errors.New("something went wrong")
+		}
+
+		if uses >= p.UserLimit {
+			l.LogAttrs(ctx, slog.LevelInfo, "the promotion user limit is reached", slog.Int("uses", uses))
+			return errors.New("the coupon usage limit is reached")
+		}
+	}
+
+	var subtotal money.Money
+	eligible := false
+
+	for _, pdt := range pdts {
+		if p.Eligible(pdt) {
+			subtotal = subtotal.Add(pdt.DiscountedPrice().Mul(pdt.Quantity))
+			eligible = true
+		}
+	}
+
+	if !eligible {
+		l.LogAttrs(ctx, slog.LevelInfo, "no product is eligible")
+		return errors.New("the coupon does not apply to the cart products")
+	}
+
+	if subtotal.Cmp(p.Min.Convert(subtotal.Currency)) < 0 {
+		l.LogAttrs(ctx, slog.LevelInfo, "the promotion minimum is not reached", slog.Any("subtotal", subtotal), slog.Any("min", p.Min))
+		return errors.New("the coupon minimum amount is not reached")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the promotion is valid")
+
+	return nil
+}
+
+// Apply returns the discount of each product line, indexed by
+// product id, and true if the delivery is free.
+// The fixed amount is converted to the currency, capped to the
+// eligible lines and split between them by their amounts,
+// so the VAT can be computed per rate.
+func (p Promotion) Apply(pdts []products.Product, currency string) (map[string]money.Money, bool) {
+	discounts := map[string]money.Money{}
+
+	if p.Type == "shipping" {
+		return discounts, true
+	}
+
+	subtotal := money.New(0).WithCurrency(currency)
+	lines := []products.Product{}
+
+	for _, pdt := range pdts {
+		if p.Eligible(pdt) {
+			subtotal = subtotal.Add(pdt.DiscountedPrice().Mul(pdt.Quantity))
+			lines = append(lines, pdt)
+		}
+	}
+
+	if p.Type == "percent" {
+		for _, pdt := range lines {
+			discounts[pdt.ID] = pdt.DiscountedPrice().Mul(pdt.Quantity).Percent(p.Percent)
+		}
+
+		return discounts, false
+	}
+
+	amount := p.Amount.Convert(currency)
+	if amount.Cmp(subtotal) > 0 {
+		amount = subtotal
+	}
+
+	rest := amount
+	for i, pdt := range lines {
+		if i == len(lines)-1 {
+			discounts[pdt.ID] = rest
+			break
+		}
+
+		d := amount.Ratio(pdt.DiscountedPrice().Mul(pdt.Quantity).Amount, subtotal.Amount)
+		discounts[pdt.ID] = d
+		rest = rest.Sub(d)
+	}
+
+	return discounts, false
+}
+
+// useScript counts an order if the usage limits are not reached,
+// so concurrent orders cannot exceed them.
+// KEYS[1] is the promotion hash, KEYS[2] the users hash.
+// ARGV[1] is the user id, 0 for a guest.
+// It returns 1 when succeed, 0 if a limit is reached
+// or -1 if the promotion does not exist.
+var useScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return -1
+end
+
+local limit = tonumber(redis.call('HGET', KEYS[1], 'limit') or '0') or 0
+local uses = tonumber(redis.call('HGET', KEYS[1], 'uses') or '0') or 0
+if limit > 0 and uses >= limit then
+	return 0
+end
+
+local userLimit = tonumber(redis.call('HGET', KEYS[1], 'user_limit') or '0') or 0
+if userLimit > 0 then
+	if ARGV[1] == '0' then
+		return 0
+	end
+
+	local used = tonumber(redis.call('HGET', KEYS[2], ARGV[1]) or '0') or 0
+	if used >= userLimit then
+		return 0
+	end
+end
+
+redis.call('HINCRBY', KEYS[1], 'uses', 1)
+if ARGV[1] ~= '0' then
+	redis.call('HINCRBY', KEYS[2], ARGV[1], 1)
+end
+
+return 1
+`)
+
+// Use counts an order for the promotion and the user.
+// The limits are checked again when counting, because
+// another order may have used the promotion since Check.
+// An error occurs if a limit is reached, see CancelUse
+// to give back the use when the order fails.
+func Use(ctx context.Context, code string, uid int) error {
+	l := slog.With(slog.String("code", code), slog.Int("uid", uid))
+	l.LogAttrs(ctx, slog.LevelInfo, "using the promotion")
+
+	ok, err := useScript.Run(ctx, db.Redis, []string{"promotion:" + code, "promotion:" + code + ":users"}, uid).Int()
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot use the promotion", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	if ok == -1 {
+		l.LogAttrs(ctx, slog.LevelInfo, "the promotion does not exist")
+		return errors.New("the coupon is not valid")
+	}
+
+	if ok == 0 {
+		l.LogAttrs(ctx, slog.LevelInfo, "the promotion limit is reached")
+		return errors.New("the coupon usage limit is reached")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the promotion is used")
+
+	return nil
+}
+
+// CancelUse gives back the use counted by Use.
+func CancelUse(ctx context.Context, code string, uid int) error {
+	l := slog.With(slog.String("code", code), slog.Int("uid", uid))
+	l.LogAttrs(ctx, slog.LevelInfo, "canceling the promotion use")
+
+	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+		rdb.HIncrBy(ctx, "promotion:"+code, "uses", -1)
+
+		if uid > 0 {
+			rdb.HIncrBy(ctx, "promotion:"+code+":users", strconv.Itoa(uid), -1)
+		}
+
+		return nil
+	}); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot cancel the promotion use", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the promotion use is canceled")
+
+	return nil
+}
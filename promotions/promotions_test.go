@@ -0,0 +1,283 @@
+package promotions
+
+import (
+	"artisons/db"
+	"artisons/money"
+	"artisons/products"
+	"artisons/tests"
+	"errors"
+	"fmt"
+	"path"
+	"runtime"
+	"testing"
+	"time"
+)
+
+var promotion Promotion = Promotion{
+	Code:    "WELCOME",
+	Label:   "Welcome",
+	Type:    "percent",
+	Percent: 10,
+	Active:  true,
+}
+
+var cur string
+
+func init() {
+	_, filename, _, _ := runtime.Caller(0)
+	cur = path.Dir(filename) + "/"
+}
+
+func TestValidate(t *testing.T) {
+	ctx := tests.Context()
+
+	var tests = []struct {
+		name   string
+		update func(p Promotion) Promotion
+		err    error
+	}{
+		{"code=", func(p Promotion) Promotion { p.Code = ""; return p }, errors.New("input:code")},
+		{"code=!!!", func(p Promotion) Promotion { p.Code = "!!!"; return p }, errors.New("input:code")},
+		{"label=", func(p Promotion) Promotion { p.Label = ""; return p }, errors.New("input:label")},
+		{"type=idontexist", func(p Promotion) Promotion { p.Type = "idontexist"; return p }, errors.New("input:type")},
+		{"percent=0", func(p Promotion) Promotion { p.Percent = 0; return p }, errors.New("input:percent")},
+		{"percent=101", func(p Promotion) Promotion { p.Percent = 101; return p }, errors.New("input:percent")},
+		{"type=fixed,amount=0", func(p Promotion) Promotion { p.Type = "fixed"; return p }, errors.New("input:amount")},
+		{"limit=-1", func(p Promotion) Promotion { p.Limit = -1; return p }, errors.New("input:limit")},
+		{"end_at<start_at", func(p Promotion) Promotion {
+			p.StartAt = time.Now()
+			p.EndAt = time.Now().Add(-time.Hour)
+			return p
+		}, errors.New("input:end_at")},
+		{"type=shipping", func(p Promotion) Promotion { p.Type = "shipping"; p.Percent = 0; return p }, nil},
+		{"success", func(p Promotion) Promotion { return p }, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.update(promotion)
+
+			if err := p.Validate(ctx); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSave(t *testing.T) {
+	ctx := tests.Context()
+
+	code, err := promotion.Save(ctx)
+	if code != promotion.Code || err != nil {
+		t.Fatalf(`code = %s, err = %v, want %s, nil`, code, err, promotion.Code)
+	}
+
+	p, err := Find(ctx, code)
+	if err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if p.Percent != promotion.Percent || !p.Active || p.Uses != 0 {
+		t.Fatalf(`p = %v, want %v`, p, promotion)
+	}
+}
+
+func TestFind(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/promotions.redis")
+
+	var tests = []struct {
+		name string
+		code string
+		err  error
+	}{
+		{"code=", "", errors.New("input:code")},
+		{"code=PROMO10", "PROMO10", nil},
+		{"code=idontexist", "idontexist", errors.New("oops the data is not found")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Find(ctx, tt.code); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/promotions.redis")
+
+	res, err := List(ctx, 0, 10)
+	if err != nil || res.Total == 0 || len(res.Promotions) == 0 {
+		t.Fatalf(`total = %d, err = %v, want > 0, nil`, res.Total, err)
+	}
+
+	res, err = List(ctx, 0, 2)
+	if err != nil || len(res.Promotions) != 2 {
+		t.Fatalf(`len(res.Promotions) = %d, err = %v, want 2, nil`, len(res.Promotions), err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/promotions.redis")
+
+	if err := Delete(ctx, "DISABLED"); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if exists, err := Exists(ctx, "DISABLED"); exists || err != nil {
+		t.Fatalf(`exists = %v, err = %v, want false, nil`, exists, err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/promotions.redis")
+
+	pdts := []products.Product{
+		{ID: "PDT1", Quantity: 2, Price: money.New(1500), Tags: []string{"clothes"}},
+	}
+
+	var tests = []struct {
+		name string
+		code string
+		uid  int
+		pdts []products.Product
+		err  error
+	}{
+		{"code=PROMO10", "PROMO10", 0, pdts, nil},
+		{"code=FIVE", "FIVE", 0, pdts, nil},
+		{"code=FIVE,min", "FIVE", 0, []products.Product{{ID: "PDT1", Quantity: 1, Price: money.New(1500)}}, errors.New("the coupon minimum amount is not reached")},
+		{"code=SHOES", "SHOES", 0, pdts, errors.New("the coupon does not apply to the cart products")},
+		{"code=EXPIRED", "EXPIRED", 0, pdts, errors.New("the coupon is not valid")},
+		{"code=DISABLED", "DISABLED", 0, pdts, errors.New("the coupon is not valid")},
+		{"code=USED", "USED", 0, pdts, errors.New("the coupon usage limit is reached")},
+		{"code=ONCE,uid=0", "ONCE", 0, pdts, errors.New("you need to be logged to use this coupon")},
+		{"code=ONCE,uid=1", "ONCE", 1, pdts, errors.New("the coupon usage limit is reached")},
+		{"code=ONCE,uid=2", "ONCE", 2, pdts, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Find(ctx, tt.code)
+			if err != nil {
+				t.Fatalf(`err = %v, want nil`, err)
+			}
+
+			if err := p.Check(ctx, tt.uid, tt.pdts); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	pdts := []products.Product{
+		{ID: "PDT1", Quantity: 2, Price: money.New(1000), Tags: []string{"clothes"}},
+		{ID: "PDT2", Quantity: 1, Price: money.New(2000), Tags: []string{"shoes"}},
+	}
+
+	var tests = []struct {
+		name      string
+		promotion Promotion
+		discounts map[string]int64
+		free      bool
+	}{
+		{"type=percent", Promotion{Type: "percent", Percent: 10}, map[string]int64{"PDT1": 200, "PDT2": 200}, false},
+		{"type=percent,tags=shoes", Promotion{Type: "percent", Percent: 10, Tags: []string{"shoes"}}, map[string]int64{"PDT2": 200}, false},
+		{"type=fixed", Promotion{Type: "fixed", Amount: money.New(1000)}, map[string]int64{"PDT1": 500, "PDT2": 500}, false},
+		{"type=fixed,amount>total", Promotion{Type: "fixed", Amount: money.New(10000)}, map[string]int64{"PDT1": 2000, "PDT2": 2000}, false},
+		{"type=fixed,amount=333", Promotion{Type: "fixed", Amount: money.New(333)}, map[string]int64{"PDT1": 167, "PDT2": 166}, false},
+		{"type=shipping", Promotion{Type: "shipping"}, map[string]int64{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discounts, free := tt.promotion.Apply(pdts, "EUR")
+
+			if free != tt.free {
+				t.Fatalf(`free = %v, want %v`, free, tt.free)
+			}
+
+			if len(discounts) != len(tt.discounts) {
+				t.Fatalf(`len(discounts) = %d, want %d`, len(discounts), len(tt.discounts))
+			}
+
+			for pid, amount := range tt.discounts {
+				if discounts[pid].Amount != amount {
+					t.Fatalf(`discounts[%s] = %d, want %d`, pid, discounts[pid].Amount, amount)
+				}
+			}
+		})
+	}
+}
+
+func TestUse(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/promotions.redis")
+
+	var tests = []struct {
+		name string
+		code string
+		uid  int
+		err  error
+	}{
+		{"code=PROMO10,uid=3", "PROMO10", 3, nil},
+		{"code=LAST,uid=3", "LAST", 3, nil},
+		{"code=LAST,uid=4", "LAST", 4, errors.New("the coupon usage limit is reached")},
+		{"code=USED", "USED", 3, errors.New("the coupon usage limit is reached")},
+		{"code=ONCE,uid=1", "ONCE", 1, errors.New("the coupon usage limit is reached")},
+		{"code=ONCE,uid=0", "ONCE", 0, errors.New("the coupon usage limit is reached")},
+		{"code=UNKNOWN", "UNKNOWN", 3, errors.New("the coupon is not valid")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Use(ctx, tt.code, tt.uid); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+		})
+	}
+
+	if uses, err := db.Redis.HGet(ctx, "promotion:PROMO10:users", "3").Int(); uses != 1 || err != nil {
+		t.Fatalf(`uses = %d, err = %v, want 1, nil`, uses, err)
+	}
+
+	if uses, err := db.Redis.HGet(ctx, "promotion:LAST", "uses").Int(); uses != 1 || err != nil {
+		t.Fatalf(`uses = %d, err = %v, want 1, nil`, uses, err)
+	}
+
+	if exists, err := db.Redis.Exists(ctx, "promotion:UNKNOWN").Result(); exists != 0 || err != nil {
+		t.Fatalf(`exists = %d, err = %v, want 0, nil`, exists, err)
+	}
+}
+
+func TestCancelUse(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/promotions.redis")
+
+	if err := Use(ctx, "LAST", 3); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if err := CancelUse(ctx, "LAST", 3); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if err := Use(ctx, "LAST", 4); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if uses, err := db.Redis.HGet(ctx, "promotion:LAST:users", "3").Int(); uses != 0 || err != nil {
+		t.Fatalf(`uses = %d, err = %v, want 0, nil`, uses, err)
+	}
+}
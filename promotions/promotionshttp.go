@@ -0,0 +1,265 @@
+package promotions
+
+import (
+	"artisons/conf"
+	"artisons/http/contexts"
+	"artisons/http/httperrors"
+	"artisons/http/httphelpers"
+	"artisons/money"
+	"artisons/tags"
+	"artisons/templates"
+	"html/template"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+var promotionsTpl *template.Template
+var promotionsHxTpl *template.Template
+var promotionsFormTpl *template.Template
+
+func init() {
+	var err error
+
+	files := append(templates.AdminTable,
+		conf.WorkingSpace+"web/views/admin/promotions/promotions-table.html",
+	)
+
+	promotionsTpl, err = templates.Build("base.html").ParseFiles(
+		append(files, append(templates.AdminListHandler,
+			conf.WorkingSpace+"web/views/admin/promotions/promotions-actions.html",
+			conf.WorkingSpace+"web/views/admin/promotions/promotions.html")...,
+		)...)
+
+	if err != nil {
+		log.Panicln(err)
+	}
+
+	promotionsHxTpl, err = templates.Build("promotions-table.html").ParseFiles(files...)
+
+	if err != nil {
+		log.Panicln(err)
+	}
+
+	promotionsFormTpl, err = templates.Build("base.html").ParseFiles(
+		append(templates.AdminUI,
+			conf.WorkingSpace+"web/views/admin/promotions/promotions-scripts.html",
+			conf.WorkingSpace+"web/views/admin/promotions/promotions-head.html",
+			conf.WorkingSpace+"web/views/admin/promotions/promotions-form.html",
+		)...)
+
+	if err != nil {
+		log.Panicln(err)
+	}
+}
+
+func AdminSaveHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := r.ParseForm(); err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot parse the form", slog.String("error", err.Error()))
+		httperrors.HXCatch(w, ctx, "something went wrong")
+		return
+	}
+
+	var percent float64
+	if r.FormValue("percent") != "" {
+		val, err := strconv.ParseFloat(r.FormValue("percent"), 64)
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "cannot parse the percent", slog.String("percent", r.FormValue("percent")), slog.String("error", err.Error()))
+			httperrors.HXCatch(w, ctx, "input:percent")
+			return
+		}
+		percent = val
+	}
+
+	amounts := map[string]money.Money{}
+	for _, key := range []string{"amount", "min"} {
+		amounts[key] = money.New(0)
+
+		if r.FormValue(key) == "" {
+			continue
+		}
+
+		val, err := money.Parse(r.FormValue(key))
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "cannot parse the value", slog.String(key, r.FormValue(key)), slog.String("error", err.Error()))
+			httperrors.HXCatch(w, ctx, "input:"+key)
+			return
+		}
+		amounts[key] = val
+	}
+
+	limits := map[string]int{}
+	for _, key := range []string{"limit", "user_limit"} {
+		if r.FormValue(key) == "" {
+			continue
+		}
+
+		val, err := strconv.ParseInt(r.FormValue(key), 10, 64)
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "cannot parse the value", slog.String(key, r.FormValue(key)), slog.String("error", err.Error()))
+			httperrors.HXCatch(w, ctx, "input:"+key)
+			return
+		}
+		limits[key] = int(val)
+	}
+
+	dates := map[string]time.Time{}
+	for _, key := range []string{"start_at", "end_at"} {
+		if r.FormValue(key) == "" {
+			continue
+		}
+
+		val, err := time.ParseInLocation("2006-01-02", r.FormValue(key), time.Local)
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "cannot parse the date", slog.String(key, r.FormValue(key)), slog.String("error", err.Error()))
+			httperrors.HXCatch(w, ctx, "input:"+key)
+			return
+		}
+		dates[key] = val
+	}
+
+	// The promotion ends at the end of the day
+	if !dates["end_at"].IsZero() {
+		dates["end_at"] = dates["end_at"].Add(24*time.Hour - time.Second)
+	}
+
+	id := r.PathValue("id")
+	code := id
+	if code == "" {
+		code = Code(r.FormValue("code"))
+	}
+
+	p := Promotion{
+		Code:      code,
+		Label:     r.FormValue("label"),
+		Type:      r.FormValue("type"),
+		Percent:   percent,
+		Amount:    amounts["amount"],
+		Min:       amounts["min"],
+		Limit:     limits["limit"],
+		UserLimit: limits["user_limit"],
+		Tags:      r.Form["tags"],
+		Active:    r.FormValue("active") == "on",
+		StartAt:   dates["start_at"],
+		EndAt:     dates["end_at"],
+	}
+
+	err := p.Validate(ctx)
+	if err != nil {
+		httperrors.HXCatch(w, ctx, err.Error())
+		return
+	}
+
+	if id == "" {
+		exists, err := Exists(ctx, code)
+		if err != nil {
+			httperrors.HXCatch(w, ctx, "input:code")
+			return
+		}
+
+		if exists {
+			httperrors.HXCatch(w, ctx, "the promotion exists already")
+			return
+		}
+	}
+
+	_, err = p.Save(ctx)
+	if err != nil {
+		httperrors.HXCatch(w, ctx, err.Error())
+		return
+	}
+
+	httphelpers.Success(w, "/admin/promotions")
+}
+
+func AdminListHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	p := httphelpers.BuildPaginator(r)
+
+	res, err := List(ctx, p.Offset, p.Num)
+	if err != nil {
+		httperrors.Catch(w, ctx, err.Error(), 500)
+		return
+	}
+
+	t := promotionsTpl
+	isHX, _ := ctx.Value(contexts.HX).(bool)
+	if isHX {
+		t = promotionsHxTpl
+	}
+
+	lang := ctx.Value(contexts.Locale).(language.Tag)
+	data := httphelpers.List[Promotion]{
+		Lang:       lang,
+		Items:      res.Promotions,
+		Empty:      len(res.Promotions) == 0,
+		Currency:   conf.Currency,
+		Pagination: p.Build(ctx, res.Total, len(res.Promotions)),
+		Page:       "Promotions",
+		Flash:      httphelpers.Flash(w, r),
+	}
+
+	if err = t.Execute(w, &data); err != nil {
+		slog.Error("cannot render the template", slog.String("error", err.Error()))
+	}
+}
+
+func AdminFormHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+
+	var promotion Promotion
+
+	if id != "" {
+		var err error
+		promotion, err = Find(ctx, id)
+
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "cannot find the promotion", slog.Any("id", id), slog.String("error", err.Error()))
+			httperrors.Page(w, ctx, "oops the data is not found", 404)
+			return
+		}
+	}
+
+	lang := ctx.Value(contexts.Locale).(language.Tag)
+	data := httphelpers.Form[Promotion]{
+		Data:     promotion,
+		Lang:     lang,
+		Currency: conf.Currency,
+		Page:     "Promotions",
+	}
+
+	t, err := tags.List(ctx, 0, 9999)
+	if err != nil {
+		httperrors.Catch(w, ctx, err.Error(), 500)
+	}
+
+	data.Extra = t
+
+	if err := promotionsFormTpl.Execute(w, &data); err != nil {
+		slog.Error("cannot render the template", slog.String("error", err.Error()))
+	}
+}
+
+func AdminDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+
+	err := Delete(ctx, id)
+	if err != nil {
+		httperrors.HXCatch(w, ctx, err.Error())
+		return
+	}
+
+	p, _ := url.Parse(r.Header.Get("HX-Current-Url"))
+	r.URL.Path = p.Path
+
+	AdminListHandler(w, r)
+}
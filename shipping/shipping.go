@@ -0,0 +1,470 @@
+// Package shipping calculates the delivery fees.
+// The destination belongs to a zone, defined by countries
+// and zipcode prefixes, and each shipping method has a rate
+// table by zone and total weight.
+// A delivery without shipping method uses the shop flat fees,
+// and the "collect" delivery is free.
+package shipping
+
+import (
+	"artisons/conf"
+	"artisons/db"
+	"artisons/money"
+	"artisons/shops"
+	"artisons/validators"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Collect is the delivery made in the shop, without fees
+const Collect = "collect"
+
+type Zone struct {
+	// The zone id, like "france" or "europe"
+	ID string
+
+	Name string
+
+	// The country codes
+	Countries []string
+
+	// The zipcode prefixes, all the zipcodes
+	// of the countries if empty
+	Zipcodes []string
+}
+
+// Rate is the price of a method for a zone,
+// up to a weight
+type Rate struct {
+	Zone string
+
+	// The maximum weight in grams, no limit if zero
+	MaxWeight float64
+
+	// The price in the shop currency
+	Price money.Money
+}
+
+type Method struct {
+	// The method id, which is the delivery name,
+	// like "colissimo" or "home"
+	ID string
+
+	Name string
+
+	Rates []Rate
+}
+
+// Quote is the price of a delivery for a cart
+type Quote struct {
+	Delivery string
+	Price    money.Money
+}
+
+// Match returns the matching score of the zone for the destination,
+// 0 if the zone does not match.
+// A zipcode prefix is more specific than a country,
+// and a long prefix more specific than a short one.
+func (z Zone) Match(country, zipcode string) int {
+	found := false
+	for _, c := range z.Countries {
+		if c == country {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		return 0
+	}
+
+	if len(z.Zipcodes) == 0 {
+		return 1
+	}
+
+	score := 0
+	for _, prefix := range z.Zipcodes {
+		if strings.HasPrefix(zipcode, prefix) && len(prefix)+1 > score {
+			score = len(prefix) + 1
+		}
+	}
+
+	return score
+}
+
+// FindZone returns the most specific zone matching
+// the destination.
+func FindZone(zones []Zone, country, zipcode string) (Zone, bool) {
+	best := Zone{}
+	score := 0
+
+	for _, z := range zones {
+		if s := z.Match(country, zipcode); s > score {
+			best = z
+			score = s
+		}
+	}
+
+	return best, score > 0
+}
+
+// Price returns the price of the method for the zone and the weight.
+// The rate with the lowest maximum weight covering the weight is used.
+// It returns false if the method cannot deliver the zone
+// or if the weight is too high.
+func (m Method) Price(zone string, weight float64) (money.Money, bool) {
+	rates := []Rate{}
+	for _, r := range m.Rates {
+		if r.Zone == zone && (r.MaxWeight == 0 || weight <= r.MaxWeight) {
+			rates = append(rates, r)
+		}
+	}
+
+	if len(rates) == 0 {
+		return money.Money{}, false
+	}
+
+	sort.Slice(rates, func(i, j int) bool {
+		if rates[i].MaxWeight == 0 {
+			return false
+		}
+
+		return rates[j].MaxWeight == 0 || rates[i].MaxWeight < rates[j].MaxWeight
+	})
+
+	return rates[0].Price, true
+}
+
+func rateField(zone string, weight float64) string {
+	return zone + ":" + strconv.FormatFloat(weight, 'f', -1, 64)
+}
+
+// Save stores the zone.
+// The keys are:
+// - shipping:zone:id => the zone data
+// - shipping:zones => the zone ids
+func (z Zone) Save(ctx context.Context) error {
+	l := slog.With(slog.String("id", z.ID))
+	l.LogAttrs(ctx, slog.LevelInfo, "saving the shipping zone")
+
+	if err := validators.V.Var(z.ID, "required,alphanum"); err != nil {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot validate the id", slog.String("error", err.Error()))
+		return errors.New("input:id")
+	}
+
+	if z.Name == "" {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot validate the name")
+		return errors.New("input:name")
+	}
+
+	if len(z.Countries) == 0 {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot validate the empty countries")
+		return errors.New("input:countries")
+	}
+
+	for _, country := range z.Countries {
+		if err := validators.V.Var(country, "required,iso3166_1_alpha2"); err != nil {
+			l.LogAttrs(ctx, slog.LevelInfo, "cannot validate the country", slog.String("country", country))
+			return errors.New("input:countries")
+		}
+	}
+
+	for _, zipcode := range z.Zipcodes {
+		if err := validators.V.Var(zipcode, "required,alphanum"); err != nil {
+			l.LogAttrs(ctx, slog.LevelInfo, "cannot validate the zipcode", slog.String("zipcode", zipcode))
+			return errors.New("input:zipcodes")
+		}
+	}
+
+	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+		rdb.HSet(ctx, "shipping:zone:"+z.ID,
+			"id", z.ID,
+			"name", z.Name,
+			"countries", strings.Join(z.Countries, ";"),
+			"zipcodes", strings.Join(z.Zipcodes, ";"),
+		)
+		rdb.SAdd(ctx, "shipping:zones", z.ID)
+
+		return nil
+	}); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot store the shipping zone", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the shipping zone is saved")
+
+	return nil
+}
+
+// Save stores the method and replaces its rates.
+// The keys are:
+// - shipping:method:id => the method data
+// - shipping:method:id:rates => the prices indexed by zone and max weight, like france:1000
+// - shipping:methods => the method ids
+func (m Method) Save(ctx context.Context) error {
+	l := slog.With(slog.String("id", m.ID))
+	l.LogAttrs(ctx, slog.LevelInfo, "saving the shipping method")
+
+	if err := validators.V.Var(m.ID, "required,alphanum"); err != nil {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot validate the id", slog.String("error", err.Error()))
+		return errors.New("input:id")
+	}
+
+	if m.ID == Collect {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot use the collect delivery as shipping method")
+		return errors.New("input:id")
+	}
+
+	if m.Name == "" {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot validate the name")
+		return errors.New("input:name")
+	}
+
+	for _, r := range m.Rates {
+		if err := validators.V.Var(r.Zone, "required,alphanum"); err != nil {
+			l.LogAttrs(ctx, slog.LevelInfo, "cannot validate the zone", slog.String("zone", r.Zone))
+			return errors.New("input:zone")
+		}
+
+		if r.MaxWeight < 0 || r.Price.Amount < 0 {
+			l.LogAttrs(ctx, slog.LevelInfo, "cannot validate the rate", slog.Float64("max_weight", r.MaxWeight), slog.Any("price", r.Price))
+			return errors.New("input:rate")
+		}
+	}
+
+	key := "shipping:method:" + m.ID
+
+	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+		rdb.HSet(ctx, key, "id", m.ID, "name", m.Name)
+		rdb.Del(ctx, key+":rates")
+
+		for _, r := range m.Rates {
+			rdb.HSet(ctx, key+":rates", rateField(r.Zone, r.MaxWeight), r.Price.Minor())
+		}
+
+		rdb.SAdd(ctx, "shipping:methods", m.ID)
+
+		return nil
+	}); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot store the shipping method", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the shipping method is saved")
+
+	return nil
+}
+
+// Zones returns the zones ordered by id
+func Zones(ctx context.Context) ([]Zone, error) {
+	slog.LogAttrs(ctx, slog.LevelInfo, "listing the shipping zones")
+
+	ids, err := db.Redis.SMembers(ctx, "shipping:zones").Result()
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot get the shipping zones", slog.String("error", err.Error()))
+		return []Zone{}, errors.New("something went wrong")
+	}
+
+	sort.Strings(ids)
+
+	cmds, err := db.Redis.Pipelined(ctx, func(rdb redis.Pipeliner) error {
+		for _, id := range ids {
+			rdb.HGetAll(ctx, "shipping:zone:"+id)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot get the shipping zones data", slog.String("error", err.Error()))
+		return []Zone{}, errors.New("something went wrong")
+	}
+
+	zones := []Zone{}
+
+	for _, cmd := range cmds {
+		data := cmd.(*redis.MapStringStringCmd).Val()
+
+		z := Zone{
+			ID:        data["id"],
+			Name:      data["name"],
+			Countries: []string{},
+			Zipcodes:  []string{},
+		}
+
+		if data["countries"] != "" {
+			z.Countries = strings.Split(data["countries"], ";")
+		}
+
+		if data["zipcodes"] != "" {
+			z.Zipcodes = strings.Split(data["zipcodes"], ";")
+		}
+
+		zones = append(zones, z)
+	}
+
+	return zones, nil
+}
+
+// Methods returns the methods indexed by id
+func Methods(ctx context.Context) (map[string]Method, error) {
+	slog.LogAttrs(ctx, slog.LevelInfo, "listing the shipping methods")
+
+	ids, err := db.Redis.SMembers(ctx, "shipping:methods").Result()
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot get the shipping methods", slog.String("error", err.Error()))
+		return map[string]Method{}, errors.New("something went wrong")
+	}
+
+	cmds, err := db.Redis.Pipelined(ctx, func(rdb redis.Pipeliner) error {
+		for _, id := range ids {
+			rdb.HGetAll(ctx, "shipping:method:"+id)
+			rdb.HGetAll(ctx, "shipping:method:"+id+":rates")
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot get the shipping methods data", slog.String("error", err.Error()))
+		return map[string]Method{}, errors.New("something went wrong")
+	}
+
+	methods := map[string]Method{}
+
+	for i := 0; i+1 < len(cmds); i += 2 {
+		data := cmds[i].(*redis.MapStringStringCmd).Val()
+		rates := cmds[i+1].(*redis.MapStringStringCmd).Val()
+
+		m := Method{
+			ID:    data["id"],
+			Name:  data["name"],
+			Rates: []Rate{},
+		}
+
+		for field, price := range rates {
+			r, err := parseRate(field, price)
+			if err != nil {
+				slog.LogAttrs(ctx, slog.LevelError, "cannot parse the rate", slog.String("id", m.ID), slog.String("rate", field), slog.String("error", err.Error()))
+				continue
+			}
+
+			m.Rates = append(m.Rates, r)
+		}
+
+		methods[m.ID] = m
+	}
+
+	return methods, nil
+}
+
+func parseRate(field, price string) (Rate, error) {
+	parts := strings.Split(field, ":")
+	if len(parts) != 2 {
+		return Rate{}, fmt.Errorf("the rate field %s is invalid", field)
+	}
+
+	weight, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return Rate{}, err
+	}
+
+	p, err := money.ParseMinor(price)
+	if err != nil {
+		return Rate{}, err
+	}
+
+	return Rate{Zone: parts[0], MaxWeight: weight, Price: p}, nil
+}
+
+// Quotes returns the deliveries available for the destination
+// and the weight, with their price in the shop currency.
+// The deliveries without shipping method use the shop flat fees.
+func Quotes(ctx context.Context, country, zipcode string, weight float64) ([]Quote, error) {
+	l := slog.With(slog.String("country", country), slog.String("zipcode", zipcode), slog.Float64("weight", weight))
+	l.LogAttrs(ctx, slog.LevelInfo, "getting the shipping quotes")
+
+	deliveries, err := shops.Deliveries(ctx)
+	if err != nil {
+		return []Quote{}, err
+	}
+
+	zones, err := Zones(ctx)
+	if err != nil {
+		return []Quote{}, err
+	}
+
+	methods, err := Methods(ctx)
+	if err != nil {
+		return []Quote{}, err
+	}
+
+	flat, err := shops.DeliveryFees(ctx)
+	if err != nil {
+		return []Quote{}, err
+	}
+
+	zone, hasZone := FindZone(zones, country, zipcode)
+
+	quotes := []Quote{}
+
+	for _, d := range deliveries {
+		if d == "home" && !conf.HasHomeDelivery {
+			continue
+		}
+
+		if d == Collect {
+			quotes = append(quotes, Quote{Delivery: d, Price: money.New(0)})
+			continue
+		}
+
+		m, ok := methods[d]
+		if !ok {
+			quotes = append(quotes, Quote{Delivery: d, Price: flat})
+			continue
+		}
+
+		if !hasZone {
+			l.LogAttrs(ctx, slog.LevelInfo, "no zone found for the destination", slog.String("delivery", d))
+			continue
+		}
+
+		price, ok := m.Price(zone.ID, weight)
+		if !ok {
+			l.LogAttrs(ctx, slog.LevelInfo, "the method cannot deliver the destination", slog.String("delivery", d), slog.String("zone", zone.ID))
+			continue
+		}
+
+		quotes = append(quotes, Quote{Delivery: d, Price: price})
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "got the shipping quotes", slog.Int("length", len(quotes)))
+
+	return quotes, nil
+}
+
+// Fee returns the price of the delivery for the destination
+// and the weight, in the shop currency.
+func Fee(ctx context.Context, delivery, country, zipcode string, weight float64) (money.Money, error) {
+	quotes, err := Quotes(ctx, country, zipcode, weight)
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	for _, q := range quotes {
+		if q.Delivery == delivery {
+			return q.Price, nil
+		}
+	}
+
+	slog.LogAttrs(ctx, slog.LevelInfo, "the delivery is not available for the destination", slog.String("delivery", delivery), slog.String("country", country), slog.String("zipcode", zipcode))
+
+	return money.Money{}, errors.New("the delivery is not available for this address")
+}
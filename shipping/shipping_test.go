@@ -0,0 +1,172 @@
+package shipping
+
+import (
+	"artisons/money"
+	"artisons/tests"
+	"errors"
+	"fmt"
+	"path"
+	"runtime"
+	"testing"
+)
+
+var cur string
+
+func init() {
+	_, filename, _, _ := runtime.Caller(0)
+	cur = path.Dir(filename) + "/"
+}
+
+var zones = []Zone{
+	{ID: "france", Countries: []string{"FR"}},
+	{ID: "corsica", Countries: []string{"FR"}, Zipcodes: []string{"20"}},
+	{ID: "benelux", Countries: []string{"BE", "LU", "NL"}},
+}
+
+var method = Method{
+	ID: "relay",
+	Rates: []Rate{
+		{Zone: "france", MaxWeight: 0, Price: money.New(990)},
+		{Zone: "france", MaxWeight: 1000, Price: money.New(490)},
+		{Zone: "france", MaxWeight: 500, Price: money.New(390)},
+		{Zone: "corsica", MaxWeight: 1000, Price: money.New(890)},
+	},
+}
+
+func TestFindZone(t *testing.T) {
+	var tests = []struct {
+		name    string
+		country string
+		zipcode string
+		zone    string
+		found   bool
+	}{
+		{"country=FR,zipcode=59000", "FR", "59000", "france", true},
+		{"country=FR,zipcode=20000", "FR", "20000", "corsica", true},
+		{"country=LU,zipcode=1111", "LU", "1111", "benelux", true},
+		{"country=DE,zipcode=10115", "DE", "10115", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z, found := FindZone(zones, tt.country, tt.zipcode)
+			if z.ID != tt.zone || found != tt.found {
+				t.Fatalf(`zone = %s, found = %v, want %s, %v`, z.ID, found, tt.zone, tt.found)
+			}
+		})
+	}
+}
+
+func TestPrice(t *testing.T) {
+	var tests = []struct {
+		name   string
+		zone   string
+		weight float64
+		price  int64
+		ok     bool
+	}{
+		{"zone=france,weight=200", "france", 200, 390, true},
+		{"zone=france,weight=500", "france", 500, 390, true},
+		{"zone=france,weight=800", "france", 800, 490, true},
+		{"zone=france,weight=5000", "france", 5000, 990, true},
+		{"zone=corsica,weight=800", "corsica", 800, 890, true},
+		{"zone=corsica,weight=5000", "corsica", 5000, 0, false},
+		{"zone=benelux,weight=800", "benelux", 800, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			price, ok := method.Price(tt.zone, tt.weight)
+			if price.Amount != tt.price || ok != tt.ok {
+				t.Fatalf(`price = %d, ok = %v, want %d, %v`, price.Amount, ok, tt.price, tt.ok)
+			}
+		})
+	}
+}
+
+func TestZoneSave(t *testing.T) {
+	ctx := tests.Context()
+
+	var tests = []struct {
+		name string
+		zone Zone
+		err  error
+	}{
+		{"id=", Zone{Name: "France", Countries: []string{"FR"}}, errors.New("input:id")},
+		{"name=", Zone{ID: "france", Countries: []string{"FR"}}, errors.New("input:name")},
+		{"countries=", Zone{ID: "france", Name: "France"}, errors.New("input:countries")},
+		{"countries=ABC", Zone{ID: "france", Name: "France", Countries: []string{"ABC"}}, errors.New("input:countries")},
+		{"zipcodes=2-0", Zone{ID: "france", Name: "France", Countries: []string{"FR"}, Zipcodes: []string{"2-0"}}, errors.New("input:zipcodes")},
+		{"success", Zone{ID: "france", Name: "France", Countries: []string{"FR"}}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.zone.Save(ctx); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestMethodSave(t *testing.T) {
+	ctx := tests.Context()
+
+	var tests = []struct {
+		name   string
+		method Method
+		err    error
+	}{
+		{"id=", Method{Name: "Relay"}, errors.New("input:id")},
+		{"id=collect", Method{ID: "collect", Name: "Collect"}, errors.New("input:id")},
+		{"name=", Method{ID: "relay"}, errors.New("input:name")},
+		{"zone=", Method{ID: "relay", Name: "Relay", Rates: []Rate{{Price: money.New(490)}}}, errors.New("input:zone")},
+		{"weight=-1", Method{ID: "relay", Name: "Relay", Rates: []Rate{{Zone: "france", MaxWeight: -1, Price: money.New(490)}}}, errors.New("input:rate")},
+		{"success", Method{ID: "relay", Name: "Relay", Rates: []Rate{{Zone: "france", MaxWeight: 1000, Price: money.New(490)}, {Zone: "france", Price: money.New(990)}}}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.method.Save(ctx); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestFee(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/shipping.redis")
+
+	var tests = []struct {
+		name     string
+		delivery string
+		zipcode  string
+		weight   float64
+		fee      int64
+		err      error
+	}{
+		{"delivery=collect", "collect", "59000", 500, 0, nil},
+		{"delivery=colissimo", "colissimo", "59000", 500, 599, nil},
+		{"delivery=relay,weight=500", "relay", "59000", 500, 490, nil},
+		{"delivery=relay,weight=2000", "relay", "59000", 2000, 990, nil},
+		{"delivery=relay,zipcode=20000", "relay", "20000", 500, 890, nil},
+		{"delivery=relay,zipcode=20000,weight=2000", "relay", "20000", 2000, 0, errors.New("the delivery is not available for this address")},
+		{"delivery=express,zipcode=59000", "express", "59000", 500, 0, errors.New("the delivery is not available for this address")},
+		{"delivery=express,zipcode=20000", "express", "20000", 500, 1990, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fee, err := Fee(ctx, tt.delivery, "FR", tt.zipcode, tt.weight)
+			if fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+
+			if fee.Amount != tt.fee {
+				t.Fatalf(`fee = %d, want %d`, fee.Amount, tt.fee)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package shops
+
+import (
+	"artisons/conf"
+	"artisons/money"
+	"artisons/string/stringutil"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+)
+
+// PaymentResult is returned by a payment provider
+// when a payment is initiated.
+type PaymentResult struct {
+	// "payment_validated" when the provider confirms the payment
+	// synchronously, "payment_progress" when the confirmation
+	// will arrive later.
+	Status string
+
+	// The URL where the customer has to be redirected
+	// to complete the payment, if any.
+	Redirect string
+
+	// The provider payment reference
+	Reference string
+}
+
+// PaymentProvider is implemented by each payment method.
+// The provider name is the value stored in the "payments" sorted set.
+type PaymentProvider interface {
+	// Initiate starts the payment of the order.
+	Initiate(ctx context.Context, oid string, amount money.Money) (PaymentResult, error)
+
+	// Verify returns the current payment status for the reference.
+	Verify(ctx context.Context, ref string) (string, error)
+
+	// Refund refunds the amount for the reference.
+	Refund(ctx context.Context, ref string, amount money.Money) error
+}
+
+var providers = map[string]PaymentProvider{}
+
+var providersMu sync.RWMutex
+
+func init() {
+	RegisterPaymentProvider("cash", Cash{})
+
+	if conf.FakePayment {
+		RegisterPaymentProvider("fake", Fake)
+	}
+}
+
+// RegisterPaymentProvider makes a payment provider available
+// by the name. If a provider is already registered with the
+// name, it is replaced.
+func RegisterPaymentProvider(name string, p PaymentProvider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	providers[name] = p
+}
+
+// FindPaymentProvider returns the provider registered by the name.
+// An error occurs if the name is not an enabled payment method
+// or if no provider is registered for it.
+func FindPaymentProvider(ctx context.Context, name string) (PaymentProvider, error) {
+	l := slog.With(slog.String("payment", name))
+	l.LogAttrs(ctx, slog.LevelInfo, "finding the payment provider")
+
+	if !IsValidPayment(ctx, name) {
+		l.LogAttrs(ctx, slog.LevelInfo, "the payment method is not enabled")
+		return nil, errors.New("you are not authorized to process this request")
+	}
+
+	providersMu.RLock()
+	p, ok := providers[name]
+	providersMu.RUnlock()
+
+	if !ok {
+		l.LogAttrs(ctx, slog.LevelError, "the payment provider is not registered")
+		return nil, errors.New("you are not authorized to process this request")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the payment provider is found")
+
+	return p, nil
+}
+
+// Pay initiates the payment of the order with
+// the provider registered for the payment method.
+func Pay(ctx context.Context, oid string, payment string, amount money.Money) (PaymentResult, error) {
+	l := slog.With(slog.String("order", oid), slog.String("payment", payment))
+	l.LogAttrs(ctx, slog.LevelInfo, "initiating the payment")
+
+	p, err := FindPaymentProvider(ctx, payment)
+	if err != nil {
+		return PaymentResult{}, err
+	}
+
+	res, err := p.Initiate(ctx, oid, amount)
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot initiate the payment", slog.String("error", err.Error()))
+		return PaymentResult{}, errors.New("something went wrong")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the payment is initiated", slog.String("status", res.Status), slog.String("ref", res.Reference))
+
+	return res, nil
+}
+
+// Cash is the payment made at the delivery or
+// at the collect. It is considered validated right away.
+type Cash struct{}
+
+func (Cash) Initiate(ctx context.Context, oid string, amount money.Money) (PaymentResult, error) {
+	return PaymentResult{Status: "payment_validated", Reference: oid}, nil
+}
+
+func (Cash) Verify(ctx context.Context, ref string) (string, error) {
+	return "payment_validated", nil
+}
+
+func (Cash) Refund(ctx context.Context, ref string, amount money.Money) error {
+	return nil
+}
+
+// FakeProvider is an in-process payment provider
+// used to test the asynchronous payment flow.
+// The payments stay in "payment_progress" until
+// Settle is called.
+type FakeProvider struct {
+	mu       sync.Mutex
+	payments map[string]string
+}
+
+// Fake is the fake provider instance registered as "fake"
+// when conf.FakePayment is enabled.
+var Fake = &FakeProvider{payments: map[string]string{}}
+
+func (f *FakeProvider) Initiate(ctx context.Context, oid string, amount money.Money) (PaymentResult, error) {
+	ref, err := stringutil.Random()
+	if err != nil {
+		return PaymentResult{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.payments[ref] = "payment_progress"
+
+	return PaymentResult{Status: "payment_progress", Reference: ref}, nil
+}
+
+func (f *FakeProvider) Verify(ctx context.Context, ref string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	status, ok := f.payments[ref]
+	if !ok {
+		return "", errors.New("oops the data is not found")
+	}
+
+	return status, nil
+}
+
+func (f *FakeProvider) Refund(ctx context.Context, ref string, amount money.Money) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.payments[ref]; !ok {
+		return errors.New("oops the data is not found")
+	}
+
+	return nil
+}
+
+// Settle simulates the provider confirmation by
+// setting the payment status of the reference.
+func (f *FakeProvider) Settle(ref, status string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.payments[ref]; !ok {
+		return errors.New("oops the data is not found")
+	}
+
+	f.payments[ref] = status
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package shops
+
+import (
+	"artisons/money"
+	"artisons/tests"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func init() {
+	RegisterPaymentProvider("fake", Fake)
+}
+
+func TestPay(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/payments.redis")
+
+	var tests = []struct {
+		name    string
+		oid     string
+		payment string
+		status  string
+		err     error
+	}{
+		{"cash", "ORD1", "cash", "payment_validated", nil},
+		{"fake", "ORD1", "fake", "payment_progress", nil},
+		{"payment=idontexist", "ORD1", "idontexist", "", errors.New("you are not authorized to process this request")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Pay(ctx, tt.oid, tt.payment, money.New(10000))
+			if fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+
+			if res.Status != tt.status {
+				t.Fatalf(`res.Status = %s, want %s`, res.Status, tt.status)
+			}
+		})
+	}
+}
+
+func TestFakeSettle(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/payments.redis")
+
+	res, err := Pay(ctx, "ORD1", "fake", money.New(10000))
+	if err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if err := Fake.Settle(res.Reference, "payment_validated"); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	status, err := Fake.Verify(ctx, res.Reference)
+	if err != nil || status != "payment_validated" {
+		t.Fatalf(`status = %s, err = %v, want payment_validated, nil`, status, err)
+	}
+
+	if err := Fake.Settle("idontexist", "payment_validated"); err == nil {
+		t.Fatalf(`err = nil, want not found`)
+	}
+}
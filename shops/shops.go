@@ -3,6 +3,7 @@ package shops
 import (
 	"artisons/conf"
 	"artisons/db"
+	"artisons/money"
 	"artisons/validators"
 	"context"
 	"errors"
@@ -48,13 +49,17 @@ type ShopSettings struct {
 	Items int
 
 	// Mininimum order
-	Min float64
+	Min money.Money
 
 	ThrowsWhenPaymentFailed bool
 
-	DeliveryFees float64
+	DeliveryFees money.Money
 
-	DeliveryFreeFees float64
+	DeliveryFreeFees money.Money
+
+	// TaxExclusive means that the prices are entered without taxes,
+	// otherwise the prices are taxes included
+	TaxExclusive bool
 
 	// Redirect after  the product was added to the cart
 	Redirect bool
@@ -186,12 +191,13 @@ func parseShopSettings(ctx context.Context, data map[string]string) ShopSettings
 		}
 	}
 
-	var err error
-	var min float64 = 0
+	min := money.New(0)
 	if data["min"] != "" {
-		min, err = strconv.ParseFloat(data["min"], 64)
+		val, err := money.ParseMinor(data["min"])
 		if err != nil {
 			slog.LogAttrs(ctx, slog.LevelError, "cannot parse the min", slog.String("min", data["min"]), slog.String("error", err.Error()))
+		} else {
+			min = val
 		}
 	}
 
@@ -215,19 +221,23 @@ func parseShopSettings(ctx context.Context, data map[string]string) ShopSettings
 		}
 	}
 
-	var deliveryFees float64 = 0
+	deliveryFees := money.New(0)
 	if data["delivery_fees"] != "" {
-		deliveryFees, err = strconv.ParseFloat(data["delivery_fees"], 64)
+		val, err := money.ParseMinor(data["delivery_fees"])
 		if err != nil {
-			slog.LogAttrs(ctx, slog.LevelError, "cannot parse the min", slog.String("delivery_fees", data["delivery_fees"]), slog.String("error", err.Error()))
+			slog.LogAttrs(ctx, slog.LevelError, "cannot parse the delivery fees", slog.String("delivery_fees", data["delivery_fees"]), slog.String("error", err.Error()))
+		} else {
+			deliveryFees = val
 		}
 	}
 
-	var deliveryFreeFees float64 = 0
+	deliveryFreeFees := money.New(0)
 	if data["delivery_free_fees"] != "" {
-		deliveryFreeFees, err = strconv.ParseFloat(data["delivery_free_fees"], 64)
+		val, err := money.ParseMinor(data["delivery_free_fees"])
 		if err != nil {
-			slog.LogAttrs(ctx, slog.LevelError, "cannot parse the min", slog.String("delivery_free_fees", data["delivery_free_fees"]), slog.String("error", err.Error()))
+			slog.LogAttrs(ctx, slog.LevelError, "cannot parse the delivery free fees", slog.String("delivery_free_fees", data["delivery_free_fees"]), slog.String("error", err.Error()))
+		} else {
+			deliveryFreeFees = val
 		}
 	}
 
@@ -248,6 +258,7 @@ func parseShopSettings(ctx context.Context, data map[string]string) ShopSettings
 		DeliveryFees:            deliveryFees,
 		DeliveryFreeFees:        deliveryFreeFees,
 		ThrowsWhenPaymentFailed: data["throws_when_payment_failed"] == "1",
+		TaxExclusive:            data["tax_exclusive"] == "1",
 	}
 }
 
@@ -294,13 +305,18 @@ func (s ShopSettings) Save(ctx context.Context) (string, error) {
 		cache = "1"
 	}
 
+	taxExclusive := "0"
+	if s.TaxExclusive {
+		taxExclusive = "1"
+	}
+
 	now := time.Now()
 	_, err := db.Redis.HSet(context.Background(), "shop",
 		"guest", guest,
 		"quantity", quantity,
 		"new", new,
 		"items", fmt.Sprintf("%d", s.Items),
-		"min", fmt.Sprintf("%2f", s.Min),
+		"min", s.Min.Minor(),
 		"redirect", redirect,
 		"cache", cache,
 		"gmap_key", s.GmapKey,
@@ -309,9 +325,10 @@ func (s ShopSettings) Save(ctx context.Context) (string, error) {
 		"color", s.Color,
 		"image_width", s.ImageWidth,
 		"image_height", s.ImageHeight,
-		"delivery_fees", s.DeliveryFees,
-		"delivery_free_fees", s.DeliveryFreeFees,
+		"delivery_fees", s.DeliveryFees.Minor(),
+		"delivery_free_fees", s.DeliveryFreeFees.Minor(),
 		"throws_when_payment_failed", throwsWhenPaymentFailed,
+		"tax_exclusive", taxExclusive,
 		"updated_at", now.Unix(),
 	).Result()
 
@@ -353,24 +370,6 @@ func Payments(ctx context.Context) ([]string, error) {
 	return pay, nil
 }
 
-func Pay(ctx context.Context, oid string, payment string) (string, error) {
-	l := slog.With(slog.String("order", oid), slog.String("payment", payment))
-
-	switch payment {
-	case "cash":
-		{
-			l.LogAttrs(ctx, slog.LevelInfo, "payment success")
-			return "", nil
-		}
-	default:
-		{
-			l.LogAttrs(ctx, slog.LevelError, "the payment method does not exist")
-			return "", errors.New("you are not authorized to process this request")
-		}
-	}
-
-}
-
 // IsValidDelivery returns true if the delivery
 // is valid. The values can be "collect" or "home".
 // The "collect" value can be used only if it's allowed
@@ -421,55 +420,55 @@ func IsValidPayment(ctx context.Context, p string) bool {
 	return true
 }
 
-func DeliveryFreeFees(ctx context.Context) (float64, error) {
+func DeliveryFreeFees(ctx context.Context) (money.Money, error) {
 	slog.LogAttrs(ctx, slog.LevelInfo, "retrieving shop delivery free fees")
 
 	d, err := db.Redis.HGet(ctx, "shop", "delivery_free_fees").Result()
 	if err != nil {
 		slog.LogAttrs(ctx, slog.LevelError, "cannot get shop delivery free fees info", slog.String("error", err.Error()))
-		return 0, errors.New("something went wrong")
+		return money.Money{}, errors.New("something went wrong")
 	}
 
-	val, err := strconv.ParseFloat(d, 64)
+	val, err := money.ParseMinor(d)
 	if err != nil {
 		slog.LogAttrs(ctx, slog.LevelError, "cannot parse shop delivery free fees info", slog.String("error", err.Error()))
-		return 0, errors.New("something went wrong")
+		return money.Money{}, errors.New("something went wrong")
 	}
 
 	return val, nil
 }
 
-func DeliveryFees(ctx context.Context) (float64, error) {
+func DeliveryFees(ctx context.Context) (money.Money, error) {
 	slog.LogAttrs(ctx, slog.LevelInfo, "retrieving shop delivery fees")
 
 	d, err := db.Redis.HGet(ctx, "shop", "delivery_fees").Result()
 	if err != nil {
 		slog.LogAttrs(ctx, slog.LevelError, "cannot get shop delivery free fees info", slog.String("error", err.Error()))
-		return 0, errors.New("something went wrong")
+		return money.Money{}, errors.New("something went wrong")
 	}
 
-	val, err := strconv.ParseFloat(d, 64)
+	val, err := money.ParseMinor(d)
 	if err != nil {
 		slog.LogAttrs(ctx, slog.LevelError, "cannot parse shop delivery free fees info", slog.String("error", err.Error()))
-		return 0, errors.New("something went wrong")
+		return money.Money{}, errors.New("something went wrong")
 	}
 
 	return val, nil
 }
 
-func MinDelivery(ctx context.Context) (float64, error) {
+func MinDelivery(ctx context.Context) (money.Money, error) {
 	slog.LogAttrs(ctx, slog.LevelInfo, "retrieving shop delivery fees")
 
 	d, err := db.Redis.HGet(ctx, "shop", "min").Result()
 	if err != nil {
 		slog.LogAttrs(ctx, slog.LevelError, "cannot get shop delivery free fees info", slog.String("error", err.Error()))
-		return 0, errors.New("something went wrong")
+		return money.Money{}, errors.New("something went wrong")
 	}
 
-	val, err := strconv.ParseFloat(d, 64)
+	val, err := money.ParseMinor(d)
 	if err != nil {
 		slog.LogAttrs(ctx, slog.LevelError, "cannot parse shop delivery free fees info", slog.String("error", err.Error()))
-		return 0, errors.New("something went wrong")
+		return money.Money{}, errors.New("something went wrong")
 	}
 
 	return val, nil
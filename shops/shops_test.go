@@ -2,7 +2,6 @@ package shops
 
 import (
 	"artisons/tests"
-	"fmt"
 	"path"
 	"reflect"
 	"runtime"
@@ -75,29 +74,6 @@ func TestPayments(t *testing.T) {
 	}
 }
 
-func TestPay(t *testing.T) {
-	ctx := tests.Context()
-
-	tests.ImportData(ctx, cur+"testdata/payments.redis")
-
-	var tests = []struct {
-		name    string
-		oid     string
-		payment string
-		err     error
-	}{
-		{"cash", "ORD1", "cash", nil},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if _, err := Pay(ctx, tt.oid, tt.payment); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
-				t.Fatalf(`err = %v, want %v`, err, tt.err)
-			}
-		})
-	}
-}
-
 func TestIsValidDelivery(t *testing.T) {
 	ctx := tests.Context()
 
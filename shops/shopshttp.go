@@ -6,6 +6,7 @@ import (
 	"artisons/http/forms"
 	"artisons/http/httperrors"
 	"artisons/http/httphelpers"
+	"artisons/money"
 	"artisons/templates"
 	"context"
 	"html/template"
@@ -76,6 +77,7 @@ func SettingsShopSave(w http.ResponseWriter, r *http.Request) {
 		Redirect:         r.FormValue("redirect") == "on",
 		FuzzySearch:      r.FormValue("fuzzy_search") == "on",
 		ExactMatchSearch: r.FormValue("exact_match_search") == "on",
+		TaxExclusive:     r.FormValue("tax_exclusive") == "on",
 	}
 
 	width := r.FormValue("image_width")
@@ -119,7 +121,7 @@ func SettingsShopSave(w http.ResponseWriter, r *http.Request) {
 
 	min := r.FormValue("min")
 	if r.FormValue("min") != "" {
-		val, err := strconv.ParseFloat(min, 64)
+		val, err := money.Parse(min)
 		if err != nil {
 			ctx = context.WithValue(ctx, contexts.HXTarget, "#alert-shop")
 			slog.LogAttrs(ctx, slog.LevelInfo, "cannot use the min value", slog.String("min", min))
@@ -5,6 +5,7 @@ import (
 	"artisons/http/contexts"
 	"artisons/http/httperrors"
 	"artisons/http/httphelpers"
+	"artisons/money"
 	"artisons/products"
 	"artisons/shops"
 	"artisons/tags/tree"
@@ -13,7 +14,6 @@ import (
 	"html/template"
 	"log/slog"
 	"net/http"
-	"strconv"
 	"strings"
 
 	"golang.org/x/text/language"
@@ -128,17 +128,19 @@ func SearchHandler(w http.ResponseWriter, r *http.Request) {
 	p := httphelpers.BuildPaginator(r)
 
 	q := r.URL.Query()
-	var min float32 = 0
+	currency := money.ContextCurrency(ctx)
+
+	min := money.New(0).WithCurrency(currency)
 	if q.Has("min") {
-		if val, err := strconv.ParseFloat(q.Get("min"), 32); err == nil {
-			min = float32(val)
+		if val, err := money.Parse(q.Get("min")); err == nil {
+			min = val.WithCurrency(currency)
 		}
 	}
 
-	var max float32 = 0
+	max := money.New(0).WithCurrency(currency)
 	if q.Has("max") {
-		if val, err := strconv.ParseFloat(q.Get("max"), 32); err == nil {
-			max = float32(val)
+		if val, err := money.Parse(q.Get("max")); err == nil {
+			max = val.WithCurrency(currency)
 		}
 	}
 
@@ -157,6 +159,7 @@ func SearchHandler(w http.ResponseWriter, r *http.Request) {
 		Keywords: q.Get("q"),
 		Tags:     q["tags"],
 		Meta:     meta,
+		Currency: currency,
 	}
 
 	res, err := products.Search(ctx, query, p.Offset, p.Num)
@@ -165,6 +168,10 @@ func SearchHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	for i, pdt := range res.Products {
+		res.Products[i], _ = pdt.InCurrency(currency)
+	}
+
 	pag := p.Build(ctx, res.Total, len(res.Products))
 
 	data := struct {
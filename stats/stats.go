@@ -5,6 +5,7 @@ import (
 	"artisons/db"
 	"artisons/http/contexts"
 	"artisons/http/referer"
+	"artisons/money"
 	"artisons/products"
 	"artisons/string/stringutil"
 	"artisons/users"
@@ -83,8 +84,9 @@ func generateDemoData(ctx context.Context) error {
 			pipe.ZIncrBy(ctx, "demo:stats:referers:"+score.Format("20060102"), 1, referers[rrand])
 			pipe.ZIncrBy(ctx, "demo:stats:systems:"+score.Format("20060102"), 1, systems[srand])
 			pipe.Set(ctx, "demo:stats:visits:"+score.Format("20060102"), visits, 0)
-			pipe.Set(ctx, "demo:stats:orders:revenues:"+score.Format("20060102"), amount, 0)
+			pipe.Set(ctx, "demo:stats:orders:revenues:"+score.Format("20060102"), amount*money.Scale, 0)
 			pipe.Set(ctx, "demo:stats:orders:count:"+score.Format("20060102"), count, 0)
+			pipe.Set(ctx, "demo:stats:orders:taxes:"+score.Format("20060102"), amount*money.Scale/6, 0)
 			pipe.Set(ctx, "demo:stats:visits:unique:"+score.Format("20060102"), uniques, 0)
 			pipe.Set(ctx, "demo:stats:pageviews:all:"+score.Format("20060102"), visits*2, 0)
 		}
@@ -262,6 +264,7 @@ func sum(array []int) int {
 // - stats:pageview - the page views
 // - stats:orders - the order total amount
 // - stats:orders:count - the order total count
+// - stats:orders:taxes - the VAT collected
 // For each statistics keys, a subset of keys is generated to retrieve the data
 // for the specified days interval.
 // To use only one loop, the stop number is the multiplication result between the total of keys
@@ -280,6 +283,7 @@ func GetAll(ctx context.Context, days int) (Data, error) {
 		{Value: []int{}},
 		{Value: []int{}},
 		{Value: []int{}},
+		{Value: []int{}},
 	}
 	prefix := getPrefix(ctx)
 	if prefix == "demo:" {
@@ -300,6 +304,7 @@ func GetAll(ctx context.Context, days int) (Data, error) {
 		prefix + "stats:pageviews:all:",
 		prefix + "stats:orders:revenues:",
 		prefix + "stats:orders:count:",
+		prefix + "stats:orders:taxes:",
 	}
 	row := 0
 
@@ -340,6 +345,11 @@ func GetAll(ctx context.Context, days int) (Data, error) {
 			slog.LogAttrs(ctx, slog.LevelError, "cannot convert the value to int", slog.String("value", s), slog.String("error", err.Error()))
 			values[row].Value = append([]int{0}, values[row].Value...)
 		} else {
+			// The revenues and the taxes are stored in minor units
+			if row == 3 || row == 5 {
+				f /= money.Scale
+			}
+
 			value := int(f)
 			values[row].Value = append([]int{value}, values[row].Value...)
 		}
@@ -418,8 +428,10 @@ func Visit(ctx context.Context, ua useragent.UserAgent, data VisitData) error {
 	return nil
 }
 
-func Order(ctx context.Context, id string, pds []products.Product, total float64) error {
-	l := slog.With(slog.String("id", id), slog.Float64("total", total))
+// Order adds the order to the revenues, the count,
+// the collected VAT and the most sold products.
+func Order(ctx context.Context, id string, pds []products.Product, total, tax money.Money) error {
+	l := slog.With(slog.String("id", id), slog.Any("total", total), slog.Any("tax", tax))
 	l.LogAttrs(ctx, slog.LevelInfo, "store order statistics")
 
 	now := time.Now().Format("20060102")
@@ -429,7 +441,9 @@ func Order(ctx context.Context, id string, pds []products.Product, total float64
 		pipe.ZIncrBy(ctx, "stats:products:most:"+now, float64(p.Quantity), p.ID)
 	}
 
-	pipe.IncrByFloat(ctx, "stats:orders:revenues:"+now, total)
+	// The statistics are in the shop currency
+	pipe.IncrBy(ctx, "stats:orders:revenues:"+now, total.Convert(conf.Currency).Amount)
+	pipe.IncrBy(ctx, "stats:orders:taxes:"+now, tax.Convert(conf.Currency).Amount)
 	pipe.Incr(ctx, "stats:orders:count:"+now)
 
 	_, err := pipe.Exec(ctx)
@@ -439,3 +453,71 @@ func Order(ctx context.Context, id string, pds []products.Product, total float64
 
 	return nil
 }
+
+// Refund removes the refunded amount from the revenues,
+// the refunded tax from the collected VAT
+// and the refunded quantities from the most sold products.
+// The refunded amount is also added to stats:orders:refunds.
+func Refund(ctx context.Context, oid string, lines map[string]int, amount, tax money.Money) error {
+	l := slog.With(slog.String("oid", oid), slog.Any("amount", amount))
+	l.LogAttrs(ctx, slog.LevelInfo, "store refund statistics")
+
+	now := time.Now().Format("20060102")
+	pipe := db.Redis.Pipeline()
+
+	for pid, qty := range lines {
+		pipe.ZIncrBy(ctx, "stats:products:most:"+now, float64(-qty), pid)
+	}
+
+	// The statistics are in the shop currency
+	amount = amount.Convert(conf.Currency)
+	tax = tax.Convert(conf.Currency)
+
+	pipe.IncrBy(ctx, "stats:orders:revenues:"+now, -amount.Amount)
+	pipe.IncrBy(ctx, "stats:orders:taxes:"+now, -tax.Amount)
+	pipe.IncrBy(ctx, "stats:orders:refunds:"+now, amount.Amount)
+
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot add statistics", slog.String("error", err.Error()))
+	}
+
+	return nil
+}
+
+// CartRecovery counts the recovery emails sent
+// for the abandoned carts in stats:carts:recovery:sent.
+func CartRecovery(ctx context.Context, cid int) error {
+	l := slog.With(slog.Int("cid", cid))
+	l.LogAttrs(ctx, slog.LevelInfo, "store cart recovery statistics")
+
+	now := time.Now().Format("20060102")
+
+	if _, err := db.Redis.Incr(ctx, "stats:carts:recovery:sent:"+now).Result(); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot add statistics", slog.String("error", err.Error()))
+	}
+
+	return nil
+}
+
+// CartRecovered counts the orders placed from a recovery email,
+// the conversions, in stats:carts:recovery:count and their
+// amount in stats:carts:recovery:revenues.
+func CartRecovered(ctx context.Context, oid string, total money.Money) error {
+	l := slog.With(slog.String("oid", oid), slog.Any("total", total))
+	l.LogAttrs(ctx, slog.LevelInfo, "store recovered cart statistics")
+
+	now := time.Now().Format("20060102")
+	pipe := db.Redis.Pipeline()
+
+	// The statistics are in the shop currency
+	pipe.Incr(ctx, "stats:carts:recovery:count:"+now)
+	pipe.IncrBy(ctx, "stats:carts:recovery:revenues:"+now, total.Convert(conf.Currency).Amount)
+
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot add statistics", slog.String("error", err.Error()))
+	}
+
+	return nil
+}
@@ -18,8 +18,8 @@ func TestGetAll(t *testing.T) {
 		t.Fatalf(`err = %s, want nil`, err.Error())
 	}
 
-	if len(data) != 6 {
-		t.Fatalf(`len(data) = %v, want 6`, len(data))
+	if len(data) != 7 {
+		t.Fatalf(`len(data) = %v, want 7`, len(data))
 	}
 
 	v := data[0]
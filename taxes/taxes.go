@@ -0,0 +1,283 @@
+// Package taxes manages the VAT classes and calculates
+// the tax breakdown of the carts and the orders.
+// A product belongs to a tax class, like "standard" or "reduced",
+// and each class has a rate per country.
+package taxes
+
+import (
+	"artisons/conf"
+	"artisons/db"
+	"artisons/money"
+	"artisons/validators"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Standard is the default tax class, also applied
+// to the delivery fees.
+const Standard = "standard"
+
+type Class struct {
+	// The class id, like "standard" or "reduced"
+	ID string
+
+	Name string
+
+	// The rates in percent indexed by country code
+	Rates map[string]float64
+}
+
+// Item is an amount to tax
+type Item struct {
+	// The rate in percent
+	Rate float64
+
+	// The amount, taxes included or not depending
+	// on the shop settings
+	Amount money.Money
+}
+
+// Line is the tax breakdown for a rate
+type Line struct {
+	Rate  float64     `json:"rate"`
+	Net   money.Money `json:"net"`
+	Tax   money.Money `json:"tax"`
+	Gross money.Money `json:"gross"`
+}
+
+// Breakdown contains the lines ordered by rate
+// and their totals
+type Breakdown struct {
+	Lines []Line      `json:"lines"`
+	Net   money.Money `json:"net"`
+	Tax   money.Money `json:"tax"`
+	Gross money.Money `json:"gross"`
+}
+
+// empty returns a breakdown without currency, the first
+// line added gives its currency
+func empty() Breakdown {
+	return Breakdown{Lines: []Line{}}
+}
+
+// Compute groups the items by rate and calculates
+// the net, tax and gross amounts.
+// When inclusive is true, the item amounts are taxes included,
+// otherwise the taxes are added on top of them.
+// The tax is rounded to the minor unit for each rate.
+func Compute(items []Item, inclusive bool) Breakdown {
+	amounts := map[float64]money.Money{}
+	for _, item := range items {
+		amounts[item.Rate] = amounts[item.Rate].Add(item.Amount)
+	}
+
+	b := empty()
+
+	for rate, amount := range amounts {
+		line := Line{Rate: rate}
+
+		if inclusive {
+			line.Gross = amount
+			line.Net = amount.Ratio(10000, int64(math.Round(10000+rate*100)))
+			line.Tax = line.Gross.Sub(line.Net)
+		} else {
+			line.Net = amount
+			line.Tax = amount.Percent(rate)
+			line.Gross = line.Net.Add(line.Tax)
+		}
+
+		b.Lines = append(b.Lines, line)
+		b.Net = b.Net.Add(line.Net)
+		b.Tax = b.Tax.Add(line.Tax)
+		b.Gross = b.Gross.Add(line.Gross)
+	}
+
+	sort.Slice(b.Lines, func(i, j int) bool {
+		return b.Lines[i].Rate < b.Lines[j].Rate
+	})
+
+	return b
+}
+
+// Serialize returns the breakdown in JSON to be stored in Redis
+func (b Breakdown) Serialize(ctx context.Context) string {
+	data, err := json.Marshal(b)
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot serialize the taxes", slog.String("error", err.Error()))
+		return ""
+	}
+
+	return string(data)
+}
+
+// UnSerialize parses the breakdown stored in Redis.
+// An empty value returns an empty breakdown.
+func UnSerialize(ctx context.Context, s string) Breakdown {
+	b := empty()
+
+	if s == "" {
+		return b
+	}
+
+	if err := json.Unmarshal([]byte(s), &b); err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot parse the taxes", slog.String("taxes", s), slog.String("error", err.Error()))
+		return empty()
+	}
+
+	return b
+}
+
+// Save stores the tax class.
+// The keys are:
+// - taxclass:id => the class data
+// - taxclass:id:rates => the rates indexed by country
+// - taxclasses => the class ids
+func (c Class) Save(ctx context.Context) error {
+	l := slog.With(slog.String("id", c.ID))
+	l.LogAttrs(ctx, slog.LevelInfo, "saving the tax class")
+
+	if err := validators.V.Var(c.ID, "required,alphanum"); err != nil {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot validate the id", slog.String("error", err.Error()))
+		return errors.New("input:id")
+	}
+
+	if c.Name == "" {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot validate the name")
+		return errors.New("input:name")
+	}
+
+	for country, rate := range c.Rates {
+		if err := validators.V.Var(country, "required,iso3166_1_alpha2"); err != nil {
+			l.LogAttrs(ctx, slog.LevelInfo, "cannot validate the country", slog.String("country", country))
+			return errors.New("input:country")
+		}
+
+		if rate < 0 || rate >= 100 {
+			l.LogAttrs(ctx, slog.LevelInfo, "cannot validate the rate", slog.Float64("rate", rate))
+			return errors.New("input:rate")
+		}
+	}
+
+	key := "taxclass:" + c.ID
+
+	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+		rdb.HSet(ctx, key, "id", c.ID, "name", c.Name)
+		rdb.Del(ctx, key+":rates")
+
+		for country, rate := range c.Rates {
+			rdb.HSet(ctx, key+":rates", country, rate)
+		}
+
+		rdb.SAdd(ctx, "taxclasses", c.ID)
+
+		return nil
+	}); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot store the tax class", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the tax class is saved")
+
+	return nil
+}
+
+// List returns the tax classes ordered by id
+func List(ctx context.Context) ([]Class, error) {
+	slog.LogAttrs(ctx, slog.LevelInfo, "listing the tax classes")
+
+	ids, err := db.Redis.SMembers(ctx, "taxclasses").Result()
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot get the tax classes", slog.String("error", err.Error()))
+		return []Class{}, errors.New("something went wrong")
+	}
+
+	sort.Strings(ids)
+
+	cmds, err := db.Redis.Pipelined(ctx, func(rdb redis.Pipeliner) error {
+		for _, id := range ids {
+			rdb.HGetAll(ctx, "taxclass:"+id)
+			rdb.HGetAll(ctx, "taxclass:"+id+":rates")
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot get the tax classes data", slog.String("error", err.Error()))
+		return []Class{}, errors.New("something went wrong")
+	}
+
+	classes := []Class{}
+
+	for i := 0; i+1 < len(cmds); i += 2 {
+		data := cmds[i].(*redis.MapStringStringCmd).Val()
+		rates := cmds[i+1].(*redis.MapStringStringCmd).Val()
+
+		c := Class{
+			ID:    data["id"],
+			Name:  data["name"],
+			Rates: map[string]float64{},
+		}
+
+		for country, rate := range rates {
+			val, err := strconv.ParseFloat(rate, 64)
+			if err != nil {
+				slog.LogAttrs(ctx, slog.LevelError, "cannot parse the rate", slog.String("id", c.ID), slog.String("rate", rate), slog.String("error", err.Error()))
+				continue
+			}
+
+			c.Rates[country] = val
+		}
+
+		classes = append(classes, c)
+	}
+
+	return classes, nil
+}
+
+// Rates returns the rates of the classes for the country,
+// indexed by class.
+// An empty class is the standard class.
+// When a rate is not defined, the default VAT rate is used.
+func Rates(ctx context.Context, classes []string, country string) (map[string]float64, error) {
+	l := slog.With(slog.Any("classes", classes), slog.String("country", country))
+	l.LogAttrs(ctx, slog.LevelInfo, "getting the tax rates")
+
+	cmds, err := db.Redis.Pipelined(ctx, func(rdb redis.Pipeliner) error {
+		for _, class := range classes {
+			if class == "" {
+				class = Standard
+			}
+
+			rdb.HGet(ctx, "taxclass:"+class+":rates", country)
+		}
+
+		return nil
+	})
+
+	if err != nil && err != redis.Nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot get the tax rates", slog.String("error", err.Error()))
+		return map[string]float64{}, errors.New("something went wrong")
+	}
+
+	rates := map[string]float64{}
+
+	for i, cmd := range cmds {
+		rate, err := cmd.(*redis.StringCmd).Float64()
+		if err != nil {
+			l.LogAttrs(ctx, slog.LevelInfo, "the rate is not defined so the default rate is used", slog.String("class", classes[i]))
+			rate = conf.DefaultVATRate
+		}
+
+		rates[classes[i]] = rate
+	}
+
+	return rates, nil
+}
@@ -0,0 +1,130 @@
+package taxes
+
+import (
+	"artisons/conf"
+	"artisons/money"
+	"artisons/tests"
+	"errors"
+	"fmt"
+	"path"
+	"runtime"
+	"testing"
+)
+
+var cur string
+
+func init() {
+	_, filename, _, _ := runtime.Caller(0)
+	cur = path.Dir(filename) + "/"
+}
+
+func TestCompute(t *testing.T) {
+	var tests = []struct {
+		name      string
+		items     []Item
+		inclusive bool
+		lines     int
+		net       int64
+		tax       int64
+		gross     int64
+	}{
+		{"inclusive=true,rate=20", []Item{{Rate: 20, Amount: money.New(10000)}, {Rate: 20, Amount: money.New(2000)}}, true, 1, 10000, 2000, 12000},
+		{"inclusive=false,rate=20", []Item{{Rate: 20, Amount: money.New(10000)}}, false, 1, 10000, 2000, 12000},
+		{"inclusive=true,rates=20,5.5", []Item{{Rate: 20, Amount: money.New(1200)}, {Rate: 5.5, Amount: money.New(1055)}}, true, 2, 2000, 255, 2255},
+		{"inclusive=false,rates=20,5.5", []Item{{Rate: 5.5, Amount: money.New(1000)}, {Rate: 20, Amount: money.New(1000)}}, false, 2, 2000, 255, 2255},
+		{"inclusive=true,rate=20,rounding", []Item{{Rate: 20, Amount: money.New(999)}}, true, 1, 833, 166, 999},
+		{"items=empty", []Item{}, true, 0, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := Compute(tt.items, tt.inclusive)
+
+			if len(b.Lines) != tt.lines {
+				t.Fatalf(`len(b.Lines) = %d, want %d`, len(b.Lines), tt.lines)
+			}
+
+			if b.Net.Amount != tt.net || b.Tax.Amount != tt.tax || b.Gross.Amount != tt.gross {
+				t.Fatalf(`b = %v, want net %d, tax %d, gross %d`, b, tt.net, tt.tax, tt.gross)
+			}
+
+			if len(b.Lines) == 2 && b.Lines[0].Rate > b.Lines[1].Rate {
+				t.Fatalf(`b.Lines = %v, want the lines ordered by rate`, b.Lines)
+			}
+		})
+	}
+}
+
+func TestSerialize(t *testing.T) {
+	ctx := tests.Context()
+
+	b := Compute([]Item{{Rate: 20, Amount: money.New(12000)}}, true)
+	u := UnSerialize(ctx, b.Serialize(ctx))
+
+	if len(u.Lines) != 1 || u.Lines[0] != b.Lines[0] || u.Gross != b.Gross {
+		t.Fatalf(`u = %v, want %v`, u, b)
+	}
+
+	if e := UnSerialize(ctx, ""); len(e.Lines) != 0 {
+		t.Fatalf(`e = %v, want an empty breakdown`, e)
+	}
+}
+
+func TestRates(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/taxes.redis")
+
+	var tests = []struct {
+		name    string
+		class   string
+		country string
+		rate    float64
+	}{
+		{"class=standard,country=FR", "standard", "FR", 20},
+		{"class=,country=BE", "", "BE", 21},
+		{"class=reduced,country=FR", "reduced", "FR", 5.5},
+		{"class=reduced,country=BE", "reduced", "BE", conf.DefaultVATRate},
+		{"class=unknown,country=FR", "unknown", "FR", conf.DefaultVATRate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rates, err := Rates(ctx, []string{tt.class}, tt.country)
+			if err != nil || rates[tt.class] != tt.rate {
+				t.Fatalf(`rates = %v, err = %v, want %.2f, nil`, rates, err, tt.rate)
+			}
+		})
+	}
+}
+
+func TestSave(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.ImportData(ctx, cur+"testdata/taxes.redis")
+
+	var tests = []struct {
+		name  string
+		class Class
+		err   error
+	}{
+		{"id=", Class{Name: "Reduced"}, errors.New("input:id")},
+		{"name=", Class{ID: "reduced"}, errors.New("input:name")},
+		{"country=FRA", Class{ID: "reduced", Name: "Reduced", Rates: map[string]float64{"FRA": 5.5}}, errors.New("input:country")},
+		{"rate=100", Class{ID: "reduced", Name: "Reduced", Rates: map[string]float64{"FR": 100}}, errors.New("input:rate")},
+		{"success", Class{ID: "reduced", Name: "Reduced", Rates: map[string]float64{"FR": 10}}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.class.Save(ctx); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+		})
+	}
+
+	classes, err := List(ctx)
+	if err != nil || len(classes) != 2 || classes[0].ID != "reduced" || classes[0].Rates["FR"] != 10 {
+		t.Fatalf(`classes = %v, err = %v, want the reduced class updated`, classes, err)
+	}
+}
@@ -40,6 +40,8 @@ var AdminUI = []string{
 	conf.WorkingSpace + "web/views/admin/icons/seo.svg",
 	conf.WorkingSpace + "web/views/admin/icons/tag.svg",
 	conf.WorkingSpace + "web/views/admin/icons/filter.svg",
+	conf.WorkingSpace + "web/views/admin/icons/discount.svg",
+	conf.WorkingSpace + "web/views/admin/icons/map-pin.svg",
 }
 
 var AdminSuccess = []string{
@@ -103,9 +105,25 @@ func init() {
 	buildTemplate("address", []string{
 		fmt.Sprintf("%s/web/views/address.html", conf.WorkingSpace),
 	})
+	buildTemplate("address-book", []string{
+		fmt.Sprintf("%s/web/views/address-book.html", conf.WorkingSpace),
+	})
 	buildTemplate("hx-success", []string{
 		fmt.Sprintf("%s/web/views/success.html", conf.WorkingSpace),
 	})
+	buildTemplate("hx-guest-success", []string{
+		fmt.Sprintf("%s/web/views/guest-success.html", conf.WorkingSpace),
+		fmt.Sprintf("%s/web/views/success.html", conf.WorkingSpace),
+	})
+	buildTemplate("lookup", []string{
+		fmt.Sprintf("%s/web/views/lookup.html", conf.WorkingSpace),
+	})
+	buildTemplate("optout", []string{
+		fmt.Sprintf("%s/web/views/optout.html", conf.WorkingSpace),
+	})
+	buildTemplate("hx-lookup", []string{
+		fmt.Sprintf("%s/web/views/lookup-order.html", conf.WorkingSpace),
+	})
 	buildTemplate("hx-input-error", []string{
 		fmt.Sprintf("%s/web/views/input-error.html", conf.WorkingSpace),
 	})
@@ -137,6 +155,17 @@ func Build(name string) *template.Template {
 		"contains": func(values []string, value string) bool {
 			return slices.Contains(values, value)
 		},
+		"countries": func() []string {
+			return conf.Countries
+		},
+		"locales": func() []string {
+			l := []string{}
+			for _, lang := range conf.Locales {
+				l = append(l, lang.String())
+			}
+
+			return l
+		},
 
 		"image": func(id, width, height string, cachebuster time.Time) string {
 			return images.URL(id, images.Options{
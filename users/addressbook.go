@@ -0,0 +1,257 @@
+package users
+
+import (
+	"artisons/addresses"
+	"artisons/db"
+	"artisons/string/stringutil"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// BookAddress is an address saved in the user address book.
+// The name helps to choose it, like "Home" or "Office".
+type BookAddress struct {
+	ID   string
+	Name string
+
+	addresses.Address
+
+	// True when the address is the default
+	// one for the billing or the shipping
+	Billing  bool
+	Shipping bool
+
+	UpdatedAt time.Time
+}
+
+func (u User) bookKey(aid string) string {
+	return fmt.Sprintf("user:%d:address:%s", u.ID, aid)
+}
+
+// SaveBookAddress creates or updates an address of the book
+// and returns its id.
+// The first address becomes the default one for the billing
+// and the shipping. The default billing address is also kept
+// as the user address, to pre-fill the forms.
+// An error occurs if the name or the address is not valid,
+// or if the updated address does not exist.
+// The keys are:
+// - user:uid:address:aid => the address data
+// - user:uid:addresses => the address ids sorted by update date
+// - user:uid => billing_address and shipping_address, the default ids
+func (u User) SaveBookAddress(ctx context.Context, a BookAddress) (string, error) {
+	l := slog.With(slog.Int("uid", u.ID), slog.String("aid", a.ID))
+	l.LogAttrs(ctx, slog.LevelInfo, "saving the book address")
+
+	if a.Name == "" {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot validate the name")
+		return "", errors.New("input:name")
+	}
+
+	if err := a.Address.Validate(ctx); err != nil {
+		return "", err
+	}
+
+	if a.ID == "" {
+		aid, err := stringutil.Random()
+		if err != nil {
+			l.LogAttrs(ctx, slog.LevelError, "cannot generate the address id", slog.String("error", err.Error()))
+			return "", errors.New("something went wrong")
+		}
+
+		a.ID = aid
+	} else if exists, err := db.Redis.Exists(ctx, u.bookKey(a.ID)).Result(); exists == 0 || err != nil {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot find the address")
+		return "", errors.New("oops the data is not found")
+	}
+
+	count, err := db.Redis.ZCard(ctx, fmt.Sprintf("user:%d:addresses", u.ID)).Result()
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot count the addresses", slog.String("error", err.Error()))
+		return "", errors.New("something went wrong")
+	}
+
+	defaults, err := db.Redis.HMGet(ctx, fmt.Sprintf("user:%d", u.ID), "billing_address", "shipping_address").Result()
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot get the default addresses", slog.String("error", err.Error()))
+		return "", errors.New("something went wrong")
+	}
+
+	if count == 0 {
+		a.Billing = true
+		a.Shipping = true
+	}
+
+	now := time.Now()
+	ukey := fmt.Sprintf("user:%d", u.ID)
+
+	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+		rdb.HSet(ctx, u.bookKey(a.ID), "id", a.ID, "name", a.Name, "updated_at", now.Unix())
+		rdb.HSet(ctx, u.bookKey(a.ID), a.Address.Fields("")...)
+		rdb.ZAdd(ctx, fmt.Sprintf("user:%d:addresses", u.ID), redis.Z{
+			Score:  float64(now.Unix()),
+			Member: a.ID,
+		})
+
+		if a.Billing {
+			rdb.HSet(ctx, ukey, "billing_address", a.ID)
+			rdb.HSet(ctx, ukey, a.Address.Fields("")...)
+		} else if defaults[0] == a.ID {
+			rdb.HDel(ctx, ukey, "billing_address")
+		}
+
+		if a.Shipping {
+			rdb.HSet(ctx, ukey, "shipping_address", a.ID)
+		} else if defaults[1] == a.ID {
+			rdb.HDel(ctx, ukey, "shipping_address")
+		}
+
+		return nil
+	}); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot store the address", slog.String("error", err.Error()))
+		return "", errors.New("something went wrong")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the book address is saved", slog.String("aid", a.ID))
+
+	return a.ID, nil
+}
+
+func parseBookAddress(ctx context.Context, m map[string]string, defaults []interface{}) (BookAddress, error) {
+	updatedAt, err := strconv.ParseInt(m["updated_at"], 10, 64)
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "cannot parse the updated_at", slog.String("updated_at", m["updated_at"]), slog.String("error", err.Error()))
+		return BookAddress{}, errors.New("something went wrong")
+	}
+
+	return BookAddress{
+		ID:        m["id"],
+		Name:      m["name"],
+		Address:   addresses.Parse(m, ""),
+		Billing:   defaults[0] == m["id"],
+		Shipping:  defaults[1] == m["id"],
+		UpdatedAt: time.Unix(updatedAt, 0),
+	}, nil
+}
+
+// FindAddress returns an address of the book
+func (u User) FindAddress(ctx context.Context, aid string) (BookAddress, error) {
+	l := slog.With(slog.Int("uid", u.ID), slog.String("aid", aid))
+	l.LogAttrs(ctx, slog.LevelInfo, "finding the book address")
+
+	if aid == "" {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot validate empty id")
+		return BookAddress{}, errors.New("input:id")
+	}
+
+	m, err := db.Redis.HGetAll(ctx, u.bookKey(aid)).Result()
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot get the address", slog.String("error", err.Error()))
+		return BookAddress{}, errors.New("something went wrong")
+	}
+
+	if len(m) == 0 {
+		l.LogAttrs(ctx, slog.LevelInfo, "cannot find the address")
+		return BookAddress{}, errors.New("oops the data is not found")
+	}
+
+	defaults, err := db.Redis.HMGet(ctx, fmt.Sprintf("user:%d", u.ID), "billing_address", "shipping_address").Result()
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot get the default addresses", slog.String("error", err.Error()))
+		return BookAddress{}, errors.New("something went wrong")
+	}
+
+	return parseBookAddress(ctx, m, defaults)
+}
+
+// Addresses returns the address book,
+// the last updated address first.
+func (u User) Addresses(ctx context.Context) ([]BookAddress, error) {
+	l := slog.With(slog.Int("uid", u.ID))
+	l.LogAttrs(ctx, slog.LevelInfo, "listing the book addresses")
+
+	ids, err := db.Redis.ZRevRange(ctx, fmt.Sprintf("user:%d:addresses", u.ID), 0, -1).Result()
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot get the address ids", slog.String("error", err.Error()))
+		return []BookAddress{}, errors.New("something went wrong")
+	}
+
+	defaults, err := db.Redis.HMGet(ctx, fmt.Sprintf("user:%d", u.ID), "billing_address", "shipping_address").Result()
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot get the default addresses", slog.String("error", err.Error()))
+		return []BookAddress{}, errors.New("something went wrong")
+	}
+
+	cmds, err := db.Redis.Pipelined(ctx, func(rdb redis.Pipeliner) error {
+		for _, id := range ids {
+			rdb.HGetAll(ctx, u.bookKey(id))
+		}
+
+		return nil
+	})
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot get the addresses", slog.String("error", err.Error()))
+		return []BookAddress{}, errors.New("something went wrong")
+	}
+
+	book := []BookAddress{}
+	for _, cmd := range cmds {
+		m := cmd.(*redis.MapStringStringCmd).Val()
+		if len(m) == 0 {
+			continue
+		}
+
+		a, err := parseBookAddress(ctx, m, defaults)
+		if err != nil {
+			continue
+		}
+
+		book = append(book, a)
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "got the book addresses", slog.Int("addresses", len(book)))
+
+	return book, nil
+}
+
+// DeleteAddress removes an address from the book.
+// If it was a default address, there is no default anymore.
+func (u User) DeleteAddress(ctx context.Context, aid string) error {
+	l := slog.With(slog.Int("uid", u.ID), slog.String("aid", aid))
+	l.LogAttrs(ctx, slog.LevelInfo, "deleting the book address")
+
+	a, err := u.FindAddress(ctx, aid)
+	if err != nil {
+		return err
+	}
+
+	ukey := fmt.Sprintf("user:%d", u.ID)
+
+	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
+		rdb.Del(ctx, u.bookKey(aid))
+		rdb.ZRem(ctx, fmt.Sprintf("user:%d:addresses", u.ID), aid)
+
+		if a.Billing {
+			rdb.HDel(ctx, ukey, "billing_address")
+		}
+
+		if a.Shipping {
+			rdb.HDel(ctx, ukey, "shipping_address")
+		}
+
+		return nil
+	}); err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot delete the address", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
+	l.LogAttrs(ctx, slog.LevelInfo, "the book address is deleted")
+
+	return nil
+}
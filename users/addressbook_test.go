@@ -0,0 +1,124 @@
+package users
+
+import (
+	"artisons/addresses"
+	"artisons/tests"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+var bookUser User = User{ID: 9}
+
+var bookAddress BookAddress = BookAddress{
+	Name: "Home",
+	Address: addresses.Address{
+		Firstname: "Arnaud",
+		Lastname:  "Deville",
+		Street:    "17 rue du moulin",
+		City:      "Lille",
+		Country:   "FR",
+		Zipcode:   "59000",
+		Phone:     "0612432122",
+	},
+}
+
+func TestSaveBookAddress(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.Del(ctx, "user:9")
+
+	var tests = []struct {
+		name   string
+		update func(a BookAddress) BookAddress
+		err    error
+	}{
+		{"name=", func(a BookAddress) BookAddress { a.Name = ""; return a }, errors.New("input:name")},
+		{"firstname=", func(a BookAddress) BookAddress { a.Firstname = ""; return a }, errors.New("input:firstname")},
+		{"id=idontexist", func(a BookAddress) BookAddress { a.ID = "idontexist"; return a }, errors.New("oops the data is not found")},
+		{"success", func(a BookAddress) BookAddress { return a }, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := bookUser.SaveBookAddress(ctx, tt.update(bookAddress)); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestAddresses(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.Del(ctx, "user:9")
+
+	home, err := bookUser.SaveBookAddress(ctx, bookAddress)
+	if err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	office := bookAddress
+	office.Name = "Office"
+	office.Shipping = true
+
+	oid, err := bookUser.SaveBookAddress(ctx, office)
+	if err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	book, err := bookUser.Addresses(ctx)
+	if err != nil || len(book) != 2 {
+		t.Fatalf(`len = %d, err = %v, want 2, nil`, len(book), err)
+	}
+
+	a, err := bookUser.FindAddress(ctx, home)
+	if err != nil || !a.Billing || a.Shipping {
+		t.Fatalf(`billing = %v, shipping = %v, err = %v, want true, false, nil`, a.Billing, a.Shipping, err)
+	}
+
+	a, err = bookUser.FindAddress(ctx, oid)
+	if err != nil || a.Billing || !a.Shipping {
+		t.Fatalf(`billing = %v, shipping = %v, err = %v, want false, true, nil`, a.Billing, a.Shipping, err)
+	}
+}
+
+func TestFindAddress(t *testing.T) {
+	ctx := tests.Context()
+
+	var tests = []struct {
+		name string
+		id   string
+		err  error
+	}{
+		{"id=", "", errors.New("input:id")},
+		{"id=idontexist", "idontexist", errors.New("oops the data is not found")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := bookUser.FindAddress(ctx, tt.id); fmt.Sprintf("%s", err) != fmt.Sprintf("%s", tt.err) {
+				t.Fatalf(`err = %v, want %v`, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDeleteAddress(t *testing.T) {
+	ctx := tests.Context()
+
+	tests.Del(ctx, "user:9")
+
+	aid, err := bookUser.SaveBookAddress(ctx, bookAddress)
+	if err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if err := bookUser.DeleteAddress(ctx, aid); err != nil {
+		t.Fatalf(`err = %v, want nil`, err)
+	}
+
+	if _, err := bookUser.FindAddress(ctx, aid); fmt.Sprintf("%s", err) != "oops the data is not found" {
+		t.Fatalf(`err = %v, want oops the data is not found`, err)
+	}
+}
@@ -113,6 +113,12 @@ func (u User) Delete(ctx context.Context) error {
 		return errors.New("something went wrong")
 	}
 
+	aids, err := db.Redis.ZRange(ctx, fmt.Sprintf("user:%d:addresses", u.ID), 0, -1).Result()
+	if err != nil {
+		l.LogAttrs(ctx, slog.LevelError, "cannot retrieve the address id list", slog.String("error", err.Error()))
+		return errors.New("something went wrong")
+	}
+
 	key := fmt.Sprintf("user:%d", u.ID)
 	if _, err := db.Redis.TxPipelined(ctx, func(rdb redis.Pipeliner) error {
 		rdb.Del(ctx, key)
@@ -121,6 +127,12 @@ func (u User) Delete(ctx context.Context) error {
 			rdb.Del(ctx, "session:"+s.ID)
 		}
 
+		for _, aid := range aids {
+			rdb.Del(ctx, u.bookKey(aid))
+		}
+
+		rdb.Del(ctx, fmt.Sprintf("user:%d:addresses", u.ID))
+
 		return nil
 	}); err != nil {
 		l.LogAttrs(ctx, slog.LevelError, "cannot store the data", slog.String("error", err.Error()))
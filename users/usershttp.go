@@ -150,23 +150,85 @@ func AccountHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func AddressesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	lang := ctx.Value(contexts.Locale).(language.Tag)
+	user := ctx.Value(contexts.User).(User)
+
+	book, err := user.Addresses(ctx)
+	if err != nil {
+		httperrors.Catch(w, ctx, err.Error(), 500)
+		return
+	}
+
+	data := struct {
+		Lang      language.Tag
+		Shop      shops.Settings
+		Tags      []tree.Leaf
+		Addresses []BookAddress
+	}{
+		lang,
+		shops.Data,
+		tree.Tree,
+		book,
+	}
+
+	if err := templates.Pages["address-book"].Execute(w, &data); err != nil {
+		slog.Error("cannot render the template", slog.String("error", err.Error()))
+	}
+}
+
 func AddressFormHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	lang := ctx.Value(contexts.Locale).(language.Tag)
 	user := ctx.Value(contexts.User).(User)
 
+	a := BookAddress{}
+	url := "/account/address/add"
+
+	if id := r.PathValue("id"); id != "" {
+		var err error
+		a, err = user.FindAddress(ctx, id)
+		if err != nil {
+			httperrors.Catch(w, ctx, err.Error(), 404)
+			return
+		}
+
+		url = "/account/address/" + id + "/edit"
+	}
+
 	data := struct {
 		Lang    language.Tag
 		Shop    shops.Settings
 		Tags    []tree.Leaf
 		Address addresses.Address
 		URL     string
+		Guest   bool
+		Email   string
+
+		// The shipping address is only asked for the checkout
+		Checkout bool
+		Shipping addresses.Address
+		Same     bool
+
+		// The address book fields
+		Book  bool
+		Entry BookAddress
+		Saved []BookAddress
 	}{
 		lang,
 		shops.Data,
 		tree.Tree,
-		user.Address,
-		"/account/address",
+		a.Address,
+		url,
+		false,
+		user.Email,
+		false,
+		addresses.Address{},
+		false,
+		true,
+		a,
+		nil,
 	}
 
 	if err := templates.Pages["address"].Execute(w, &data); err != nil {
@@ -176,7 +238,6 @@ func AddressFormHandler(w http.ResponseWriter, r *http.Request) {
 
 func AddressHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	lang := ctx.Value(contexts.Locale).(language.Tag)
 	user := ctx.Value(contexts.User).(User)
 
 	if err := r.ParseForm(); err != nil {
@@ -185,35 +246,30 @@ func AddressHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	a := addresses.Address{
-		Firstname:     r.FormValue("firstname"),
-		Lastname:      r.FormValue("lastname"),
-		Street:        r.FormValue("street"),
-		Complementary: r.FormValue("complementary"),
-		City:          r.FormValue("city"),
-		Zipcode:       r.FormValue("zipcode"),
-		Phone:         r.FormValue("phone"),
+	a := BookAddress{
+		ID:       r.PathValue("id"),
+		Name:     r.FormValue("name"),
+		Address:  addresses.FromForm(r, ""),
+		Billing:  r.FormValue("billing") == "on",
+		Shipping: r.FormValue("shipping") == "on",
 	}
 
-	if err := a.Validate(ctx); err != nil {
+	if _, err := user.SaveBookAddress(ctx, a); err != nil {
 		httperrors.HXCatch(w, ctx, err.Error())
 		return
 	}
 
-	if err := user.SaveAddress(ctx, a); err != nil {
+	w.Header().Set("HX-Redirect", "/account/address")
+}
+
+func AddressDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := ctx.Value(contexts.User).(User)
+
+	if err := user.DeleteAddress(ctx, r.PathValue("id")); err != nil {
 		httperrors.HXCatch(w, ctx, err.Error())
 		return
 	}
 
-	data := struct {
-		Lang           language.Tag
-		SuccessMessage string
-	}{
-		lang,
-		"The address has been saved successfully.",
-	}
-
-	if err := templates.Pages["hx-success"].Execute(w, &data); err != nil {
-		slog.Error("cannot render the template", slog.String("error", err.Error()))
-	}
+	w.Header().Set("HX-Redirect", "/account/address")
 }
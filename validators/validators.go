@@ -2,17 +2,81 @@ package validators
 
 import (
 	"regexp"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 )
 
 var V = validator.New()
 
+// Zipcodes are the zipcode formats per country code
+var Zipcodes = map[string]*regexp.Regexp{
+	"FR": regexp.MustCompile(`^\d{5}$`),
+	"BE": regexp.MustCompile(`^\d{4}$`),
+	"CH": regexp.MustCompile(`^\d{4}$`),
+	"DE": regexp.MustCompile(`^\d{5}$`),
+}
+
+// Phones are the phone formats per country code,
+// with the international prefix or the national 0.
+// The spaces, dots, dashes and parentheses are ignored.
+var Phones = map[string]*regexp.Regexp{
+	"FR": regexp.MustCompile(`^(\+33|0033|0)[1-9]\d{8}$`),
+	"BE": regexp.MustCompile(`^(\+32|0032|0)[1-9]\d{7,8}$`),
+	"CH": regexp.MustCompile(`^(\+41|0041|0)[1-9]\d{8}$`),
+	"DE": regexp.MustCompile(`^(\+49|0049|0)[1-9]\d{5,12}$`),
+}
+
+var phoneSeparators = strings.NewReplacer(" ", "", ".", "", "-", "", "(", "", ")", "")
+
 func init() {
 	V.RegisterValidation("title", title)
+	V.RegisterValidation("country", country)
+	V.RegisterValidation("zipcode", zipcode)
+	V.RegisterValidation("phone", phone)
 }
 
 // title validates a title product by allowing only necessary chars.
 func title(fl validator.FieldLevel) bool {
 	return regexp.MustCompile(`^[a-zA-Z0-9()\- ]+$`).MatchString(fl.Field().String())
 }
+
+// country validates a country code having
+// zipcode and phone rules.
+func country(fl validator.FieldLevel) bool {
+	_, ok := Zipcodes[fl.Field().String()]
+	return ok
+}
+
+// countryParam returns the country code of the
+// field named by the param, like zipcode=Country.
+func countryParam(fl validator.FieldLevel) string {
+	f := fl.Parent().FieldByName(fl.Param())
+	if !f.IsValid() {
+		return ""
+	}
+
+	return f.String()
+}
+
+// zipcode validates a zipcode for the country
+// of the field named by the param.
+func zipcode(fl validator.FieldLevel) bool {
+	re, ok := Zipcodes[countryParam(fl)]
+	if !ok {
+		return false
+	}
+
+	return re.MatchString(strings.TrimSpace(fl.Field().String()))
+}
+
+// phone validates a phone number for the country
+// of the field named by the param.
+func phone(fl validator.FieldLevel) bool {
+	re, ok := Phones[countryParam(fl)]
+	if !ok {
+		return false
+	}
+
+	return re.MatchString(phoneSeparators.Replace(fl.Field().String()))
+}
@@ -28,3 +28,36 @@ func TestValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestAddress(t *testing.T) {
+	type address struct {
+		Country string `validate:"country"`
+		Zipcode string `validate:"zipcode=Country"`
+		Phone   string `validate:"phone=Country"`
+	}
+
+	var tests = []struct {
+		name    string
+		address address
+		valid   bool
+	}{
+		{"country=FR", address{"FR", "59000", "06 12 43 21 22"}, true},
+		{"country=FR,phone=+33", address{"FR", "59000", "+33612432122"}, true},
+		{"country=BE", address{"BE", "1000", "+32 2 123 45 67"}, true},
+		{"country=CH", address{"CH", "1201", "022 123 45 67"}, true},
+		{"country=DE", address{"DE", "10115", "030 1234567"}, true},
+		{"country=US", address{"US", "10115", "030 1234567"}, false},
+		{"country=FR,zipcode=1000", address{"FR", "1000", "0612432122"}, false},
+		{"country=BE,zipcode=59000", address{"BE", "59000", "+3221234567"}, false},
+		{"country=FR,phone=6012432122", address{"FR", "59000", "6012432122"}, false},
+		{"country=CH,phone=+33612432122", address{"CH", "1201", "+33612432122"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := V.Struct(tt.address); (err == nil) != tt.valid {
+				t.Fatalf(`err = %v, want valid %v`, err, tt.valid)
+			}
+		})
+	}
+}
@@ -33,3 +33,34 @@ if (document.getElementsByClassName("tags").length > 0) {
 
 }
 
+
+document.querySelectorAll(".images-sortable").forEach((list) => {
+	var dragged = null;
+
+	list.addEventListener("dragstart", (e) => {
+		dragged = e.target.closest(".images-sortable-item");
+		dragged.classList.add("dragging");
+	});
+
+	list.addEventListener("dragend", () => {
+		dragged.classList.remove("dragging");
+		dragged = null;
+
+		// The first image becomes the primary one
+		list.querySelector(".images-sortable-item input[name=primary]").checked = true;
+	});
+
+	list.addEventListener("dragover", (e) => {
+		e.preventDefault();
+
+		var item = e.target.closest(".images-sortable-item");
+		if (!dragged || !item || item === dragged) {
+			return;
+		}
+
+		var rect = item.getBoundingClientRect();
+		var after = e.clientY > rect.top + rect.height / 2;
+
+		list.insertBefore(dragged, after ? item.nextSibling : item);
+	});
+});
@@ -10,6 +10,7 @@ let pageviewsData = [];
 let bounceRatesData = [];
 let ordersData = [];
 let ordersCountsData = [];
+let ordersTaxesData = [];
 let schart;
 let ochart;
 let visitsChartIndex = 1;
@@ -52,6 +53,7 @@ function reload() {
 	bounceRatesData = JSON.parse(findById("bounce-rates").innerText);
 	ordersData = JSON.parse(findById("orders").innerText);
 	ordersCountsData = JSON.parse(findById("orders-counts").innerText);
+	ordersTaxesData = JSON.parse(findById("orders-taxes").innerText);
 	days = parseInt(document.getElementById("days").value, 10);
 	labels = [];
 	now = new Date();
@@ -99,6 +101,11 @@ function reload() {
 			createOrdersChart(ordersCountsData, labels);
 			break;
 		}
+		case 3: {
+			toggleSelectedClass("orders-taxes-anchor", "stats-orders");
+			createOrdersChart(ordersTaxesData, labels);
+			break;
+		}
 	}
 
 	registerEvents();
@@ -192,4 +199,16 @@ function registerEvents() {
 
 		ordersChartIndex = 2;
 	};
+
+	const ordersTaxes = document.getElementById("orders-taxes-anchor");
+
+	ordersTaxes.onclick = function (e) {
+		e.preventDefault();
+
+		toggleSelectedClass("orders-taxes-anchor", "stats-orders");
+
+		ochart.update({ series: [ordersTaxesData], labels });
+
+		ordersChartIndex = 3;
+	};
 }